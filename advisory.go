@@ -0,0 +1,139 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Key of a Postgres advisory lock. Either a single 64-bit key or a pair of
+// 32-bit keys. Both key spaces do not overlap.
+type AdvisoryLockKey struct {
+	key    int64
+	k1, k2 int32
+	pair   bool
+}
+
+// Advisory lock key from a single 64-bit integer
+func LockKey(key int64) AdvisoryLockKey {
+	return AdvisoryLockKey{key: key}
+}
+
+// Advisory lock key from a pair of 32-bit integers
+func LockKeyPair(k1, k2 int32) AdvisoryLockKey {
+	return AdvisoryLockKey{k1: k1, k2: k2, pair: true}
+}
+
+// Advisory lock key from the 64-bit FNV-1a hash of a string. Useful for
+// locking named resources.
+func LockKeyString(s string) AdvisoryLockKey {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return LockKey(int64(h.Sum64()))
+}
+
+func (k AdvisoryLockKey) String() string {
+	if k.pair {
+		return fmt.Sprintf("(%d,%d)", k.k1, k.k2)
+	}
+	return fmt.Sprint(k.key)
+}
+
+// Build call of advisory lock function fn with the key as arguments
+func (k AdvisoryLockKey) query(fn string) (sql string, args []interface{}) {
+	if k.pair {
+		return fmt.Sprintf("SELECT %s($1,$2)", fn), []interface{}{k.k1, k.k2}
+	}
+	return fmt.Sprintf("SELECT %s($1)", fn), []interface{}{k.key}
+}
+
+// Execute advisory lock function fn with the key and scan its boolean
+// result, if any
+func (k AdvisoryLockKey) call(
+	ctx context.Context,
+	q Querier,
+	fn string,
+	res *bool,
+) error {
+	sql, args := k.query(fn)
+	if res == nil {
+		_, err := q.Exec(ctx, sql, args...)
+		return err
+	}
+	return q.QueryRow(ctx, sql, args...).Scan(res)
+}
+
+// Acquire a session-level advisory lock, run fn and release the lock.
+// Blocks until the lock is acquired or ctx is done.
+//
+// conn must be a single connection, like *pgx.Conn or *pgxpool.Conn, and not
+// a pool, as the lock is bound to the connection it was acquired on.
+func WithAdvisoryLock(
+	ctx context.Context,
+	conn Querier,
+	key AdvisoryLockKey,
+	fn func() error,
+) (err error) {
+	err = key.call(ctx, conn, "pg_advisory_lock", nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		// Release the lock even, if ctx was cancelled
+		unlockErr := AdvisoryUnlock(context.Background(), conn, key)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+	return fn()
+}
+
+// Try to acquire a session-level advisory lock without blocking. Returns,
+// if the lock was acquired. The lock must be released with AdvisoryUnlock on
+// the same connection.
+func TryAdvisoryLock(
+	ctx context.Context,
+	conn Querier,
+	key AdvisoryLockKey,
+) (acquired bool, err error) {
+	err = key.call(ctx, conn, "pg_try_advisory_lock", &acquired)
+	return
+}
+
+// Release a session-level advisory lock acquired on the same connection
+func AdvisoryUnlock(
+	ctx context.Context,
+	conn Querier,
+	key AdvisoryLockKey,
+) (err error) {
+	var released bool
+	err = key.call(ctx, conn, "pg_advisory_unlock", &released)
+	if err == nil && !released {
+		err = fmt.Errorf("pg_util: advisory lock %s was not held", key)
+	}
+	return
+}
+
+// Acquire a transaction-level advisory lock, that is released automatically
+// at the end of the transaction. Blocks until the lock is acquired or ctx is
+// done.
+func AdvisoryXactLock(
+	ctx context.Context,
+	tx pgx.Tx,
+	key AdvisoryLockKey,
+) error {
+	return key.call(ctx, tx, "pg_advisory_xact_lock", nil)
+}
+
+// Try to acquire a transaction-level advisory lock without blocking.
+// Returns, if the lock was acquired.
+func TryAdvisoryXactLock(
+	ctx context.Context,
+	tx pgx.Tx,
+	key AdvisoryLockKey,
+) (acquired bool, err error) {
+	err = key.call(ctx, tx, "pg_try_advisory_xact_lock", &acquired)
+	return
+}
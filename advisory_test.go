@@ -0,0 +1,105 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestAdvisoryLockKey(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, sql, str string
+		key            AdvisoryLockKey
+		args           []interface{}
+	}{
+		{
+			name: "single",
+			key:  LockKey(1),
+			sql:  "SELECT pg_advisory_lock($1)",
+			str:  "1",
+			args: []interface{}{int64(1)},
+		},
+		{
+			name: "pair",
+			key:  LockKeyPair(1, 2),
+			sql:  "SELECT pg_advisory_lock($1,$2)",
+			str:  "(1,2)",
+			args: []interface{}{int32(1), int32(2)},
+		},
+		{
+			name: "string",
+			key:  LockKeyString("a"),
+			sql:  "SELECT pg_advisory_lock($1)",
+			str:  "-5808556873153909620",
+			args: []interface{}{int64(-5808556873153909620)},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, args := c.key.query("pg_advisory_lock")
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v`", args)
+			}
+			if s := c.key.String(); s != c.str {
+				t.Fatalf("string mismatch: %s != %s", s, c.str)
+			}
+		})
+	}
+}
+
+func TestAdvisoryLocks(t *testing.T) {
+	t.Parallel()
+
+	u := getURL(t)
+	conn, err := pgx.Connect(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	other, err := pgx.Connect(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close(context.Background())
+
+	key := LockKeyPair(11, 39)
+	err = WithAdvisoryLock(context.Background(), conn, key, func() error {
+		acquired, err := TryAdvisoryLock(context.Background(), other, key)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			t.Fatal("lock acquired twice")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = InTransaction(context.Background(), other, func(tx pgx.Tx) error {
+		acquired, err := TryAdvisoryXactLock(context.Background(), tx, key)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			t.Fatal("lock not released")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,224 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// Table audit triggers write changes to
+	AuditTable = "pg_util_audit"
+
+	// Configuration parameter identifying the actor of changes, unless
+	// overridden by AuditTriggerOpts.ActorSetting. Set it with WithRLSContext
+	// or SetLocal.
+	DefaultAuditActorSetting = "app.current_user_id"
+
+	// Name of audit triggers and their trigger function
+	auditTrigger = "pg_util_audit"
+)
+
+// Create the audit table and the trigger function used by audit triggers, if
+// they do not exist yet. Run before InstallAuditTrigger.
+func CreateAuditTable(ctx context.Context, q Querier) (err error) {
+	table := quoteIdentifier(AuditTable)
+	_, err = q.Exec(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS `+table+` (
+			id bigserial PRIMARY KEY,
+			table_name text NOT NULL,
+			operation text NOT NULL,
+			row_key text,
+			old_row jsonb,
+			new_row jsonb,
+			actor text,
+			changed_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS `+quoteName(AuditTable+"_row_idx")+`
+			ON `+table+` (table_name, row_key, id);
+		CREATE OR REPLACE FUNCTION `+quoteName(auditTrigger)+`()
+		RETURNS trigger
+		LANGUAGE plpgsql
+		AS $$
+		DECLARE
+			old_row jsonb;
+			new_row jsonb;
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN
+				old_row := to_jsonb(OLD);
+			END IF;
+			IF TG_OP <> 'DELETE' THEN
+				new_row := to_jsonb(NEW);
+			END IF;
+			IF TG_OP = 'UPDATE' AND old_row = new_row THEN
+				RETURN NULL;
+			END IF;
+			INSERT INTO `+table+` (
+				table_name, operation, row_key, old_row, new_row, actor
+			)
+			VALUES (
+				TG_TABLE_NAME,
+				TG_OP,
+				coalesce(new_row, old_row) ->> TG_ARGV[0],
+				old_row,
+				new_row,
+				nullif(current_setting(TG_ARGV[1], true), '')
+			);
+			RETURN NULL;
+		END
+		$$`,
+	)
+	return
+}
+
+// Options for building and installing an audit trigger
+type AuditTriggerOpts struct {
+	// Table to audit. Required.
+	Table string
+
+	// Column identifying rows in the audit history. Defaults to "id".
+	KeyColumn string
+
+	// Configuration parameter identifying the actor of changes. Defaults to
+	// DefaultAuditActorSetting.
+	ActorSetting string
+}
+
+// Build statements replacing the audit trigger of o.Table. The trigger
+// records the old and new row as JSON, the row key, the actor and the time
+// of every INSERT, UPDATE and DELETE in AuditTable. Updates, that do not
+// change the row, are skipped.
+func BuildAuditTrigger(o AuditTriggerOpts) (sql string, err error) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildAuditTrigger", start, sql, 0, false)
+	}()
+
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	if o.KeyColumn == "" {
+		o.KeyColumn = "id"
+	}
+	if o.ActorSetting == "" {
+		o.ActorSetting = DefaultAuditActorSetting
+	}
+
+	var w strings.Builder
+	w.WriteString("DROP TRIGGER IF EXISTS ")
+	w.WriteString(quoteName(auditTrigger))
+	w.WriteString(" ON ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(";\nCREATE TRIGGER ")
+	w.WriteString(quoteName(auditTrigger))
+	w.WriteString("\nAFTER INSERT OR UPDATE OR DELETE ON ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString("\nFOR EACH ROW EXECUTE PROCEDURE ")
+	w.WriteString(quoteName(auditTrigger))
+	w.WriteByte('(')
+	writeQuotedString(&w, o.KeyColumn)
+	w.WriteString(", ")
+	writeQuotedString(&w, o.ActorSetting)
+	w.WriteByte(')')
+	sql = w.String()
+	return
+}
+
+// Build and install the audit trigger of o.Table.
+// Requires CreateAuditTable.
+//
+// See BuildAuditTrigger for further documentation.
+func InstallAuditTrigger(
+	ctx context.Context,
+	q Querier,
+	o AuditTriggerOpts,
+) (err error) {
+	sql, err := BuildAuditTrigger(o)
+	if err != nil {
+		return
+	}
+	_, err = q.Exec(ctx, sql)
+	return
+}
+
+// Remove the audit trigger of table. Its existing audit history is kept.
+func RemoveAuditTrigger(ctx context.Context, q Querier, table string) (
+	err error,
+) {
+	_, err = q.Exec(
+		ctx,
+		"DROP TRIGGER IF EXISTS "+quoteName(auditTrigger)+
+			" ON "+quoteIdentifier(table),
+	)
+	return
+}
+
+// Change recorded by an audit trigger
+type AuditEntry struct {
+	ID int64 `json:"id"`
+
+	// Audited table
+	Table string `json:"table"`
+
+	// INSERT, UPDATE or DELETE
+	Operation string `json:"operation"`
+
+	// Value of the key column of the row
+	Key string `json:"key"`
+
+	// Row before and after the change. Old is nil for inserts and New for
+	// deletes.
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+
+	// Value of the actor setting at the time of the change, if set
+	Actor string `json:"actor,omitempty"`
+
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Return the audit history of the row of table with key, oldest change
+// first
+func AuditHistory(ctx context.Context, q Querier, table, key string) (
+	entries []AuditEntry,
+	err error,
+) {
+	err = QueryEach(
+		ctx,
+		q,
+		`SELECT id, table_name, operation, row_key, old_row, new_row,
+			coalesce(actor, ''), changed_at
+		FROM `+quoteIdentifier(AuditTable)+`
+		WHERE table_name = $1 AND row_key = $2
+		ORDER BY id`,
+		[]interface{}{table, key},
+		func(row pgx.Row) (err error) {
+			var (
+				e              AuditEntry
+				oldRow, newRow []byte
+			)
+			err = row.Scan(
+				&e.ID,
+				&e.Table,
+				&e.Operation,
+				&e.Key,
+				&oldRow,
+				&newRow,
+				&e.Actor,
+				&e.ChangedAt,
+			)
+			if err != nil {
+				return
+			}
+			e.Old, e.New = oldRow, newRow
+			entries = append(entries, e)
+			return
+		},
+	)
+	return
+}
@@ -0,0 +1,146 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestBuildAuditTrigger(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		opts AuditTriggerOpts
+		sql  string
+		err  error
+	}{
+		{
+			name: "defaults",
+			opts: AuditTriggerOpts{Table: "users"},
+			sql: `DROP TRIGGER IF EXISTS "pg_util_audit" ON "users";
+CREATE TRIGGER "pg_util_audit"
+AFTER INSERT OR UPDATE OR DELETE ON "users"
+FOR EACH ROW EXECUTE PROCEDURE "pg_util_audit"('id', 'app.current_user_id')`,
+		},
+		{
+			name: "custom",
+			opts: AuditTriggerOpts{
+				Table:        "posts",
+				KeyColumn:    "post_id",
+				ActorSetting: "app.actor",
+			},
+			sql: `DROP TRIGGER IF EXISTS "pg_util_audit" ON "posts";
+CREATE TRIGGER "pg_util_audit"
+AFTER INSERT OR UPDATE OR DELETE ON "posts"
+FOR EACH ROW EXECUTE PROCEDURE "pg_util_audit"('post_id', 'app.actor')`,
+		},
+		{
+			name: "no table",
+			err:  ErrNoTable,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, err := BuildAuditTrigger(c.opts)
+			if err != c.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sql != c.sql {
+				t.Fatalf("unexpected sql:\n%s", sql)
+			}
+		})
+	}
+}
+
+func TestAuditTrigger(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		err = CreateAuditTable(ctx, tx)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(
+			ctx,
+			`create temp table audit_test (
+				id int primary key,
+				name text not null
+			) on commit drop`,
+		)
+		if err != nil {
+			return
+		}
+		err = InstallAuditTrigger(ctx, tx, AuditTriggerOpts{
+			Table: "audit_test",
+		})
+		if err != nil {
+			return
+		}
+
+		err = WithRLSContext(
+			ctx,
+			tx,
+			map[string]string{DefaultAuditActorSetting: "alice"},
+			func(tx pgx.Tx) error {
+				return ExecAll(
+					ctx,
+					tx,
+					`insert into audit_test values (1, 'a')`,
+					`update audit_test set name = 'a'`,
+					`update audit_test set name = 'b'`,
+					`delete from audit_test`,
+				)
+			},
+		)
+		if err != nil {
+			return
+		}
+
+		entries, err := AuditHistory(ctx, tx, "audit_test", "1")
+		if err != nil {
+			return
+		}
+		ops := make([]string, len(entries))
+		for i, e := range entries {
+			ops[i] = e.Operation
+			if e.Actor != "alice" {
+				t.Fatalf("unexpected actor: %s", e.Actor)
+			}
+		}
+		if len(ops) != 3 ||
+			ops[0] != "INSERT" || ops[1] != "UPDATE" || ops[2] != "DELETE" {
+			t.Fatalf("unexpected operations: %v", ops)
+		}
+		if entries[0].Old != nil || entries[2].New != nil {
+			t.Fatal("unexpected row images")
+		}
+		var row struct {
+			Name string `json:"name"`
+		}
+		err = json.Unmarshal(entries[1].New, &row)
+		if err != nil {
+			return
+		}
+		if row.Name != "b" {
+			t.Fatalf("unexpected new row: %s", entries[1].New)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
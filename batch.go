@@ -0,0 +1,117 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Queue one insert statement per element of rows into batch.
+// rows must be a slice of structs or pointers to structs.
+//
+// opts.Data is ignored. BeforeInsert hooks operate on copies of the slice
+// elements. See InsertOpts for further documentation.
+func QueueInserts(batch *pgx.Batch, opts InsertOpts, rows interface{}) (
+	err error,
+) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("pg_util: rows must be a slice, got %T", rows)
+	}
+
+	t := v.Type().Elem()
+	deref := t.Kind() == reflect.Ptr
+	if deref {
+		t = t.Elem()
+	}
+	meta, err := getStructMeta(t)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		if deref {
+			if row.IsNil() {
+				return fmt.Errorf("pg_util: nil row at index %d", i)
+			}
+			row = row.Elem()
+		}
+		sql, args, err := buildInsert("QueueInserts", &opts, row, meta)
+		if err != nil {
+			return err
+		}
+		batch.Queue(sql, args...)
+	}
+	return
+}
+
+// Anything, that can send a batch of queries, like *pgx.Conn, *pgxpool.Pool
+// or pgx.Tx
+type BatchSender interface {
+	SendBatch(context.Context, *pgx.Batch) pgx.BatchResults
+}
+
+// Result of a single query sent by BatchGet
+type BatchItem[T any] struct {
+	// Scanned row
+	Row T
+
+	// Error of the query, if any. ErrNoRows, if it produced no rows.
+	Err error
+}
+
+// Run query sql once for each element of args in a single batch and scan the
+// first row of each result into the corresponding item. Saves network round
+// trips for chatty read patterns.
+//
+// Elements of args must be structs or pointers to structs. Their fields are
+// passed as arguments $1, $2, ... in the order ExtractArgs returns them.
+// Result columns are mapped to fields of T using the rules of SelectStructs.
+//
+// Errors of individual queries are returned in the items. A failed query
+// aborts the implicit transaction of the batch, so all following queries
+// fail as well. A non-nil error is only returned, if the batch could not be
+// built.
+func BatchGet[A, T any](
+	ctx context.Context,
+	q BatchSender,
+	sql string,
+	args []A,
+) (items []BatchItem[T], err error) {
+	meta, err := getStructMeta(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return
+	}
+
+	var batch pgx.Batch
+	for i := range args {
+		var a []interface{}
+		a, err = ExtractArgs(args[i])
+		if err != nil {
+			return nil, fmt.Errorf("pg_util: args at index %d: %w", i, err)
+		}
+		batch.Queue(sql, a...)
+	}
+	if len(args) == 0 {
+		return
+	}
+
+	// Errors are reported per item, so the error of Close is redundant
+	res := q.SendBatch(ctx, &batch)
+	defer res.Close()
+
+	items = make([]BatchItem[T], len(args))
+	for i := range items {
+		it := &items[i]
+		var rows pgx.Rows
+		rows, it.Err = res.Query()
+		if it.Err != nil {
+			continue
+		}
+		it.Err = scanFirstRow(rows, meta, reflect.ValueOf(&it.Row).Elem())
+	}
+	return
+}
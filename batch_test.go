@@ -0,0 +1,136 @@
+package pg_util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestQueueInserts(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		F1 string
+		F2 int
+	}
+
+	cases := [...]struct {
+		name string
+		rows interface{}
+		n    int
+		err  bool
+	}{
+		{
+			name: "structs",
+			rows: []row{{"a", 1}, {"b", 2}},
+			n:    2,
+		},
+		{
+			name: "pointers",
+			rows: []*row{{"a", 1}, {"b", 2}, {"c", 3}},
+			n:    3,
+		},
+		{
+			name: "nil pointer",
+			rows: []*row{nil},
+			err:  true,
+		},
+		{
+			name: "not a slice",
+			rows: row{"a", 1},
+			err:  true,
+		},
+		{
+			name: "not a struct slice",
+			rows: []int{1},
+			err:  true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var b pgx.Batch
+			err := QueueInserts(&b, InsertOpts{Table: "t1"}, c.rows)
+			if c.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Len() != c.n {
+				t.Fatalf("queued statement count mismatch: %d != %d", b.Len(), c.n)
+			}
+		})
+	}
+}
+
+func TestQueueInsertsBeforeInsertCopy(t *testing.T) {
+	t.Parallel()
+
+	rows := []beforeInsertRow{{"a", 1}}
+	ptrs := []*beforeInsertRow{{"b", 2}}
+	var b pgx.Batch
+	err := QueueInserts(&b, InsertOpts{Table: "t1"}, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = QueueInserts(&b, InsertOpts{Table: "t1"}, ptrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].F1 != "a" || ptrs[0].F1 != "b" {
+		t.Fatalf("caller's rows modified: %+v %+v", rows[0], *ptrs[0])
+	}
+}
+
+func TestBatchGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	type args struct {
+		ID int
+	}
+	type row struct {
+		ID     int
+		Square int
+	}
+
+	items, err := BatchGet[args, row](
+		ctx,
+		conn,
+		`select id, id * id as square
+		from generate_series(1, 3) id
+		where id = $1`,
+		[]args{{1}, {5}, {3}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	std := []BatchItem[row]{
+		{Row: row{1, 1}},
+		{Err: ErrNoRows},
+		{Row: row{3, 9}},
+	}
+	if len(items) != len(std) {
+		t.Fatalf("item count mismatch: %d != %d", len(items), len(std))
+	}
+	for i := range std {
+		if items[i] != std[i] {
+			t.Fatalf("item %d mismatch: %+v != %+v", i, items[i], std[i])
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Options for updating many rows with a single UPDATE ... FROM unnest(...)
+// statement
+type BulkUpdateOpts struct {
+	// Table to update. Required.
+	Table string
+
+	// Slice of structs or pointers to structs with the new row values.
+	// Required.
+	//
+	// See InsertOpts.Data for column mapping rules. Columns with an ",expr="
+	// tag option are set to the expression.
+	Rows interface{}
+
+	// Use the exact case of Go field names for columns not set through a tag.
+	// By default such names are converted to lowercase, matching Postgres case
+	// folding of unquoted identifiers.
+	QuoteAll bool
+
+	// Columns to match rows on. Defaults to the columns tagged with ",pk".
+	KeyColumns []string
+
+	// Columns to update. Defaults to all columns not in KeyColumns.
+	UpdateColumns []string
+
+	// Postgres types of columns by column name as in KeyColumns, used to cast
+	// the passed arrays. By default types are derived from the Go types of the fields.
+	// Required for types, that can not be derived. Example:
+	// map[string]string{"ip": "inet"}
+	ColumnTypes map[string]string
+
+	// Optional suffix to statement
+	Suffix string
+}
+
+// Build UPDATE statement updating all rows of o.Rows with a single array
+// argument per column:
+//
+//	UPDATE t SET ... FROM unnest($1::bigint[],$2::text[]) AS u(...)
+//	WHERE t.id = u.id
+//
+// See BulkUpdateOpts for further documentation.
+func BuildBulkUpdate(o BulkUpdateOpts) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildBulkUpdate", start, sql, len(args), false)
+	}()
+
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	rows, meta, err := structSliceMeta(o.Rows)
+	if err != nil {
+		return
+	}
+	keys, update, err := resolveUpsertColumns(
+		meta,
+		o.KeyColumns,
+		o.UpdateColumns,
+		o.QuoteAll,
+	)
+	if err != nil {
+		return
+	}
+	if len(update) == 0 {
+		err = ErrNoColumns
+		return
+	}
+
+	byID := make(map[string]*columnMeta, len(meta.writable))
+	for _, c := range meta.writable {
+		byID[c.identifier(o.QuoteAll)] = c
+	}
+	column := func(id string) (*columnMeta, error) {
+		c, ok := byID[id]
+		if !ok {
+			return nil, &UnknownColumnError{id, meta.typ}
+		}
+		return c, nil
+	}
+
+	// Columns passed as arrays
+	var (
+		passed []string
+		unnest strings.Builder
+	)
+	pass := func(id string, c *columnMeta) error {
+		typ, err := arrayElemType(id, c, meta.typ, o.ColumnTypes)
+		if err != nil {
+			return err
+		}
+		arr, err := columnArray(c, meta.typ, rows)
+		if err != nil {
+			return err
+		}
+		args = append(args, arr)
+		if len(passed) != 0 {
+			unnest.WriteByte(',')
+		}
+		fmt.Fprintf(&unnest, "$%d::%s[]", len(args), typ)
+		passed = append(passed, id)
+		return nil
+	}
+	for _, id := range keys {
+		c, err := column(id)
+		if err != nil {
+			return "", nil, err
+		}
+		if c.expr != "" {
+			return "", nil, fmt.Errorf(
+				"pg_util: key column %s can not be an expression",
+				id,
+			)
+		}
+		err = pass(id, c)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	var w strings.Builder
+	table := quoteIdentifier(o.Table)
+	w.WriteString("UPDATE ")
+	w.WriteString(table)
+	w.WriteString(" SET ")
+	for i, id := range update {
+		c, err := column(id)
+		if err != nil {
+			return "", nil, err
+		}
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(quoteName(id))
+		w.WriteByte('=')
+		if c.expr != "" {
+			w.WriteString(c.expr)
+			continue
+		}
+		err = pass(id, c)
+		if err != nil {
+			return "", nil, err
+		}
+		w.WriteString("pg_util_u.")
+		w.WriteString(quoteName(id))
+	}
+	w.WriteString(" FROM unnest(")
+	w.WriteString(unnest.String())
+	w.WriteString(") AS pg_util_u(")
+	writeIdentifierList(&w, passed)
+	w.WriteString(") WHERE ")
+	for i, id := range keys {
+		if i != 0 {
+			w.WriteString(" AND ")
+		}
+		id = quoteName(id)
+		w.WriteString(table)
+		w.WriteByte('.')
+		w.WriteString(id)
+		w.WriteString("=pg_util_u.")
+		w.WriteString(id)
+	}
+	writeSuffix(&w, o.Suffix)
+
+	sql = w.String()
+	return
+}
+
+// Build and execute UPDATE statement updating all rows of o.Rows. Returns the
+// number of updated rows.
+//
+// See BulkUpdateOpts for further documentation.
+func BulkUpdate(ctx context.Context, q Querier, o BulkUpdateOpts) (
+	n int64,
+	err error,
+) {
+	sql, args, err := BuildBulkUpdate(o)
+	if err != nil {
+		return
+	}
+	tag, err := q.Exec(ctx, sql, args...)
+	if err != nil {
+		return
+	}
+	n = tag.RowsAffected()
+	return
+}
+
+// Return struct values and column metadata of a slice of structs or pointers
+// to structs
+func structSliceMeta(rows interface{}) (
+	values []reflect.Value,
+	meta *structMeta,
+	err error,
+) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		err = fmt.Errorf("pg_util: rows must be a slice, got %T", rows)
+		return
+	}
+	t := v.Type().Elem()
+	deref := t.Kind() == reflect.Ptr
+	if deref {
+		t = t.Elem()
+	}
+	meta, err = getStructMeta(t)
+	if err != nil {
+		return
+	}
+
+	values = make([]reflect.Value, v.Len())
+	for i := range values {
+		row := v.Index(i)
+		if deref {
+			if row.IsNil() {
+				err = fmt.Errorf("pg_util: nil row at index %d", i)
+				return
+			}
+			row = row.Elem()
+		}
+		values[i] = row
+	}
+	return
+}
+
+// Build typed slice of the values of column c of all rows. Zero values of
+// ",nullzero" columns and nil values are passed as NULL.
+func columnArray(c *columnMeta, typ reflect.Type, rows []reflect.Value) (
+	arr interface{},
+	err error,
+) {
+	var (
+		vals    = make([]interface{}, len(rows))
+		elem    reflect.Type
+		hasNull bool
+	)
+	for i, row := range rows {
+		vals[i], err = c.value(row)
+		if err != nil {
+			return
+		}
+		rv := reflect.ValueOf(vals[i])
+		switch {
+		case !rv.IsValid():
+			hasNull = true
+			continue
+		case rv.Kind() == reflect.Ptr:
+			if rv.IsNil() {
+				hasNull = true
+			}
+			rv = reflect.New(rv.Type().Elem()).Elem()
+		}
+		switch {
+		case elem == nil:
+			elem = rv.Type()
+		case elem != rv.Type():
+			err = fmt.Errorf(
+				"pg_util: mixed value types for column %s: %s and %s",
+				c.name,
+				elem,
+				rv.Type(),
+			)
+			return
+		}
+	}
+	if elem == nil {
+		// All values are NULL
+		if c.toString {
+			elem = reflect.TypeOf("")
+		} else {
+			elem = typ.FieldByIndex(c.index).Type
+			for elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+		}
+		hasNull = true
+	}
+	if hasNull {
+		elem = reflect.PtrTo(elem)
+	}
+
+	s := reflect.MakeSlice(reflect.SliceOf(elem), len(vals), len(vals))
+	for i, val := range vals {
+		rv := reflect.ValueOf(val)
+		switch {
+		case !rv.IsValid() || rv.Kind() == reflect.Ptr && rv.IsNil():
+			continue
+		case hasNull && rv.Kind() != reflect.Ptr:
+			ptr := reflect.New(rv.Type())
+			ptr.Elem().Set(rv)
+			rv = ptr
+		case !hasNull && rv.Kind() == reflect.Ptr:
+			rv = rv.Elem()
+		}
+		s.Index(i).Set(rv)
+	}
+	return s.Interface(), nil
+}
+
+// Return Postgres type of column c with identifier id for casting arrays
+// passed to unnest
+func arrayElemType(
+	id string,
+	c *columnMeta,
+	typ reflect.Type,
+	types map[string]string,
+) (string, error) {
+	if t, ok := types[id]; ok {
+		return t, nil
+	}
+	if c.cast != "" {
+		return c.cast, nil
+	}
+	if c.toString {
+		return "text", nil
+	}
+
+	t := typ.FieldByIndex(c.index).Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return "timestamptz", nil
+	case reflect.TypeOf([]byte(nil)):
+		return "bytea", nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "smallint", nil
+	case reflect.Int32, reflect.Uint16:
+		return "integer", nil
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "bigint", nil
+	case reflect.Float32:
+		return "real", nil
+	case reflect.Float64:
+		return "double precision", nil
+	case reflect.String:
+		return "text", nil
+	}
+	return "", fmt.Errorf(
+		"pg_util: can not derive Postgres type of column %s from %s; "+
+			"set it in ColumnTypes",
+		c.name,
+		t,
+	)
+}
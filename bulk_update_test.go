@@ -0,0 +1,192 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type bulkUpdateRow struct {
+	ID        int64   `db:"id,pk"`
+	Name      string  `db:"name,nullzero"`
+	Score     float64 `db:"score"`
+	Label     int     `db:"label,string"`
+	UpdatedAt int     `db:"updated_at,expr=now()"`
+}
+
+func TestBuildBulkUpdate(t *testing.T) {
+	t.Parallel()
+
+	rows := []bulkUpdateRow{
+		{ID: 1, Name: "a", Score: 1.5, Label: 1},
+		{ID: 2, Score: 2, Label: 2},
+	}
+	a := "a"
+
+	cases := [...]struct {
+		name, sql string
+		opts      BulkUpdateOpts
+		args      []interface{}
+	}{
+		{
+			name: "defaults",
+			sql: `UPDATE "t13" SET "name"=pg_util_u."name",` +
+				`"score"=pg_util_u."score","label"=pg_util_u."label",` +
+				`"updated_at"=now() ` +
+				`FROM unnest($1::bigint[],$2::text[],` +
+				`$3::double precision[],$4::text[]) ` +
+				`AS pg_util_u("id","name","score","label") ` +
+				`WHERE "t13"."id"=pg_util_u."id"`,
+			args: []interface{}{
+				[]int64{1, 2},
+				[]*string{&a, nil},
+				[]float64{1.5, 2},
+				[]string{"1", "2"},
+			},
+		},
+		{
+			name: "custom columns",
+			opts: BulkUpdateOpts{
+				KeyColumns:    []string{"id", "label"},
+				UpdateColumns: []string{"score"},
+				ColumnTypes:   map[string]string{"score": "numeric"},
+				Suffix:        "RETURNING id",
+			},
+			sql: `UPDATE "t13" SET "score"=pg_util_u."score" ` +
+				`FROM unnest($1::bigint[],$2::text[],$3::numeric[]) ` +
+				`AS pg_util_u("id","label","score") ` +
+				`WHERE "t13"."id"=pg_util_u."id" ` +
+				`AND "t13"."label"=pg_util_u."label" RETURNING id`,
+			args: []interface{}{
+				[]int64{1, 2},
+				[]string{"1", "2"},
+				[]float64{1.5, 2},
+			},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			c.opts.Table = "t13"
+			c.opts.Rows = rows
+			sql, args, err := BuildBulkUpdate(c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args,
+					c.args)
+			}
+		})
+	}
+}
+
+func TestBuildBulkUpdateUnknownType(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := BuildBulkUpdate(BulkUpdateOpts{
+		Table: "t13",
+		Rows: []struct {
+			ID   int `db:"id,pk"`
+			Data struct{ A int }
+		}{{}},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBuildBulkUpdateUntaggedColumnType(t *testing.T) {
+	t.Parallel()
+
+	sql, _, err := BuildBulkUpdate(BulkUpdateOpts{
+		Table: "t13",
+		Rows: []struct {
+			ID    int `db:"id,pk"`
+			Score float64
+		}{{}},
+		ColumnTypes: map[string]string{"score": "numeric"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `UPDATE "t13" SET "score"=pg_util_u."score" ` +
+		`FROM unnest($1::bigint[],$2::numeric[]) ` +
+		`AS pg_util_u("id","score") ` +
+		`WHERE "t13"."id"=pg_util_u."id"`
+	if sql != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, std)
+	}
+}
+
+func TestBulkUpdate(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(
+				context.Background(),
+				`create temp table bulk_update_test (
+					id bigint primary key,
+					name text,
+					score double precision not null,
+					label text not null,
+					updated_at timestamptz
+				) on commit drop;
+				insert into bulk_update_test (id, score, label)
+				values (1, 0, ''), (2, 0, ''), (3, 0, '')`,
+			)
+			if err != nil {
+				return
+			}
+
+			n, err := BulkUpdate(context.Background(), tx, BulkUpdateOpts{
+				Table: "bulk_update_test",
+				Rows: []bulkUpdateRow{
+					{ID: 1, Name: "a", Score: 1.5, Label: 1},
+					{ID: 2, Score: 2, Label: 2},
+				},
+			})
+			if err != nil {
+				return
+			}
+			if n != 2 {
+				t.Fatalf("updated row count mismatch: %d != 2", n)
+			}
+
+			var label string
+			err = tx.
+				QueryRow(
+					context.Background(),
+					`select label from bulk_update_test where id = 2`,
+				).
+				Scan(&label)
+			if err != nil {
+				return
+			}
+			if label != "2" {
+				t.Fatalf("row not updated: %s", label)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// No foreign key column specified for child rows
+var ErrNoForeignKey = errors.New("pg_util: no foreign key column specified")
+
+// Options for inserting a parent row and child rows referencing it
+type InsertWithChildrenOpts struct {
+	// Options for inserting the parent row. Data must be a pointer to a
+	// struct, so columns tagged with ",generated" can be scanned back into it.
+	Parent InsertOpts
+
+	// Column of the parent row, whose value is propagated to the children.
+	// Defaults to the single column of the parent tagged with ",pk".
+	ParentKey string
+
+	// Options for inserting the child rows. Data is ignored. Defaults to
+	// Table set to ChildTable.
+	Child InsertOpts
+
+	// Table to insert child rows into. Shorthand for Child.Table.
+	ChildTable string
+
+	// Slice of structs or pointers to structs to insert as child rows.
+	// The foreign key column of each child is set in place.
+	Children interface{}
+
+	// Column of the child rows to set to the value of ParentKey. Required.
+	ForeignKey string
+}
+
+// Insert a parent row, propagate its key, like a generated id, into the
+// foreign key column of each child row and insert all child rows in a single
+// batch. All statements are executed inside a transaction.
+//
+// Parent.Data and Children are modified in place before the transaction is
+// committed, so they keep the generated and propagated keys even if it is
+// rolled back afterwards.
+//
+// Returns *InvalidTypeError, if Parent.Data is not a pointer to a struct.
+//
+// See InsertWithChildrenOpts and InsertOpts for further documentation.
+func InsertWithChildren(
+	ctx context.Context,
+	conn TxStarter,
+	o InsertWithChildrenOpts,
+) error {
+	if o.Child.Table == "" {
+		o.Child.Table = o.ChildTable
+	}
+	if o.Child.Table == "" {
+		return ErrNoTable
+	}
+	if o.ForeignKey == "" {
+		return ErrNoForeignKey
+	}
+	// Generated keys can only be scanned back into a pointer
+	if v := reflect.ValueOf(o.Parent.Data); v.Kind() != reflect.Ptr ||
+		v.IsNil() ||
+		v.Elem().Kind() != reflect.Struct {
+		return &InvalidTypeError{reflect.TypeOf(o.Parent.Data)}
+	}
+
+	return InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		err = Insert(ctx, tx, o.Parent)
+		if err != nil {
+			return
+		}
+		key, err := parentKey(o.Parent.Data, o.ParentKey)
+		if err != nil {
+			return
+		}
+		err = setForeignKeys(o.Children, o.ForeignKey, key)
+		if err != nil {
+			return
+		}
+
+		var batch pgx.Batch
+		err = QueueInserts(&batch, o.Child, o.Children)
+		if err != nil || batch.Len() == 0 {
+			return
+		}
+		res := tx.SendBatch(ctx, &batch)
+		for i := 0; i < batch.Len(); i++ {
+			_, err = res.Exec()
+			if err != nil {
+				res.Close()
+				return
+			}
+		}
+		return res.Close()
+	})
+}
+
+// Read value of parent key column from parent struct
+func parentKey(parent interface{}, column string) (
+	key reflect.Value,
+	err error,
+) {
+	v, meta, err := getDataMeta(parent)
+	if err != nil {
+		return
+	}
+
+	var c *columnMeta
+	if column != "" {
+		var ok bool
+		c, ok = meta.lookup(column)
+		if !ok {
+			err = &UnknownColumnError{column, meta.typ}
+			return
+		}
+	} else {
+		for i := range meta.columns {
+			if meta.columns[i].pk {
+				if c != nil {
+					err = errors.New(
+						"pg_util: ParentKey must be set for composite " +
+							"primary keys",
+					)
+					return
+				}
+				c = &meta.columns[i]
+			}
+		}
+		if c == nil {
+			err = ErrNoPrimaryKey
+			return
+		}
+	}
+	key = v.FieldByIndex(c.index)
+	return
+}
+
+// Set foreign key column of all child structs in slice children to key
+func setForeignKeys(children interface{}, column string, key reflect.Value) (
+	err error,
+) {
+	v := reflect.ValueOf(children)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("pg_util: children must be a slice, got %T",
+			children)
+	}
+	t := v.Type().Elem()
+	deref := t.Kind() == reflect.Ptr
+	if deref {
+		t = t.Elem()
+	}
+	meta, err := getStructMeta(t)
+	if err != nil {
+		return
+	}
+	c, ok := meta.lookup(column)
+	if !ok {
+		return &UnknownColumnError{column, meta.typ}
+	}
+	ft := t.FieldByIndex(c.index).Type
+	if !key.Type().AssignableTo(ft) &&
+		!(isInteger(key.Type()) && isInteger(ft)) {
+		return fmt.Errorf(
+			"pg_util: can not assign parent key of type %s to %s",
+			key.Type(),
+			ft,
+		)
+	}
+	key = key.Convert(ft)
+
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		if deref {
+			if row.IsNil() {
+				return fmt.Errorf("pg_util: nil row at index %d", i)
+			}
+			row = row.Elem()
+		}
+		row.FieldByIndex(c.index).Set(key)
+	}
+	return
+}
+
+// Returns, if t is an integer type
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
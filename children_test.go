@@ -0,0 +1,142 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestSetForeignKeys(t *testing.T) {
+	t.Parallel()
+
+	type child struct {
+		ParentID int32 `db:"parent_id"`
+		Name     string
+	}
+
+	children := []child{{Name: "a"}, {Name: "b"}}
+	err := setForeignKeys(children, "parent_id", reflect.ValueOf(int64(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range children {
+		if c.ParentID != 3 {
+			t.Fatalf("foreign key not set: %+v", c)
+		}
+	}
+
+	ptrs := []*child{{Name: "a"}}
+	err = setForeignKeys(ptrs, "parent_id", reflect.ValueOf(int64(4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ptrs[0].ParentID != 4 {
+		t.Fatalf("foreign key not set: %+v", ptrs[0])
+	}
+
+	err = setForeignKeys(children, "nope", reflect.ValueOf(1))
+	if _, ok := err.(*UnknownColumnError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = setForeignKeys(children, "Name", reflect.ValueOf(1))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestInsertWithChildrenInvalidParent(t *testing.T) {
+	t.Parallel()
+
+	type parent struct {
+		ID int64 `db:"id,pk,generated"`
+	}
+
+	var nilPtr *parent
+	for _, data := range [...]interface{}{nil, parent{}, nilPtr, new(int)} {
+		err := InsertWithChildren(
+			context.Background(),
+			nil,
+			InsertWithChildrenOpts{
+				Parent:     InsertOpts{Table: "parents", Data: data},
+				ChildTable: "children",
+				ForeignKey: "parent_id",
+			},
+		)
+		var tErr *InvalidTypeError
+		if !errors.As(err, &tErr) {
+			t.Fatalf("expected *InvalidTypeError for %T, got %v", data, err)
+		}
+	}
+}
+
+func TestInsertWithChildren(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(
+		context.Background(),
+		`create temp table insert_children_parent (
+			id bigint generated always as identity primary key,
+			name text not null
+		) on commit drop;
+		create temp table insert_children_child (
+			parent_id bigint not null
+				references insert_children_parent(id),
+			name text not null
+		) on commit drop`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type child struct {
+		ParentID int64 `db:"parent_id"`
+		Name     string
+	}
+	parent := struct {
+		ID   int64 `db:"id,pk,generated"`
+		Name string
+	}{Name: "parent"}
+	children := []child{{Name: "a"}, {Name: "b"}}
+	err = InsertWithChildren(context.Background(), tx, InsertWithChildrenOpts{
+		Parent: InsertOpts{
+			Table: "insert_children_parent",
+			Data:  &parent,
+		},
+		ChildTable: "insert_children_child",
+		Children:   children,
+		ForeignKey: "parent_id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	err = tx.QueryRow(
+		context.Background(),
+		`select count(*)
+		from insert_children_child
+		where parent_id = $1`,
+		parent.ID,
+	).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("child count mismatch: %d != 2", n)
+	}
+}
@@ -0,0 +1,557 @@
+// Command pg_util-gen generates reflection-free insert builders and scanners
+// for model structs. The generated code produces the same SQL as
+// pg_util.BuildInsert with default options and honors the same `db` struct
+// tags, so the runtime builders and generated code can be used side by side.
+//
+// Usage with go generate:
+//
+//	//go:generate go run github.com/bakape/pg_util/cmd/pg_util-gen -type User -table users
+//
+// For type User this generates user_pg.go in the current directory with:
+//
+//	// SQL and arguments for inserting u into the table
+//	func InsertUser(u User) (sql string, args []interface{}, err error)
+//
+//	// Comma-separated columns of User in the order expected by ScanUser
+//	const UserColumns = "..."
+//
+//	// Scan a row selecting UserColumns into u
+//	func ScanUser(row interface{ Scan(...interface{}) error }, u *User) error
+//
+// Fields tagged with ",string" or ",nullzero" of predeclared types and
+// time.Time are converted directly. Fields of other types are converted at
+// runtime with pg_util.ConvertArg. If User or any struct embedded in it
+// declares a BeforeInsert method in the same package, it is called on the
+// copy u before its fields are read, like pg_util.BuildInsert does for
+// implementations of pg_util.BeforeInserter.
+//
+// Registered encoders and type converters are not applied by generated code.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	var (
+		typeName = flag.String("type", "", "name of the struct type. Required.")
+		table    = flag.String("table", "", "table to insert into. Required.")
+		dir      = flag.String("dir", ".", "directory of the package")
+		output   = flag.String(
+			"output",
+			"",
+			"output file name. Defaults to <type>_pg.go in dir.",
+		)
+	)
+	flag.Parse()
+	if *typeName == "" || *table == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = filepath.Join(*dir, strings.ToLower(*typeName)+"_pg.go")
+	}
+
+	err := run(*dir, *typeName, *table, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pg_util-gen:", err)
+		os.Exit(1)
+	}
+}
+
+// Parse package in dir and write generated code for typeName to output
+func run(dir, typeName, table, output string) (err error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(
+		fset,
+		dir,
+		func(fi os.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go") &&
+				fi.Name() != filepath.Base(output)
+		},
+		0,
+	)
+	if err != nil {
+		return
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expected a single package in %s, got %d", dir,
+			len(pkgs))
+	}
+	var files []*ast.File
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			files = append(files, f)
+		}
+	}
+
+	src, err := generate(files, typeName, table)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(output, src, 0644)
+}
+
+// Column mapped to a struct field
+type column struct {
+	// Column name
+	name string
+
+	// Name was set explicitly through a tag and must be quoted
+	quote bool
+
+	// Selector path of the field from the root struct
+	path string
+
+	// Declared type of the field
+	typ ast.Expr
+
+	toString, nullZero, generated, readOnly bool
+
+	// Raw SQL expression to use instead of the field value
+	expr string
+
+	// Postgres type to cast the placeholder to
+	cast string
+}
+
+// Write column name to w, quoting it, if set through a tag
+func (c *column) writeName(w *bytes.Buffer) {
+	if c.quote {
+		w.WriteString(quoteName(c.name))
+	} else {
+		w.WriteString(c.name)
+	}
+}
+
+// Generate formatted source code of the builders for type typeName declared
+// in files
+func generate(files []*ast.File, typeName, table string) (
+	src []byte,
+	err error,
+) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to parse")
+	}
+	var (
+		structs = make(map[string]*ast.StructType)
+
+		// Types declaring a BeforeInsert method
+		hooks = make(map[string]bool)
+	)
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.TypeSpec:
+				if st, ok := n.Type.(*ast.StructType); ok {
+					structs[n.Name.Name] = st
+				}
+			case *ast.FuncDecl:
+				if n.Name.Name == "BeforeInsert" && n.Recv != nil &&
+					len(n.Recv.List) == 1 {
+					if name := localTypeName(n.Recv.List[0].Type); name != "" {
+						hooks[name] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	st, ok := structs[typeName]
+	if !ok {
+		return nil, fmt.Errorf("struct type %s not found", typeName)
+	}
+
+	var cols []column
+	err = scanStruct(structs, st, "u", make(map[string]struct{}), &cols)
+	if err != nil {
+		return
+	}
+
+	var (
+		insert, names, returning bytes.Buffer
+		args                     []string
+
+		// Statements converting arguments after the argument list is
+		// constructed
+		conversions bytes.Buffer
+
+		useConvert, useStrconv bool
+	)
+	insert.WriteString("INSERT INTO ")
+	for i, part := range strings.Split(table, ".") {
+		if i != 0 {
+			insert.WriteByte('.')
+		}
+		insert.WriteString(quoteName(part))
+	}
+	insert.WriteString(" (")
+	var values bytes.Buffer
+	for i := range cols {
+		c := &cols[i]
+		if names.Len() != 0 {
+			names.WriteByte(',')
+		}
+		c.writeName(&names)
+
+		switch {
+		case c.generated:
+			if returning.Len() == 0 {
+				returning.WriteString(" RETURNING ")
+			} else {
+				returning.WriteByte(',')
+			}
+			c.writeName(&returning)
+			continue
+		case c.readOnly:
+			continue
+		}
+
+		if values.Len() != 0 {
+			insert.WriteByte(',')
+			values.WriteByte(',')
+		}
+		c.writeName(&insert)
+		if c.expr != "" {
+			values.WriteString(c.expr)
+			continue
+		}
+		fmt.Fprintf(&values, "$%d", len(args)+1)
+		if c.cast != "" {
+			values.WriteString("::" + c.cast)
+		}
+		if !c.toString && !c.nullZero {
+			args = append(args, c.path)
+			continue
+		}
+
+		n := len(args)
+		arg := c.path
+		if c.toString {
+			arg = stringConversion(c.typ, c.path)
+		}
+		var zero string
+		if c.nullZero {
+			zero = zeroCheck(c.typ, c.path)
+		}
+		if arg == "" || c.nullZero && zero == "" {
+			useConvert = true
+			args = append(args, "nil")
+			fmt.Fprintf(
+				&conversions,
+				"args[%d], err = pg_util.ConvertArg(%s, %t, %t)\n"+
+					"if err != nil {\nreturn \"\", nil, err\n}\n",
+				n,
+				c.path,
+				c.toString,
+				c.nullZero,
+			)
+			continue
+		}
+
+		if strings.HasPrefix(arg, "strconv.") {
+			useStrconv = true
+		}
+		args = append(args, arg)
+		if c.nullZero {
+			null := "nil"
+			if c.toString {
+				null = "(*string)(nil)"
+			}
+			fmt.Fprintf(
+				&conversions,
+				"if %s {\nargs[%d] = %s\n}\n",
+				zero,
+				n,
+				null,
+			)
+		}
+	}
+	insert.WriteString(") VALUES (")
+	insert.Write(values.Bytes())
+	insert.WriteByte(')')
+	insert.Write(returning.Bytes())
+
+	var w bytes.Buffer
+	fmt.Fprintf(
+		&w,
+		"// Code generated by pg_util-gen. DO NOT EDIT.\n\npackage %s\n\n",
+		files[0].Name.Name,
+	)
+	if useConvert || useStrconv {
+		w.WriteString("import (\n")
+		if useStrconv {
+			w.WriteString(`"strconv"` + "\n")
+			if useConvert {
+				w.WriteByte('\n')
+			}
+		}
+		if useConvert {
+			w.WriteString(`"github.com/bakape/pg_util"` + "\n")
+		}
+		w.WriteString(")\n\n")
+	}
+	fmt.Fprintf(
+		&w,
+		`// Comma-separated columns of %[1]s in the order expected by Scan%[1]s
+const %[1]sColumns = %[2]s
+
+// SQL and arguments for inserting u into %[3]q. Produces the same statement
+// as pg_util.BuildInsert.
+func Insert%[1]s(u %[1]s) (sql string, args []interface{}, err error) {
+`,
+		typeName,
+		strconv.Quote(names.String()),
+		table,
+	)
+	if hasBeforeInsert(structs, hooks, typeName) {
+		w.WriteString("err = u.BeforeInsert()\n" +
+			"if err != nil {\nreturn \"\", nil, err\n}\n")
+	}
+	w.WriteString("args = []interface{}{\n")
+	for _, a := range args {
+		fmt.Fprintf(&w, "%s,\n", a)
+	}
+	w.WriteString("}\n")
+	w.Write(conversions.Bytes())
+	fmt.Fprintf(
+		&w,
+		`return %s, args, nil
+}
+
+// Scan a row selecting %[2]sColumns into u
+func Scan%[2]s(row interface{ Scan(...interface{}) error }, u *%[2]s) error {
+	return row.Scan(
+`,
+		strconv.Quote(insert.String()),
+		typeName,
+	)
+	for _, c := range cols {
+		fmt.Fprintf(&w, "&%s,\n", c.path)
+	}
+	w.WriteString(")\n}\n")
+
+	return format.Source(w.Bytes())
+}
+
+// Scan fields of struct st and any embedded structs declared in the same
+// package using depth first search, mirroring the runtime column mapping
+func scanStruct(
+	structs map[string]*ast.StructType,
+	st *ast.StructType,
+	path string,
+	dedup map[string]struct{},
+	cols *[]column,
+) (err error) {
+	type embeddedStruct struct {
+		path string
+		st   *ast.StructType
+	}
+	var embedded []embeddedStruct
+
+	for _, f := range st.Fields.List {
+		var tag string
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(unquoted).Get("db")
+		}
+		c := parseTag(tag)
+		if c.name == "-" {
+			continue
+		}
+
+		names := make([]string, 0, len(f.Names))
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			// Embedded field
+			switch t := f.Type.(type) {
+			case *ast.Ident:
+				if est, ok := structs[t.Name]; ok {
+					embedded = append(embedded, embeddedStruct{
+						path: path + "." + t.Name,
+						st:   est,
+					})
+					continue
+				}
+				names = append(names, t.Name)
+			case *ast.StarExpr:
+				id, ok := t.X.(*ast.Ident)
+				if !ok {
+					return fmt.Errorf("unsupported embedded type in %s", path)
+				}
+				names = append(names, id.Name)
+			default:
+				return fmt.Errorf(
+					"unsupported embedded type in %s: only types declared in "+
+						"the same package are supported",
+					path,
+				)
+			}
+		}
+
+		for _, n := range names {
+			if !ast.IsExported(n) {
+				continue
+			}
+			col := c
+			if col.name == "" {
+				col.name = n
+			} else {
+				col.quote = true
+			}
+			if _, ok := dedup[col.name]; ok {
+				continue
+			}
+			dedup[col.name] = struct{}{}
+			col.path = path + "." + n
+			col.typ = f.Type
+			*cols = append(*cols, col)
+		}
+	}
+
+	for _, e := range embedded {
+		err = scanStruct(structs, e.st, e.path, dedup, cols)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Quote a single-part SQL identifier the same way as pg_util
+func quoteName(s string) string {
+	s = strings.ReplaceAll(s, `"`, `""`)
+	return `"` + strings.ReplaceAll(s, "\x00", "") + `"`
+}
+
+// Return the name of a type or pointer to a type declared in the same package
+// or an empty string, if typ is neither
+func localTypeName(typ ast.Expr) string {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if id, ok := typ.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// Report, if type name or any struct embedded in it declares a BeforeInsert
+// method
+func hasBeforeInsert(
+	structs map[string]*ast.StructType,
+	hooks map[string]bool,
+	name string,
+) bool {
+	if hooks[name] {
+		return true
+	}
+	st, ok := structs[name]
+	if !ok {
+		return false
+	}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			if n := localTypeName(f.Type); n != "" && n != name &&
+				hasBeforeInsert(structs, hooks, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return an expression converting the field at path of type typ to a string
+// the same way as pg_util.BuildInsert or an empty string, if the type is not
+// known to convert without reflection
+func stringConversion(typ ast.Expr, path string) string {
+	id, ok := typ.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	switch id.Name {
+	case "string":
+		return path
+	case "bool":
+		return fmt.Sprintf("strconv.FormatBool(%s)", path)
+	case "int", "int8", "int16", "int32", "int64", "rune":
+		return fmt.Sprintf("strconv.FormatInt(int64(%s), 10)", path)
+	case "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte":
+		return fmt.Sprintf("strconv.FormatUint(uint64(%s), 10)", path)
+	}
+	return ""
+}
+
+// Return a condition checking, if the field at path of type typ is its zero
+// value, or an empty string, if the type is not known to check without
+// reflection
+func zeroCheck(typ ast.Expr, path string) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return path + ` == ""`
+		case "bool":
+			return "!" + path
+		case "int", "int8", "int16", "int32", "int64", "rune",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte",
+			"float32", "float64":
+			return path + " == 0"
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" &&
+			t.Sel.Name == "Time" {
+			return path + ".IsZero()"
+		}
+	}
+	return ""
+}
+
+// Parse `db` struct tag. The name is left empty, if not set.
+func parseTag(tag string) (c column) {
+	split := strings.Split(tag, ",")
+	c.name = split[0]
+	for j := 1; j < len(split); j++ {
+		s := split[j]
+		switch {
+		case strings.HasPrefix(s, "cast="):
+			// Types may contain commas inside parentheses
+			for strings.Count(s, "(") > strings.Count(s, ")") &&
+				j+1 < len(split) {
+				j++
+				s += "," + split[j]
+			}
+			c.cast = s[len("cast="):]
+		case s == "string":
+			c.toString = true
+		case s == "nullzero":
+			c.nullZero = true
+		case s == "generated":
+			c.generated = true
+		case s == "readonly":
+			c.readOnly = true
+		case strings.HasPrefix(s, "expr="):
+			// Expressions may contain commas, so consume the rest of the tag
+			c.expr = strings.Join(split[j:], ",")[len("expr="):]
+			return
+		}
+	}
+	return
+}
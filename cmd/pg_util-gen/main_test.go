@@ -0,0 +1,129 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bakape/pg_util"
+)
+
+const testSrc = `package models
+
+type Inner struct {
+	Created time.Time ` + "`db:\"created,nullzero\"`" + `
+	Name    string
+}
+
+type User struct {
+	ID      int64  ` + "`db:\"id,generated\"`" + `
+	Name    string ` + "`db:\"name\"`" + `
+	Age     int    ` + "`db:\",string\"`" + `
+	Updated time.Time ` + "`db:\"updated,expr=now()\"`" + `
+	Views   int    ` + "`db:\"views,readonly\"`" + `
+	Price   string ` + "`db:\"price,cast=numeric(10,2),nullzero\"`" + `
+	Tags    []string ` + "`db:\"tags,string\"`" + `
+	Skip    int    ` + "`db:\"-\"`" + `
+	private int
+	Inner
+}
+
+func (u *User) BeforeInsert() error {
+	return nil
+}
+`
+
+type Inner struct {
+	Created time.Time `db:"created,nullzero"`
+	Name    string
+}
+
+type User struct {
+	ID      int64     `db:"id,generated"`
+	Name    string    `db:"name"`
+	Age     int       `db:",string"`
+	Updated time.Time `db:"updated,expr=now()"`
+	Views   int       `db:"views,readonly"`
+	Price   string    `db:"price,cast=numeric(10,2),nullzero"`
+	Tags    []string  `db:"tags,string"`
+	Skip    int       `db:"-"`
+	private int
+	Inner
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "user.go", testSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate([]*ast.File{f}, "User", "app.users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sql, _ := pg_util.BuildInsert(pg_util.InsertOpts{
+		Table: "app.users",
+		Data:  User{},
+	})
+	for _, s := range [...]string{
+		"package models",
+		`"github.com/bakape/pg_util"`,
+		strconv.Quote(sql),
+		`const UserColumns = "\"id\",\"name\",Age,\"updated\",\"views\",` +
+			`\"price\",\"tags\",` +
+			`\"created\",Name"`,
+		"func InsertUser(u User) (sql string, args []interface{}, err error) {",
+		"err = u.BeforeInsert()",
+		"strconv.FormatInt(int64(u.Age), 10),",
+		"if u.Price == \"\" {\n\t\targs[2] = nil\n\t}",
+		"args[3], err = pg_util.ConvertArg(u.Tags, true, false)",
+		"if u.Inner.Created.IsZero() {\n\t\targs[4] = nil\n\t}",
+		"&u.Inner.Created,",
+	} {
+		if !strings.Contains(string(src), s) {
+			t.Fatalf("generated code does not contain `%s`:\n%s", s, src)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, src, err string
+	}{
+		{
+			name: "not found",
+			src:  "package models\n",
+			err:  "struct type User not found",
+		},
+		{
+			name: "foreign embedded struct",
+			src:  "package models\n\ntype User struct {\n\tsql.NullString\n}\n",
+			err: "unsupported embedded type in u: only types declared in " +
+				"the same package are supported",
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := parser.ParseFile(token.NewFileSet(), "user.go", c.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = generate([]*ast.File{f}, "User", "users")
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("error mismatch: `%v` != `%s`", err, c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package pg_util
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Description of a table column mapped to a struct field using pg_util's
+// `db` tag semantics
+type Column struct {
+	// Column name
+	Name string
+
+	// Name of the Go struct field
+	Field string
+
+	// Type of the Go struct field
+	Type reflect.Type
+
+	// Name was set explicitly through a tag and is quoted in generated SQL to
+	// preserve case
+	Quoted bool
+
+	// Tag options following the name. Example: []string{"pk", "string"}
+	Options []string
+
+	// Field index path from the root struct for use with
+	// reflect.Value.FieldByIndex
+	Index []int
+}
+
+// Returns, if the column has the tag option. Options with values, like
+// "expr=now()", are matched by the part before "=".
+func (c *Column) HasOption(name string) bool {
+	_, ok := c.Option(name)
+	return ok
+}
+
+// Return the value of an option of the form "name=value" and, if the option
+// is set at all
+func (c *Column) Option(name string) (value string, ok bool) {
+	for _, o := range c.Options {
+		if o == name {
+			return "", true
+		}
+		if strings.HasPrefix(o, name) && len(o) > len(name) &&
+			o[len(name)] == '=' {
+			return o[len(name)+1:], true
+		}
+	}
+	return
+}
+
+// Return name of the column as it is written in generated SQL
+func (c *Column) SQLName() string {
+	if c.Quoted {
+		return `"` + c.Name + `"`
+	}
+	return c.Name
+}
+
+// Return the columns a struct maps to in the same order the statement
+// builders use. v can be a struct, a pointer to a struct, or a reflect.Type
+// of either.
+//
+// See InsertOpts.Data for column mapping rules.
+func Columns(v interface{}) (cols []Column, err error) {
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	meta, err := getStructMeta(t)
+	if err != nil {
+		return
+	}
+
+	cols = make([]Column, len(meta.columns))
+	for i := range meta.columns {
+		var (
+			c = &meta.columns[i]
+			f = t.FieldByIndex(c.index)
+		)
+		cols[i] = Column{
+			Name:    c.name,
+			Field:   f.Name,
+			Type:    f.Type,
+			Quoted:  c.quote,
+			Options: append([]string(nil), c.options...),
+			Index:   append([]int(nil), c.index...),
+		}
+	}
+	return
+}
@@ -0,0 +1,73 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestColumns(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		F3 string `db:"f3,expr=coalesce(a, b)"`
+	}
+	type row struct {
+		ID int `db:"id,pk,string"`
+		F2 string
+		inner
+		F4 int `db:"-"`
+	}
+
+	std := []Column{
+		{
+			Name:    "id",
+			Field:   "ID",
+			Type:    reflect.TypeOf(0),
+			Quoted:  true,
+			Options: []string{"pk", "string"},
+			Index:   []int{0},
+		},
+		{
+			Name:  "F2",
+			Field: "F2",
+			Type:  reflect.TypeOf(""),
+			Index: []int{1},
+		},
+		{
+			Name:    "f3",
+			Field:   "F3",
+			Type:    reflect.TypeOf(""),
+			Quoted:  true,
+			Options: []string{"expr=coalesce(a, b)"},
+			Index:   []int{2, 0},
+		},
+	}
+
+	for _, v := range [...]interface{}{
+		row{},
+		(*row)(nil),
+		reflect.TypeOf(row{}),
+	} {
+		cols, err := Columns(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cols, std) {
+			t.Fatalf("column mismatch: `%+v` != `%+v`", cols, std)
+		}
+	}
+
+	if !std[0].HasOption("pk") || std[1].HasOption("pk") {
+		t.Fatal("option detection mismatch")
+	}
+	if e, _ := std[2].Option("expr"); e != "coalesce(a, b)" {
+		t.Fatalf("option value mismatch: %s", e)
+	}
+	if std[0].SQLName() != `"id"` {
+		t.Fatalf("SQL name mismatch: %s", std[0].SQLName())
+	}
+
+	if _, err := Columns(1); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,345 @@
+package pg_util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// Key/value table read by ConfigWatcher
+	ConfigTable = "pg_util_config"
+
+	// Channel notified with the key of changed rows of ConfigTable
+	ConfigChannel = "pg_util_config"
+)
+
+// Create the config table and the trigger notifying ConfigChannel on changes,
+// if they do not exist yet
+func CreateConfigTable(ctx context.Context, q Querier) (err error) {
+	table := quoteIdentifier(ConfigTable)
+	fn := quoteName(ConfigTable + "_notify")
+	_, err = q.Exec(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS `+table+` (
+			key text PRIMARY KEY,
+			value jsonb NOT NULL,
+			updated_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE OR REPLACE FUNCTION `+fn+`()
+		RETURNS trigger
+		LANGUAGE plpgsql
+		AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				PERFORM pg_notify('`+ConfigChannel+`', OLD.key);
+			ELSE
+				PERFORM pg_notify('`+ConfigChannel+`', NEW.key);
+			END IF;
+			RETURN NULL;
+		END
+		$$;
+		DROP TRIGGER IF EXISTS `+fn+` ON `+table+`;
+		CREATE TRIGGER `+fn+`
+		AFTER INSERT OR UPDATE OR DELETE ON `+table+`
+		FOR EACH ROW EXECUTE PROCEDURE `+fn+`()`,
+	)
+	return
+}
+
+// Set config key to the JSON encoding of value. Watchers are notified, once
+// the change is committed.
+func SetConfig(ctx context.Context, q Querier, key string, value interface{}) (
+	err error,
+) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	_, err = q.Exec(
+		ctx,
+		`INSERT INTO `+quoteIdentifier(ConfigTable)+` (key, value)
+		VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE
+			SET value = excluded.value,
+				updated_at = now()`,
+		key,
+		string(buf),
+	)
+	return
+}
+
+// Delete config key. Watchers are notified, once the change is committed.
+func DeleteConfig(ctx context.Context, q Querier, key string) (err error) {
+	_, err = q.Exec(
+		ctx,
+		`DELETE FROM `+quoteIdentifier(ConfigTable)+` WHERE key = $1`,
+		key,
+	)
+	return
+}
+
+// Options for NewConfigWatcher
+type ConfigWatcherOpts struct {
+	// Connection or pool to read the config table with. Required.
+	Conn Querier
+
+	// URL to connect to the database on for receiving change notifications.
+	// Required.
+	ConnectionURL string
+
+	// Optional handler for decoding and connection errors
+	OnError func(err error)
+
+	// Optional context for cancelling watching
+	Context context.Context
+}
+
+// Keeps an in-memory copy of the config table updated through notifications
+// and calls callbacks registered with WatchConfig, when their keys change.
+// Create with NewConfigWatcher.
+type ConfigWatcher struct {
+	opts ConfigWatcherOpts
+
+	// Serializes reloads and callbacks
+	reloadMu sync.Mutex
+
+	mu sync.RWMutex
+
+	// Start was called and has not failed
+	running bool
+
+	// Initial values were loaded
+	started bool
+
+	// Raw JSON values by key
+	values map[string][]byte
+
+	// Callbacks by key
+	callbacks map[string][]func(raw []byte)
+}
+
+// Create a watcher for the table created by CreateConfigTable. Register
+// callbacks with WatchConfig and start watching with Start.
+func NewConfigWatcher(opts ConfigWatcherOpts) *ConfigWatcher {
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	return &ConfigWatcher{
+		opts:      opts,
+		values:    make(map[string][]byte),
+		callbacks: make(map[string][]func(raw []byte)),
+	}
+}
+
+func (w *ConfigWatcher) handleError(err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+}
+
+// Start listening for changes and load the config table. Callbacks
+// registered before are called with the initial values of their keys.
+// Returns on the first successful load. If the initial load fails, listening
+// is stopped and Start can be retried.
+func (w *ConfigWatcher) Start() (err error) {
+	w.mu.Lock()
+	running := w.running
+	w.running = true
+	w.mu.Unlock()
+	if running {
+		return errors.New("pg_util: config watcher already started")
+	}
+
+	ctx, cancel := context.WithCancel(w.opts.Context)
+	defer func() {
+		if err != nil {
+			cancel()
+			w.mu.Lock()
+			w.running = false
+			w.mu.Unlock()
+		}
+	}()
+
+	// Listen before loading, so no changes are missed in between
+	err = Listen(ListenOpts{
+		ConnectionURL: w.opts.ConnectionURL,
+		Channel:       ConfigChannel,
+		Context:       ctx,
+		OnError:       w.opts.OnError,
+		OnMsg: func(key string) error {
+			return w.reload(key)
+		},
+		OnReconnect: func() {
+			// Notifications may have been missed
+			err := w.reload("")
+			if err != nil {
+				w.handleError(err)
+			}
+		},
+	})
+	if err != nil {
+		return
+	}
+	return w.reload("")
+}
+
+// Read key or all keys, if empty, from the database and call the callbacks
+// of changed keys
+func (w *ConfigWatcher) reload(key string) (err error) {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	sql := `SELECT key, value::text FROM ` + quoteIdentifier(ConfigTable)
+	args := []interface{}{}
+	if key != "" {
+		sql += ` WHERE key = $1`
+		args = append(args, key)
+	}
+	loaded := make(map[string][]byte)
+	err = QueryEach(
+		w.opts.Context,
+		w.opts.Conn,
+		sql,
+		args,
+		func(row pgx.Row) (err error) {
+			var (
+				k string
+				v []byte
+			)
+			err = row.Scan(&k, &v)
+			if err != nil {
+				return
+			}
+			loaded[k] = v
+			return
+		},
+	)
+	if err != nil {
+		return
+	}
+
+	type call struct {
+		fn  func([]byte)
+		raw []byte
+	}
+	var calls []call
+	w.mu.Lock()
+	apply := func(k string, v []byte) {
+		old, existed := w.values[k]
+		if v == nil {
+			if !existed {
+				return
+			}
+			delete(w.values, k)
+		} else {
+			if existed && bytes.Equal(old, v) {
+				return
+			}
+			w.values[k] = v
+		}
+		for _, fn := range w.callbacks[k] {
+			calls = append(calls, call{fn, v})
+		}
+	}
+	if key != "" {
+		apply(key, loaded[key])
+	} else {
+		for k := range w.values {
+			if _, ok := loaded[k]; !ok {
+				apply(k, nil)
+			}
+		}
+		for k, v := range loaded {
+			apply(k, v)
+		}
+
+		// Set under reloadMu, so callbacks registered by WatchConfig
+		// concurrently either receive the loaded values from here or
+		// immediately
+		w.started = true
+	}
+	w.mu.Unlock()
+
+	for _, c := range calls {
+		c.fn(c.raw)
+	}
+	return
+}
+
+// Return the raw JSON value of key and, if it is set
+func (w *ConfigWatcher) raw(key string) (raw []byte, ok bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	raw, ok = w.values[key]
+	return
+}
+
+// Decode raw JSON value of key into T
+func decodeConfig[T any](key string, raw []byte) (v T, err error) {
+	err = json.Unmarshal(raw, &v)
+	if err != nil {
+		err = fmt.Errorf("pg_util: decoding config key=%s error=%w", key, err)
+	}
+	return
+}
+
+// Return the current value of key decoded into T and, if key is set
+func ConfigValue[T any](w *ConfigWatcher, key string) (
+	v T,
+	ok bool,
+	err error,
+) {
+	raw, ok := w.raw(key)
+	if !ok {
+		return
+	}
+	v, err = decodeConfig[T](key, raw)
+	return
+}
+
+// Call fn with the value of key decoded into T every time it changes. ok is
+// false, if the key was deleted. If the watcher is already started and key is
+// set, fn is called immediately with the current value.
+//
+// Callbacks are called serially in the order of changes. Values, that fail to
+// decode, are reported to ConfigWatcherOpts.OnError without calling fn. fn
+// must not call WatchConfig.
+func WatchConfig[T any](
+	w *ConfigWatcher,
+	key string,
+	fn func(value T, ok bool),
+) {
+	cb := func(raw []byte) {
+		if raw == nil {
+			var zero T
+			fn(zero, false)
+			return
+		}
+		v, err := decodeConfig[T](key, raw)
+		if err != nil {
+			w.handleError(err)
+			return
+		}
+		fn(v, true)
+	}
+
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	w.mu.Lock()
+	w.callbacks[key] = append(w.callbacks[key], cb)
+	started := w.started
+	raw, ok := w.values[key]
+	w.mu.Unlock()
+
+	if started && ok {
+		cb(raw)
+	}
+}
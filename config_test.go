@@ -0,0 +1,113 @@
+package pg_util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	u := getURL(t)
+	pool, err := pgxpool.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	err = CreateConfigTable(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const key = "config_test.limit"
+	err = SetConfig(ctx, pool, key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteConfig(context.Background(), pool, key)
+
+	type change struct {
+		value int
+		ok    bool
+	}
+	changes := make(chan change, 10)
+	w := NewConfigWatcher(ConfigWatcherOpts{
+		Conn:          pool,
+		ConnectionURL: u,
+		Context:       ctx,
+		OnError: func(err error) {
+			t.Error(err)
+		},
+	})
+	WatchConfig(w, key, func(value int, ok bool) {
+		changes <- change{value, ok}
+	})
+	err = w.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(std change) {
+		t.Helper()
+
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case c := <-changes:
+			if c != std {
+				t.Fatalf("expected %+v, got %+v", std, c)
+			}
+		}
+	}
+
+	expect(change{1, true})
+
+	v, ok, err := ConfigValue[int](w, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || v != 1 {
+		t.Fatalf("unexpected value: %d %t", v, ok)
+	}
+
+	// Unchanged values do not trigger callbacks
+	err = SetConfig(ctx, pool, key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetConfig(ctx, pool, key, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(change{2, true})
+
+	err = DeleteConfig(ctx, pool, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(change{0, false})
+}
+
+func TestConfigWatcherStartRetry(t *testing.T) {
+	t.Parallel()
+
+	w := NewConfigWatcher(ConfigWatcherOpts{
+		ConnectionURL: "postgres://127.0.0.1:1/none?connect_timeout=1",
+	})
+	for i := 0; i < 2; i++ {
+		err := w.Start()
+		if err == nil ||
+			err.Error() == "pg_util: config watcher already started" {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+	}
+	if w.started {
+		t.Fatal("watcher marked as started")
+	}
+}
@@ -0,0 +1,100 @@
+package pg_util
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Options for retrying connection attempts
+type ConnectOpts struct {
+	// Maximum number of attempts, including the first one. Unlimited, if
+	// zero. Use a context with a deadline to bound the total waiting time.
+	MaxAttempts int
+
+	// Delay before the first retry. Doubled after each retry. Defaults to
+	// 100ms.
+	Backoff time.Duration
+
+	// Maximum delay between retries. Defaults to 5s.
+	MaxBackoff time.Duration
+
+	// Optional function called with the error of each failed attempt. Useful
+	// for logging, while waiting for the database to start.
+	OnError func(attempt int, err error)
+}
+
+// Connect to the database at url, retrying with exponential backoff until it
+// accepts connections. Useful for waiting for the database on container
+// startup.
+//
+// An invalid url is returned as an error immediately. Returns the last
+// connection error, if all attempts fail, or the context error, if ctx is
+// done while waiting.
+func ConnectWithRetry(ctx context.Context, url string, opts ConnectOpts) (
+	conn *pgx.Conn,
+	err error,
+) {
+	conf, err := pgx.ParseConfig(url)
+	if err != nil {
+		return
+	}
+	err = connectWithRetry(ctx, opts, func() (err error) {
+		conn, err = pgx.ConnectConfig(ctx, conf)
+		return
+	})
+	return
+}
+
+// Like ConnectWithRetry, but creates a connection pool. The pool is only
+// returned, once a connection has been established.
+func ConnectPoolWithRetry(
+	ctx context.Context,
+	url string,
+	opts ConnectOpts,
+) (pool *pgxpool.Pool, err error) {
+	conf, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return
+	}
+	conf.LazyConnect = false
+	err = connectWithRetry(ctx, opts, func() (err error) {
+		pool, err = pgxpool.ConnectConfig(ctx, conf)
+		return
+	})
+	return
+}
+
+// Call connect until it succeeds or the attempts defined by opts are
+// exhausted
+func connectWithRetry(
+	ctx context.Context,
+	opts ConnectOpts,
+	connect func() error,
+) (err error) {
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+
+	b := backoff{opts.Backoff, opts.MaxBackoff}
+	for attempt := 1; ; attempt++ {
+		err = connect()
+		if err == nil {
+			return
+		}
+		if opts.OnError != nil {
+			opts.OnError(attempt, err)
+		}
+		if opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts {
+			return
+		}
+		if err = b.wait(ctx); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConnectWithRetryAttempts(t *testing.T) {
+	t.Parallel()
+
+	errFail := errors.New("fail")
+	cases := [...]struct {
+		name              string
+		maxAttempts       int
+		failures          int
+		attempts, errored int
+		err               error
+	}{
+		{
+			name:     "first attempt",
+			attempts: 1,
+		},
+		{
+			name:     "after failures",
+			failures: 2,
+			attempts: 3,
+			errored:  2,
+		},
+		{
+			name:        "attempts exhausted",
+			maxAttempts: 2,
+			failures:    5,
+			attempts:    2,
+			errored:     2,
+			err:         errFail,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var attempts, errored int
+			err := connectWithRetry(
+				context.Background(),
+				ConnectOpts{
+					MaxAttempts: c.maxAttempts,
+					Backoff:     time.Millisecond,
+					OnError: func(attempt int, err error) {
+						errored++
+						if attempt != errored {
+							t.Fatalf("attempt mismatch: %d != %d", attempt,
+								errored)
+						}
+					},
+				},
+				func() error {
+					attempts++
+					if attempts <= c.failures {
+						return errFail
+					}
+					return nil
+				},
+			)
+			if err != c.err {
+				t.Fatalf("error mismatch: %v != %v", err, c.err)
+			}
+			if attempts != c.attempts {
+				t.Fatalf("attempts mismatch: %d != %d", attempts, c.attempts)
+			}
+			if errored != c.errored {
+				t.Fatalf("errors mismatch: %d != %d", errored, c.errored)
+			}
+		})
+	}
+}
+
+func TestConnectWithRetryCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		10*time.Millisecond,
+	)
+	defer cancel()
+
+	err := connectWithRetry(ctx, ConnectOpts{}, func() error {
+		return errors.New("fail")
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestConnectWithRetryInvalidURL(t *testing.T) {
+	t.Parallel()
+
+	_, err := ConnectWithRetry(
+		context.Background(),
+		"postgres://%",
+		ConnectOpts{},
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestConnectWithRetry(t *testing.T) {
+	t.Parallel()
+
+	conn, err := ConnectWithRetry(context.Background(), getURL(t),
+		ConnectOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close(context.Background())
+
+	pool, err := ConnectPoolWithRetry(context.Background(), getURL(t),
+		ConnectOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+}
@@ -0,0 +1,142 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Errors registered by constraint name
+var constraintErrors sync.Map
+
+// Register err to be produced by TranslateError for violations of constraint.
+// This allows producing domain errors like ErrEmailTaken at the database
+// boundary. Example:
+//
+//	RegisterConstraintError("users_email_key", ErrEmailTaken)
+//
+// Pass nil to remove a registered error.
+func RegisterConstraintError(constraint string, err error) {
+	if err == nil {
+		constraintErrors.Delete(constraint)
+		return
+	}
+	constraintErrors.Store(constraint, err)
+}
+
+// Error produced by TranslateError for violations of registered constraints.
+// Unwraps to the registered error and can be converted to the original
+// *pgconn.PgError with errors.As.
+type ConstraintError struct {
+	// Registered error
+	Err error
+
+	// Original database error
+	PgErr *pgconn.PgError
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf(
+		"%s (constraint %s: %s)",
+		e.Err,
+		e.PgErr.ConstraintName,
+		e.PgErr.Message,
+	)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConstraintError) As(target interface{}) bool {
+	if t, ok := target.(**pgconn.PgError); ok {
+		*t = e.PgErr
+		return true
+	}
+	return false
+}
+
+// Translate err into a *ConstraintError, if it is or wraps a *pgconn.PgError
+// violating a constraint registered with RegisterConstraintError. Otherwise
+// err is returned unchanged.
+func TranslateError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.ConstraintName == "" {
+		return err
+	}
+	if _, ok := err.(*ConstraintError); ok {
+		return err
+	}
+	registered, ok := constraintErrors.Load(pgErr.ConstraintName)
+	if !ok {
+		return err
+	}
+	return &ConstraintError{
+		Err:   registered.(error),
+		PgErr: pgErr,
+	}
+}
+
+// Wrap q, so that all errors returned by it are passed through
+// TranslateError. The returned Querier can be passed to any helper taking a
+// Querier.
+func TranslateErrors(q Querier) Querier {
+	return translatingQuerier{q}
+}
+
+type translatingQuerier struct {
+	q Querier
+}
+
+func (t translatingQuerier) Exec(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgconn.CommandTag, error) {
+	tag, err := t.q.Exec(ctx, sql, args...)
+	return tag, TranslateError(err)
+}
+
+func (t translatingQuerier) Query(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgx.Rows, error) {
+	r, err := t.q.Query(ctx, sql, args...)
+	if err != nil {
+		return r, TranslateError(err)
+	}
+	return translatingRows{r}, nil
+}
+
+func (t translatingQuerier) QueryRow(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) pgx.Row {
+	return translatingRow{t.q.QueryRow(ctx, sql, args...)}
+}
+
+type translatingRows struct {
+	pgx.Rows
+}
+
+func (r translatingRows) Err() error {
+	return TranslateError(r.Rows.Err())
+}
+
+func (r translatingRows) Scan(dest ...interface{}) error {
+	return TranslateError(r.Rows.Scan(dest...))
+}
+
+type translatingRow struct {
+	pgx.Row
+}
+
+func (r translatingRow) Scan(dest ...interface{}) error {
+	return TranslateError(r.Row.Scan(dest...))
+}
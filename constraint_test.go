@@ -0,0 +1,122 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestTranslateError(t *testing.T) {
+	t.Parallel()
+
+	errTaken := errors.New("email taken")
+	RegisterConstraintError("translate_test_email_key", errTaken)
+
+	registered := &pgconn.PgError{
+		Code:           "23505",
+		Message:        "duplicate key",
+		ConstraintName: "translate_test_email_key",
+	}
+	unregistered := &pgconn.PgError{
+		Code:           "23505",
+		ConstraintName: "translate_test_other_key",
+	}
+	other := errors.New("other")
+
+	cases := [...]struct {
+		name string
+		in   error
+		out  error
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "other error",
+			in:   other,
+			out:  other,
+		},
+		{
+			name: "unregistered constraint",
+			in:   unregistered,
+			out:  unregistered,
+		},
+		{
+			name: "registered constraint",
+			in:   registered,
+			out:  errTaken,
+		},
+		{
+			name: "wrapped",
+			in:   fmt.Errorf("insert: %w", registered),
+			out:  errTaken,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := TranslateError(c.in)
+			if !errors.Is(err, c.out) {
+				t.Fatalf("error mismatch: %v != %v", err, c.out)
+			}
+			if c.out == errTaken {
+				var pgErr *pgconn.PgError
+				if !errors.As(err, &pgErr) || pgErr != registered {
+					t.Fatal("original error not accessible")
+				}
+			}
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	t.Parallel()
+
+	errTaken := errors.New("email taken")
+	RegisterConstraintError("translate_errors_test_email_key", errTaken)
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(
+				context.Background(),
+				`create temp table translate_errors_test (
+					email text
+						constraint translate_errors_test_email_key unique
+				) on commit drop`,
+			)
+			if err != nil {
+				return
+			}
+
+			q := TranslateErrors(tx)
+			for i := 0; i < 2; i++ {
+				_, err = q.Exec(
+					context.Background(),
+					"insert into translate_errors_test values ('a@b.c')",
+				)
+			}
+			if !errors.Is(err, errTaken) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package pg_util
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// Set, once any converter has been registered, to skip lookups otherwise
+	convertersRegistered int32
+
+	// Converters by Go type
+	typeConverters sync.Map
+)
+
+// Register fn to convert all struct field values of type T into the values
+// passed to the driver by all statement builders. Useful for custom enum types
+// or decimal types, that would otherwise need the ",string" tag option on
+// every field. Pass nil to remove a registered converter.
+//
+// Converters only match the exact field type, so a converter for T is not
+// applied to *T fields. Encoders registered with RegisterFieldEncoder or
+// RegisterTagEncoder take precedence over converters. Converted values are
+// passed to the driver as is and ",string" conversion is skipped.
+func RegisterConverter[T any](fn func(T) (interface{}, error)) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if fn == nil {
+		typeConverters.Delete(typ)
+		return
+	}
+	typeConverters.Store(typ, func(v reflect.Value) (interface{}, error) {
+		return fn(v.Interface().(T))
+	})
+	atomic.StoreInt32(&convertersRegistered, 1)
+}
+
+// Return converter registered for type t, if any
+func typeConverter(t reflect.Type) FieldEncoder {
+	if atomic.LoadInt32(&convertersRegistered) == 0 {
+		return nil
+	}
+	conv, ok := typeConverters.Load(t)
+	if !ok {
+		return nil
+	}
+	return conv.(func(reflect.Value) (interface{}, error))
+}
@@ -0,0 +1,34 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+)
+
+type converterEnum int
+
+type converterRow struct {
+	F1 converterEnum
+	F2 *converterEnum
+	F3 converterEnum `db:"f3,string"`
+	F4 converterEnum `db:"f4,nullzero"`
+}
+
+func TestRegisterConverter(t *testing.T) {
+	RegisterConverter(func(e converterEnum) (interface{}, error) {
+		return [...]string{"zero", "one", "two"}[e], nil
+	})
+	defer RegisterConverter[converterEnum](nil)
+
+	_, args, err := BuildInsertT(InsertOptsT[converterRow]{
+		Table: "t1",
+		Data:  converterRow{F1: 1, F3: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []interface{}{"one", (*converterEnum)(nil), "two", nil}
+	if !reflect.DeepEqual(args, std) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, std)
+	}
+}
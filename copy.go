@@ -0,0 +1,425 @@
+package pg_util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Data format of COPY
+type CopyFormat int
+
+const (
+	// CSV without a header row
+	CopyCSV CopyFormat = iota
+
+	// CSV with a header row of column names
+	CopyCSVHeader
+
+	// Postgres binary format. Fastest, but only readable by COPY FROM into
+	// columns of the same types.
+	CopyBinary
+
+	// Postgres tab-separated text format
+	CopyText
+)
+
+// Return options of COPY for the format
+func (f CopyFormat) options() string {
+	switch f {
+	case CopyCSVHeader:
+		return "FORMAT csv, HEADER true"
+	case CopyBinary:
+		return "FORMAT binary"
+	case CopyText:
+		return "FORMAT text"
+	default:
+		return "FORMAT csv"
+	}
+}
+
+// Run fn with the low-level connection underlying conn. conn can be a
+// *pgx.Conn, a pgx.Tx, a *pgxpool.Conn or a *pgxpool.Pool, in which case a
+// connection is acquired for the duration of fn.
+func withPgConn(
+	ctx context.Context,
+	conn Querier,
+	fn func(*pgconn.PgConn) error,
+) error {
+	switch c := conn.(type) {
+	case *pgx.Conn:
+		return fn(c.PgConn())
+	case interface{ Conn() *pgx.Conn }:
+		// Adapters like mock.Tx implement pgx.Tx without a connection
+		if pc := c.Conn(); pc != nil {
+			return fn(pc.PgConn())
+		}
+	case poolAcquirer:
+		pc, err := c.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer pc.Release()
+		return fn(pc.Conn().PgConn())
+	}
+	return fmt.Errorf("pg_util: COPY not supported on %T", conn)
+}
+
+// Stream the results of query to w with COPY (query) TO STDOUT in format.
+// Useful for streaming exports and backups of tables to files or HTTP
+// responses without buffering them. Pass "TABLE name" as query to export an
+// entire table.
+//
+// COPY does not support bind parameters, so query must not have any.
+// Returns the number of copied rows.
+func CopyOut(
+	ctx context.Context,
+	conn Querier,
+	query string,
+	w io.Writer,
+	format CopyFormat,
+) (n int64, err error) {
+	err = withPgConn(ctx, conn, func(pc *pgconn.PgConn) error {
+		tag, err := pc.CopyTo(
+			ctx,
+			w,
+			fmt.Sprintf(
+				"COPY (%s) TO STDOUT WITH (%s)",
+				query,
+				format.options(),
+			),
+		)
+		n = tag.RowsAffected()
+		return err
+	})
+	return
+}
+
+// Options for CopyInCSV
+type CopyInCSVOpts struct {
+	// Input starts with a header row, which is skipped
+	Header bool
+
+	// Field delimiter. Defaults to ','.
+	Delimiter rune
+
+	// Unquoted string representing NULL. Defaults to an empty unquoted field.
+	Null string
+
+	// Optional handler for rows rejected by the database. If set, rows are
+	// copied in batches of BatchSize and rejected rows are skipped and passed
+	// to OnRowError instead of aborting the copy. Returning an error aborts
+	// the copy. Inside a transaction each batch is copied in a savepoint.
+	//
+	// Each rejected row causes its batch to be copied again, so small batches
+	// are faster for inputs with many invalid rows.
+	OnRowError func(err *CopyRowError) error
+
+	// Number of rows per batch with OnRowError set. Defaults to 1000.
+	BatchSize int
+}
+
+// Row of CSV input rejected by COPY
+type CopyRowError struct {
+	// Line number of the start of the row in the input
+	Line int64
+
+	// Column of the rejected value, if known
+	Column string
+
+	// Raw CSV of the row. Only set with CopyInCSVOpts.OnRowError.
+	Row string
+
+	// Error returned by the database
+	Err error
+}
+
+func (e *CopyRowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf(
+			"pg_util: copy line=%d column=%s error=%s",
+			e.Line, e.Column, e.Err,
+		)
+	}
+	return fmt.Sprintf("pg_util: copy line=%d error=%s", e.Line, e.Err)
+}
+
+func (e *CopyRowError) Unwrap() error {
+	return e.Err
+}
+
+// Matches the error context of COPY, like
+// `COPY users, line 3, column age: "abc"`
+var copyWhereRe = regexp.MustCompile(
+	`COPY [^,]+, line (\d+)(?:, column ([^:]+))?`,
+)
+
+// Parse the line and column of a rejected row from COPY error err
+func parseCopyError(err error) (line int64, column string, ok bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return
+	}
+	m := copyWhereRe.FindStringSubmatch(pgErr.Where)
+	if m == nil {
+		return
+	}
+	line, perr := strconv.ParseInt(m[1], 10, 64)
+	if perr != nil {
+		return
+	}
+	return line, m[2], true
+}
+
+// Load CSV from r into columns of table with COPY ... FROM STDIN. Loads all
+// columns in table order, if columns is empty. Rows rejected by the database
+// are returned as *CopyRowError, unless handled by opts.OnRowError.
+//
+// conn can be a *pgx.Conn, a pgx.Tx, a *pgxpool.Conn or a *pgxpool.Pool.
+// Returns the number of loaded rows.
+func CopyInCSV(
+	ctx context.Context,
+	conn Querier,
+	table string,
+	columns []string,
+	r io.Reader,
+	opts CopyInCSVOpts,
+) (n int64, err error) {
+	if table == "" {
+		err = ErrNoTable
+		return
+	}
+	err = withPgConn(ctx, conn, func(pc *pgconn.PgConn) (err error) {
+		if opts.OnRowError == nil {
+			var tag pgconn.CommandTag
+			tag, err = pc.CopyFrom(
+				ctx,
+				r,
+				buildCopyInCSV(table, columns, &opts, opts.Header),
+			)
+			n = tag.RowsAffected()
+			if line, col, ok := parseCopyError(err); ok {
+				err = &CopyRowError{
+					Line:   line,
+					Column: col,
+					Err:    err,
+				}
+			}
+			return
+		}
+		n, err = copyInCSVBatches(ctx, pc, table, columns, r, &opts)
+		return
+	})
+	return
+}
+
+// Build COPY FROM STDIN statement for CSV input
+func buildCopyInCSV(
+	table string,
+	columns []string,
+	opts *CopyInCSVOpts,
+	header bool,
+) string {
+	var w strings.Builder
+	w.WriteString("COPY ")
+	w.WriteString(quoteIdentifier(table))
+	if len(columns) != 0 {
+		w.WriteString(" (")
+		writeIdentifierList(&w, columns)
+		w.WriteByte(')')
+	}
+	w.WriteString(" FROM STDIN WITH (FORMAT csv")
+	if header {
+		w.WriteString(", HEADER true")
+	}
+	if opts.Delimiter != 0 {
+		w.WriteString(", DELIMITER ")
+		writeQuotedString(&w, string(opts.Delimiter))
+	}
+	if opts.Null != "" {
+		w.WriteString(", NULL ")
+		writeQuotedString(&w, opts.Null)
+	}
+	w.WriteByte(')')
+	return w.String()
+}
+
+// Row of CSV input for batched copying
+type csvRow struct {
+	line int64
+	data []byte
+}
+
+// Copy CSV from r in batches, skipping and reporting rejected rows
+func copyInCSVBatches(
+	ctx context.Context,
+	pc *pgconn.PgConn,
+	table string,
+	columns []string,
+	r io.Reader,
+	opts *CopyInCSVOpts,
+) (n int64, err error) {
+	size := opts.BatchSize
+	if size <= 0 {
+		size = 1000
+	}
+	var (
+		sql   = buildCopyInCSV(table, columns, opts, false)
+		inTx  = pc.TxStatus() == 'T'
+		rows  = newCSVRowReader(r)
+		batch = make([]csvRow, 0, size)
+	)
+
+	if opts.Header {
+		_, err = rows.next()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	for {
+		batch = batch[:0]
+		for len(batch) < size {
+			var row csvRow
+			row, err = rows.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return
+			}
+			batch = append(batch, row)
+		}
+		if len(batch) == 0 {
+			return n, nil
+		}
+
+		var copied int64
+		copied, err = copyCSVBatch(ctx, pc, sql, inTx, batch, opts)
+		n += copied
+		if err != nil {
+			return
+		}
+		if len(batch) < size {
+			return
+		}
+	}
+}
+
+// Copy batch of rows, retrying without each rejected row
+func copyCSVBatch(
+	ctx context.Context,
+	pc *pgconn.PgConn,
+	sql string,
+	inTx bool,
+	batch []csvRow,
+	opts *CopyInCSVOpts,
+) (n int64, err error) {
+	exec := func(sql string) error {
+		_, err := pc.Exec(ctx, sql).ReadAll()
+		return err
+	}
+
+	var buf bytes.Buffer
+	for len(batch) != 0 {
+		buf.Reset()
+		for _, r := range batch {
+			buf.Write(r.data)
+		}
+
+		if inTx {
+			err = exec("SAVEPOINT pg_util_copy")
+			if err != nil {
+				return
+			}
+		}
+		tag, copyErr := pc.CopyFrom(ctx, &buf, sql)
+		if copyErr == nil {
+			if inTx {
+				err = exec("RELEASE SAVEPOINT pg_util_copy")
+				if err != nil {
+					return
+				}
+			}
+			n += tag.RowsAffected()
+			return
+		}
+		if inTx {
+			err = exec("ROLLBACK TO SAVEPOINT pg_util_copy")
+			if err != nil {
+				return
+			}
+		}
+
+		line, col, ok := parseCopyError(copyErr)
+		if !ok || line < 1 || line > int64(len(batch)) {
+			return n, copyErr
+		}
+		i := int(line - 1)
+		err = opts.OnRowError(&CopyRowError{
+			Line:   batch[i].line,
+			Column: col,
+			Row:    string(batch[i].data),
+			Err:    copyErr,
+		})
+		if err != nil {
+			return
+		}
+		batch = append(batch[:i:i], batch[i+1:]...)
+	}
+	return
+}
+
+// Splits CSV input into raw rows, keeping quoted line breaks inside rows
+type csvRowReader struct {
+	r    *bufio.Reader
+	line int64
+}
+
+func newCSVRowReader(r io.Reader) *csvRowReader {
+	return &csvRowReader{r: bufio.NewReader(r)}
+}
+
+// Read the next row. Returns io.EOF, if there are no more rows.
+func (r *csvRowReader) next() (row csvRow, err error) {
+	row.line = r.line + 1
+	quotes := 0
+	for {
+		var line []byte
+		line, err = r.r.ReadBytes('\n')
+		if len(line) != 0 {
+			r.line++
+			row.data = append(row.data, line...)
+			quotes += bytes.Count(line, []byte{'"'})
+		}
+		if err == io.EOF {
+			if len(row.data) == 0 {
+				return
+			}
+			if row.data[len(row.data)-1] != '\n' {
+				row.data = append(row.data, '\n')
+			}
+			return row, nil
+		}
+		if err != nil {
+			return
+		}
+		// Escaped quotes are doubled, so line breaks are only inside quoted
+		// fields on an odd quote count
+		if quotes%2 == 0 {
+			return
+		}
+	}
+}
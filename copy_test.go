@@ -0,0 +1,291 @@
+package pg_util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestCopyOut(t *testing.T) {
+	t.Parallel()
+
+	const query = `select i, 'row ' || i as name from generate_series(1, 2) i`
+	cases := [...]struct {
+		name   string
+		format CopyFormat
+		out    string
+	}{
+		{
+			name:   "csv",
+			format: CopyCSV,
+			out:    "1,row 1\n2,row 2\n",
+		},
+		{
+			name:   "csv header",
+			format: CopyCSVHeader,
+			out:    "i,name\n1,row 1\n2,row 2\n",
+		},
+		{
+			name:   "text",
+			format: CopyText,
+			out:    "1\trow 1\n2\trow 2\n",
+		},
+	}
+
+	ctx := context.Background()
+	u := getURL(t)
+	pool, err := pgxpool.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			n, err := CopyOut(ctx, pool, query, &buf, c.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 {
+				t.Fatalf("unexpected row count: %d", n)
+			}
+			if buf.String() != c.out {
+				t.Fatalf("unexpected output:\n%s", buf.String())
+			}
+		})
+	}
+
+	t.Run("transaction", func(t *testing.T) {
+		t.Parallel()
+
+		conn, err := pgx.Connect(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close(ctx)
+
+		err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(
+				ctx,
+				`create temp table copy_out_test on commit drop as
+				select 1 as id`,
+			)
+			if err != nil {
+				return
+			}
+			var buf bytes.Buffer
+			_, err = CopyOut(ctx, tx, "table copy_out_test", &buf, CopyBinary)
+			if err != nil {
+				return
+			}
+			if !bytes.HasPrefix(buf.Bytes(), []byte("PGCOPY\n")) {
+				t.Fatalf("unexpected output: %q", buf.Bytes())
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestCSVRowReader(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		rows     []csvRow
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "simple",
+			in:   "a,b\nc,d",
+			rows: []csvRow{
+				{1, []byte("a,b\n")},
+				{2, []byte("c,d\n")},
+			},
+		},
+		{
+			name: "quoted line break",
+			in:   "1,\"a\nb\"\n2,\"\"\"x\"\"\"\n",
+			rows: []csvRow{
+				{1, []byte("1,\"a\nb\"\n")},
+				{3, []byte("2,\"\"\"x\"\"\"\n")},
+			},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := newCSVRowReader(strings.NewReader(c.in))
+			var rows []csvRow
+			for {
+				row, err := r.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				rows = append(rows, row)
+			}
+			if !reflect.DeepEqual(rows, c.rows) {
+				t.Fatalf("expected %q, got %q", c.rows, rows)
+			}
+		})
+	}
+}
+
+func TestParseCopyError(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name   string
+		err    error
+		line   int64
+		column string
+		ok     bool
+	}{
+		{
+			name: "not a PgError",
+			err:  errors.New("nope"),
+		},
+		{
+			name:   "with column",
+			err:    &pgconn.PgError{Where: `COPY users, line 3, column age: "x"`},
+			line:   3,
+			column: "age",
+			ok:     true,
+		},
+		{
+			name: "without column",
+			err:  &pgconn.PgError{Where: `COPY users, line 12`},
+			line: 12,
+			ok:   true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			line, column, ok := parseCopyError(c.err)
+			if line != c.line || column != c.column || ok != c.ok {
+				t.Fatalf("unexpected result: %d %s %t", line, column, ok)
+			}
+		})
+	}
+}
+
+func TestCopyInCSV(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	const in = "id;name\n1;a\nx;b\n3;\"multi\nline\"\n4;NULL\n"
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		_, err = tx.Exec(
+			ctx,
+			`create temp table copy_in_test (
+				id int primary key,
+				name text
+			) on commit drop`,
+		)
+		if err != nil {
+			return
+		}
+
+		opts := CopyInCSVOpts{
+			Header:    true,
+			Delimiter: ';',
+			Null:      "NULL",
+		}
+
+		// Aborts on the first invalid row
+		err = InTransaction(ctx, tx, func(tx pgx.Tx) (err error) {
+			_, err = CopyInCSV(
+				ctx,
+				tx,
+				"copy_in_test",
+				nil,
+				strings.NewReader(in),
+				opts,
+			)
+			return
+		})
+		var rowErr *CopyRowError
+		if !errors.As(err, &rowErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rowErr.Line != 3 || rowErr.Column != "id" {
+			t.Fatalf("unexpected row error: %+v", rowErr)
+		}
+
+		// Skips and reports invalid rows
+		var rejected []*CopyRowError
+		opts.BatchSize = 2
+		opts.OnRowError = func(err *CopyRowError) error {
+			rejected = append(rejected, err)
+			return nil
+		}
+		n, err := CopyInCSV(
+			ctx,
+			tx,
+			"copy_in_test",
+			[]string{"id", "name"},
+			strings.NewReader(in),
+			opts,
+		)
+		if err != nil {
+			return
+		}
+		if n != 3 {
+			t.Fatalf("unexpected row count: %d", n)
+		}
+		if len(rejected) != 1 ||
+			rejected[0].Line != 3 ||
+			rejected[0].Row != "x;b\n" {
+			t.Fatalf("unexpected rejected rows: %+v", rejected)
+		}
+
+		names, err := QueryValues[*string](
+			ctx,
+			tx,
+			`select name from copy_in_test order by id`,
+		)
+		if err != nil {
+			return
+		}
+		if len(names) != 3 || *names[0] != "a" ||
+			*names[1] != "multi\nline" || names[2] != nil {
+			t.Fatalf("unexpected rows: %v", names)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
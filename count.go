@@ -0,0 +1,69 @@
+package pg_util
+
+import (
+	"context"
+	"strings"
+)
+
+// Count rows of table matching the non-zero fields of the cond struct.
+// A nil cond counts all rows.
+//
+// See BuildWhere for condition rules.
+func Count(ctx context.Context, q Querier, table string, cond interface{}) (
+	n int64,
+	err error,
+) {
+	sql, args, err := buildCondQuery("SELECT count(*) FROM ", table, cond, "")
+	if err != nil {
+		return
+	}
+	err = q.QueryRow(ctx, sql, args...).Scan(&n)
+	return
+}
+
+// Returns, if any row of table matches the non-zero fields of the cond
+// struct. A nil cond matches any row.
+//
+// See BuildWhere for condition rules.
+func Exists(ctx context.Context, q Querier, table string, cond interface{}) (
+	exists bool,
+	err error,
+) {
+	sql, args, err := buildCondQuery("SELECT 1 FROM ", table, cond, " LIMIT 1")
+	if err != nil {
+		return
+	}
+	err = q.QueryRow(ctx, "SELECT EXISTS ("+sql+")", args...).Scan(&exists)
+	return
+}
+
+// Build query from head, the quoted table, conditions built from cond and
+// tail
+func buildCondQuery(head, table string, cond interface{}, tail string) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	if table == "" {
+		err = ErrNoTable
+		return
+	}
+
+	var w strings.Builder
+	w.WriteString(head)
+	w.WriteString(quoteIdentifier(table))
+	if cond != nil {
+		var where string
+		where, args, err = BuildWhere(cond, 0)
+		if err != nil {
+			return
+		}
+		if where != "" {
+			w.WriteString(" WHERE ")
+			w.WriteString(where)
+		}
+	}
+	w.WriteString(tail)
+	sql = w.String()
+	return
+}
@@ -0,0 +1,121 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestBuildCondQuery(t *testing.T) {
+	t.Parallel()
+
+	type cond struct {
+		ID   int `db:"id"`
+		Name string
+	}
+
+	cases := [...]struct {
+		name, sql string
+		cond      interface{}
+		args      []interface{}
+	}{
+		{
+			name: "nil",
+			sql:  `SELECT count(*) FROM "t1"`,
+		},
+		{
+			name: "zero",
+			cond: cond{},
+			sql:  `SELECT count(*) FROM "t1"`,
+		},
+		{
+			name: "fields",
+			cond: cond{ID: 1, Name: "a"},
+			sql:  `SELECT count(*) FROM "t1" WHERE "id"=$1 AND Name=$2`,
+			args: []interface{}{1, "a"},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, args, err := buildCondQuery(
+				"SELECT count(*) FROM ",
+				"t1",
+				c.cond,
+				"",
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args,
+					c.args)
+			}
+		})
+	}
+}
+
+func TestCountExists(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(
+				context.Background(),
+				`create temp table count_test (
+					id bigint primary key,
+					name text not null
+				) on commit drop;
+				insert into count_test (id, name)
+				values (1, 'a'), (2, 'a'), (3, 'b')`,
+			)
+			if err != nil {
+				return
+			}
+
+			type cond struct {
+				Name string `db:"name"`
+			}
+			n, err := Count(context.Background(), tx, "count_test", cond{"a"})
+			if err != nil {
+				return
+			}
+			if n != 2 {
+				t.Fatalf("count mismatch: %d != 2", n)
+			}
+
+			exists, err := Exists(
+				context.Background(),
+				tx,
+				"count_test",
+				cond{"c"},
+			)
+			if err != nil {
+				return
+			}
+			if exists {
+				t.Fatal("row should not exist")
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
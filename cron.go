@@ -0,0 +1,180 @@
+package pg_util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximum span searched for the next activation of a cron expression
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Determines activation times of a periodic task
+type Schedule interface {
+	// Return the first activation time strictly after t or zero time, if
+	// there is none
+	Next(t time.Time) time.Time
+}
+
+// Schedule activating at multiples of an interval
+type interval time.Duration
+
+// Return a Schedule activating every d. Activations are aligned to multiples
+// of d since the zero time, so all replicas agree on them.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+func (i interval) Next(t time.Time) time.Time {
+	if i <= 0 {
+		return time.Time{}
+	}
+	return t.Truncate(time.Duration(i)).Add(time.Duration(i))
+}
+
+// Parsed cron expression
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// Day of month or week fields are unrestricted
+	domStar, dowStar bool
+}
+
+// Parse a standard 5 field cron expression of minute, hour, day of month,
+// month and day of week. Fields support *, lists, ranges and steps, like
+// "*/15 9-17 * * 1-5". Sunday is either 0 or 7. If both day of month and day
+// of week are restricted, either of them matching is sufficient.
+//
+// The descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly are also supported.
+//
+// Activation times are calculated in the location of the time passed to Next.
+func ParseCron(expr string) (Schedule, error) {
+	switch strings.TrimSpace(expr) {
+	case "@yearly", "@annually":
+		expr = "0 0 1 1 *"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@daily", "@midnight":
+		expr = "0 0 * * *"
+	case "@hourly":
+		expr = "0 * * * *"
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf(
+			"pg_util: cron expression %q must have 5 fields",
+			expr,
+		)
+	}
+
+	var (
+		s    cronSchedule
+		err  error
+		dest = [...]*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+		min  = [...]int{0, 0, 1, 1, 0}
+		max  = [...]int{59, 23, 31, 12, 7}
+	)
+	for i, f := range fields {
+		*dest[i], err = parseCronField(f, min[i], max[i])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"pg_util: cron expression %q: %w",
+				expr, err,
+			)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// Parse a single comma-separated cron field into a bit set of values
+func parseCronField(field string, min, max int) (set uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				err = fmt.Errorf("invalid step in %q", part)
+				return
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			lo, err = strconv.Atoi(loStr)
+			if err != nil {
+				err = fmt.Errorf("invalid value in %q", part)
+				return
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiStr)
+				if err != nil {
+					err = fmt.Errorf("invalid value in %q", part)
+					return
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			err = fmt.Errorf("%q out of range %d-%d", part, min, max)
+			return
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0,
+				t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0,
+				t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Report, if the day of t matches the day of month and day of week fields
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dow
+	case s.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
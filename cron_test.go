@@ -0,0 +1,129 @@
+package pg_util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	t.Parallel()
+
+	// Friday
+	from := time.Date(2021, 1, 1, 10, 30, 15, 0, time.UTC)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2021, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	cases := [...]struct {
+		name, expr string
+		next       time.Time
+	}{
+		{
+			name: "every minute",
+			expr: "* * * * *",
+			next: at(1, 1, 10, 31),
+		},
+		{
+			name: "step",
+			expr: "*/15 * * * *",
+			next: at(1, 1, 10, 45),
+		},
+		{
+			name: "list and range",
+			expr: "0 9-10,14 * * *",
+			next: at(1, 1, 14, 0),
+		},
+		{
+			name: "next day",
+			expr: "0 9 * * *",
+			next: at(1, 2, 9, 0),
+		},
+		{
+			name: "weekday",
+			expr: "0 9 * * 1-5",
+			next: at(1, 4, 9, 0),
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			next: at(1, 3, 0, 0),
+		},
+		{
+			name: "day of month or week",
+			expr: "0 0 15 * 0",
+			next: at(1, 3, 0, 0),
+		},
+		{
+			name: "month",
+			expr: "0 0 1 3 *",
+			next: at(3, 1, 0, 0),
+		},
+		{
+			name: "descriptor",
+			expr: "@monthly",
+			next: at(2, 1, 0, 0),
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			next: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "never",
+			expr: "0 0 31 2 *",
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := ParseCron(c.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := s.Next(from)
+			if !next.Equal(c.next) {
+				t.Fatalf("next mismatch: %s != %s", next, c.next)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, expr string
+	}{
+		{"too few fields", "* * * *"},
+		{"out of range", "60 * * * *"},
+		{"inverted range", "0 5-1 * * *"},
+		{"invalid step", "*/0 * * * *"},
+		{"not a number", "a * * * *"},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseCron(c.expr)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestEvery(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2021, 1, 1, 10, 31, 15, 0, time.UTC)
+	next := Every(5 * time.Minute).Next(from)
+	std := time.Date(2021, 1, 1, 10, 35, 0, 0, time.UTC)
+	if !next.Equal(std) {
+		t.Fatalf("next mismatch: %s != %s", next, std)
+	}
+}
@@ -0,0 +1,70 @@
+package pg_util
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Common table expression to prepend to a statement as part of a WITH clause
+type CTE struct {
+	// Name of the CTE. Quoted as an identifier.
+	Name string
+
+	// Query of the CTE. Placeholders start from $1 and are renumbered
+	// automatically, when composing multiple fragments.
+	SQL string
+
+	// Arguments to SQL
+	Args []interface{}
+}
+
+// Write WITH clause for ctes, if any, followed by a space.
+// Placeholders are shifted to start from $offset+1.
+// Returns the combined arguments of all ctes.
+func writeCTEs(w *strings.Builder, ctes []CTE, offset int) (
+	args []interface{},
+) {
+	if len(ctes) == 0 {
+		return
+	}
+
+	w.WriteString("WITH ")
+	for i, c := range ctes {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(quoteName(c.Name))
+		w.WriteString(" AS (")
+		w.WriteString(shiftPlaceholders(c.SQL, offset+len(args)))
+		w.WriteByte(')')
+		args = append(args, c.Args...)
+	}
+	w.WriteByte(' ')
+	return
+}
+
+// Return combined arguments of all ctes
+func cteArgs(ctes []CTE) (args []interface{}) {
+	for _, c := range ctes {
+		args = append(args, c.Args...)
+	}
+	return
+}
+
+// Build statement cache key from ctes
+func ctesCacheKey(ctes []CTE) string {
+	if len(ctes) == 0 {
+		return ""
+	}
+
+	var w strings.Builder
+	for _, c := range ctes {
+		w.WriteString(c.Name)
+		w.WriteByte(0)
+		w.WriteString(c.SQL)
+		w.WriteByte(0)
+		w.WriteString(strconv.Itoa(len(c.Args)))
+		w.WriteByte(0)
+	}
+	return w.String()
+}
@@ -0,0 +1,178 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCTEs(t *testing.T) {
+	t.Parallel()
+
+	ctes := []CTE{
+		{
+			Name: "a",
+			SQL:  `SELECT $1::int AS v`,
+			Args: []interface{}{1},
+		},
+		{
+			Name: "b",
+			SQL:  `SELECT $1::text AS w, $2::text AS x`,
+			Args: []interface{}{"b", "c"},
+		},
+	}
+
+	type row struct {
+		ID   int `db:"id,pk"`
+		Name string
+	}
+
+	cases := [...]struct {
+		name, sql string
+		build     func() (string, []interface{}, error)
+		args      []interface{}
+	}{
+		{
+			name: "insert",
+			build: func() (string, []interface{}, error) {
+				sql, args := BuildInsert(InsertOpts{
+					Table: "t5",
+					Data:  row{1, "aaa"},
+					CTEs:  ctes,
+				})
+				return sql, args, nil
+			},
+			sql: `WITH "a" AS (SELECT $1::int AS v),` +
+				`"b" AS (SELECT $2::text AS w, $3::text AS x) ` +
+				`INSERT INTO "t5" ("id",Name) VALUES ($4,$5)`,
+			args: []interface{}{1, "b", "c", 1, "aaa"},
+		},
+		{
+			name: "update",
+			build: func() (string, []interface{}, error) {
+				return BuildUpdateByPK(ByPKOpts{
+					Table: "t5",
+					Data:  row{1, "aaa"},
+					CTEs:  ctes,
+				})
+			},
+			sql: `WITH "a" AS (SELECT $1::int AS v),` +
+				`"b" AS (SELECT $2::text AS w, $3::text AS x) ` +
+				`UPDATE "t5" SET Name=$4 WHERE "id"=$5`,
+			args: []interface{}{1, "b", "c", "aaa", 1},
+		},
+		{
+			name: "insert select",
+			build: func() (string, []interface{}, error) {
+				return BuildInsertSelect(InsertSelectOpts{
+					Table:   "t5",
+					Columns: row{},
+					Select:  `SELECT v, w FROM a, b WHERE x = $1`,
+					Args:    []interface{}{"d"},
+					CTEs:    ctes,
+				})
+			},
+			sql: `WITH "a" AS (SELECT $1::int AS v),` +
+				`"b" AS (SELECT $2::text AS w, $3::text AS x) ` +
+				`INSERT INTO "t5" ("id",Name) SELECT v, w FROM a, b WHERE x = $4`,
+			args: []interface{}{1, "b", "c", "d"},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			q, args, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", q, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, c.args)
+			}
+		})
+	}
+}
+
+func TestArgOffset(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID   int `db:"id,pk"`
+		Name string
+	}
+	ctes := []CTE{{Name: "a", SQL: "SELECT $1::int", Args: []interface{}{0}}}
+
+	cases := [...]struct {
+		name, sql string
+		build     func() (string, []interface{}, error)
+	}{
+		{
+			name: "insert",
+			build: func() (string, []interface{}, error) {
+				return BuildInsertT(InsertOptsT[row]{
+					Table:     "t7",
+					Data:      row{1, "aaa"},
+					CTEs:      ctes,
+					ArgOffset: 2,
+				})
+			},
+			sql: `WITH "a" AS (SELECT $3::int) ` +
+				`INSERT INTO "t7" ("id",Name) VALUES ($4,$5)`,
+		},
+		{
+			name: "update",
+			build: func() (string, []interface{}, error) {
+				return BuildUpdateByPK(ByPKOpts{
+					Table:     "t7",
+					Data:      row{1, "aaa"},
+					CTEs:      ctes,
+					ArgOffset: 2,
+				})
+			},
+			sql: `WITH "a" AS (SELECT $3::int) ` +
+				`UPDATE "t7" SET Name=$4 WHERE "id"=$5`,
+		},
+		{
+			name: "delete",
+			build: func() (string, []interface{}, error) {
+				return BuildDeleteByPK(ByPKOpts{
+					Table:     "t7",
+					Data:      row{1, "aaa"},
+					ArgOffset: 2,
+				})
+			},
+			sql: `DELETE FROM "t7" WHERE "id"=$3`,
+		},
+		{
+			name: "select",
+			build: func() (string, []interface{}, error) {
+				return BuildSelect(SelectOpts{
+					Table:     "t7",
+					Columns:   row{},
+					Where:     `"id" = $1`,
+					ArgOffset: 2,
+				})
+			},
+			sql: `SELECT "id",Name FROM "t7" WHERE ("id" = $3)`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			q, _, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", q, c.sql)
+			}
+		})
+	}
+}
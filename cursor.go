@@ -0,0 +1,130 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Default number of rows fetched per batch by Cursor
+const DefaultCursorBatchSize = 1000
+
+// Counter for generating unique cursor names
+var cursorCounter uint64
+
+// Declare a server-side cursor for query sql in tx and fetch its rows in
+// batches of batchSize, calling fn for each row. Allows processing large
+// result sets with bounded memory. If batchSize is not positive,
+// DefaultCursorBatchSize is used.
+//
+// fn must scan the current row and must not advance or close rows. Iteration
+// stops at the first error returned by fn.
+func Cursor(
+	ctx context.Context,
+	tx pgx.Tx,
+	sql string,
+	args []interface{},
+	batchSize int,
+	fn func(pgx.Rows) error,
+) (err error) {
+	if batchSize <= 0 {
+		batchSize = DefaultCursorBatchSize
+	}
+
+	name := "pg_util_cursor_" + strconv.FormatUint(
+		atomic.AddUint64(&cursorCounter, 1),
+		10,
+	)
+	_, err = tx.Exec(ctx, "DECLARE "+name+" NO SCROLL CURSOR FOR "+sql,
+		args...)
+	if err != nil {
+		return
+	}
+
+	fetch := "FETCH FORWARD " + strconv.Itoa(batchSize) + " FROM " + name
+	for {
+		var n int
+		n, err = fetchBatch(ctx, tx, fetch, fn)
+		if err != nil {
+			return
+		}
+		if n < batchSize {
+			break
+		}
+	}
+
+	_, err = tx.Exec(ctx, "CLOSE "+name)
+	return
+}
+
+// Fetch a batch of rows from a cursor with the FETCH statement sql and call
+// fn for each. Returns the number of fetched rows.
+func fetchBatch(
+	ctx context.Context,
+	tx pgx.Tx,
+	sql string,
+	fn func(pgx.Rows) error,
+) (n int, err error) {
+	rows, err := tx.Query(ctx, sql)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n++
+		if err = fn(rows); err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// Like Cursor, but scans each row into a struct of type T passed to fn.
+//
+// See SelectStructs for column mapping rules.
+func ForEachRow[T any](
+	ctx context.Context,
+	tx pgx.Tx,
+	sql string,
+	args []interface{},
+	batchSize int,
+	fn func(T) error,
+) (err error) {
+	meta, err := getStructMeta(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return
+	}
+
+	var (
+		indices [][]int
+		targets []interface{}
+	)
+	return Cursor(
+		ctx,
+		tx,
+		sql,
+		args,
+		batchSize,
+		func(rows pgx.Rows) (err error) {
+			if indices == nil {
+				indices, err = resultIndices(meta, rows.FieldDescriptions())
+				if err != nil {
+					return
+				}
+				targets = make([]interface{}, len(indices))
+			}
+			var row T
+			err = scanStruct(rows, reflect.ValueOf(&row).Elem(), indices,
+				targets)
+			if err != nil {
+				return
+			}
+			return fn(row)
+		},
+	)
+}
@@ -0,0 +1,135 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestCursor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	errStop := errors.New("stop")
+	cases := [...]struct {
+		name            string
+		rows, batchSize int
+		stopAt          int
+	}{
+		{
+			name:      "empty",
+			batchSize: 10,
+		},
+		{
+			name:      "partial batch",
+			rows:      25,
+			batchSize: 10,
+		},
+		{
+			name:      "full batches",
+			rows:      30,
+			batchSize: 10,
+		},
+		{
+			name: "default batch size",
+			rows: DefaultCursorBatchSize + 1,
+		},
+		{
+			name:      "stopped",
+			rows:      30,
+			batchSize: 10,
+			stopAt:    15,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			err := InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+				var sum, n int
+				err = Cursor(
+					ctx,
+					tx,
+					"select generate_series(1, $1)",
+					[]interface{}{c.rows},
+					c.batchSize,
+					func(rows pgx.Rows) (err error) {
+						var i int
+						if err = rows.Scan(&i); err != nil {
+							return
+						}
+						n++
+						sum += i
+						if n == c.stopAt {
+							return errStop
+						}
+						return
+					},
+				)
+				if c.stopAt != 0 {
+					if err != errStop {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if n != c.stopAt {
+						t.Fatalf("row count mismatch: %d != %d", n, c.stopAt)
+					}
+					return nil
+				}
+				if err != nil {
+					return
+				}
+				if n != c.rows || sum != c.rows*(c.rows+1)/2 {
+					t.Fatalf("unexpected rows: count=%d sum=%d", n, sum)
+				}
+				return
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestForEachRow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	type row struct {
+		ID   int
+		Name string
+	}
+	var rows []row
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) error {
+		return ForEachRow(
+			ctx,
+			tx,
+			"select i as id, 'n' || i as name from generate_series(1, 5) i",
+			nil,
+			2,
+			func(r row) error {
+				rows = append(rows, r)
+				return nil
+			},
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || rows[4] != (row{5, "n5"}) {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+}
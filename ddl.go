@@ -0,0 +1,249 @@
+package pg_util
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Options for building a CREATE TABLE statement
+type CreateTableOpts struct {
+	// Table to create. Required.
+	Table string
+
+	// Struct, pointer to struct or reflect.Type of either, that defines the
+	// columns of the table. Columns are mapped the same way as by
+	// InsertOpts.Data.
+	//
+	// Column types are inferred from the Go field types or the ",cast=" tag
+	// option. Override them with ",type=" after the name.
+	// Example: `db:"price,type=numeric(10,2)"`
+	// uint, uint64 and uintptr are mapped to numeric(20), as they exceed the
+	// range of bigint.
+	//
+	// Columns of types, that can not hold nil, like int or string, are NOT
+	// NULL, unless tagged with ",nullzero". Pointers, slices, maps and
+	// sql.Null* types are nullable, unless tagged with ",notnull".
+	//
+	// Further constraint tag options:
+	//	pk            Part of the primary key
+	//	generated     Identity column for integer types without a default
+	//	unique        UNIQUE constraint
+	//	default=expr  DEFAULT expression
+	//	references=t  REFERENCES constraint, like "users(id)"
+	//	check=expr    CHECK constraint
+	//
+	// Commas in option values must be inside parentheses.
+	Data interface{}
+
+	// Do not return an error, if the table already exists
+	IfNotExists bool
+
+	// Create a temporary table
+	Temporary bool
+
+	// Raw partitioning clause of a partitioned table.
+	// Example: "RANGE (created_at)"
+	PartitionBy string
+}
+
+// Build CREATE TABLE statement with column definitions derived from a
+// struct. Useful for tests, prototypes and keeping tables consistent with Go
+// models.
+//
+// See CreateTableOpts for column mapping rules.
+func BuildCreateTable(o CreateTableOpts) (sql string, err error) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildCreateTable", start, sql, 0, false)
+	}()
+
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	cols, err := Columns(o.Data)
+	if err != nil {
+		return
+	}
+
+	var w strings.Builder
+	w.WriteString("CREATE ")
+	if o.Temporary {
+		w.WriteString("TEMPORARY ")
+	}
+	w.WriteString("TABLE ")
+	if o.IfNotExists {
+		w.WriteString("IF NOT EXISTS ")
+	}
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(" (")
+
+	var pk []string
+	for i := range cols {
+		c := &cols[i]
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString("\n\t")
+		writeColumnDefinition(&w, c)
+		if c.HasOption("pk") {
+			pk = append(pk, c.SQLName())
+		}
+	}
+	if len(pk) != 0 {
+		w.WriteString(",\n\tPRIMARY KEY (")
+		w.WriteString(strings.Join(pk, ", "))
+		w.WriteByte(')')
+	}
+	w.WriteString("\n)")
+	if o.PartitionBy != "" {
+		w.WriteString(" PARTITION BY ")
+		w.WriteString(o.PartitionBy)
+	}
+	sql = w.String()
+	return
+}
+
+// Write definition of column c
+func writeColumnDefinition(w *strings.Builder, c *Column) {
+	typ, notNull := columnType(c)
+	w.WriteString(c.SQLName())
+	w.WriteByte(' ')
+	w.WriteString(typ)
+
+	def, hasDefault := c.Option("default")
+	if c.HasOption("generated") && !hasDefault && isIntegerType(typ) {
+		w.WriteString(" GENERATED BY DEFAULT AS IDENTITY")
+	}
+	if notNull {
+		w.WriteString(" NOT NULL")
+	}
+	if hasDefault {
+		w.WriteString(" DEFAULT ")
+		w.WriteString(def)
+	}
+	if c.HasOption("unique") {
+		w.WriteString(" UNIQUE")
+	}
+	if ref, ok := c.Option("references"); ok {
+		w.WriteString(" REFERENCES ")
+		w.WriteString(ref)
+	}
+	if check, ok := c.Option("check"); ok {
+		w.WriteString(" CHECK (")
+		w.WriteString(check)
+		w.WriteByte(')')
+	}
+}
+
+// Report, if typ is an integer SQL type
+func isIntegerType(typ string) bool {
+	switch typ {
+	case "smallint", "integer", "bigint":
+		return true
+	}
+	return false
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+	// SQL types of sql.Null* types
+	nullTypes = map[reflect.Type]string{
+		reflect.TypeOf(sql.NullBool{}):    "boolean",
+		reflect.TypeOf(sql.NullByte{}):    "smallint",
+		reflect.TypeOf(sql.NullInt16{}):   "smallint",
+		reflect.TypeOf(sql.NullInt32{}):   "integer",
+		reflect.TypeOf(sql.NullInt64{}):   "bigint",
+		reflect.TypeOf(sql.NullFloat64{}): "double precision",
+		reflect.TypeOf(sql.NullString{}):  "text",
+		reflect.TypeOf(sql.NullTime{}):    "timestamptz",
+	}
+)
+
+// Return the SQL type of column c and, if it is NOT NULL
+func columnType(c *Column) (typ string, notNull bool) {
+	t := c.Type
+	notNull = c.HasOption("notnull") || c.HasOption("pk")
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+	default:
+		if _, ok := nullTypes[t]; !ok && !c.HasOption("nullzero") {
+			notNull = true
+		}
+	}
+
+	if typ, ok := c.Option("type"); ok {
+		return typ, notNull
+	}
+	// The value is cast to this type on insertion anyway
+	if typ, ok := c.Option("cast"); ok {
+		return typ, notNull
+	}
+	if c.HasOption("string") {
+		return "text", notNull
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return goSQLType(t), notNull
+}
+
+// Infer SQL type from Go type t
+func goSQLType(t reflect.Type) string {
+	if typ, ok := nullTypes[t]; ok {
+		return typ
+	}
+	switch t {
+	case timeType:
+		return "timestamptz"
+	case durationType:
+		return "bigint"
+	case rawMessageType:
+		return "jsonb"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "smallint"
+	case reflect.Int32, reflect.Uint16:
+		return "integer"
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "bigint"
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		// Exceed the range of bigint
+		return "numeric(20)"
+	case reflect.Float32:
+		return "real"
+	case reflect.Float64:
+		return "double precision"
+	case reflect.String:
+		return "text"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytea"
+		}
+		e := t.Elem()
+		for e.Kind() == reflect.Ptr {
+			e = e.Elem()
+		}
+		switch typ := goSQLType(e); {
+		case typ == "jsonb":
+			return typ
+		case strings.HasSuffix(typ, "[]"):
+			// Postgres arrays are multidimensional without a distinct type
+			return typ
+		default:
+			return typ + "[]"
+		}
+	default:
+		return "jsonb"
+	}
+}
@@ -0,0 +1,140 @@
+package pg_util
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type createTableTest struct {
+	ID        int64  `db:"id,pk,generated"`
+	Name      string `db:"name,unique"`
+	Email     *string
+	Price     float64        `db:"price,type=numeric(10,2),check=price >= 0"`
+	Tags      []string       `db:"tags,notnull,default='{}'"`
+	Meta      map[string]int `db:"meta"`
+	Note      sql.NullString `db:"note"`
+	Parent    int64          `db:"parent,nullzero,references=create_table_test(id)"`
+	CreatedAt time.Time      `db:"created_at,default=now()"`
+	Ignored   bool           `db:"-"`
+}
+
+func TestBuildCreateTable(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		opts CreateTableOpts
+		std  string
+		err  error
+	}{
+		{
+			name: "full",
+			opts: CreateTableOpts{
+				Table:       "create_table_test",
+				Data:        createTableTest{},
+				IfNotExists: true,
+			},
+			std: `CREATE TABLE IF NOT EXISTS "create_table_test" (
+	"id" bigint GENERATED BY DEFAULT AS IDENTITY NOT NULL,
+	"name" text NOT NULL UNIQUE,
+	Email text,
+	"price" numeric(10,2) NOT NULL CHECK (price >= 0),
+	"tags" text[] NOT NULL DEFAULT '{}',
+	"meta" jsonb,
+	"note" text,
+	"parent" bigint REFERENCES create_table_test(id),
+	"created_at" timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY ("id")
+)`,
+		},
+		{
+			name: "temporary partitioned",
+			opts: CreateTableOpts{
+				Table: "events",
+				Data: &struct {
+					At    time.Time `db:"at,pk"`
+					Kind  int16     `db:"kind,pk"`
+					Bytes []byte    `db:"bytes"`
+				}{},
+				Temporary:   true,
+				PartitionBy: "RANGE (at)",
+			},
+			std: `CREATE TEMPORARY TABLE "events" (
+	"at" timestamptz NOT NULL,
+	"kind" smallint NOT NULL,
+	"bytes" bytea,
+	PRIMARY KEY ("at", "kind")
+) PARTITION BY RANGE (at)`,
+		},
+		{
+			name: "cast and unsigned",
+			opts: CreateTableOpts{
+				Table: "hosts",
+				Data: struct {
+					IP    string `db:"ip,cast=inet"`
+					Price string `db:"price,cast=numeric(10,2),nullzero"`
+					Small uint32 `db:"small"`
+					Big   uint64 `db:"big"`
+					Ptr   uintptr
+				}{},
+			},
+			std: `CREATE TABLE "hosts" (
+	"ip" inet NOT NULL,
+	"price" numeric(10,2),
+	"small" bigint NOT NULL,
+	"big" numeric(20) NOT NULL,
+	Ptr numeric(20) NOT NULL
+)`,
+		},
+		{
+			name: "no table",
+			opts: CreateTableOpts{
+				Data: createTableTest{},
+			},
+			err: ErrNoTable,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, err := BuildCreateTable(c.opts)
+			if err != c.err {
+				t.Fatalf("error mismatch: %v != %v", err, c.err)
+			}
+			if sql != c.std {
+				t.Fatalf("SQL mismatch:\n%s\n!=\n%s", sql, c.std)
+			}
+		})
+	}
+}
+
+func TestCreateTableExec(t *testing.T) {
+	t.Parallel()
+
+	sql, err := BuildCreateTable(CreateTableOpts{
+		Table:     "create_table_test",
+		Data:      createTableTest{},
+		Temporary: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(context.Background(), sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
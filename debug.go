@@ -0,0 +1,154 @@
+package pg_util
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Render sql with all $N placeholders replaced by args formatted as SQL
+// literals. Placeholders without a corresponding argument are left intact.
+//
+// Only intended for logging and pasting statements into psql or EXPLAIN.
+// Always use parameterized execution to run statements.
+func DebugSQL(sql string, args []interface{}) string {
+	return replacePlaceholders(sql, func(w *strings.Builder, n uint64) {
+		if n == 0 || n > uint64(len(args)) {
+			w.WriteByte('$')
+			w.WriteString(strconv.FormatUint(n, 10))
+			return
+		}
+		writeLiteral(w, args[n-1])
+	})
+}
+
+// Write v formatted as an SQL literal
+func writeLiteral(w *strings.Builder, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("NULL")
+		return
+	case string:
+		writeQuotedString(w, v)
+		return
+	case []byte:
+		if v == nil {
+			w.WriteString("NULL")
+			return
+		}
+		w.WriteString(`'\x`)
+		w.WriteString(hex.EncodeToString(v))
+		w.WriteString(`'::bytea`)
+		return
+	case bool:
+		if v {
+			w.WriteString("TRUE")
+		} else {
+			w.WriteString("FALSE")
+		}
+		return
+	case time.Time:
+		writeQuotedString(w, v.Format(time.RFC3339Nano))
+		w.WriteString("::timestamptz")
+		return
+	case driver.Valuer:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			w.WriteString("NULL")
+			return
+		}
+		val, err := v.Value()
+		if err != nil {
+			writeQuotedString(w, fmt.Sprint(v))
+			return
+		}
+		writeLiteral(w, val)
+		return
+	case fmt.Stringer:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			w.WriteString("NULL")
+			return
+		}
+		writeQuotedString(w, v.String())
+		return
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			w.WriteString("NULL")
+		} else {
+			writeLiteral(w, rv.Elem().Interface())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		i := rv.Int()
+		if i < 0 {
+			// Parenthesize, so operators like - before the placeholder do
+			// not merge into a -- comment
+			w.WriteByte('(')
+			w.WriteString(strconv.FormatInt(i, 10))
+			w.WriteByte(')')
+		} else {
+			w.WriteString(strconv.FormatInt(i, 10))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		w.WriteString(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		switch {
+		case math.IsNaN(f):
+			w.WriteString("'NaN'::float8")
+		case math.IsInf(f, 1):
+			w.WriteString("'Infinity'::float8")
+		case math.IsInf(f, -1):
+			w.WriteString("'-Infinity'::float8")
+		case math.Signbit(f):
+			w.WriteByte('(')
+			w.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+			w.WriteByte(')')
+		default:
+			w.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case reflect.String:
+		writeQuotedString(w, rv.String())
+	case reflect.Bool:
+		writeLiteral(w, rv.Bool())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			w.WriteString("NULL")
+			return
+		}
+		if rv.Len() == 0 {
+			// ARRAY[] can not infer its type
+			w.WriteString("'{}'::")
+			w.WriteString(goSQLType(rv.Type()))
+			return
+		}
+		w.WriteString("ARRAY[")
+		for i := 0; i < rv.Len(); i++ {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			writeLiteral(w, rv.Index(i).Interface())
+		}
+		w.WriteByte(']')
+	default:
+		writeQuotedString(w, fmt.Sprint(v))
+	}
+}
+
+// Write s as a single-quoted SQL string literal
+func writeQuotedString(w *strings.Builder, s string) {
+	w.WriteByte('\'')
+	w.WriteString(strings.ReplaceAll(s, "'", "''"))
+	w.WriteByte('\'')
+}
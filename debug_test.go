@@ -0,0 +1,93 @@
+package pg_util
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDebugSQL(t *testing.T) {
+	t.Parallel()
+
+	var (
+		nilInt *int
+		one    = 1
+	)
+
+	cases := [...]struct {
+		name, sql, std string
+		args           []interface{}
+	}{
+		{
+			name: "scalars",
+			sql:  `select $1, $2, $3, $4, $5`,
+			args: []interface{}{1, 1.5, true, "it's", nil},
+			std:  `select 1, 1.5, TRUE, 'it''s', NULL`,
+		},
+		{
+			name: "negative numbers",
+			sql:  `SELECT 1-$1, 1-$2`,
+			args: []interface{}{-5, -1.5},
+			std:  `SELECT 1-(-5), 1-(-1.5)`,
+		},
+		{
+			name: "pointers",
+			sql:  `select $1, $2`,
+			args: []interface{}{nilInt, &one},
+			std:  `select NULL, 1`,
+		},
+		{
+			name: "bytes and arrays",
+			sql:  `select $1, $2`,
+			args: []interface{}{[]byte{0xde, 0xad}, []int{1, 2}},
+			std:  `select '\xdead'::bytea, ARRAY[1,2]`,
+		},
+		{
+			name: "special floats and empty arrays",
+			sql:  `select $1, $2, $3, $4, $5`,
+			args: []interface{}{
+				math.NaN(),
+				math.Inf(1),
+				float32(math.Inf(-1)),
+				[]string{},
+				[0]int64{},
+			},
+			std: `select 'NaN'::float8, 'Infinity'::float8, ` +
+				`'-Infinity'::float8, '{}'::text[], '{}'::bigint[]`,
+		},
+		{
+			name: "time",
+			sql:  `select $1`,
+			args: []interface{}{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+			std:  `select '2020-01-02T03:04:05Z'::timestamptz`,
+		},
+		{
+			name: "driver valuer",
+			sql:  `select $1, $2`,
+			args: []interface{}{
+				sql.NullString{String: "a", Valid: true},
+				sql.NullInt64{},
+			},
+			std: `select 'a', NULL`,
+		},
+		{
+			name: "missing argument and literals",
+			sql:  `select '$1', $1, $2`,
+			args: []interface{}{1},
+			std:  `select '$1', 1, $2`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res := DebugSQL(c.sql, c.args)
+			if res != c.std {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", res, c.std)
+			}
+		})
+	}
+}
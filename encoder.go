@@ -0,0 +1,77 @@
+package pg_util
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// Set, once any encoder has been registered, to skip lookups otherwise
+	encodersRegistered int32
+
+	// Encoders by tag option name
+	tagEncoders sync.Map
+
+	// Encoders by fieldEncoderKey
+	fieldEncoders sync.Map
+)
+
+// Transforms the value of a struct field into the value passed to the driver.
+// Useful for encrypting columns or producing custom wire formats without
+// wrapping field types.
+type FieldEncoder func(field reflect.Value) (interface{}, error)
+
+// Key for encoders of a specific struct field
+type fieldEncoderKey struct {
+	typ   reflect.Type
+	field string
+}
+
+// Register enc to be used for all struct fields with the tag option
+// ",<option>". Example: `db:"secret,encrypt"`
+//
+// Encoders are applied, when statement arguments are built, after ",nullzero"
+// handling. The encoded value is passed to the driver as is and ",string"
+// conversion is skipped. Pass nil to remove a registered encoder.
+func RegisterTagEncoder(option string, enc FieldEncoder) {
+	storeEncoder(&tagEncoders, option, enc)
+}
+
+// Register enc to be used for the field with Go name field of struct type typ.
+// For fields of embedded structs typ must be the embedded struct type.
+// Field encoders take precedence over tag option encoders.
+//
+// See RegisterTagEncoder for further documentation.
+func RegisterFieldEncoder(typ reflect.Type, field string, enc FieldEncoder) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	storeEncoder(&fieldEncoders, fieldEncoderKey{typ, field}, enc)
+}
+
+func storeEncoder(m *sync.Map, k interface{}, enc FieldEncoder) {
+	if enc == nil {
+		m.Delete(k)
+		return
+	}
+	m.Store(k, enc)
+	atomic.StoreInt32(&encodersRegistered, 1)
+}
+
+// Return encoder registered for column, if any
+func (c *columnMeta) encoder() FieldEncoder {
+	if atomic.LoadInt32(&encodersRegistered) == 0 {
+		return nil
+	}
+	enc, ok := fieldEncoders.Load(fieldEncoderKey{c.owner, c.field})
+	if ok {
+		return enc.(FieldEncoder)
+	}
+	for _, o := range c.options {
+		if enc, ok := tagEncoders.Load(o); ok {
+			return enc.(FieldEncoder)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package pg_util
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type encoderInner struct {
+	F3 string
+}
+
+type encoderRow struct {
+	F1 string `db:"f1,test_reverse"`
+	F2 string `db:"f2,test_reverse,nullzero"`
+	F4 int    `db:"f4,test_fail"`
+	encoderInner
+}
+
+func TestFieldEncoders(t *testing.T) {
+	RegisterTagEncoder("test_reverse", func(v reflect.Value) (
+		interface{},
+		error,
+	) {
+		r := []rune(v.String())
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	})
+	t.Cleanup(func() {
+		RegisterTagEncoder("test_reverse", nil)
+	})
+	RegisterFieldEncoder(
+		reflect.TypeOf(encoderInner{}),
+		"F3",
+		func(v reflect.Value) (interface{}, error) {
+			return strings.ToUpper(v.String()), nil
+		},
+	)
+	t.Cleanup(func() {
+		RegisterFieldEncoder(reflect.TypeOf(encoderInner{}), "F3", nil)
+	})
+
+	_, args, err := BuildUpdateByPK(ByPKOpts{
+		Table: "t1",
+		Data: struct {
+			ID int `db:"id,pk"`
+			encoderRow
+		}{
+			ID:         1,
+			encoderRow: encoderRow{"abc", "", 2, encoderInner{"def"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []interface{}{"cba", nil, 2, "DEF", 1}
+	if !reflect.DeepEqual(args, std) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, std)
+	}
+
+	errFail := errors.New("encoding failed")
+	RegisterTagEncoder("test_fail", func(reflect.Value) (interface{}, error) {
+		return nil, errFail
+	})
+	t.Cleanup(func() {
+		RegisterTagEncoder("test_fail", nil)
+	})
+	_, _, err = BuildInsertT(InsertOptsT[encoderRow]{
+		Table: "t1",
+		Data:  encoderRow{},
+	})
+	if err != errFail {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
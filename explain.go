@@ -0,0 +1,118 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Node of a query plan produced by EXPLAIN (FORMAT JSON). Costs are in the
+// planner's arbitrary units and times in milliseconds.
+type Plan struct {
+	NodeType     string  `json:"Node Type"`
+	RelationName string  `json:"Relation Name"`
+	Alias        string  `json:"Alias"`
+	IndexName    string  `json:"Index Name"`
+	IndexCond    string  `json:"Index Cond"`
+	Filter       string  `json:"Filter"`
+	StartupCost  float64 `json:"Startup Cost"`
+	TotalCost    float64 `json:"Total Cost"`
+	PlanRows     float64 `json:"Plan Rows"`
+	PlanWidth    int     `json:"Plan Width"`
+
+	// Only set by ExplainAnalyze
+	ActualStartupTime float64 `json:"Actual Startup Time"`
+	ActualTotalTime   float64 `json:"Actual Total Time"`
+	ActualRows        float64 `json:"Actual Rows"`
+	ActualLoops       float64 `json:"Actual Loops"`
+
+	// Child nodes
+	Plans []Plan `json:"Plans"`
+}
+
+// Return p and all its descendant nodes in depth first order
+func (p *Plan) Nodes() (nodes []*Plan) {
+	nodes = append(nodes, p)
+	for i := range p.Plans {
+		nodes = append(nodes, p.Plans[i].Nodes()...)
+	}
+	return
+}
+
+// Returns, if any node of the plan scans using index
+func (p *Plan) UsesIndex(index string) bool {
+	for _, n := range p.Nodes() {
+		if n.IndexName == index {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns, if any node of the plan is of type nodeType.
+// Example: "Seq Scan"
+func (p *Plan) HasNode(nodeType string) bool {
+	for _, n := range p.Nodes() {
+		if n.NodeType == nodeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Parsed output of EXPLAIN (FORMAT JSON)
+type ExplainResult struct {
+	// Root node of the plan
+	Plan Plan `json:"Plan"`
+
+	// Only set by ExplainAnalyze
+	PlanningTime  float64 `json:"Planning Time"`
+	ExecutionTime float64 `json:"Execution Time"`
+}
+
+// Return the query plan of sql with args without executing it. Useful for
+// asserting index usage in tests and tooling.
+func Explain(
+	ctx context.Context,
+	q Querier,
+	sql string,
+	args ...interface{},
+) (ExplainResult, error) {
+	return explain(ctx, q, "EXPLAIN (FORMAT JSON) ", sql, args)
+}
+
+// Like Explain, but executes sql and includes actual timings and row counts.
+// Run data-modifying statements in a transaction, that is rolled back
+// afterwards, to avoid their side effects.
+func ExplainAnalyze(
+	ctx context.Context,
+	q Querier,
+	sql string,
+	args ...interface{},
+) (ExplainResult, error) {
+	return explain(ctx, q, "EXPLAIN (ANALYZE, FORMAT JSON) ", sql, args)
+}
+
+func explain(
+	ctx context.Context,
+	q Querier,
+	prefix, sql string,
+	args []interface{},
+) (res ExplainResult, err error) {
+	var buf []byte
+	err = q.QueryRow(ctx, prefix+sql, args...).Scan(&buf)
+	if err != nil {
+		return
+	}
+	var results []ExplainResult
+	err = json.Unmarshal(buf, &results)
+	if err != nil {
+		return
+	}
+	if len(results) == 0 {
+		err = errors.New("pg_util: empty EXPLAIN output")
+		return
+	}
+	res = results[0]
+	return
+}
@@ -0,0 +1,95 @@
+package pg_util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestPlanNodes(t *testing.T) {
+	t.Parallel()
+
+	p := Plan{
+		NodeType: "Nested Loop",
+		Plans: []Plan{
+			{
+				NodeType:  "Index Scan",
+				IndexName: "users_pkey",
+			},
+			{
+				NodeType: "Hash",
+				Plans: []Plan{
+					{
+						NodeType: "Seq Scan",
+					},
+				},
+			},
+		},
+	}
+
+	cases := [...]struct {
+		name               string
+		index, nodeType    string
+		usesIndex, hasNode bool
+	}{
+		{
+			name:      "present",
+			index:     "users_pkey",
+			nodeType:  "Seq Scan",
+			usesIndex: true,
+			hasNode:   true,
+		},
+		{
+			name:     "absent",
+			index:    "users_email_key",
+			nodeType: "Bitmap Heap Scan",
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if p.UsesIndex(c.index) != c.usesIndex {
+				t.Fatalf("index usage mismatch: %t", c.usesIndex)
+			}
+			if p.HasNode(c.nodeType) != c.hasNode {
+				t.Fatalf("node presence mismatch: %t", c.hasNode)
+			}
+		})
+	}
+
+	if n := len(p.Nodes()); n != 4 {
+		t.Fatalf("node count mismatch: %d != 4", n)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	res, err := Explain(ctx, conn, "select * from generate_series(1, $1)", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Plan.NodeType != "Function Scan" {
+		t.Fatalf("unexpected node type: %s", res.Plan.NodeType)
+	}
+
+	res, err = ExplainAnalyze(ctx, conn,
+		"select * from generate_series(1, $1)", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Plan.ActualRows != 10 {
+		t.Fatalf("row count mismatch: %f != 10", res.Plan.ActualRows)
+	}
+}
@@ -0,0 +1,287 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Rows of a table loaded by LoadFixtures
+type Fixture struct {
+	// Table to insert into. May be qualified with a schema, like
+	// "schema.table". Required.
+	Table string
+
+	// Slice of structs or pointers to structs to insert. Required.
+	//
+	// See InsertOpts.Data for column mapping rules. Columns with an ",expr="
+	// tag option and generated columns are skipped, so rows referencing each
+	// other must set their keys explicitly.
+	Rows interface{}
+
+	// Tables, whose fixtures must be loaded before this one, in addition to
+	// the tables referenced through ",references=" tag options
+	DependsOn []string
+}
+
+// Decode fixture rows for table from data containing an array of objects
+// keyed by column names. Columns are mapped to the fields of T the same way
+// as by the statement builders. Objects with keys not mapped to any column
+// are an error.
+//
+// Column values are converted to the field types through their JSON
+// encoding. unmarshal decodes data and defaults to json.Unmarshal. Pass
+// another decoder, like yaml.Unmarshal, to load fixtures in other formats.
+func DecodeFixture[T any](
+	table string,
+	data []byte,
+	unmarshal func(data []byte, v interface{}) error,
+) (f Fixture, err error) {
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	meta, err := getStructMeta(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return
+	}
+
+	var objects []map[string]interface{}
+	err = unmarshal(data, &objects)
+	if err != nil {
+		return
+	}
+	rows := make([]T, len(objects))
+	for i, obj := range objects {
+		v := reflect.ValueOf(&rows[i]).Elem()
+		for k, val := range obj {
+			c, ok := meta.lookup(k)
+			if !ok {
+				err = fmt.Errorf(
+					"pg_util: fixture %s row %d: unknown column %s",
+					table, i, k,
+				)
+				return
+			}
+
+			var buf []byte
+			buf, err = json.Marshal(stringKeys(val))
+			if err != nil {
+				return
+			}
+			err = json.Unmarshal(
+				buf,
+				v.FieldByIndex(c.index).Addr().Interface(),
+			)
+			if err != nil {
+				err = fmt.Errorf(
+					"pg_util: fixture %s row %d column %s: %w",
+					table, i, k, err,
+				)
+				return
+			}
+		}
+	}
+
+	f = Fixture{
+		Table: table,
+		Rows:  rows,
+	}
+	return
+}
+
+// Recursively convert maps with interface{} keys, as produced by some YAML
+// decoders, to maps with string keys, so they can be encoded as JSON
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = stringKeys(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = stringKeys(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Insert rows of fixtures with COPY in dependency order, so rows referenced
+// by foreign keys are inserted first. Dependencies are derived from
+// ",references=" tag options of the row structs and Fixture.DependsOn.
+// Dependencies on tables without fixtures and on the table itself are ignored.
+// Otherwise fixtures are loaded in the order they are passed in.
+//
+// Sequences of serial and identity primary key columns, tagged with ",pk", are
+// advanced past the largest loaded key, so rows inserted later do not collide
+// with the fixtures.
+//
+// Returns the total number of inserted rows. Run in a transaction, so a
+// failing fixture does not leave the database partially seeded.
+func LoadFixtures(ctx context.Context, tx pgx.Tx, fixtures ...Fixture) (
+	n int64,
+	err error,
+) {
+	order, err := fixtureOrder(fixtures)
+	if err != nil {
+		return
+	}
+	for _, i := range order {
+		f := &fixtures[i]
+		var src *structCopySource
+		src, err = newStructCopySource(f.Rows)
+		if err != nil {
+			return
+		}
+		if src.Len() == 0 {
+			continue
+		}
+
+		table := pgx.Identifier(strings.Split(f.Table, "."))
+		var copied int64
+		copied, err = tx.CopyFrom(ctx, table, src.columnNames(false), src)
+		n += copied
+		if err == nil {
+			err = syncFixtureSequences(ctx, tx, table, src.meta)
+		}
+		if err != nil {
+			err = fmt.Errorf("pg_util: loading fixture %s: %w", f.Table, err)
+			return
+		}
+	}
+	return
+}
+
+// Set the sequences of serial and identity primary key columns of table to
+// the largest key in the table
+func syncFixtureSequences(
+	ctx context.Context,
+	tx pgx.Tx,
+	table pgx.Identifier,
+	meta *structMeta,
+) (err error) {
+	quoted := table.Sanitize()
+	for i := range meta.columns {
+		c := &meta.columns[i]
+		if !c.pk || c.expr != "" {
+			continue
+		}
+
+		// Returns NULL without changing anything, if the column has no
+		// sequence
+		name := c.identifier(false)
+		_, err = tx.Exec(
+			ctx,
+			`SELECT setval(pg_get_serial_sequence($1, $2), max(`+
+				quoteName(name)+`))
+			FROM `+quoted,
+			quoted,
+			name,
+		)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Return indices of fixtures sorted in dependency order
+func fixtureOrder(fixtures []Fixture) (order []int, err error) {
+	byTable := make(map[string][]int, len(fixtures))
+	for i, f := range fixtures {
+		if f.Table == "" {
+			return nil, ErrNoTable
+		}
+		byTable[f.Table] = append(byTable[f.Table], i)
+	}
+
+	deps := make([][]int, len(fixtures))
+	for i, f := range fixtures {
+		var tables []string
+		tables, err = fixtureDependencies(f)
+		if err != nil {
+			return
+		}
+		for _, t := range tables {
+			if t != f.Table {
+				deps[i] = append(deps[i], byTable[t]...)
+			}
+		}
+	}
+
+	// Depth first search preserving the passed order among independent
+	// fixtures
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(fixtures))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf(
+				"pg_util: fixture dependency cycle on table %s",
+				fixtures[i].Table,
+			)
+		case done:
+			return nil
+		}
+		state[i] = visiting
+		for _, d := range deps[i] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		order = append(order, i)
+		return nil
+	}
+	for i := range fixtures {
+		err = visit(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Return tables fixture f depends on
+func fixtureDependencies(f Fixture) (tables []string, err error) {
+	tables = append(tables, f.DependsOn...)
+
+	t := reflect.TypeOf(f.Rows)
+	if t == nil || t.Kind() != reflect.Slice {
+		err = fmt.Errorf("pg_util: rows must be a slice, got %T", f.Rows)
+		return
+	}
+	cols, err := Columns(t.Elem())
+	if err != nil {
+		return
+	}
+	for i := range cols {
+		ref, ok := cols[i].Option("references")
+		if !ok {
+			continue
+		}
+		// Strip referenced columns and any actions
+		if j := strings.IndexAny(ref, "( "); j != -1 {
+			ref = ref[:j]
+		}
+		tables = append(tables, ref)
+	}
+	return
+}
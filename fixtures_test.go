@@ -0,0 +1,230 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type fixtureUser struct {
+	ID   int64 `db:"id,pk"`
+	Name string
+}
+
+type fixturePost struct {
+	ID     int64             `db:"id,pk"`
+	Author int64             `db:"author,references=fixture_users(id)"`
+	Body   string            `db:"body"`
+	Meta   map[string]string `db:"meta"`
+	Time   time.Time         `db:"created_at"`
+}
+
+func TestFixtureOrder(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name     string
+		fixtures []Fixture
+		order    []int
+		err      bool
+	}{
+		{
+			name: "references",
+			fixtures: []Fixture{
+				{Table: "fixture_posts", Rows: []fixturePost{}},
+				{Table: "fixture_users", Rows: []fixtureUser{}},
+			},
+			order: []int{1, 0},
+		},
+		{
+			name: "depends on",
+			fixtures: []Fixture{
+				{Table: "a", Rows: []fixtureUser{}, DependsOn: []string{"b"}},
+				{Table: "c", Rows: []*fixtureUser{}},
+				{Table: "b", Rows: []fixtureUser{}},
+			},
+			order: []int{2, 0, 1},
+		},
+		{
+			name: "missing dependency",
+			fixtures: []Fixture{
+				{Table: "fixture_posts", Rows: []fixturePost{}},
+			},
+			order: []int{0},
+		},
+		{
+			name: "cycle",
+			fixtures: []Fixture{
+				{Table: "a", Rows: []fixtureUser{}, DependsOn: []string{"b"}},
+				{Table: "b", Rows: []fixtureUser{}, DependsOn: []string{"a"}},
+			},
+			err: true,
+		},
+		{
+			name: "not a slice",
+			fixtures: []Fixture{
+				{Table: "a", Rows: fixtureUser{}},
+			},
+			err: true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			order, err := fixtureOrder(c.fixtures)
+			if c.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(order, c.order) {
+				t.Fatalf("expected %v, got %v", c.order, order)
+			}
+		})
+	}
+}
+
+func TestDecodeFixture(t *testing.T) {
+	t.Parallel()
+
+	f, err := DecodeFixture[fixturePost](
+		"fixture_posts",
+		[]byte(`[{
+			"id": 1,
+			"author": 2,
+			"body": "hello",
+			"meta": {"lang": "en"},
+			"created_at": "2020-01-02T03:04:05Z"
+		}]`),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []fixturePost{{
+		ID:     1,
+		Author: 2,
+		Body:   "hello",
+		Meta:   map[string]string{"lang": "en"},
+		Time:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}
+	if !reflect.DeepEqual(f.Rows, std) {
+		t.Fatalf("expected %+v, got %+v", std, f.Rows)
+	}
+
+	// Decoders producing maps with interface{} keys
+	f, err = DecodeFixture[fixturePost](
+		"fixture_posts",
+		nil,
+		func(_ []byte, v interface{}) error {
+			*v.(*[]map[string]interface{}) = []map[string]interface{}{{
+				"id":   1,
+				"meta": map[interface{}]interface{}{"lang": "en"},
+			}}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := f.Rows.([]fixturePost)[0].Meta["lang"]; m != "en" {
+		t.Fatalf("unexpected meta: %s", m)
+	}
+
+	_, err = DecodeFixture[fixturePost](
+		"fixture_posts",
+		[]byte(`[{"nope": 1}]`),
+		json.Unmarshal,
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			err = ExecAll(
+				context.Background(),
+				tx,
+				`create temp table fixture_users (
+					id bigserial primary key,
+					name text not null
+				) on commit drop`,
+				`create temp table fixture_posts (
+					id bigint primary key,
+					author bigint not null references fixture_users(id),
+					body text not null,
+					meta jsonb,
+					created_at timestamptz not null
+				) on commit drop`,
+			)
+			if err != nil {
+				return
+			}
+
+			n, err := LoadFixtures(
+				context.Background(),
+				tx,
+				Fixture{
+					Table: "pg_temp.fixture_posts",
+					Rows: []fixturePost{
+						{ID: 1, Author: 1, Body: "a", Time: time.Now()},
+						{ID: 2, Author: 2, Body: "b", Time: time.Now()},
+					},
+				},
+				Fixture{
+					Table: "fixture_users",
+					Rows: []*fixtureUser{
+						{ID: 1, Name: "x"},
+						{ID: 2, Name: "y"},
+					},
+				},
+			)
+			if err != nil {
+				return
+			}
+			if n != 4 {
+				t.Fatalf("unexpected row count: %d", n)
+			}
+
+			// Sequence advanced past the loaded keys
+			id, err := QueryValue[int64](
+				context.Background(),
+				tx,
+				`insert into fixture_users (name) values ('z') returning id`,
+			)
+			if err != nil {
+				return
+			}
+			if id != 3 {
+				t.Fatalf("sequence not advanced: %d", id)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+package pg_util
+
+import "reflect"
+
+// Convert a field value the same way the statement builders do for fields
+// tagged with ",string" and/or ",nullzero". Used by code generated with
+// cmd/pg_util-gen for field types it can not convert directly. Registered
+// encoders and converters are not applied.
+func ConvertArg(val interface{}, toString, nullZero bool) (
+	arg interface{},
+	err error,
+) {
+	v := reflect.ValueOf(val)
+	if val == nil || nullZero && isZero(v, val) {
+		if toString {
+			arg = (*string)(nil)
+		}
+		return
+	}
+	if toString {
+		return convertToString(v, val)
+	}
+	return val, nil
+}
@@ -0,0 +1,51 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertArg(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name               string
+		val                interface{}
+		toString, nullZero bool
+		std                interface{}
+	}{
+		{"plain", 1, false, false, 1},
+		{"string", 1, true, false, "1"},
+		{"nullzero", 0, false, true, nil},
+		{"nullzero non-zero", 2, false, true, 2},
+		{"nullzero time", time.Time{}, false, true, nil},
+		{"nullzero string", "", true, true, (*string)(nil)},
+		{"nil", nil, true, false, (*string)(nil)},
+		{"slice", []int{1, 2}, true, false, `{"1","2"}`},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := ConvertArg(c.val, c.toString, c.nullZero)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res, c.std) {
+				t.Fatalf("value mismatch: `%#v` != `%#v`", res, c.std)
+			}
+		})
+	}
+}
+
+func TestConvertArgError(t *testing.T) {
+	t.Parallel()
+
+	_, err := ConvertArg(map[string]interface{}{"a": func() {}}, true, false)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -1,8 +1,21 @@
 module github.com/bakape/pg_util
 
-go 1.12
+go 1.18
 
 require (
 	github.com/jackc/pgconn v1.6.2
+	github.com/jackc/pgproto3/v2 v2.0.2
 	github.com/jackc/pgx/v4 v4.7.2
 )
+
+require (
+	github.com/jackc/chunkreader/v2 v2.0.1 // indirect
+	github.com/jackc/pgio v1.0.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20200714003250-2b9c44734f2b // indirect
+	github.com/jackc/pgtype v1.4.1 // indirect
+	github.com/jackc/puddle v1.1.1 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/text v0.3.3 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+)
@@ -0,0 +1,57 @@
+package pg_util
+
+import (
+	"context"
+	"time"
+)
+
+// Options for HealthCheck
+type HealthCheckOpts struct {
+	// Also report the replication lag, if the server is a standby
+	ReplicationLag bool
+}
+
+// Status of the database reported by HealthCheck
+type HealthStatus struct {
+	// Round trip time of the health check query
+	Latency time.Duration `json:"latency"`
+
+	// Server is a standby in recovery mode
+	InRecovery bool `json:"in_recovery"`
+
+	// Server version. Example: "13.2"
+	Version string `json:"version"`
+
+	// Time since the last transaction replayed by a standby. Only set, if
+	// requested and the server is in recovery. Grows, if the primary is
+	// idle.
+	ReplicationLag time.Duration `json:"replication_lag,omitempty"`
+}
+
+// Check the database is reachable and report its status. Suitable for
+// /healthz endpoints and load balancer probes.
+func HealthCheck(ctx context.Context, q Querier, opts HealthCheckOpts) (
+	s HealthStatus,
+	err error,
+) {
+	sql := `SELECT pg_is_in_recovery(), current_setting('server_version')`
+	if opts.ReplicationLag {
+		sql += `, CASE WHEN pg_is_in_recovery()
+			THEN extract(epoch FROM now() - pg_last_xact_replay_timestamp())
+		END`
+	} else {
+		sql += `, NULL::float8`
+	}
+
+	var lag *float64
+	start := time.Now()
+	err = q.QueryRow(ctx, sql).Scan(&s.InRecovery, &s.Version, &lag)
+	if err != nil {
+		return
+	}
+	s.Latency = time.Since(start)
+	if lag != nil {
+		s.ReplicationLag = time.Duration(*lag * float64(time.Second))
+	}
+	return
+}
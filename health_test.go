@@ -0,0 +1,36 @@
+package pg_util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	s, err := HealthCheck(
+		context.Background(),
+		conn,
+		HealthCheckOpts{ReplicationLag: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version == "" {
+		t.Fatal("no version")
+	}
+	if s.Latency <= 0 {
+		t.Fatalf("invalid latency: %s", s.Latency)
+	}
+	if !s.InRecovery && s.ReplicationLag != 0 {
+		t.Fatalf("replication lag on primary: %s", s.ReplicationLag)
+	}
+}
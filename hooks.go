@@ -0,0 +1,68 @@
+package pg_util
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var buildHook atomic.Value // func(BuildInfo)
+
+// Information about a statement produced by one of the statement builders
+type BuildInfo struct {
+	// Name of the builder function. Example: "BuildInsert"
+	Builder string
+
+	// Generated SQL
+	SQL string
+
+	// Number of arguments
+	ArgCount int
+
+	// Statement was retrieved from the statement cache
+	Cached bool
+
+	// Time it took to build the statement
+	Duration time.Duration
+}
+
+// Set a function to be called with information about every statement built
+// by the statement builders. Useful for auditing generated statements in
+// production. Pass nil to remove the hook.
+//
+// fn is called synchronously from the builder and must be safe for concurrent
+// use.
+func SetBuildHook(fn func(BuildInfo)) {
+	buildHook.Store(fn)
+}
+
+// Return current time, if a build hook is set, or zero time otherwise
+func buildStart() time.Time {
+	if fn, _ := buildHook.Load().(func(BuildInfo)); fn != nil {
+		return time.Now()
+	}
+	return time.Time{}
+}
+
+// Pass information about a built statement to the build hook, if any
+func reportBuild(
+	builder string,
+	start time.Time,
+	sql string,
+	argCount int,
+	cached bool,
+) {
+	fn, _ := buildHook.Load().(func(BuildInfo))
+	if fn == nil || sql == "" {
+		return
+	}
+	info := BuildInfo{
+		Builder:  builder,
+		SQL:      sql,
+		ArgCount: argCount,
+		Cached:   cached,
+	}
+	if !start.IsZero() {
+		info.Duration = time.Since(start)
+	}
+	fn(info)
+}
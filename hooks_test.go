@@ -0,0 +1,107 @@
+package pg_util
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBuildHook(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		infos []BuildInfo
+	)
+	SetBuildHook(func(info BuildInfo) {
+		if !strings.Contains(info.SQL, `"hook_test"`) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		infos = append(infos, info)
+	})
+	defer SetBuildHook(nil)
+
+	for i := 0; i < 2; i++ {
+		BuildInsert(InsertOpts{
+			Table: "hook_test",
+			Data: struct {
+				F1 string
+				F2 int
+			}{"aaa", 1},
+		})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(infos) != 2 {
+		t.Fatalf("unexpected hook call count: %d", len(infos))
+	}
+	for i, cached := range [...]bool{false, true} {
+		info := infos[i]
+		if info.Builder != "BuildInsert" {
+			t.Fatalf("unexpected builder: %s", info.Builder)
+		}
+		if info.ArgCount != 2 {
+			t.Fatalf("unexpected argument count: %d", info.ArgCount)
+		}
+		if info.Cached != cached {
+			t.Fatalf("cache status mismatch: %t != %t", info.Cached, cached)
+		}
+	}
+}
+
+func TestBuildHookInsertVariants(t *testing.T) {
+	type row struct {
+		ID int `db:"id,pk"`
+	}
+
+	var (
+		mu       sync.Mutex
+		builders []string
+	)
+	SetBuildHook(func(info BuildInfo) {
+		if !strings.Contains(info.SQL, `"hook_variants_test"`) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		builders = append(builders, info.Builder)
+	})
+	defer SetBuildHook(nil)
+
+	opts := InsertOpts{Table: "hook_variants_test", Data: row{1}}
+	BuildInsert(opts)
+	_, _, err := BuildInsertE(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = AppendInsert(nil, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = BuildInsertT(InsertOptsT[row]{
+		Table: "hook_variants_test",
+		Data:  row{1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = BuildUpsert(UpsertOpts{InsertOpts: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	std := []string{
+		"BuildInsert",
+		"BuildInsertE",
+		"AppendInsert",
+		"BuildInsertT",
+		"BuildUpsert",
+	}
+	if !reflect.DeepEqual(builders, std) {
+		t.Fatalf("builder mismatch: %v != %v", builders, std)
+	}
+}
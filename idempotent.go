@@ -0,0 +1,85 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Table used by Idempotent to store keys and results
+const IdempotencyTable = "pg_util_idempotency_keys"
+
+// Create the table used by Idempotent, if it does not exist yet
+func CreateIdempotencyTable(ctx context.Context, q Querier) (err error) {
+	_, err = q.Exec(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS `+quoteIdentifier(IdempotencyTable)+` (
+			key text PRIMARY KEY,
+			result jsonb,
+			created_at timestamptz NOT NULL DEFAULT now()
+		)`,
+	)
+	return
+}
+
+// Run fn exactly once per key and store its JSON-encoded result. Subsequent
+// calls with the same key skip fn and return the stored result instead.
+// Useful for deduplicating retried API requests or message deliveries.
+//
+// The key is claimed and fn is run in a single transaction, so concurrent
+// calls with the same key block until the first one finishes. If fn fails,
+// the key is released and fn will be run again on the next call.
+//
+// Requires the table created by CreateIdempotencyTable.
+func Idempotent[T any](
+	ctx context.Context,
+	conn TxStarter,
+	key string,
+	fn func(pgx.Tx) (T, error),
+) (T, error) {
+	return InTransactionValue(ctx, conn, func(tx pgx.Tx) (val T, err error) {
+		table := quoteIdentifier(IdempotencyTable)
+		tag, err := tx.Exec(
+			ctx,
+			`INSERT INTO `+table+` (key) VALUES ($1) ON CONFLICT DO NOTHING`,
+			key,
+		)
+		if err != nil {
+			return
+		}
+
+		if tag.RowsAffected() == 0 {
+			// Already processed
+			var res []byte
+			err = tx.
+				QueryRow(
+					ctx,
+					`SELECT result FROM `+table+` WHERE key = $1`,
+					key,
+				).
+				Scan(&res)
+			if err != nil {
+				return
+			}
+			err = json.Unmarshal(res, &val)
+			return
+		}
+
+		val, err = fn(tx)
+		if err != nil {
+			return
+		}
+		res, err := json.Marshal(val)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE `+table+` SET result = $2 WHERE key = $1`,
+			key,
+			string(res),
+		)
+		return
+	})
+}
@@ -0,0 +1,72 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestIdempotent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	err = CreateIdempotencyTable(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(
+		ctx,
+		`DELETE FROM `+IdempotencyTable+` WHERE key = 'idempotent_test'`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		N int
+	}
+	var calls int
+	errFail := errors.New("fail")
+	run := func(fail bool) (result, error) {
+		return Idempotent(
+			ctx,
+			conn,
+			"idempotent_test",
+			func(pgx.Tx) (res result, err error) {
+				calls++
+				if fail {
+					err = errFail
+					return
+				}
+				res.N = calls
+				return
+			},
+		)
+	}
+
+	// Failed runs release the key
+	_, err = run(true)
+	if err != errFail {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		res, err := run(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.N != 2 {
+			t.Fatalf("result mismatch: %d != 2", res.N)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("call count mismatch: %d != 2", calls)
+	}
+}
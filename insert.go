@@ -1,20 +1,30 @@
 package pg_util
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 )
 
 var (
-	insertCache  sync.Map
-	dedupMapPool = sync.Pool{
-		New: func() interface{} {
-			return make(map[string]struct{})
-		},
-	}
+	insertCache sync.Map
+
+	// No table specified to insert into
+	ErrNoTable = errors.New("pg_util: no table specified")
+
+	// Suffix contains a RETURNING clause, but one is also generated for
+	// columns tagged with ",generated" or because of Refresh
+	ErrSuffixReturning = errors.New(
+		"pg_util: Suffix contains RETURNING, but a RETURNING clause is " +
+			"generated",
+	)
+
+	returningRe = regexp.MustCompile(`(?i)\breturning\b`)
 )
 
 // Options for building insert statement
@@ -22,7 +32,8 @@ type InsertOpts struct {
 	// Table to insert into
 	Table string
 
-	// Struct that will have all its public fields written to the database.
+	// Struct or pointer to struct that will have all its public fields
+	// written to the database.
 	//
 	// Use `db:"name"` to override the default name of a column.
 	//
@@ -30,6 +41,37 @@ type InsertOpts struct {
 	// being passed to the driver. This is useful in some cases like encoding to
 	// Postgres domains. This also works, if the name part of the tag is empty.
 	// Examples: `db:"name,string"` `db:",string"`
+	// Nil pointers and driver.Valuer implementations producing nil values,
+	// like invalid sql.NullString or sql.NullInt64, are passed as NULL.
+	// Slices and arrays, except for []byte, are encoded as Postgres array
+	// literals and maps as JSON objects with sorted keys. Nil slices and maps
+	// are passed as NULL.
+	//
+	// Tags with ",nullzero" after the name will have zero values written as
+	// NULL. Types with an IsZero() method, like time.Time, are checked using
+	// it. Example: `db:"deleted_at,nullzero"`
+	//
+	// Tags with ",expr=" after the name will have the column value rendered as
+	// the specified raw SQL expression instead of a bind parameter. The field
+	// value is ignored. As the expression may contain commas, this option must
+	// be the last one in the tag.
+	// Example: `db:"updated_at,expr=now()"`
+	//
+	// Tags with ",cast=" after the name will have the bind parameter of the
+	// column cast to the specified Postgres type. Useful, when the type
+	// inferred by the driver does not match domains, enums or extension
+	// types. Examples: `db:"ip,cast=inet"` `db:"price,cast=numeric(10,2)"`
+	//
+	// Tags with ",generated" after the name mark columns generated by the
+	// database, like identity or serial columns or columns with defaults.
+	// These are excluded from the written columns and added to a RETURNING
+	// clause instead. Insert scans them back into Data.
+	// Example: `db:"id,generated"`
+	//
+	// Tags with ",readonly" after the name mark columns, that are only read by
+	// select and scanning helpers, like computed or trigger-maintained
+	// columns. These are never written by INSERT or UPDATE statements.
+	// Example: `db:"search_vector,readonly"`
 	//
 	// Fields with a `db:"-"` tag will be skipped
 	//
@@ -42,164 +84,504 @@ type InsertOpts struct {
 	// Optional prefix to statement
 	Prefix string
 
+	// Optional common table expressions to prepend to the statement as a WITH
+	// clause. Written after Prefix. Placeholders and arguments of all CTEs are
+	// renumbered automatically and their arguments prepended to the returned
+	// arguments.
+	CTEs []CTE
+
+	// Optional suffix to statement. Must not contain a RETURNING clause, if
+	// one is generated for columns tagged with ",generated" or Refresh.
+	Suffix string
+
+	// Shift generated placeholders by ArgOffset, so the statement can be
+	// appended to other SQL, whose arguments occupy the first ArgOffset
+	// positions. The returned arguments do not include these.
+	ArgOffset int
+
+	// Double-quote all column names, including ones not set through a tag,
+	// preserving the exact case of Go field names. By default such names are
+	// left unquoted and thus folded to lowercase by Postgres.
+	QuoteAll bool
+
+	// Add a RETURNING clause for all columns, so the exec helpers refresh Data
+	// with values set by defaults, triggers and generated columns after the
+	// write. Data must be a pointer to a struct for the refresh to happen.
+	Refresh bool
+
+	// Write an OVERRIDING SYSTEM VALUE clause, so values can be written to
+	// identity columns declared GENERATED ALWAYS, for example during
+	// migrations or data imports. Such columns must not be tagged with
+	// ",generated" to be written.
+	OverridingSystemValue bool
+
+	// Optional raw SQL expressions to use for columns instead of values.
+	// Maps column names to expressions and takes precedence over "expr="
+	// tags. Example: map[string]string{"updated_at": "now()"}
+	Expressions map[string]string
+
+	// Optional hook to call with a pointer to a copy of Data before its fields
+	// are scanned, so the caller's value is never modified. Called after
+	// Data's own BeforeInsert method, if Data implements BeforeInserter.
+	BeforeInsert func(data interface{}) error
+}
+
+// Implemented by Data structs, that need to populate, validate or normalize
+// their fields before being inserted. Called on a copy of Data before its
+// fields are scanned.
+type BeforeInserter interface {
+	BeforeInsert() error
+}
+
+// Options for building insert statement with a statically typed Data struct.
+//
+// See InsertOpts for further documentation.
+type InsertOptsT[T any] struct {
+	// Table to insert into
+	Table string
+
+	// Struct that will have all its public fields written to the database
+	Data T
+
+	// Optional prefix to statement
+	Prefix string
+
+	// Optional common table expressions to prepend to the statement as a WITH
+	// clause. Written after Prefix. Placeholders and arguments of all CTEs are
+	// renumbered automatically and their arguments prepended to the returned
+	// arguments.
+	CTEs []CTE
+
 	// Optional suffix to statement
 	Suffix string
+
+	// Optional raw SQL expressions to use for columns instead of values
+	Expressions map[string]string
+
+	// Shift generated placeholders by ArgOffset
+	ArgOffset int
+
+	// Double-quote all column names
+	QuoteAll bool
+
+	// Add a RETURNING clause for all columns
+	Refresh bool
+
+	// Write an OVERRIDING SYSTEM VALUE clause
+	OverridingSystemValue bool
+
+	// Optional hook to call with a pointer to a copy of Data before its fields
+	// are scanned
+	BeforeInsert func(data *T) error
+}
+
+// Convert to untyped options without Data
+func (o *InsertOptsT[T]) untyped() (opts InsertOpts) {
+	opts = InsertOpts{
+		Table:                 o.Table,
+		Prefix:                o.Prefix,
+		Suffix:                o.Suffix,
+		CTEs:                  o.CTEs,
+		Expressions:           o.Expressions,
+		ArgOffset:             o.ArgOffset,
+		QuoteAll:              o.QuoteAll,
+		Refresh:               o.Refresh,
+		OverridingSystemValue: o.OverridingSystemValue,
+	}
+	if o.BeforeInsert != nil {
+		opts.BeforeInsert = func(data interface{}) error {
+			return o.BeforeInsert(data.(*T))
+		}
+	}
+	return
 }
 
 // Build and cache insert statement for all fields of data. This includes
 // embedded struct fields.
 //
+// Panics, if Data is not a struct or a pointer to a struct, or the
+// BeforeInsert hook returns an error. Use BuildInsertE to handle these as
+// errors instead. Unlike BuildInsertE, an empty Table is not validated.
+//
 // See InsertOpts for further documentation.
 func BuildInsert(o InsertOpts) (sql string, args []interface{}) {
-	rootT := reflect.TypeOf(o.Data)
-	k := struct {
-		table, prefix, suffix string
-		typ                   reflect.Type
-	}{
-		table:  o.Table,
-		prefix: o.Prefix,
-		suffix: o.Suffix,
-		typ:    rootT,
+	v, meta, err := getDataMeta(o.Data)
+	if err == nil {
+		sql, args, err = buildInsert("BuildInsert", &o, v, meta)
 	}
-	_sql, cached := insertCache.Load(k)
-	if cached {
-		sql = _sql.(string)
+	if err != nil {
+		panic(err)
 	}
+	return
+}
 
+// Build and cache insert statement for all fields of data. This includes
+// embedded struct fields.
+//
+// Returns ErrNoTable, if Table is not set, and *InvalidTypeError, if Data is
+// nil, a nil pointer or not a struct or a pointer to a struct.
+//
+// See InsertOpts for further documentation.
+func BuildInsertE(o InsertOpts) (sql string, args []interface{}, err error) {
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return
+	}
+	return buildInsert("BuildInsertE", &o, v, meta)
+}
+
+// Append insert statement for all fields of Data to dstSQL and its arguments
+// to dstArgs. Statements are built and cached the same way as by BuildInsertE,
+// but the SQL and argument slice are not allocated, if dstSQL and dstArgs have
+// sufficient capacity. Useful for hot write paths, that reuse buffers.
+//
+// Arguments of non-pointer fields are still boxed into interface{} values,
+// which may allocate for each such field.
+//
+// Placeholders are numbered starting after ArgOffset and do not account for
+// any arguments already in dstArgs.
+//
+// See InsertOpts for further documentation.
+func AppendInsert(dstSQL []byte, dstArgs []interface{}, o InsertOpts) (
+	sql []byte,
+	args []interface{},
+	err error,
+) {
+	if o.Table == "" {
+		return dstSQL, dstArgs, ErrNoTable
+	}
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return dstSQL, dstArgs, err
+	}
+	s, args, err := appendInsert("AppendInsert", dstArgs, &o, v, meta)
+	if err != nil {
+		return dstSQL, dstArgs, err
+	}
+	sql = append(dstSQL, s...)
+	return
+}
+
+// Build and cache insert statement for all fields of data. This includes
+// embedded struct fields.
+//
+// Column metadata is computed only once per T. Returns an error instead of
+// panicking on misuse.
+//
+// See InsertOpts for further documentation.
+func BuildInsertT[T any](o InsertOptsT[T]) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	meta, err := getStructMeta(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return
+	}
+	opts := o.untyped()
+	return buildInsert(
+		"BuildInsertT",
+		&opts,
+		reflect.ValueOf(&o.Data).Elem(),
+		meta,
+	)
+}
+
+// Build and execute insert statement for all fields of Data.
+//
+// If Data is a pointer to a struct, columns tagged with ",generated" or all
+// columns, if Refresh is set, are scanned back into it from the RETURNING
+// clause. In this case ErrNoRows is returned, if no row was inserted, for
+// example because of an ON CONFLICT DO NOTHING suffix.
+//
+// See InsertOpts for further documentation.
+func Insert(ctx context.Context, q Querier, o InsertOpts) (err error) {
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return
+	}
+	sql, args, err := buildInsert("Insert", &o, v, meta)
+	if err != nil {
+		return
+	}
+
+	return execReturning(ctx, q, sql, args, v, meta.returning(o.Refresh))
+}
+
+// Execute write statement and scan the returned columns into struct value v,
+// if it is addressable and there are any returned columns
+func execReturning(
+	ctx context.Context,
+	q Querier,
+	sql string,
+	args []interface{},
+	v reflect.Value,
+	returning []*columnMeta,
+) (err error) {
+	if len(returning) == 0 || !v.CanAddr() {
+		_, err = q.Exec(ctx, sql, args...)
+		return
+	}
+	targets := make([]interface{}, len(returning))
+	for i, c := range returning {
+		targets[i] = v.FieldByIndex(c.index).Addr().Interface()
+	}
+	return q.QueryRow(ctx, sql, args...).Scan(targets...)
+}
+
+// Build insert statement reporting it to the build hook as built by builder
+func buildInsert(
+	builder string,
+	o *InsertOpts,
+	v reflect.Value,
+	meta *structMeta,
+) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	return appendInsert(builder, nil, o, v, meta)
+}
+
+// Build insert statement and append its arguments to dstArgs
+func appendInsert(
+	builder string,
+	dstArgs []interface{},
+	o *InsertOpts,
+	v reflect.Value,
+	meta *structMeta,
+) (
+	sql string,
+	args []interface{},
+	err error,
+) {
 	var (
-		w          strings.Builder
-		scanStruct func(parentV reflect.Value, parentT reflect.Type)
-		dedupMap   = dedupMapPool.Get().(map[string]struct{})
+		start  = buildStart()
+		cached bool
 	)
 	defer func() {
-		for k := range dedupMap {
-			delete(dedupMap, k)
-		}
-		dedupMapPool.Put(dedupMap)
+		reportBuild(builder, start, sql, len(args)-len(dstArgs), cached)
 	}()
-	scanStruct = func(parentV reflect.Value, parentT reflect.Type) {
-		type desc struct {
-			reflect.Value
-			reflect.Type
-		}
 
-		var (
-			embedded []desc
-			l        = parentT.NumField()
-		)
-		for i := 0; i < l; i++ {
-			var (
-				f               = parentT.Field(i)
-				split           = strings.Split(f.Tag.Get("db"), ",")
-				tag             = split[0]
-				name            string
-				convertToString bool
-			)
-			for _, s := range split[1:] {
-				if s == "string" {
-					convertToString = true
-				}
-			}
-			switch tag {
-			case "-":
-				continue
-			case "":
-				name = f.Name
-			default:
-				name = tag
-			}
+	args = dstArgs
+	v, err = runBeforeInsert(o, v, meta)
+	if err != nil {
+		return
+	}
 
-			v := parentV.Field(i)
-			if f.Anonymous {
-				embedded = append(embedded, desc{
-					v,
-					f.Type,
-				})
-				continue
+	for _, c := range o.CTEs {
+		args = append(args, c.Args...)
+	}
+	argOffset := o.ArgOffset + len(args) - len(dstArgs)
+	for _, c := range meta.writable {
+		if o.expression(c) == "" {
+			args, err = c.appendValue(args, v)
+			if err != nil {
+				return
 			}
+		}
+	}
 
-			if _, ok := dedupMap[name]; ok {
-				continue
-			}
+	k := struct {
+		table, prefix, suffix, exprs, ctes string
+		argOffset                          int
+		quoteAll, refresh, overriding      bool
+		typ                                reflect.Type
+	}{
+		table:      o.Table,
+		prefix:     o.Prefix,
+		suffix:     o.Suffix,
+		exprs:      expressionsCacheKey(o.Expressions),
+		ctes:       ctesCacheKey(o.CTEs),
+		argOffset:  o.ArgOffset,
+		quoteAll:   o.QuoteAll,
+		refresh:    o.Refresh,
+		overriding: o.OverridingSystemValue,
+		typ:        v.Type(),
+	}
+	if _sql, ok := insertCache.Load(k); ok {
+		sql = _sql.(string)
+		cached = true
+		return
+	}
 
-			if !cached {
-				if len(dedupMap) != 0 {
-					w.WriteByte(',')
-				}
-
-				// Do not quote names without specified tags to preserve case
-				// insensitivity
-				if tag != "" {
-					w.WriteByte('"')
-				}
-				w.WriteString(name)
-				if tag != "" {
-					w.WriteByte('"')
-				}
-			}
-			dedupMap[name] = struct{}{}
-			val := v.Interface()
-			if convertToString {
-				// Consistently convert the value type to not allow any external
-				// reflection to chose inconsistent branches
-				if v.Type().Kind() == reflect.Ptr {
-					if v.IsNil() {
-						val = (*string)(nil)
-					} else {
-						val = fmt.Sprint(
-							reflect.
-								ValueOf(val).
-								Elem().
-								Interface(),
-						)
-					}
-				} else {
-					val = fmt.Sprint(val)
-				}
-			}
-			args = append(args, val)
+	var w strings.Builder
+	writePrefix(&w, o.Prefix)
+	writeCTEs(&w, o.CTEs, o.ArgOffset)
+	w.WriteString("INSERT INTO ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(" (")
+	for i, c := range meta.writable {
+		if i != 0 {
+			w.WriteByte(',')
 		}
-
-		for _, d := range embedded {
-			scanStruct(d.Value, d.Type)
+		c.writeName(&w, o.QuoteAll)
+	}
+	w.WriteByte(')')
+	if o.OverridingSystemValue {
+		w.WriteString(" OVERRIDING SYSTEM VALUE")
+	}
+	w.WriteString(" VALUES (")
+	arg := argOffset
+	for i, c := range meta.writable {
+		if i != 0 {
+			w.WriteByte(',')
 		}
+		if e := o.expression(c); e != "" {
+			w.WriteString(e)
+		} else {
+			c.writePlaceholder(&w, arg)
+			arg++
+		}
+	}
+	w.WriteByte(')')
+	err = writeSuffixReturning(
+		&w,
+		o.Suffix,
+		meta.returning(o.Refresh),
+		o.QuoteAll,
+	)
+	if err != nil {
+		return
+	}
+
+	sql = w.String()
+	insertCache.Store(k, sql)
+	return
+}
+
+// Return SQL expression to use for column c, if any. Expressions set through
+// options override ones set through tags.
+func (o *InsertOpts) expression(c *columnMeta) string {
+	if e, ok := o.Expressions[c.name]; ok {
+		return e
 	}
+	return c.expr
+}
 
-	if !cached {
-		if o.Prefix != "" {
-			w.WriteString(o.Prefix)
-			w.WriteByte(' ')
+// Write RETURNING clause for columns, if any
+func writeReturning(
+	w *strings.Builder,
+	columns []*columnMeta,
+	quoteAll bool,
+) {
+	if len(columns) == 0 {
+		return
+	}
+	w.WriteString(" RETURNING ")
+	for i, c := range columns {
+		if i != 0 {
+			w.WriteByte(',')
 		}
-		fmt.Fprintf(&w, `INSERT INTO "%s" (`, o.Table)
+		c.writeName(w, quoteAll)
 	}
+}
 
-	scanStruct(reflect.ValueOf(o.Data), rootT)
+// Write optional suffix followed by RETURNING clause for columns, if any.
+// Returns ErrSuffixReturning, if both would contain a RETURNING clause.
+func writeSuffixReturning(
+	w *strings.Builder,
+	suffix string,
+	columns []*columnMeta,
+	quoteAll bool,
+) error {
+	if len(columns) != 0 && returningRe.MatchString(suffix) {
+		return ErrSuffixReturning
+	}
+	writeSuffix(w, suffix)
+	writeReturning(w, columns, quoteAll)
+	return nil
+}
 
-	if !cached {
-		w.WriteString(") VALUES (")
-		var tmp []byte
-		for i := 0; i < len(dedupMap); i++ {
-			if i != 0 {
-				w.WriteByte(',')
-			}
-			w.WriteByte('$')
-			if i < 9 {
-				w.WriteByte(byte(i) + '0' + 1) // Avoids allocation
-			} else {
-				tmp = strconv.AppendUint(tmp[:0], uint64(i+1), 10)
-				w.Write(tmp)
-			}
-		}
-		w.WriteByte(')')
+// Run BeforeInsert hooks of the Data struct and options, if any.
+// Returns the possibly modified struct value.
+func runBeforeInsert(o *InsertOpts, v reflect.Value, meta *structMeta) (
+	reflect.Value,
+	error,
+) {
+	if !meta.beforeInsert && o.BeforeInsert == nil {
+		return v, nil
+	}
 
-		if o.Suffix != "" {
-			w.WriteByte(' ')
-			w.WriteString(o.Suffix)
+	// Always operate on a copy, so the hooks can modify the struct through a
+	// pointer without affecting the caller's value
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+	v = cp
+	ptr := v.Addr().Interface()
+
+	if meta.beforeInsert {
+		if err := ptr.(BeforeInserter).BeforeInsert(); err != nil {
+			return v, err
 		}
+	}
+	if o.BeforeInsert != nil {
+		if err := o.BeforeInsert(ptr); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
 
-		sql = w.String()
-		insertCache.Store(k, sql)
+// Build deterministic statement cache key from column expression overrides
+func expressionsCacheKey(exprs map[string]string) string {
+	if len(exprs) == 0 {
+		return ""
 	}
 
-	return
+	keys := make([]string, 0, len(exprs))
+	for k := range exprs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var w strings.Builder
+	for _, k := range keys {
+		w.WriteString(k)
+		w.WriteByte(0)
+		w.WriteString(exprs[k])
+		w.WriteByte(0)
+	}
+	return w.String()
+}
+
+// Write optional statement prefix followed by a space
+func writePrefix(w *strings.Builder, prefix string) {
+	if prefix != "" {
+		w.WriteString(prefix)
+		w.WriteByte(' ')
+	}
+}
+
+// Write optional statement suffix preceded by a space
+func writeSuffix(w *strings.Builder, suffix string) {
+	if suffix != "" {
+		w.WriteByte(' ')
+		w.WriteString(suffix)
+	}
+}
+
+// Write n comma-separated placeholders starting from $offset+1
+func writePlaceholders(w *strings.Builder, n, offset int) {
+	var tmp []byte
+	for i := offset; i < offset+n; i++ {
+		if i != offset {
+			w.WriteByte(',')
+		}
+		w.WriteByte('$')
+		if i < 9 {
+			w.WriteByte(byte(i) + '0' + 1) // Avoids allocation
+		} else {
+			tmp = strconv.AppendUint(tmp[:0], uint64(i+1), 10)
+			w.Write(tmp)
+		}
+	}
 }
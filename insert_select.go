@@ -0,0 +1,109 @@
+package pg_util
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// No SELECT query specified
+var ErrNoSelect = errors.New("pg_util: no SELECT query specified")
+
+// Options for building an INSERT ... SELECT statement
+type InsertSelectOpts struct {
+	// Table to insert into
+	Table string
+
+	// Value of the struct type, whose columns will be inserted. Only the type
+	// is used. Can also be a nil pointer to such a struct.
+	//
+	// See InsertOpts.Data for column mapping rules.
+	Columns interface{}
+
+	// SELECT query fragment producing rows with values for all columns in the
+	// order of the struct fields. Placeholders start from $1.
+	// Example: `SELECT a, b FROM t2 WHERE c = $1`
+	Select string
+
+	// Arguments to Select
+	Args []interface{}
+
+	// Shift placeholders in Select by ArgOffset, so the statement can be
+	// combined with other SQL (like a Prefix), whose arguments occupy the first
+	// ArgOffset positions.
+	ArgOffset int
+
+	// Double-quote all column names, including ones not set through a tag,
+	// preserving the exact case of Go field names. By default such names are
+	// left unquoted and thus folded to lowercase by Postgres.
+	QuoteAll bool
+
+	// Optional prefix to statement
+	Prefix string
+
+	// Optional common table expressions to prepend to the statement as a WITH
+	// clause. Written after Prefix. Placeholders of all CTEs and Select are
+	// renumbered automatically and the CTE arguments prepended to the returned
+	// arguments.
+	CTEs []CTE
+
+	// Optional suffix to statement
+	Suffix string
+}
+
+// Build INSERT INTO "table" (columns) SELECT ... statement with the column list
+// derived from a struct type.
+//
+// See InsertSelectOpts for further documentation.
+func BuildInsertSelect(o InsertSelectOpts) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildInsertSelect", start, sql, len(args), false)
+	}()
+
+	switch {
+	case o.Table == "":
+		err = ErrNoTable
+		return
+	case o.Select == "":
+		err = ErrNoSelect
+		return
+	}
+
+	t := reflect.TypeOf(o.Columns)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	meta, err := getStructMeta(t)
+	if err != nil {
+		return
+	}
+	if len(meta.writable) == 0 {
+		err = ErrNoColumns
+		return
+	}
+
+	var w strings.Builder
+	writePrefix(&w, o.Prefix)
+	args = writeCTEs(&w, o.CTEs, o.ArgOffset)
+	w.WriteString("INSERT INTO ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(" (")
+	for i, c := range meta.writable {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		c.writeName(&w, o.QuoteAll)
+	}
+	w.WriteString(") ")
+	w.WriteString(shiftPlaceholders(o.Select, o.ArgOffset+len(args)))
+	writeSuffix(&w, o.Suffix)
+
+	sql = w.String()
+	args = append(args, o.Args...)
+	return
+}
@@ -0,0 +1,36 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildInsertSelect(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		F1 string
+		F2 int `db:"field_2"`
+	}
+
+	q, args, err := BuildInsertSelect(InsertSelectOpts{
+		Table:     "t1",
+		Columns:   (*row)(nil),
+		Select:    `SELECT f1, f2 FROM t2 WHERE f3 = $1`,
+		Args:      []interface{}{3},
+		ArgOffset: 1,
+		Prefix:    `WITH v AS (SELECT $1::int)`,
+		Suffix:    "ON CONFLICT DO NOTHING",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `WITH v AS (SELECT $1::int) INSERT INTO "t1" (F1,"field_2") ` +
+		`SELECT f1, f2 FROM t2 WHERE f3 = $2 ON CONFLICT DO NOTHING`
+	if q != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", q, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{3}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+}
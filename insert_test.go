@@ -1,8 +1,14 @@
 package pg_util
 
 import (
+	"context"
+	"errors"
 	"net"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/jackc/pgx/v4"
 )
 
 func TestTestBuildInsert(t *testing.T) {
@@ -160,6 +166,32 @@ func TestTestBuildInsert(t *testing.T) {
 			sql:  `INSERT INTO "t2" (F1,F2) VALUES ($1,$2)`,
 			args: []interface{}{"aaa", 1},
 		},
+		{
+			name: "with expression tag",
+			opts: InsertOpts{
+				Table: "t1",
+				Data: struct {
+					F1 string
+					F2 int `db:"f2,expr=coalesce(null, now())"`
+					F3 string
+				}{"aaa", 1, "bbb"},
+			},
+			sql:  `INSERT INTO "t1" (F1,"f2",F3) VALUES ($1,coalesce(null, now()),$2)`,
+			args: []interface{}{"aaa", "bbb"},
+		},
+		{
+			name: "with expressions map",
+			opts: InsertOpts{
+				Table: "t4",
+				Data: struct {
+					F1 string
+					F2 int
+				}{"aaa", 1},
+				Expressions: map[string]string{"F1": "now()"},
+			},
+			sql:  `INSERT INTO "t4" (F1,F2) VALUES (now(),$1)`,
+			args: []interface{}{1},
+		},
 		{
 			name: "with many args",
 			opts: InsertOpts{
@@ -208,3 +240,438 @@ func TestTestBuildInsert(t *testing.T) {
 		run(cases[i])
 	}
 }
+
+func TestBuildInsertT(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		F1 string
+		F2 int `db:"field_2"`
+	}
+
+	q, args, err := BuildInsertT(InsertOptsT[row]{
+		Table: "t3",
+		Data:  row{"aaa", 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `INSERT INTO "t3" (F1,"field_2") VALUES ($1,$2)`
+	if q != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", q, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"aaa", 1}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+}
+
+func TestBuildInsertTErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no table", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, err := BuildInsertT(InsertOptsT[struct{ F1 int }]{})
+		if err != ErrNoTable {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("not a struct", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, err := BuildInsertT(InsertOptsT[*struct{ F1 int }]{
+			Table: "t1",
+		})
+		if _, ok := err.(*InvalidTypeError); !ok {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+type beforeInsertRow struct {
+	F1 string
+	F2 int
+}
+
+func (r *beforeInsertRow) BeforeInsert() error {
+	if r.F2 < 0 {
+		return errors.New("negative F2")
+	}
+	r.F1 = strings.ToUpper(r.F1)
+	return nil
+}
+
+func TestBeforeInsert(t *testing.T) {
+	t.Parallel()
+
+	t.Run("method", func(t *testing.T) {
+		t.Parallel()
+
+		data := beforeInsertRow{"aaa", 1}
+		_, args := BuildInsert(InsertOpts{
+			Table: "t1",
+			Data:  data,
+		})
+		if !reflect.DeepEqual(args, []interface{}{"AAA", 1}) {
+			t.Fatalf("argument list mismatch: `%+v`", args)
+		}
+		if data.F1 != "aaa" {
+			t.Fatal("caller's value modified")
+		}
+	})
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+
+		_, args, err := BuildInsertT(InsertOptsT[beforeInsertRow]{
+			Table: "t1",
+			Data:  beforeInsertRow{"aaa", 1},
+			BeforeInsert: func(r *beforeInsertRow) error {
+				r.F2++
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(args, []interface{}{"AAA", 2}) {
+			t.Fatalf("argument list mismatch: `%+v`", args)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, err := BuildInsertT(InsertOptsT[beforeInsertRow]{
+			Table: "t1",
+			Data:  beforeInsertRow{"aaa", -1},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestBuildInsertGenerated(t *testing.T) {
+	t.Parallel()
+
+	q, args := BuildInsert(InsertOpts{
+		Table: "t6",
+		Data: &struct {
+			ID      int `db:"id,generated"`
+			F1      string
+			Created int `db:"created,generated"`
+		}{0, "aaa", 0},
+	})
+	const std = `INSERT INTO "t6" (F1) VALUES ($1) RETURNING "id","created"`
+	if q != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", q, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"aaa"}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+}
+
+func TestInsertGenerated(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(
+				context.Background(),
+				`create temp table insert_generated_test (
+					id bigint generated always as identity,
+					name text not null
+				) on commit drop`,
+			)
+			if err != nil {
+				return
+			}
+
+			row := struct {
+				ID   int64 `db:"id,generated"`
+				Name string
+			}{Name: "aaa"}
+			err = Insert(context.Background(), tx, InsertOpts{
+				Table: "insert_generated_test",
+				Data:  &row,
+			})
+			if err != nil {
+				return
+			}
+			if row.ID != 1 {
+				t.Fatalf("generated column not scanned: %d", row.ID)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuoteAll(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID        int `db:"id,pk"`
+		CreatedAt int `db:"createdAt,generated"`
+		UserName  string
+	}
+
+	cases := [...]struct {
+		name, sql string
+		build     func() (string, []interface{}, error)
+	}{
+		{
+			name: "insert",
+			build: func() (string, []interface{}, error) {
+				return BuildInsertT(InsertOptsT[row]{
+					Table:    "t8",
+					QuoteAll: true,
+				})
+			},
+			sql: `INSERT INTO "t8" ("id","UserName") VALUES ($1,$2) ` +
+				`RETURNING "createdAt"`,
+		},
+		{
+			name: "update",
+			build: func() (string, []interface{}, error) {
+				return BuildUpdateByPK(ByPKOpts{
+					Table:    "t8",
+					Data:     row{},
+					QuoteAll: true,
+				})
+			},
+			sql: `UPDATE "t8" SET "UserName"=$1 WHERE "id"=$2`,
+		},
+		{
+			name: "select",
+			build: func() (string, []interface{}, error) {
+				return BuildSelect(SelectOpts{
+					Table:    "t8",
+					Columns:  row{},
+					QuoteAll: true,
+				})
+			},
+			sql: `SELECT "id","createdAt","UserName" FROM "t8"`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			q, _, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", q, c.sql)
+			}
+		})
+	}
+}
+
+func TestBuildInsertE(t *testing.T) {
+	t.Parallel()
+
+	var nilPtr *struct{ F1 int }
+	i := 1
+	cases := [...]struct {
+		name string
+		opts InsertOpts
+		err  string
+	}{
+		{
+			name: "no table",
+			opts: InsertOpts{Data: struct{ F1 int }{}},
+			err:  ErrNoTable.Error(),
+		},
+		{
+			name: "nil data",
+			opts: InsertOpts{Table: "t1"},
+			err:  "pg_util: Data must be a struct, got <nil>",
+		},
+		{
+			name: "nil pointer",
+			opts: InsertOpts{Table: "t1", Data: nilPtr},
+			err:  "pg_util: Data must be a struct, got *struct { F1 int }",
+		},
+		{
+			name: "pointer to non-struct",
+			opts: InsertOpts{Table: "t1", Data: &i},
+			err:  "pg_util: Data must be a struct, got *int",
+		},
+		{
+			name: "non-struct",
+			opts: InsertOpts{Table: "t1", Data: i},
+			err:  "pg_util: Data must be a struct, got int",
+		},
+		{
+			name: "suffix with RETURNING",
+			opts: InsertOpts{
+				Table: "t1",
+				Data: struct {
+					ID int `db:"id,generated"`
+					F1 int
+				}{},
+				Suffix: "ON CONFLICT DO NOTHING returning id",
+			},
+			err: ErrSuffixReturning.Error(),
+		},
+		{
+			name: "suffix with RETURNING and refresh",
+			opts: InsertOpts{
+				Table:   "t1",
+				Data:    struct{ F1 int }{},
+				Suffix:  "RETURNING F1",
+				Refresh: true,
+			},
+			err: ErrSuffixReturning.Error(),
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := BuildInsertE(c.opts)
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("error mismatch: `%v` != `%s`", err, c.err)
+			}
+		})
+	}
+
+	q, args, err := BuildInsertE(InsertOpts{
+		Table: "t1",
+		Data:  &struct{ F1 int }{1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `INSERT INTO "t1" (F1) VALUES ($1)`
+	if q != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", q, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+
+	// BuildInsert does not validate the table for backwards compatibility
+	q, _ = BuildInsert(InsertOpts{Data: struct{ F1 int }{1}})
+	const noTable = `INSERT INTO "" (F1) VALUES ($1)`
+	if q != noTable {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", q, noTable)
+	}
+}
+
+func TestAppendInsert(t *testing.T) {
+	type row struct {
+		F1 *int
+		F2 *string `db:"f2"`
+	}
+	var (
+		i    = 1
+		r    = &row{F1: &i}
+		sql  = append(make([]byte, 0, 256), "SELECT 1;"...)
+		args = append(make([]interface{}, 0, 8), 0)
+		opts = InsertOpts{Table: "t1", Data: r, ArgOffset: 1}
+	)
+	sql, args, err := AppendInsert(sql, args, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `SELECT 1;INSERT INTO "t1" (F1,"f2") VALUES ($2,$3)`
+	if string(sql) != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, std)
+	}
+	stdArgs := []interface{}{0, r.F1, r.F2}
+	if !reflect.DeepEqual(args, stdArgs) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, stdArgs)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		sql, args, err = AppendInsert(sql[:0], args[:0], opts)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs != 0 {
+		t.Fatalf("unexpected allocations: %f", allocs)
+	}
+
+	// Only boxing of the value fields into arguments allocates
+	type valueRow struct {
+		F1 int
+		F2 string
+	}
+	opts.Data = &valueRow{1000, "abc"}
+	allocs = testing.AllocsPerRun(100, func() {
+		sql, args, err = AppendInsert(sql[:0], args[:0], opts)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs > 2 {
+		t.Fatalf("unexpected allocations: %f", allocs)
+	}
+}
+
+func TestCast(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID    int    `db:"id,pk,cast=bigint"`
+		IP    string `db:"ip,cast=inet"`
+		Price string `db:"price,cast=numeric(10,2),nullzero"`
+		Mood  string `db:"mood,cast=mood,expr='ok'"`
+	}
+	data := row{1, "127.0.0.1", "1.50", ""}
+
+	sql, _ := BuildInsert(InsertOpts{Table: "t1", Data: data})
+	const insert = `INSERT INTO "t1" ("id","ip","price","mood") ` +
+		`VALUES ($1::bigint,$2::inet,$3::numeric(10,2),'ok')`
+	if sql != insert {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, insert)
+	}
+
+	sql, _, err := BuildUpdateByPK(ByPKOpts{Table: "t1", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const update = `UPDATE "t1" SET "ip"=$1::inet,"price"=$2::numeric(10,2),` +
+		`"mood"='ok' WHERE "id"=$3::bigint`
+	if sql != update {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, update)
+	}
+}
+
+func TestOverridingSystemValue(t *testing.T) {
+	t.Parallel()
+
+	sql, args := BuildInsert(InsertOpts{
+		Table: "t1",
+		Data: struct {
+			ID   int64 `db:"id"`
+			Name string
+		}{1, "a"},
+		OverridingSystemValue: true,
+	})
+	const std = `INSERT INTO "t1" ("id",Name) OVERRIDING SYSTEM VALUE ` +
+		`VALUES ($1,$2)`
+	if sql != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(1), "a"}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+}
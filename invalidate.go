@@ -0,0 +1,113 @@
+package pg_util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// Channel notified by Invalidate
+	InvalidationChannel = "pg_util_invalidate"
+
+	// Maximum size of a NOTIFY payload in bytes
+	maxNotifyPayload = 7999
+)
+
+// Notify all instances listening with ListenInvalidations to invalidate
+// cached keys, if tx commits. Keys are split into multiple notifications to
+// fit the payload size limit.
+func Invalidate(ctx context.Context, tx pgx.Tx, keys ...string) (err error) {
+	payloads, err := invalidationPayloads(keys)
+	if err != nil {
+		return
+	}
+	for _, p := range payloads {
+		err = NotifyOnCommit(ctx, tx, InvalidationChannel, p)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Encode keys into JSON arrays not exceeding maxNotifyPayload
+func invalidationPayloads(keys []string) (payloads []string, err error) {
+	var w bytes.Buffer
+	flush := func() {
+		if w.Len() != 0 {
+			w.WriteByte(']')
+			payloads = append(payloads, w.String())
+			w.Reset()
+		}
+	}
+
+	for _, k := range keys {
+		enc, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		if len(enc)+2 > maxNotifyPayload {
+			return nil, fmt.Errorf(
+				"pg_util: invalidation key too long: %d bytes",
+				len(k),
+			)
+		}
+		if w.Len()+len(enc)+2 > maxNotifyPayload {
+			flush()
+		}
+		if w.Len() == 0 {
+			w.WriteByte('[')
+		} else {
+			w.WriteByte(',')
+		}
+		w.Write(enc)
+	}
+	flush()
+	return
+}
+
+// Options for calling ListenInvalidations()
+type InvalidationOpts struct {
+	// URL to connect to the database on. Required.
+	ConnectionURL string
+
+	// Called with the keys of each notification of Invalidate committed by
+	// any instance, including this one. Called with nil keys after
+	// reconnecting, as notifications may have been missed, in which case the
+	// entire cache should be invalidated. Required.
+	OnInvalidate func(keys []string)
+
+	// Optional error handler
+	OnError func(err error)
+
+	// Optional context for cancelling listening
+	Context context.Context
+}
+
+// Listen for cache invalidations sent by Invalidate. Run in every instance
+// with an in-memory cache to keep the caches of all instances consistent
+// with the database.
+func ListenInvalidations(opts InvalidationOpts) error {
+	return Listen(ListenOpts{
+		ConnectionURL: opts.ConnectionURL,
+		Channel:       InvalidationChannel,
+		Context:       opts.Context,
+		OnError:       opts.OnError,
+		OnReconnect: func() {
+			opts.OnInvalidate(nil)
+		},
+		OnMsg: func(msg string) (err error) {
+			var keys []string
+			err = json.Unmarshal([]byte(msg), &keys)
+			if err != nil {
+				return
+			}
+			opts.OnInvalidate(keys)
+			return
+		},
+	})
+}
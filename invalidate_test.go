@@ -0,0 +1,127 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestInvalidationPayloads(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("a", 5000)
+
+	cases := [...]struct {
+		name     string
+		keys     []string
+		payloads int
+		err      bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "single payload",
+			keys:     []string{"a", `b"c`},
+			payloads: 1,
+		},
+		{
+			name:     "split",
+			keys:     []string{long, long, "b"},
+			payloads: 2,
+		},
+		{
+			name: "key too long",
+			keys: []string{strings.Repeat("a", maxNotifyPayload)},
+			err:  true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			payloads, err := invalidationPayloads(c.keys)
+			if c.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(payloads) != c.payloads {
+				t.Fatalf("payload count mismatch: %d != %d",
+					len(payloads), c.payloads)
+			}
+
+			var keys []string
+			for _, p := range payloads {
+				if len(p) > maxNotifyPayload {
+					t.Fatalf("payload too long: %d", len(p))
+				}
+				var dec []string
+				err = json.Unmarshal([]byte(p), &dec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, dec...)
+			}
+			if !reflect.DeepEqual(keys, c.keys) {
+				t.Fatalf("key mismatch: %v != %v", keys, c.keys)
+			}
+		})
+	}
+}
+
+func TestListenInvalidations(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	received := make(chan []string, 1)
+	err := ListenInvalidations(InvalidationOpts{
+		ConnectionURL: getURL(t),
+		Context:       ctx,
+		OnInvalidate: func(keys []string) {
+			// Ignore invalidations of other tests
+			if len(keys) != 0 && strings.HasPrefix(keys[0], "invalidate_test") {
+				received <- keys
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	std := []string{"invalidate_test:1", "invalidate_test:2"}
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) error {
+		return Invalidate(ctx, tx, std...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case keys := <-received:
+		if !reflect.DeepEqual(keys, std) {
+			t.Fatalf("key mismatch: %v != %v", keys, std)
+		}
+	case <-ctx.Done():
+		t.Fatal("invalidation not received")
+	}
+}
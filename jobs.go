@@ -0,0 +1,490 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// Table storing queued jobs
+	JobsTable = "pg_util_jobs"
+
+	// Channel notified with the job kind on commit of Enqueue
+	JobsChannel = "pg_util_jobs"
+
+	// Default maximum number of attempts of a job
+	DefaultJobMaxAttempts = 25
+
+	// Minimum duration to wait for the next due job
+	minJobWait = 100 * time.Millisecond
+
+	// Maximum delay between attempts of DefaultJobBackoff
+	maxJobBackoff = time.Hour
+)
+
+// Default delay before retrying a job after its failed attempt number
+// attempt. Starts at 1 second and doubles with each attempt up to 1 hour.
+func DefaultJobBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 13 {
+		// 2^12 seconds already exceed the maximum
+		return maxJobBackoff
+	}
+	d := time.Second << (attempt - 1)
+	if d > maxJobBackoff {
+		d = maxJobBackoff
+	}
+	return d
+}
+
+// Background job stored in JobsTable
+type Job struct {
+	// Unique ID assigned by Enqueue
+	ID int64
+
+	// Kind of the job used to select its handler. Required.
+	Kind string
+
+	// JSON-encodable payload of the job. Set to json.RawMessage for jobs
+	// passed to handlers. Use Decode to unmarshal it.
+	Payload interface{}
+
+	// Number of the current attempt starting from 1. Only set for jobs
+	// passed to handlers.
+	Attempt int
+
+	// Maximum number of attempts, after which the job is marked as failed and
+	// is not retried anymore. Defaults to DefaultJobMaxAttempts.
+	MaxAttempts int
+
+	// Time, before which the job is not run. The job is due immediately, if
+	// zero. See also EnqueueAt and EnqueueIn.
+	RunAt time.Time
+}
+
+// Decode the JSON payload of the job into dst
+func (j Job) Decode(dst interface{}) (err error) {
+	buf, ok := j.Payload.(json.RawMessage)
+	if !ok {
+		buf, err = json.Marshal(j.Payload)
+		if err != nil {
+			return
+		}
+	}
+	return json.Unmarshal(buf, dst)
+}
+
+// Processes a job of a registered kind. Runs in a pseudo nested transaction
+// of the transaction, that claimed the job, so any changes made on tx are
+// committed atomically with the removal of the job.
+type JobHandler func(ctx context.Context, tx pgx.Tx, job Job) error
+
+// Error of a job handler reported to WorkerOpts.OnError
+type JobError struct {
+	Job Job
+
+	// Job was marked as failed and will not be retried
+	Failed bool
+
+	Err error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf(
+		"pg_util: job id=%d kind=%s attempt=%d: %s",
+		e.Job.ID, e.Job.Kind, e.Job.Attempt, e.Err,
+	)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// Create the table used by the job queue, if it does not exist yet
+func CreateJobsTable(ctx context.Context, q Querier) (err error) {
+	_, err = q.Exec(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS `+quoteIdentifier(JobsTable)+` (
+			id bigserial PRIMARY KEY,
+			kind text NOT NULL,
+			payload jsonb NOT NULL DEFAULT 'null',
+			attempts int NOT NULL DEFAULT 0,
+			max_attempts int NOT NULL,
+			last_error text,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			failed_at timestamptz,
+			run_at timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS `+quoteName(JobsTable+"_pending_idx")+`
+			ON `+quoteIdentifier(JobsTable)+` (kind, id)
+			WHERE failed_at IS NULL;
+		CREATE INDEX IF NOT EXISTS `+quoteName(JobsTable+"_run_at_idx")+`
+			ON `+quoteIdentifier(JobsTable)+` (run_at)
+			WHERE failed_at IS NULL`,
+	)
+	return
+}
+
+// Add job to the queue as part of transaction tx. The job only becomes
+// visible to workers, and workers are only woken up, if tx commits.
+//
+// Requires the table created by CreateJobsTable.
+func Enqueue(ctx context.Context, tx pgx.Tx, job Job) (id int64, err error) {
+	return enqueue(ctx, tx, job, 0)
+}
+
+// Like Enqueue, but the job is not run before at
+func EnqueueAt(
+	ctx context.Context,
+	tx pgx.Tx,
+	job Job,
+	at time.Time,
+) (id int64, err error) {
+	job.RunAt = at
+	return enqueue(ctx, tx, job, 0)
+}
+
+// Like Enqueue, but the job is not run before d passes. d is added to the
+// database server time to avoid clock skew between the application and
+// database servers.
+func EnqueueIn(
+	ctx context.Context,
+	tx pgx.Tx,
+	job Job,
+	d time.Duration,
+) (id int64, err error) {
+	job.RunAt = time.Time{}
+	return enqueue(ctx, tx, job, d)
+}
+
+// Insert job due at job.RunAt or after delay from now, if job.RunAt is zero
+func enqueue(
+	ctx context.Context,
+	tx pgx.Tx,
+	job Job,
+	delay time.Duration,
+) (id int64, err error) {
+	if job.Kind == "" {
+		err = errors.New("pg_util: job kind required")
+		return
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultJobMaxAttempts
+	}
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return
+	}
+
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	err = tx.
+		QueryRow(
+			ctx,
+			`INSERT INTO `+quoteIdentifier(JobsTable)+`
+				(kind, payload, max_attempts, run_at)
+			VALUES (
+				$1,
+				$2,
+				$3,
+				coalesce($4::timestamptz, now() + make_interval(secs => $5))
+			)
+			RETURNING id`,
+			job.Kind,
+			string(payload),
+			job.MaxAttempts,
+			runAt,
+			delay.Seconds(),
+		).
+		Scan(&id)
+	if err != nil {
+		return
+	}
+	err = NotifyOnCommit(ctx, tx, JobsChannel, job.Kind)
+	return
+}
+
+// Options for NewWorker
+type WorkerOpts struct {
+	// Connection or pool to claim and process jobs on. Each concurrently
+	// processed job holds a transaction, so a pool is recommended for
+	// Concurrency above 1. Required.
+	Conn TxStarter
+
+	// URL to listen for notifications of enqueued jobs on. Jobs are only
+	// discovered by polling, if empty.
+	ConnectionURL string
+
+	// Number of jobs processed concurrently. Defaults to 1.
+	Concurrency int
+
+	// Maximum interval of polling for jobs, when no notifications arrive.
+	// Workers also wake up, when the earliest delayed job becomes due.
+	// Defaults to 5 seconds.
+	PollInterval time.Duration
+
+	// Delay before retrying a job after its failed attempt number attempt.
+	// Defaults to DefaultJobBackoff.
+	RetryBackoff func(attempt int) time.Duration
+
+	// Optional handler for job and database errors
+	OnError func(err error)
+}
+
+// Claims jobs from JobsTable using FOR UPDATE SKIP LOCKED and dispatches them
+// to handlers registered by kind. Jobs are removed after their handler
+// succeeds. Failed jobs are retried after WorkerOpts.RetryBackoff up to their
+// MaxAttempts.
+type Worker struct {
+	opts WorkerOpts
+
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+// Create a worker. Register handlers with Handle and start it with Run.
+func NewWorker(opts WorkerOpts) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	if opts.RetryBackoff == nil {
+		opts.RetryBackoff = DefaultJobBackoff
+	}
+	return &Worker{
+		opts:     opts,
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+// Register handler for jobs of kind. Replaces any previous handler of kind.
+// Only jobs of kinds with a registered handler are claimed.
+func (w *Worker) Handle(kind string, handler JobHandler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.handlers[kind] = handler
+}
+
+// Return registered job kinds and their handlers
+func (w *Worker) registered() (kinds []string, handlers map[string]JobHandler) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	handlers = make(map[string]JobHandler, len(w.handlers))
+	kinds = make([]string, 0, len(w.handlers))
+	for k, h := range w.handlers {
+		handlers[k] = h
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return
+}
+
+// Process jobs until ctx is done. Waits for jobs in progress to finish
+// before returning.
+func (w *Worker) Run(ctx context.Context) (err error) {
+	if w.opts.Conn == nil {
+		return errors.New("pg_util: worker connection required")
+	}
+
+	wake, err := listenWake(
+		ctx,
+		w.opts.ConnectionURL,
+		JobsChannel,
+		w.opts.Concurrency,
+		w.opts.OnError,
+	)
+	if err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(w.opts.Concurrency)
+	for i := 0; i < w.opts.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			w.process(ctx, wake)
+		}()
+	}
+	wg.Wait()
+	return
+}
+
+// Process jobs until ctx is done, sleeping until woken up, the next delayed
+// job becomes due or the poll interval passes, when no jobs are available
+func (w *Worker) process(ctx context.Context, wake <-chan struct{}) {
+	for {
+		found, wait, err := w.runOne(ctx)
+		if err != nil {
+			found = false
+			wait = w.opts.PollInterval
+			if ctx.Err() == nil {
+				w.handleError(err)
+			}
+		}
+		if found {
+			continue
+		}
+
+		if !sleepOrWake(ctx, wait, wake) {
+			return
+		}
+	}
+}
+
+func (w *Worker) handleError(err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+}
+
+// Claim and process a single due job. Returns, if a job was found, and the
+// duration to wait for the next due job, if not.
+func (w *Worker) runOne(ctx context.Context) (
+	found bool,
+	wait time.Duration,
+	err error,
+) {
+	wait = w.opts.PollInterval
+	kinds, handlers := w.registered()
+	if len(kinds) == 0 {
+		return
+	}
+
+	err = InTransaction(ctx, w.opts.Conn, func(tx pgx.Tx) (err error) {
+		var (
+			job     Job
+			payload []byte
+		)
+		err = tx.
+			QueryRow(
+				ctx,
+				`SELECT id, kind, payload, attempts, max_attempts, run_at
+				FROM `+quoteIdentifier(JobsTable)+`
+				WHERE failed_at IS NULL
+					AND kind = ANY($1)
+					AND run_at <= now()
+				ORDER BY run_at, id
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED`,
+				kinds,
+			).
+			Scan(
+				&job.ID,
+				&job.Kind,
+				&payload,
+				&job.Attempt,
+				&job.MaxAttempts,
+				&job.RunAt,
+			)
+		switch err {
+		case nil:
+			found = true
+		case pgx.ErrNoRows:
+			wait, err = w.nextDue(ctx, tx, kinds)
+			return
+		default:
+			return
+		}
+		job.Payload = json.RawMessage(payload)
+		job.Attempt++
+
+		jobErr := InTransaction(ctx, tx, func(tx pgx.Tx) error {
+			return runJobHandler(ctx, tx, handlers[job.Kind], job)
+		})
+		if jobErr == nil {
+			_, err = tx.Exec(
+				ctx,
+				`DELETE FROM `+quoteIdentifier(JobsTable)+` WHERE id = $1`,
+				job.ID,
+			)
+			return
+		}
+
+		failed := job.Attempt >= job.MaxAttempts
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE `+quoteIdentifier(JobsTable)+`
+			SET attempts = $2,
+				last_error = $3,
+				failed_at = CASE WHEN $4 THEN now() END,
+				run_at = now() + make_interval(secs => $5)
+			WHERE id = $1`,
+			job.ID,
+			job.Attempt,
+			jobErr.Error(),
+			failed,
+			w.opts.RetryBackoff(job.Attempt).Seconds(),
+		)
+		if err != nil {
+			return
+		}
+		w.handleError(&JobError{
+			Job:    job,
+			Failed: failed,
+			Err:    jobErr,
+		})
+		return
+	})
+	return
+}
+
+// Return the duration until the next delayed job of kinds becomes due,
+// limited to the poll interval
+func (w *Worker) nextDue(ctx context.Context, tx pgx.Tx, kinds []string) (
+	wait time.Duration,
+	err error,
+) {
+	wait = w.opts.PollInterval
+	var secs *float64
+	err = tx.
+		QueryRow(
+			ctx,
+			`SELECT EXTRACT(EPOCH FROM min(run_at) - now())::float8
+			FROM `+quoteIdentifier(JobsTable)+`
+			WHERE failed_at IS NULL AND kind = ANY($1)`,
+			kinds,
+		).
+		Scan(&secs)
+	if err != nil || secs == nil {
+		return
+	}
+	if d := time.Duration(*secs * float64(time.Second)); d < wait {
+		wait = d
+		if wait < minJobWait {
+			// Due job locked by another worker. Avoid busy polling.
+			wait = minJobWait
+		}
+	}
+	return
+}
+
+// Run handler on job, converting panics to errors
+func runJobHandler(
+	ctx context.Context,
+	tx pgx.Tx,
+	handler JobHandler,
+	job Job,
+) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+	return handler(ctx, tx, job)
+}
@@ -0,0 +1,362 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestJobDecode(t *testing.T) {
+	t.Parallel()
+
+	type payload struct {
+		N int
+	}
+
+	cases := [...]struct {
+		name string
+		in   interface{}
+	}{
+		{
+			name: "raw",
+			in:   json.RawMessage(`{"N":1}`),
+		},
+		{
+			name: "value",
+			in:   payload{N: 1},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var p payload
+			err := Job{Payload: c.in}.Decode(&p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.N != 1 {
+				t.Fatalf("payload mismatch: %d != 1", p.N)
+			}
+		})
+	}
+}
+
+func TestDefaultJobBackoff(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		attempt int
+		backoff time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{13, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(strconv.Itoa(c.attempt), func(t *testing.T) {
+			t.Parallel()
+
+			if d := DefaultJobBackoff(c.attempt); d != c.backoff {
+				t.Fatalf("expected %s, got %s", c.backoff, d)
+			}
+		})
+	}
+}
+
+func TestWorker(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	err = CreateJobsTable(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pool.Exec(
+		ctx,
+		`DELETE FROM `+JobsTable+`
+		WHERE kind IN ('worker_test_ok', 'worker_test_fail')`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids [2]int64
+	err = InTransaction(ctx, pool, func(tx pgx.Tx) (err error) {
+		ids[0], err = Enqueue(ctx, tx, Job{
+			Kind:    "worker_test_ok",
+			Payload: map[string]int{"N": 1},
+		})
+		if err != nil {
+			return
+		}
+		ids[1], err = Enqueue(ctx, tx, Job{
+			Kind:        "worker_test_fail",
+			MaxAttempts: 1,
+		})
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errFail := errors.New("fail")
+	processed := make(chan int, 1)
+	failed := make(chan *JobError, 1)
+	w := NewWorker(WorkerOpts{
+		Conn:          pool,
+		ConnectionURL: getURL(t),
+		Concurrency:   2,
+		OnError: func(err error) {
+			var jErr *JobError
+			if errors.As(err, &jErr) {
+				failed <- jErr
+			}
+		},
+	})
+	w.Handle(
+		"worker_test_ok",
+		func(ctx context.Context, tx pgx.Tx, job Job) (err error) {
+			var p struct {
+				N int
+			}
+			err = job.Decode(&p)
+			if err != nil {
+				return
+			}
+			processed <- p.N
+			return
+		},
+	)
+	w.Handle(
+		"worker_test_fail",
+		func(context.Context, pgx.Tx, Job) error {
+			return errFail
+		},
+	)
+
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- w.Run(runCtx)
+	}()
+
+	select {
+	case n := <-processed:
+		if n != 1 {
+			t.Fatalf("payload mismatch: %d != 1", n)
+		}
+	case <-ctx.Done():
+		t.Fatal("job not processed")
+	}
+	select {
+	case jErr := <-failed:
+		if jErr.Job.ID != ids[1] || !jErr.Failed || !errors.Is(jErr, errFail) {
+			t.Fatalf("unexpected job error: %v", jErr)
+		}
+	case <-ctx.Done():
+		t.Fatal("job failure not reported")
+	}
+
+	stop()
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		remaining []int64
+		hasFailed bool
+	)
+	remaining, err = QueryValues[int64](
+		ctx,
+		pool,
+		`SELECT id FROM `+JobsTable+` WHERE id = ANY($1)`,
+		ids[:],
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0] != ids[1] {
+		t.Fatalf("remaining jobs mismatch: %v", remaining)
+	}
+	hasFailed, err = QueryValue[bool](
+		ctx,
+		pool,
+		`SELECT failed_at IS NOT NULL FROM `+JobsTable+` WHERE id = $1`,
+		ids[1],
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasFailed {
+		t.Fatal("job not marked as failed")
+	}
+}
+
+func TestWorkerDelayed(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	err = CreateJobsTable(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pool.Exec(
+		ctx,
+		`DELETE FROM `+JobsTable+` WHERE kind = 'worker_delayed_test'`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const delay = time.Second
+	start := time.Now()
+	err = InTransaction(ctx, pool, func(tx pgx.Tx) (err error) {
+		_, err = EnqueueIn(ctx, tx, Job{Kind: "worker_delayed_test"}, delay)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Long poll interval and no notifications ensure the job is picked up by
+	// the due job timer
+	processed := make(chan time.Duration, 1)
+	w := NewWorker(WorkerOpts{
+		Conn:         pool,
+		PollInterval: time.Minute,
+		OnError: func(err error) {
+			t.Error(err)
+		},
+	})
+	w.Handle(
+		"worker_delayed_test",
+		func(context.Context, pgx.Tx, Job) error {
+			processed <- time.Since(start)
+			return nil
+		},
+	)
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go w.Run(runCtx)
+
+	select {
+	case d := <-processed:
+		if d < delay {
+			t.Fatalf("job run too early: %s", d)
+		}
+	case <-ctx.Done():
+		t.Fatal("job not processed")
+	}
+}
+
+func TestWorkerRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	err = CreateJobsTable(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pool.Exec(
+		ctx,
+		`DELETE FROM `+JobsTable+` WHERE kind = 'worker_backoff_test'`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id int64
+	err = InTransaction(ctx, pool, func(tx pgx.Tx) (err error) {
+		id, err = Enqueue(ctx, tx, Job{
+			Kind:        "worker_backoff_test",
+			MaxAttempts: 5,
+		})
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int32
+	w := NewWorker(WorkerOpts{
+		Conn:         pool,
+		PollInterval: 50 * time.Millisecond,
+		RetryBackoff: func(int) time.Duration {
+			return time.Hour
+		},
+	})
+	w.Handle(
+		"worker_backoff_test",
+		func(context.Context, pgx.Tx, Job) error {
+			atomic.AddInt32(&attempts, 1)
+			return errors.New("fail")
+		},
+	)
+
+	// Give the worker plenty of polls to wrongly retry the job
+	runCtx, stop := context.WithTimeout(ctx, time.Second)
+	defer stop()
+	err = w.Run(runCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Fatalf("expected 1 attempt, got %d", n)
+	}
+
+	delayed, err := QueryValue[bool](
+		ctx,
+		pool,
+		`SELECT run_at > now() + interval '59 minutes'
+		FROM `+JobsTable+`
+		WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !delayed {
+		t.Fatal("retry not delayed")
+	}
+}
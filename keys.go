@@ -0,0 +1,164 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Build a `"column" = ANY($1)` condition matching any of keys. keys must be a
+// slice or array. Placeholders start at $offset+1.
+//
+// Integer keys are passed as []int64 and []interface{} keys are converted to
+// a slice of their common element type, so they are always encoded as a
+// Postgres array. Unsigned keys overflowing int64 return an error. Empty or
+// nil keys produce FALSE and no arguments.
+func BuildAny(column string, keys interface{}, offset int) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	arr, n, err := keysArray(keys)
+	switch {
+	case err != nil:
+		return
+	case n == 0:
+		sql = "FALSE"
+		return
+	}
+	sql = fmt.Sprintf("%s = ANY($%d)", quoteName(column), offset+1)
+	args = []interface{}{arr}
+	return
+}
+
+// Delete all rows of table, whose column matches any of keys. Returns the
+// number of deleted rows.
+//
+// See BuildAny for key encoding.
+func DeleteByIDs(
+	ctx context.Context,
+	q Querier,
+	table, column string,
+	keys interface{},
+) (n int64, err error) {
+	if table == "" {
+		err = ErrNoTable
+		return
+	}
+	cond, args, err := BuildAny(column, keys, 0)
+	if err != nil {
+		return
+	}
+	tag, err := q.Exec(
+		ctx,
+		"DELETE FROM "+quoteIdentifier(table)+" WHERE "+cond,
+		args...,
+	)
+	if err != nil {
+		return
+	}
+	n = tag.RowsAffected()
+	return
+}
+
+// Select all rows of table, whose column matches any of keys, into structs of
+// type T.
+//
+// See BuildAny for key encoding and SelectStructs for column mapping rules.
+func SelectByIDs[T any](
+	ctx context.Context,
+	q Querier,
+	table, column string,
+	keys interface{},
+) (rows []T, err error) {
+	cond, args, err := BuildAny(column, keys, 0)
+	if err != nil {
+		return
+	}
+	sql, args, err := BuildSelect(SelectOpts{
+		Table:   table,
+		Columns: (*T)(nil),
+		Where:   cond,
+		Args:    args,
+	})
+	if err != nil {
+		return
+	}
+	err = SelectStructs(ctx, q, &rows, sql, args...)
+	return
+}
+
+// Normalize keys into a value encodable as a Postgres array and return it
+// with the number of keys
+func keysArray(keys interface{}) (arr interface{}, n int, err error) {
+	v := reflect.ValueOf(keys)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+	case reflect.Invalid:
+		return
+	default:
+		err = fmt.Errorf("pg_util: keys must be a slice, got %T", keys)
+		return
+	}
+	n = v.Len()
+	if n == 0 {
+		return
+	}
+
+	elem := v.Type().Elem()
+	if elem.Kind() == reflect.Interface {
+		for i := 0; i < n; i++ {
+			e := v.Index(i)
+			if e.IsNil() {
+				err = fmt.Errorf("pg_util: nil key at index %d", i)
+				return
+			}
+			switch t := e.Elem().Type(); {
+			case i == 0:
+				elem = t
+			case t != elem:
+				err = fmt.Errorf(
+					"pg_util: mixed key types: %s and %s",
+					elem,
+					t,
+				)
+				return
+			}
+		}
+	}
+
+	switch elem.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		elem = reflect.TypeOf(int64(0))
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem() == elem {
+		arr = keys
+		return
+	}
+
+	s := reflect.MakeSlice(reflect.SliceOf(elem), n, n)
+	for i := 0; i < n; i++ {
+		e := v.Index(i)
+		if e.Kind() == reflect.Interface {
+			e = e.Elem()
+		}
+		switch e.Kind() {
+		case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			// Converting would silently wrap around
+			if e.Uint() > math.MaxInt64 {
+				err = fmt.Errorf(
+					"pg_util: key %d at index %d overflows bigint",
+					e.Uint(),
+					i,
+				)
+				return
+			}
+		}
+		s.Index(i).Set(e.Convert(elem))
+	}
+	arr = s.Interface()
+	return
+}
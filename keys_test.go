@@ -0,0 +1,170 @@
+package pg_util
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestBuildAny(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		keys interface{}
+		sql  string
+		args []interface{}
+		err  bool
+	}{
+		{
+			name: "int64",
+			keys: []int64{1, 2},
+			sql:  `"id" = ANY($3)`,
+			args: []interface{}{[]int64{1, 2}},
+		},
+		{
+			name: "int",
+			keys: []int{1, 2},
+			sql:  `"id" = ANY($3)`,
+			args: []interface{}{[]int64{1, 2}},
+		},
+		{
+			name: "uint64",
+			keys: []uint64{1, 2},
+			sql:  `"id" = ANY($3)`,
+			args: []interface{}{[]int64{1, 2}},
+		},
+		{
+			name: "uint64 overflow",
+			keys: []uint64{1, math.MaxUint64},
+			err:  true,
+		},
+		{
+			name: "interface",
+			keys: []interface{}{"a", "b"},
+			sql:  `"id" = ANY($3)`,
+			args: []interface{}{[]string{"a", "b"}},
+		},
+		{
+			name: "array",
+			keys: [2]string{"a", "b"},
+			sql:  `"id" = ANY($3)`,
+			args: []interface{}{[]string{"a", "b"}},
+		},
+		{
+			name: "empty",
+			keys: []int{},
+			sql:  "FALSE",
+		},
+		{
+			name: "nil",
+			sql:  "FALSE",
+		},
+		{
+			name: "mixed",
+			keys: []interface{}{1, "a"},
+			err:  true,
+		},
+		{
+			name: "not a slice",
+			keys: 1,
+			err:  true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, args, err := BuildAny("id", c.keys, 2)
+			if c.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if sql != "" {
+					t.Fatalf("unexpected SQL on error: %s", sql)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args,
+					c.args)
+			}
+		})
+	}
+}
+
+func TestByIDs(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(
+				context.Background(),
+				`create temp table by_ids_test (
+					id bigint primary key,
+					name text not null
+				) on commit drop;
+				insert into by_ids_test (id, name)
+				values (1, 'a'), (2, 'b'), (3, 'c')`,
+			)
+			if err != nil {
+				return
+			}
+
+			type row struct {
+				ID   int64
+				Name string
+			}
+			rows, err := SelectByIDs[row](
+				context.Background(),
+				tx,
+				"by_ids_test",
+				"id",
+				[]int{1, 3},
+			)
+			if err != nil {
+				return
+			}
+			if len(rows) != 2 {
+				t.Fatalf("row count mismatch: %d != 2", len(rows))
+			}
+
+			n, err := DeleteByIDs(
+				context.Background(),
+				tx,
+				"by_ids_test",
+				"id",
+				[]int{1, 2},
+			)
+			if err != nil {
+				return
+			}
+			if n != 2 {
+				t.Fatalf("deleted row count mismatch: %d != 2", n)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,128 @@
+package pg_util
+
+import (
+	"context"
+	"io"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Maximum size of a single read or write of a large object, so streaming
+// never loads more than this into memory at once
+const largeObjectChunkSize = 256 << 10
+
+// Large object reading or writing in chunks of at most largeObjectChunkSize
+type largeObject struct {
+	*pgx.LargeObject
+}
+
+func (o largeObject) Read(p []byte) (n int, err error) {
+	if len(p) > largeObjectChunkSize {
+		p = p[:largeObjectChunkSize]
+	}
+	return o.LargeObject.Read(p)
+}
+
+func (o largeObject) Write(p []byte) (n int, err error) {
+	for len(p) != 0 {
+		chunk := p
+		if len(chunk) > largeObjectChunkSize {
+			chunk = chunk[:largeObjectChunkSize]
+		}
+		var m int
+		m, err = o.LargeObject.Write(chunk)
+		n += m
+		if err != nil {
+			return
+		}
+		p = p[m:]
+	}
+	return
+}
+
+// Create a large object and pass a writer for its contents to fn inside a
+// transaction. The large object is only created, if fn succeeds.
+// Returns the OID of the new large object.
+func WithLargeObjectWriter(
+	ctx context.Context,
+	conn TxStarter,
+	fn func(w io.Writer) error,
+) (oid uint32, err error) {
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		lo := tx.LargeObjects()
+		oid, err = lo.Create(ctx, 0)
+		if err != nil {
+			return
+		}
+		obj, err := lo.Open(ctx, oid, pgx.LargeObjectModeWrite)
+		if err != nil {
+			return
+		}
+		err = fn(largeObject{obj})
+		if err != nil {
+			return
+		}
+		return obj.Close()
+	})
+	if err != nil {
+		oid = 0
+	}
+	return
+}
+
+// Pass a reader of large object oid to fn inside a transaction
+func WithLargeObjectReader(
+	ctx context.Context,
+	conn TxStarter,
+	oid uint32,
+	fn func(r io.ReadSeeker) error,
+) error {
+	return InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		lo := tx.LargeObjects()
+		obj, err := lo.Open(ctx, oid, pgx.LargeObjectModeRead)
+		if err != nil {
+			return
+		}
+		err = fn(largeObject{obj})
+		if err != nil {
+			return
+		}
+		return obj.Close()
+	})
+}
+
+// Stream r into a new large object and return its OID
+func ImportLargeObject(ctx context.Context, conn TxStarter, r io.Reader) (
+	oid uint32,
+	err error,
+) {
+	return WithLargeObjectWriter(ctx, conn, func(w io.Writer) (err error) {
+		_, err = io.Copy(w, r)
+		return
+	})
+}
+
+// Stream the contents of large object oid to w and return the number of
+// written bytes
+func ExportLargeObject(
+	ctx context.Context,
+	conn TxStarter,
+	oid uint32,
+	w io.Writer,
+) (n int64, err error) {
+	err = WithLargeObjectReader(ctx, conn, oid, func(r io.ReadSeeker) (
+		err error,
+	) {
+		n, err = io.Copy(w, r)
+		return
+	})
+	return
+}
+
+// Delete large object oid
+func DeleteLargeObject(ctx context.Context, q Querier, oid uint32) (
+	err error,
+) {
+	_, err = q.Exec(ctx, `SELECT lo_unlink($1)`, oid)
+	return
+}
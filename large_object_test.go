@@ -0,0 +1,87 @@
+package pg_util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestLargeObject(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	// Larger than a single chunk
+	data := make([]byte, largeObjectChunkSize*2+100)
+	rand.Read(data)
+
+	oid, err := ImportLargeObject(ctx, conn, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteLargeObject(ctx, conn, oid)
+
+	var buf bytes.Buffer
+	n, err := ExportLargeObject(ctx, conn, oid, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("exported data mismatch: %d bytes", n)
+	}
+
+	err = WithLargeObjectReader(ctx, conn, oid, func(r io.ReadSeeker) (
+		err error,
+	) {
+		_, err = r.Seek(-10, io.SeekEnd)
+		if err != nil {
+			return
+		}
+		tail, err := io.ReadAll(r)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(tail, data[len(data)-10:]) {
+			t.Fatal("tail mismatch")
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLargeObjectWriterRollback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	oid, err := WithLargeObjectWriter(ctx, conn, func(w io.Writer) error {
+		_, err := w.Write([]byte("partial"))
+		if err != nil {
+			return err
+		}
+		return io.ErrUnexpectedEOF
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oid != 0 {
+		t.Fatalf("unexpected oid: %d", oid)
+	}
+}
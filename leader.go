@@ -0,0 +1,171 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Options for calling LeaderElector()
+type LeaderElectorOpts struct {
+	// URL to connect to the database on. A dedicated connection holds the
+	// leadership lock. Required.
+	ConnectionURL string
+
+	// Name of the election. All candidates of the same election must use the
+	// same name. Required.
+	Name string
+
+	// Called, when this process becomes the leader. ctx is cancelled on
+	// resignation and can be used to stop singleton workers. Must not block.
+	// Required.
+	OnElected func(ctx context.Context)
+
+	// Optional handler for loss of leadership, including shutdown through
+	// Context
+	OnResigned func()
+
+	// Optional error handler
+	OnError func(err error)
+
+	// Interval of trying to acquire leadership by followers and checking the
+	// connection by the leader. Defaults to 1 second.
+	Interval time.Duration
+
+	// Optional context for stopping the election. Leadership is resigned,
+	// once it is done.
+	Context context.Context
+}
+
+// LeaderElector runs a leader election between all processes using the same
+// opts.Name, so singleton background workers can be coordinated without
+// external services.
+//
+// Leadership is a session-level advisory lock held on a dedicated connection.
+// The leader pings the database every Interval and resigns, if a ping fails
+// or does not respond within Interval. It then reconnects and competes for
+// leadership again. The database releases the lock of a lost connection only
+// once it detects the loss, so failover may be delayed by up to the TCP
+// keepalive timeout of the server.
+//
+// At most one process is the leader at any time on a best-effort basis: a
+// partitioned leader resigns within two Intervals, but the guarantee only
+// holds, if the server takes longer than that to drop the lost connection.
+//
+// The election runs in the background. Only invalid opts and the first
+// connection failure are returned as errors.
+func LeaderElector(opts LeaderElectorOpts) (err error) {
+	if opts.Name == "" || opts.OnElected == nil {
+		return errors.New("pg_util: election Name and OnElected required")
+	}
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+
+	conn, err := pgx.Connect(opts.Context, opts.ConnectionURL)
+	if err != nil {
+		return
+	}
+	e := leaderElection{
+		opts: opts,
+		key:  LockKeyString("pg_util_leader:" + opts.Name),
+	}
+	go e.run(conn)
+	return
+}
+
+// Running leader election
+type leaderElection struct {
+	opts LeaderElectorOpts
+	key  AdvisoryLockKey
+}
+
+func (e leaderElection) handleError(format string, args ...interface{}) {
+	if e.opts.OnError != nil {
+		e.opts.OnError(fmt.Errorf("pg_util: "+format, args...))
+	}
+}
+
+// Compete for leadership on conn and reconnect on connection loss until the
+// context is done
+func (e leaderElection) run(conn *pgx.Conn) {
+	ctx := e.opts.Context
+	for {
+		err := e.campaign(conn)
+		conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		e.handleError("leader election name=%s error=%s", e.opts.Name, err)
+
+		conn, err = ConnectWithRetry(ctx, e.opts.ConnectionURL, ConnectOpts{
+			Backoff:    e.opts.Interval,
+			MaxBackoff: e.opts.Interval,
+			OnError: func(_ int, err error) {
+				e.handleError(
+					"reconnecting leader election name=%s error=%s",
+					e.opts.Name, err,
+				)
+			},
+		})
+		if err != nil {
+			// Context done
+			return
+		}
+	}
+}
+
+// Acquire and hold leadership on conn until the connection fails or the
+// context is done
+func (e leaderElection) campaign(conn *pgx.Conn) (err error) {
+	ctx := e.opts.Context
+	for {
+		var acquired bool
+		acquired, err = TryAdvisoryLock(ctx, conn, e.key)
+		if err != nil {
+			return
+		}
+		if acquired {
+			return e.lead(conn)
+		}
+		if !sleepOrWake(ctx, e.opts.Interval, nil) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Hold leadership on conn until the connection fails or the context is done
+func (e leaderElection) lead(conn *pgx.Conn) (err error) {
+	ctx, cancel := context.WithCancel(e.opts.Context)
+	defer func() {
+		cancel()
+		if e.opts.OnResigned != nil {
+			e.opts.OnResigned()
+		}
+	}()
+	e.opts.OnElected(ctx)
+
+	for {
+		if !sleepOrWake(ctx, e.opts.Interval, nil) {
+			return ctx.Err()
+		}
+		err = e.ping(ctx, conn)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Check the connection, failing, if it does not respond within the interval
+func (e leaderElection) ping(ctx context.Context, conn *pgx.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, e.opts.Interval)
+	defer cancel()
+
+	return conn.Ping(ctx)
+}
@@ -0,0 +1,75 @@
+package pg_util
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaderElector(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	elected := make(chan int, 2)
+	resigned := make(chan int, 2)
+	var cancels [2]context.CancelFunc
+	for i := 0; i < 2; i++ {
+		i := i
+		var candidateCtx context.Context
+		candidateCtx, cancels[i] = context.WithCancel(ctx)
+		defer cancels[i]()
+
+		err := LeaderElector(LeaderElectorOpts{
+			ConnectionURL: getURL(t),
+			Name:          "leader_elector_test",
+			Context:       candidateCtx,
+			Interval:      100 * time.Millisecond,
+			OnElected: func(context.Context) {
+				elected <- i
+			},
+			OnResigned: func() {
+				resigned <- i
+			},
+			OnError: func(err error) {
+				t.Error(err)
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var leader int
+	select {
+	case leader = <-elected:
+	case <-ctx.Done():
+		t.Fatal("no leader elected")
+	}
+
+	// Only one leader at a time
+	select {
+	case i := <-elected:
+		t.Fatalf("second leader elected: %d", i)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	cancels[leader]()
+	select {
+	case i := <-resigned:
+		if i != leader {
+			t.Fatalf("resigned mismatch: %d != %d", i, leader)
+		}
+	case <-ctx.Done():
+		t.Fatal("leader did not resign")
+	}
+	select {
+	case i := <-elected:
+		if i == leader {
+			t.Fatal("resigned leader reelected")
+		}
+	case <-ctx.Done():
+		t.Fatal("no new leader elected")
+	}
+}
@@ -193,3 +193,67 @@ func Listen(opts ListenOpts) (err error) {
 
 	return
 }
+
+// Send a notification with payload on channel as part of transaction tx.
+// Postgres only delivers the notification, if the transaction commits, so
+// paired with Listen this enables reliable event flows, where listeners never
+// observe events of rolled back changes.
+//
+// Notifications with identical channel and payload in the same transaction
+// are delivered only once.
+func NotifyOnCommit(
+	ctx context.Context,
+	tx pgx.Tx,
+	channel, payload string,
+) (err error) {
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, payload)
+	return
+}
+
+// Listen on channel and return a channel receiving a value for each
+// notification. Notifications exceeding the buffer size n are coalesced. The
+// returned channel never receives, if url is empty.
+func listenWake(
+	ctx context.Context,
+	url, channel string,
+	n int,
+	onError func(error),
+) (wake chan struct{}, err error) {
+	wake = make(chan struct{}, n)
+	if url == "" {
+		return
+	}
+	err = Listen(ListenOpts{
+		ConnectionURL: url,
+		Channel:       channel,
+		Context:       ctx,
+		OnError:       onError,
+		OnMsg: func(string) error {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+	})
+	return
+}
+
+// Sleep for d or until a value is received from wake. Returns false, if ctx
+// was done first.
+func sleepOrWake(
+	ctx context.Context,
+	d time.Duration,
+	wake <-chan struct{},
+) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-wake:
+	case <-timer.C:
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package pg_util
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -113,3 +114,51 @@ func TestReconnect(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestNotifyOnCommit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	listener, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close(ctx)
+	_, err = listener.Exec(ctx, `listen notify_on_commit_test`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	errFail := errors.New("fail")
+	for _, payload := range [...]string{"rolled back", "committed"} {
+		err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+			err = NotifyOnCommit(ctx, tx, "notify_on_commit_test", payload)
+			if err != nil {
+				return
+			}
+			if payload == "rolled back" {
+				return errFail
+			}
+			return
+		})
+		if err != nil && err != errFail {
+			t.Fatal(err)
+		}
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	n, err := listener.WaitForNotification(wctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Payload != "committed" {
+		t.Fatalf("payload mismatch: %s != committed", n.Payload)
+	}
+}
@@ -0,0 +1,189 @@
+package pg_util
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Information about a statement executed on a transaction wrapped by LogTx
+type StatementLog struct {
+	// Executed statement
+	SQL string
+
+	// Arguments of the statement
+	Args []interface{}
+
+	// Time from sending the statement to receiving its result. For Query
+	// this includes iterating the rows until they are closed.
+	Duration time.Duration
+
+	// Number of rows affected by Exec or returned by Query and QueryRow
+	Rows int64
+
+	// Error of the statement, if any
+	Err error
+}
+
+// Wrap conn, so that all transactions started on it are wrapped with LogTx.
+// Allows drop-in statement logging for code passing a TxStarter to
+// InTransaction and its variants.
+//
+// Transaction options are supported, if conn implements TxOptionsStarter.
+func LogTxStarter(conn TxStarter, fn func(StatementLog)) TxOptionsStarter {
+	return loggingTxStarter{conn, fn}
+}
+
+type loggingTxStarter struct {
+	conn TxStarter
+	fn   func(StatementLog)
+}
+
+func (l loggingTxStarter) Begin(ctx context.Context) (pgx.Tx, error) {
+	return l.BeginTx(ctx, pgx.TxOptions{})
+}
+
+func (l loggingTxStarter) BeginTx(ctx context.Context, opts pgx.TxOptions) (
+	tx pgx.Tx,
+	err error,
+) {
+	tx, err = beginTx(ctx, l.conn, opts)
+	if err != nil {
+		return
+	}
+	tx = LogTx(tx, l.fn)
+	return
+}
+
+// Wrap tx, so that every statement executed through Exec, Query and QueryRow
+// on it or on pseudo nested transactions started from it is passed to fn.
+// SendBatch and CopyFrom are not logged.
+//
+// fn is called synchronously after the statement finishes and must be safe
+// for concurrent use, if used for multiple transactions.
+func LogTx(tx pgx.Tx, fn func(StatementLog)) pgx.Tx {
+	return &loggingTx{tx, fn}
+}
+
+type loggingTx struct {
+	pgx.Tx
+	fn func(StatementLog)
+}
+
+func (l *loggingTx) Begin(ctx context.Context) (tx pgx.Tx, err error) {
+	tx, err = l.Tx.Begin(ctx)
+	if err != nil {
+		return
+	}
+	tx = LogTx(tx, l.fn)
+	return
+}
+
+func (l *loggingTx) Exec(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (tag pgconn.CommandTag, err error) {
+	start := time.Now()
+	tag, err = l.Tx.Exec(ctx, sql, args...)
+	l.fn(StatementLog{
+		SQL:      sql,
+		Args:     args,
+		Duration: time.Since(start),
+		Rows:     tag.RowsAffected(),
+		Err:      err,
+	})
+	return
+}
+
+func (l *loggingTx) Query(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgx.Rows, error) {
+	log := StatementLog{
+		SQL:  sql,
+		Args: args,
+	}
+	start := time.Now()
+	rows, err := l.Tx.Query(ctx, sql, args...)
+	if err != nil {
+		log.Duration = time.Since(start)
+		log.Err = err
+		l.fn(log)
+		return rows, err
+	}
+	return &loggingRows{
+		Rows:  rows,
+		fn:    l.fn,
+		start: start,
+		log:   log,
+	}, nil
+}
+
+func (l *loggingTx) QueryRow(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) pgx.Row {
+	start := time.Now()
+	return loggingRow{
+		Row:   l.Tx.QueryRow(ctx, sql, args...),
+		fn:    l.fn,
+		start: start,
+		log: StatementLog{
+			SQL:  sql,
+			Args: args,
+		},
+	}
+}
+
+// Rows, that log their statement once closed
+type loggingRows struct {
+	pgx.Rows
+	fn     func(StatementLog)
+	start  time.Time
+	log    StatementLog
+	closed bool
+}
+
+func (r *loggingRows) Next() bool {
+	if r.Rows.Next() {
+		r.log.Rows++
+		return true
+	}
+	r.Close()
+	return false
+}
+
+func (r *loggingRows) Close() {
+	r.Rows.Close()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.log.Duration = time.Since(r.start)
+	r.log.Err = r.Rows.Err()
+	r.fn(r.log)
+}
+
+// Row, that logs its statement once scanned
+type loggingRow struct {
+	pgx.Row
+	fn    func(StatementLog)
+	start time.Time
+	log   StatementLog
+}
+
+func (r loggingRow) Scan(dest ...interface{}) (err error) {
+	err = r.Row.Scan(dest...)
+	r.log.Duration = time.Since(r.start)
+	r.log.Err = err
+	if err == nil {
+		r.log.Rows = 1
+	}
+	r.fn(r.log)
+	return
+}
@@ -0,0 +1,93 @@
+package pg_util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestLogTxStarter(t *testing.T) {
+	t.Parallel()
+
+	var logs []StatementLog
+	conn := LogTxStarter(fakeTxStarter{}, func(l StatementLog) {
+		logs = append(logs, l)
+	})
+
+	err := InTransaction(context.Background(), conn, func(tx pgx.Tx) error {
+		return ExecAll(context.Background(), tx, "a", "fail")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(logs) != 2 {
+		t.Fatalf("log count mismatch: %d != 2", len(logs))
+	}
+	if logs[0].SQL != "a" || logs[0].Err != nil {
+		t.Fatalf("unexpected log: %+v", logs[0])
+	}
+	if logs[1].SQL != "fail" || logs[1].Err == nil {
+		t.Fatalf("unexpected log: %+v", logs[1])
+	}
+
+	_, err = conn.BeginTx(
+		context.Background(),
+		pgx.TxOptions{IsoLevel: pgx.Serializable},
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLogTx(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	var logs []StatementLog
+	err = InTransaction(
+		ctx,
+		LogTxStarter(conn, func(l StatementLog) {
+			logs = append(logs, l)
+		}),
+		func(tx pgx.Tx) (err error) {
+			// Nested transactions are logged too
+			return InTransaction(ctx, tx, func(tx pgx.Tx) (err error) {
+				_, err = QueryValues[int](ctx, tx,
+					"select generate_series(1, $1)", 3)
+				if err != nil {
+					return
+				}
+				_, err = QueryValue[int](ctx, tx, "select 1")
+				return
+			})
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	std := []struct {
+		sql  string
+		rows int64
+	}{
+		{"select generate_series(1, $1)", 3},
+		{"select 1", 1},
+	}
+	if len(logs) != len(std) {
+		t.Fatalf("log count mismatch: %d != %d", len(logs), len(std))
+	}
+	for i, s := range std {
+		l := logs[i]
+		if l.SQL != s.sql || l.Rows != s.rows || l.Err != nil {
+			t.Fatalf("unexpected log: %+v", l)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package pg_util
+
+import (
+	"strings"
+)
+
+// Options for building a TRUNCATE statement
+type TruncateOpts struct {
+	// Tables to truncate. Required.
+	Tables []string
+
+	// Reset sequences owned by columns of the truncated tables
+	RestartIdentity bool
+
+	// Also truncate all tables, that have foreign-key references to any of the
+	// truncated tables
+	Cascade bool
+}
+
+// Build TRUNCATE statement with safely quoted table names
+func BuildTruncate(o TruncateOpts) (sql string, err error) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildTruncate", start, sql, 0, false)
+	}()
+
+	if len(o.Tables) == 0 {
+		err = ErrNoTable
+		return
+	}
+
+	var w strings.Builder
+	w.WriteString("TRUNCATE ")
+	writeTableList(&w, o.Tables)
+	if o.RestartIdentity {
+		w.WriteString(" RESTART IDENTITY")
+	}
+	if o.Cascade {
+		w.WriteString(" CASCADE")
+	}
+	sql = w.String()
+	return
+}
+
+// Options for building a VACUUM statement
+type VacuumOpts struct {
+	// Tables to vacuum. If empty, all tables in the current database are
+	// vacuumed.
+	Tables []string
+
+	// Reclaim more space by rewriting the entire table
+	Full bool
+
+	// Aggressively freeze tuples
+	Freeze bool
+
+	// Print a detailed vacuum activity report
+	Verbose bool
+
+	// Also update statistics used by the planner
+	Analyze bool
+}
+
+// Build VACUUM statement with safely quoted table names.
+//
+// Note that VACUUM can not be executed inside a transaction block.
+func BuildVacuum(o VacuumOpts) (sql string) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildVacuum", start, sql, 0, false)
+	}()
+
+	var w strings.Builder
+	w.WriteString("VACUUM")
+	var opts []string
+	for _, o := range [...]struct {
+		name    string
+		enabled bool
+	}{
+		{"FULL", o.Full},
+		{"FREEZE", o.Freeze},
+		{"VERBOSE", o.Verbose},
+		{"ANALYZE", o.Analyze},
+	} {
+		if o.enabled {
+			opts = append(opts, o.name)
+		}
+	}
+	if len(opts) != 0 {
+		w.WriteString(" (")
+		w.WriteString(strings.Join(opts, ","))
+		w.WriteByte(')')
+	}
+	if len(o.Tables) != 0 {
+		w.WriteByte(' ')
+		writeTableList(&w, o.Tables)
+	}
+	sql = w.String()
+	return
+}
+
+// Options for building an ANALYZE statement
+type AnalyzeOpts struct {
+	// Tables to analyze. If empty, all tables in the current database are
+	// analyzed.
+	Tables []string
+
+	// Print progress messages
+	Verbose bool
+}
+
+// Build ANALYZE statement with safely quoted table names
+func BuildAnalyze(o AnalyzeOpts) (sql string) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildAnalyze", start, sql, 0, false)
+	}()
+
+	var w strings.Builder
+	w.WriteString("ANALYZE")
+	if o.Verbose {
+		w.WriteString(" (VERBOSE)")
+	}
+	if len(o.Tables) != 0 {
+		w.WriteByte(' ')
+		writeTableList(&w, o.Tables)
+	}
+	sql = w.String()
+	return
+}
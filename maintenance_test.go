@@ -0,0 +1,78 @@
+package pg_util
+
+import (
+	"testing"
+)
+
+func TestBuildMaintenance(t *testing.T) {
+	t.Parallel()
+
+	truncate := func(o TruncateOpts) string {
+		sql, err := BuildTruncate(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sql
+	}
+
+	cases := [...]struct {
+		name, sql, std string
+	}{
+		{
+			name: "truncate",
+			sql:  truncate(TruncateOpts{Tables: []string{"t1"}}),
+			std:  `TRUNCATE "t1"`,
+		},
+		{
+			name: "truncate with options",
+			sql: truncate(TruncateOpts{
+				Tables:          []string{"t1", `t"2`},
+				RestartIdentity: true,
+				Cascade:         true,
+			}),
+			std: `TRUNCATE "t1","t""2" RESTART IDENTITY CASCADE`,
+		},
+		{
+			name: "vacuum",
+			sql:  BuildVacuum(VacuumOpts{}),
+			std:  `VACUUM`,
+		},
+		{
+			name: "vacuum with options",
+			sql: BuildVacuum(VacuumOpts{
+				Tables:  []string{"t1"},
+				Full:    true,
+				Analyze: true,
+			}),
+			std: `VACUUM (FULL,ANALYZE) "t1"`,
+		},
+		{
+			name: "analyze",
+			sql: BuildAnalyze(AnalyzeOpts{
+				Tables:  []string{"t1", "t2"},
+				Verbose: true,
+			}),
+			std: `ANALYZE (VERBOSE) "t1","t2"`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if c.sql != c.std {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", c.sql, c.std)
+			}
+		})
+	}
+}
+
+func TestBuildTruncateNoTables(t *testing.T) {
+	t.Parallel()
+
+	_, err := BuildTruncate(TruncateOpts{})
+	if err != ErrNoTable {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package pg_util
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var mergeCache sync.Map
+
+// Action to take on rows matched or not matched by a MERGE statement
+type MergeAction int
+
+const (
+	// UPDATE for matched and INSERT for not matched rows
+	MergeDefault MergeAction = iota
+
+	// Update matched rows. Only valid for MergeOpts.Matched.
+	MergeUpdate
+
+	// Delete matched rows. Only valid for MergeOpts.Matched.
+	MergeDelete
+
+	// Insert not matched rows. Only valid for MergeOpts.NotMatched.
+	MergeInsert
+
+	// Do nothing
+	MergeDoNothing
+)
+
+// Options for building a MERGE statement for a single source row. Requires
+// PostgreSQL 15 or later.
+type MergeOpts struct {
+	// Table to merge into. Required.
+	Table string
+
+	// Struct or pointer to struct with the source row. See InsertOpts.Data for
+	// column mapping rules.
+	Data interface{}
+
+	// Use the exact case of Go field names for columns not set through a tag.
+	// By default such names are converted to lowercase, matching Postgres case
+	// folding of unquoted identifiers.
+	QuoteAll bool
+
+	// Columns to match target rows on. Defaults to the columns tagged with
+	// ",pk".
+	On []string
+
+	// Action to take on matched rows. Defaults to MergeUpdate.
+	Matched MergeAction
+
+	// Optional raw SQL condition, that matched rows must also satisfy for
+	// Matched to be applied
+	MatchedCondition string
+
+	// Columns to update on matched rows. Defaults to all columns not in On.
+	UpdateColumns []string
+
+	// Action to take, if no row matched. Defaults to MergeInsert.
+	NotMatched MergeAction
+
+	// Optional prefix to statement
+	Prefix string
+
+	// Shift generated placeholders by ArgOffset, so the statement can be
+	// appended to other SQL, whose arguments occupy the first ArgOffset
+	// positions. The returned arguments do not include these.
+	ArgOffset int
+
+	// Optional suffix to statement
+	Suffix string
+}
+
+// Build and cache a MERGE statement, that updates or deletes the rows of
+// Table matching Data on the On columns and inserts Data, if none matched.
+// Unlike ON CONFLICT, does not require a unique index on the On columns.
+//
+// See MergeOpts for further documentation.
+func BuildMerge(o MergeOpts) (sql string, args []interface{}, err error) {
+	var (
+		start  = buildStart()
+		cached bool
+	)
+	defer func() {
+		reportBuild("BuildMerge", start, sql, len(args), cached)
+	}()
+
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	switch o.Matched {
+	case MergeDefault:
+		o.Matched = MergeUpdate
+	case MergeUpdate, MergeDelete, MergeDoNothing:
+	default:
+		err = fmt.Errorf("pg_util: invalid action for matched rows: %d",
+			o.Matched)
+		return
+	}
+	switch o.NotMatched {
+	case MergeDefault:
+		o.NotMatched = MergeInsert
+	case MergeInsert, MergeDoNothing:
+	default:
+		err = fmt.Errorf("pg_util: invalid action for not matched rows: %d",
+			o.NotMatched)
+		return
+	}
+
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return
+	}
+	on, update, err := resolveUpsertColumns(
+		meta,
+		o.On,
+		o.UpdateColumns,
+		o.QuoteAll,
+	)
+	if err != nil {
+		return
+	}
+
+	// Parameters are referenced by column, as they are used in multiple
+	// clauses
+	values := make(map[string]string, len(meta.writable))
+	for _, c := range meta.writable {
+		id := c.identifier(o.QuoteAll)
+		if c.expr != "" {
+			values[id] = c.expr
+			continue
+		}
+		args, err = c.appendValue(args, v)
+		if err != nil {
+			return
+		}
+		var w strings.Builder
+		c.writePlaceholder(&w, o.ArgOffset+len(args)-1)
+		values[id] = w.String()
+	}
+
+	k := struct {
+		table, prefix, suffix, cond, on, update string
+		matched, notMatched                     MergeAction
+		argOffset                               int
+		quoteAll                                bool
+		typ                                     reflect.Type
+	}{
+		table:      o.Table,
+		prefix:     o.Prefix,
+		suffix:     o.Suffix,
+		cond:       o.MatchedCondition,
+		on:         strings.Join(on, "\x00"),
+		update:     strings.Join(update, "\x00"),
+		matched:    o.Matched,
+		notMatched: o.NotMatched,
+		argOffset:  o.ArgOffset,
+		quoteAll:   o.QuoteAll,
+		typ:        v.Type(),
+	}
+	if _sql, ok := mergeCache.Load(k); ok {
+		sql = _sql.(string)
+		cached = true
+		return
+	}
+
+	value := func(id string) (string, error) {
+		val, ok := values[id]
+		if !ok {
+			return "", &UnknownColumnError{id, meta.typ}
+		}
+		return val, nil
+	}
+
+	var w strings.Builder
+	writePrefix(&w, o.Prefix)
+	w.WriteString("MERGE INTO ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(" USING (SELECT) AS pg_util_source ON ")
+	for i, id := range on {
+		if i != 0 {
+			w.WriteString(" AND ")
+		}
+		val, err := value(id)
+		if err != nil {
+			return "", nil, err
+		}
+		w.WriteString(quoteName(id))
+		w.WriteByte('=')
+		w.WriteString(val)
+	}
+
+	w.WriteString(" WHEN MATCHED")
+	if o.MatchedCondition != "" {
+		w.WriteString(" AND ")
+		w.WriteString(o.MatchedCondition)
+	}
+	w.WriteString(" THEN ")
+	switch {
+	case o.Matched == MergeDelete:
+		w.WriteString("DELETE")
+	case o.Matched == MergeDoNothing || len(update) == 0:
+		w.WriteString("DO NOTHING")
+	default:
+		w.WriteString("UPDATE SET ")
+		for i, id := range update {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			val, err := value(id)
+			if err != nil {
+				return "", nil, err
+			}
+			w.WriteString(quoteName(id))
+			w.WriteByte('=')
+			w.WriteString(val)
+		}
+	}
+
+	w.WriteString(" WHEN NOT MATCHED THEN ")
+	if o.NotMatched == MergeDoNothing {
+		w.WriteString("DO NOTHING")
+	} else {
+		w.WriteString("INSERT (")
+		for i, c := range meta.writable {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(quoteName(c.identifier(o.QuoteAll)))
+		}
+		w.WriteString(") VALUES (")
+		for i, c := range meta.writable {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(values[c.identifier(o.QuoteAll)])
+		}
+		w.WriteByte(')')
+	}
+	writeSuffix(&w, o.Suffix)
+
+	sql = w.String()
+	mergeCache.Store(k, sql)
+	return
+}
@@ -0,0 +1,108 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildMerge(t *testing.T) {
+	t.Parallel()
+
+	const (
+		on     = `MERGE INTO "t12" USING (SELECT) AS pg_util_source ON "id"=$1`
+		insert = ` WHEN NOT MATCHED THEN INSERT ("id","name","updated_at") ` +
+			`VALUES ($1,$2,now())`
+	)
+
+	cases := [...]struct {
+		name, sql string
+		opts      MergeOpts
+	}{
+		{
+			name: "defaults",
+			opts: MergeOpts{},
+			sql: on + ` WHEN MATCHED THEN UPDATE SET "name"=$2,` +
+				`"updated_at"=now()` + insert,
+		},
+		{
+			name: "delete on match",
+			opts: MergeOpts{
+				Matched:          MergeDelete,
+				MatchedCondition: `"name" = ''`,
+			},
+			sql: on + ` WHEN MATCHED AND "name" = '' THEN DELETE` + insert,
+		},
+		{
+			name: "do nothing",
+			opts: MergeOpts{
+				On:            []string{"id", "name"},
+				UpdateColumns: []string{"updated_at"},
+				NotMatched:    MergeDoNothing,
+				ArgOffset:     2,
+				Suffix:        "RETURNING id",
+			},
+			sql: `MERGE INTO "t12" USING (SELECT) AS pg_util_source ` +
+				`ON "id"=$3 AND "name"=$4 ` +
+				`WHEN MATCHED THEN UPDATE SET "updated_at"=now() ` +
+				`WHEN NOT MATCHED THEN DO NOTHING RETURNING id`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			c.opts.Table = "t12"
+			c.opts.Data = upsertRow{ID: 1, Name: "a"}
+			sql, args, err := BuildMerge(c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, []interface{}{1, "a"}) {
+				t.Fatalf("argument list mismatch: `%+v`", args)
+			}
+		})
+	}
+}
+
+func TestBuildMergeErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		opts MergeOpts
+	}{
+		{"no table", MergeOpts{Data: upsertRow{}}},
+		{"invalid matched", MergeOpts{
+			Table:   "t12",
+			Data:    upsertRow{},
+			Matched: MergeInsert,
+		}},
+		{"invalid not matched", MergeOpts{
+			Table:      "t12",
+			Data:       upsertRow{},
+			NotMatched: MergeDelete,
+		}},
+		{"unknown column", MergeOpts{
+			Table: "t12",
+			Data:  upsertRow{},
+			On:    []string{"nope"},
+		}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := BuildMerge(c.opts)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
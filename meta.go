@@ -0,0 +1,464 @@
+package pg_util
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var structMetaCache sync.Map
+
+// Error returned, when a type can not be mapped to table columns
+type InvalidTypeError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidTypeError) Error() string {
+	return fmt.Sprintf("pg_util: Data must be a struct, got %v", e.Type)
+}
+
+// Cached description of the columns of a struct type
+type structMeta struct {
+	// Described struct type
+	typ reflect.Type
+
+	columns []columnMeta
+
+	// Pointer to type implements BeforeInserter
+	beforeInsert bool
+
+	// Pointers to all columns
+	all []*columnMeta
+
+	// Columns written by INSERT and UPDATE statements
+	writable []*columnMeta
+
+	// Columns generated by the database, that are excluded from INSERT and
+	// UPDATE statements and fetched through RETURNING instead
+	generated []*columnMeta
+
+	// Column indices by exact name of quoted columns and lowercase name of
+	// unquoted columns
+	byName map[string]int
+}
+
+// Find column matching a column name in a query result, following Postgres
+// case folding rules for unquoted identifiers
+func (m *structMeta) lookup(name string) (c *columnMeta, ok bool) {
+	i, ok := m.byName[name]
+	if !ok {
+		i, ok = m.byName[strings.ToLower(name)]
+		if !ok || m.columns[i].quote {
+			return nil, false
+		}
+	}
+	return &m.columns[i], true
+}
+
+// Description of a single column mapped to a struct field
+type columnMeta struct {
+	// Column name
+	name string
+
+	// Name was set explicitly through a tag and must be quoted
+	quote bool
+
+	// Convert value to a string before passing it to the driver
+	toString bool
+
+	// Column is part of the primary key
+	pk bool
+
+	// Write zero values as NULL
+	nullZero bool
+
+	// Column is generated by the database and never written
+	generated bool
+
+	// Column is only read and never written
+	readOnly bool
+
+	// Raw SQL expression to use instead of the field value
+	expr string
+
+	// Postgres type to cast the placeholder of the value to
+	cast string
+
+	// Field index path from the root struct
+	index []int
+
+	// Struct type declaring the field and Go name of the field
+	owner reflect.Type
+	field string
+
+	// Raw tag options following the name
+	options []string
+}
+
+// Write column name to w, quoting it, if required or quoteAll is set
+func (c *columnMeta) writeName(w *strings.Builder, quoteAll bool) {
+	// Do not quote names without specified tags to preserve case
+	// insensitivity
+	if c.quote || quoteAll {
+		w.WriteString(quoteName(c.name))
+	} else {
+		w.WriteString(c.name)
+	}
+}
+
+// Write placeholder $offset+1 for the column value followed by a type cast,
+// if any
+func (c *columnMeta) writePlaceholder(w *strings.Builder, offset int) {
+	writePlaceholders(w, 1, offset)
+	if c.cast != "" {
+		w.WriteString("::")
+		w.WriteString(c.cast)
+	}
+}
+
+// Return column name as an unquoted identifier, following Postgres case
+// folding rules for names not set through a tag, unless quoteAll is set
+func (c *columnMeta) identifier(quoteAll bool) string {
+	if c.quote || quoteAll {
+		return c.name
+	}
+	return strings.ToLower(c.name)
+}
+
+// Extract value of column from root struct value v
+func (c *columnMeta) value(v reflect.Value) (val interface{}, err error) {
+	v = v.FieldByIndex(c.index)
+	val = v.Interface()
+	if c.nullZero && isZero(v, val) {
+		if c.toString {
+			return (*string)(nil), nil
+		}
+		return nil, nil
+	}
+	if enc := c.encoder(); enc != nil {
+		return enc(v)
+	}
+	if conv := typeConverter(v.Type()); conv != nil {
+		return conv(v)
+	}
+	if c.toString {
+		val, err = convertToString(v, val)
+	}
+	return
+}
+
+// Append value of column from root struct value v to args
+func (c *columnMeta) appendValue(args []interface{}, v reflect.Value) (
+	[]interface{},
+	error,
+) {
+	val, err := c.value(v)
+	if err != nil {
+		return args, err
+	}
+	return append(args, val), nil
+}
+
+// Returns, if v is the zero value of its type. Types, that define their own
+// IsZero method, like time.Time, use it.
+func isZero(v reflect.Value, val interface{}) bool {
+	if z, ok := val.(interface{ IsZero() bool }); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return true
+		}
+		return z.IsZero()
+	}
+	return v.IsZero()
+}
+
+// Convert value to a string or a nil *string for NULL values.
+// Nil pointers and driver.Valuer implementations, like sql.NullString,
+// producing nil values are treated as NULL. Slices and arrays are encoded as
+// Postgres array literals and maps as JSON.
+func convertToString(v reflect.Value, val interface{}) (
+	interface{},
+	error,
+) {
+	// Consistently convert the value type to not allow any external
+	// reflection to chose inconsistent branches
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return (*string)(nil), nil
+		}
+		if _, ok := val.(driver.Valuer); !ok {
+			v = v.Elem()
+			val = v.Interface()
+		}
+	}
+	if valuer, ok := val.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		switch {
+		case err != nil:
+			return nil, err
+		case dv == nil:
+			return (*string)(nil), nil
+		}
+		val = dv
+		v = reflect.ValueOf(dv)
+	}
+	if b, ok := val.([]byte); ok {
+		return string(b), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return (*string)(nil), nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		var w strings.Builder
+		err := writeArrayLiteral(&w, v)
+		if err != nil {
+			return nil, err
+		}
+		return w.String(), nil
+	case reflect.Map:
+		// encoding/json sorts map keys, so the output is deterministic
+		buf, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		return string(buf), nil
+	}
+	return fmt.Sprint(val), nil
+}
+
+// Write slice or array v as a Postgres array literal. Nested slices and
+// arrays are written as nested arrays and all other elements as quoted
+// strings.
+func writeArrayLiteral(w *strings.Builder, v reflect.Value) error {
+	w.WriteByte('{')
+	for i := 0; i < v.Len(); i++ {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		e := v.Index(i)
+		for e.Kind() == reflect.Interface && !e.IsNil() {
+			e = e.Elem()
+		}
+		switch e.Kind() {
+		case reflect.Slice, reflect.Array:
+			if e.Type().Elem().Kind() != reflect.Uint8 {
+				if e.Kind() == reflect.Slice && e.IsNil() {
+					w.WriteString("NULL")
+					continue
+				}
+				err := writeArrayLiteral(w, e)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		case reflect.Interface:
+			// Nil interface
+			w.WriteString("NULL")
+			continue
+		}
+
+		s, err := convertToString(e, e.Interface())
+		if err != nil {
+			return err
+		}
+		ptr, ok := s.(*string)
+		if ok {
+			if ptr == nil {
+				w.WriteString("NULL")
+				continue
+			}
+			s = *ptr
+		}
+		w.WriteByte('"')
+		for _, r := range s.(string) {
+			if r == '"' || r == '\\' {
+				w.WriteByte('\\')
+			}
+			w.WriteRune(r)
+		}
+		w.WriteByte('"')
+	}
+	w.WriteByte('}')
+	return nil
+}
+
+// Return columns to return from a write statement: all columns, if refresh is
+// set, or only the generated ones otherwise
+func (m *structMeta) returning(refresh bool) []*columnMeta {
+	if refresh {
+		return m.all
+	}
+	return m.generated
+}
+
+// Return cached column metadata for struct type t.
+// Metadata is only computed once per type.
+func getStructMeta(t reflect.Type) (m *structMeta, err error) {
+	if t == nil || t.Kind() != reflect.Struct {
+		err = &InvalidTypeError{t}
+		return
+	}
+
+	cached, ok := structMetaCache.Load(t)
+	if ok {
+		return cached.(*structMeta), nil
+	}
+
+	m = &structMeta{
+		typ: t,
+		beforeInsert: reflect.PtrTo(t).
+			Implements(reflect.TypeOf((*BeforeInserter)(nil)).Elem()),
+	}
+	dedup := make(map[string]struct{})
+	scanStructType(m, dedup, t, nil)
+	m.byName = make(map[string]int, len(m.columns))
+	for i := range m.columns {
+		c := &m.columns[i]
+		m.all = append(m.all, c)
+		switch {
+		case c.generated:
+			m.generated = append(m.generated, c)
+		case !c.readOnly:
+			m.writable = append(m.writable, c)
+		}
+		if c.quote {
+			m.byName[c.name] = i
+		} else if _, ok := m.byName[strings.ToLower(c.name)]; !ok {
+			m.byName[strings.ToLower(c.name)] = i
+		}
+	}
+	structMetaCache.Store(t, m)
+	return
+}
+
+// Scan fields of struct type t and any embedded structs using depth first
+// search
+func scanStructType(
+	m *structMeta,
+	dedup map[string]struct{},
+	t reflect.Type,
+	parentIndex []int,
+) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			f     = t.Field(i)
+			split = strings.Split(f.Tag.Get("db"), ",")
+			tag   = split[0]
+			name  string
+			c     columnMeta
+		)
+	options:
+		for j := 1; j < len(split); j++ {
+			s := split[j]
+			if strings.HasPrefix(s, "cast=") ||
+				strings.HasPrefix(s, "type=") ||
+				strings.HasPrefix(s, "default=") ||
+				strings.HasPrefix(s, "references=") ||
+				strings.HasPrefix(s, "check=") {
+				// Types and expressions may contain commas inside
+				// parentheses, like numeric(10,2)
+				for strings.Count(s, "(") > strings.Count(s, ")") &&
+					j+1 < len(split) {
+					j++
+					s += "," + split[j]
+				}
+			}
+			if s != "" && !strings.HasPrefix(s, "expr=") {
+				c.options = append(c.options, s)
+			}
+			switch {
+			case s == "string":
+				c.toString = true
+			case s == "pk":
+				c.pk = true
+			case s == "nullzero":
+				c.nullZero = true
+			case s == "generated":
+				c.generated = true
+			case s == "readonly":
+				c.readOnly = true
+			case strings.HasPrefix(s, "cast="):
+				c.cast = s[len("cast="):]
+			case strings.HasPrefix(s, "expr="):
+				// Expressions may contain commas, so consume the rest of the
+				// tag
+				c.expr = strings.Join(split[j:], ",")[len("expr="):]
+				c.options = append(c.options, "expr="+c.expr)
+				break options
+			}
+		}
+		switch tag {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		default:
+			name = tag
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, f)
+			continue
+		}
+		if f.PkgPath != "" {
+			// Unexported field
+			continue
+		}
+
+		if _, ok := dedup[name]; ok {
+			continue
+		}
+		dedup[name] = struct{}{}
+		c.name = name
+		c.quote = tag != ""
+		c.index = appendIndex(parentIndex, i)
+		c.owner = t
+		c.field = f.Name
+		m.columns = append(m.columns, c)
+	}
+
+	for _, f := range embedded {
+		scanStructType(m, dedup, f.Type, appendIndex(parentIndex, f.Index[0]))
+	}
+}
+
+// Append i to a copy of index path
+func appendIndex(index []int, i int) []int {
+	return append(append(make([]int, 0, len(index)+1), index...), i)
+}
+
+// Return value and cached column metadata of data struct or pointer to
+// struct
+func getDataMeta(data interface{}) (
+	v reflect.Value,
+	m *structMeta,
+	err error,
+) {
+	v = reflect.ValueOf(data)
+	if !v.IsValid() {
+		err = &InvalidTypeError{}
+		return
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			err = &InvalidTypeError{v.Type()}
+			return
+		}
+		v = v.Elem()
+	}
+	m, err = getStructMeta(v.Type())
+	if err != nil {
+		// Report the type actually passed in
+		err = &InvalidTypeError{reflect.TypeOf(data)}
+	}
+	return
+}
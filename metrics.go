@@ -0,0 +1,118 @@
+package pg_util
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// Counters of TxStats. Durations are stored in nanoseconds.
+	txStarted, txActive, txCommitted, txRolledBack, txRetries, txDuration int64
+
+	txHook atomic.Value // func(TxInfo)
+)
+
+// Statistics of transactions run by InTransaction and its variants since
+// process start. Pseudotransactions via savepoints are included.
+type TxStats struct {
+	// Number of transactions started
+	Started int64
+
+	// Number of transactions currently in progress
+	Active int64
+
+	// Number of committed transactions
+	Committed int64
+
+	// Number of rolled back transactions, including failed commits
+	RolledBack int64
+
+	// Number of retries performed by InTransactionRetry
+	Retries int64
+
+	// Total duration of all finished transactions
+	TotalDuration time.Duration
+}
+
+// Ratio of rolled back transactions to all finished transactions. Returns 0,
+// if no transactions have finished.
+func (s TxStats) RollbackRatio() float64 {
+	finished := s.Committed + s.RolledBack
+	if finished == 0 {
+		return 0
+	}
+	return float64(s.RolledBack) / float64(finished)
+}
+
+// Average duration of finished transactions
+func (s TxStats) AverageDuration() time.Duration {
+	finished := s.Committed + s.RolledBack
+	if finished == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(finished)
+}
+
+// Return statistics of all transactions run so far. Useful for exporting as
+// metrics and alerting on rollback rate or long running transaction spikes.
+func Stats() TxStats {
+	return TxStats{
+		Started:       atomic.LoadInt64(&txStarted),
+		Active:        atomic.LoadInt64(&txActive),
+		Committed:     atomic.LoadInt64(&txCommitted),
+		RolledBack:    atomic.LoadInt64(&txRolledBack),
+		Retries:       atomic.LoadInt64(&txRetries),
+		TotalDuration: time.Duration(atomic.LoadInt64(&txDuration)),
+	}
+}
+
+// Information about a finished transaction
+type TxInfo struct {
+	// Time from the start of the transaction to its commit or rollback
+	Duration time.Duration
+
+	// Transaction was committed
+	Committed bool
+
+	// Error, that caused the rollback, if any
+	Err error
+}
+
+// Set a function to be called with information about every finished
+// transaction. Useful for recording duration histograms. Pass nil to remove
+// the hook.
+//
+// fn is called synchronously after the transaction is finished and must be
+// safe for concurrent use.
+func SetTxHook(fn func(TxInfo)) {
+	txHook.Store(fn)
+}
+
+// Record the start of a transaction and return its start time
+func txStart() time.Time {
+	atomic.AddInt64(&txStarted, 1)
+	atomic.AddInt64(&txActive, 1)
+	return time.Now()
+}
+
+// Record the end of transaction tx started at start
+func txEnd(start time.Time, tx pgx.Tx, committed bool, err error) {
+	d := time.Since(start)
+	atomic.AddInt64(&txActive, -1)
+	atomic.AddInt64(&txDuration, int64(d))
+	if committed {
+		atomic.AddInt64(&txCommitted, 1)
+	} else {
+		atomic.AddInt64(&txRolledBack, 1)
+	}
+	if fn, _ := txHook.Load().(func(TxInfo)); fn != nil {
+		fn(TxInfo{
+			Duration:  d,
+			Committed: committed,
+			Err:       err,
+		})
+	}
+	reportSlowTx(tx, d, err)
+}
@@ -0,0 +1,94 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestTxStatsRatios(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name    string
+		stats   TxStats
+		ratio   float64
+		average time.Duration
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "mixed",
+			stats: TxStats{
+				Committed:     3,
+				RolledBack:    1,
+				TotalDuration: 8 * time.Second,
+			},
+			ratio:   0.25,
+			average: 2 * time.Second,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if r := c.stats.RollbackRatio(); r != c.ratio {
+				t.Fatalf("ratio mismatch: %f != %f", r, c.ratio)
+			}
+			if a := c.stats.AverageDuration(); a != c.average {
+				t.Fatalf("average mismatch: %s != %s", a, c.average)
+			}
+		})
+	}
+}
+
+// Not parallel, as the statistics and hook are global
+func TestStats(t *testing.T) {
+	var infos []TxInfo
+	SetTxHook(func(info TxInfo) {
+		infos = append(infos, info)
+	})
+	defer SetTxHook(nil)
+
+	before := Stats()
+	errFail := errors.New("fail")
+	for _, err := range [...]error{nil, errFail} {
+		InTransaction(
+			context.Background(),
+			fakeTxStarter{},
+			func(pgx.Tx) error {
+				return err
+			},
+		)
+	}
+	after := Stats()
+
+	if n := after.Started - before.Started; n != 2 {
+		t.Fatalf("started mismatch: %d != 2", n)
+	}
+	if n := after.Committed - before.Committed; n != 1 {
+		t.Fatalf("committed mismatch: %d != 1", n)
+	}
+	if n := after.RolledBack - before.RolledBack; n != 1 {
+		t.Fatalf("rolled back mismatch: %d != 1", n)
+	}
+	if after.Active != before.Active {
+		t.Fatalf("active mismatch: %d != %d", after.Active, before.Active)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("hook call count mismatch: %d != 2", len(infos))
+	}
+	if !infos[0].Committed || infos[0].Err != nil {
+		t.Fatalf("unexpected info: %+v", infos[0])
+	}
+	if infos[1].Committed || infos[1].Err != errFail {
+		t.Fatalf("unexpected info: %+v", infos[1])
+	}
+}
@@ -0,0 +1,521 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Table storing applied migrations
+const MigrationsTable = "pg_util_migrations"
+
+// Single versioned schema migration
+type Migration struct {
+	// Unique positive version. Migrations are applied in ascending order of
+	// their versions.
+	Version int64
+
+	// Descriptive name
+	Name string
+
+	// SQL script applying the migration. Executed with ExecScript.
+	Up string
+
+	// Optional SQL script reverting the migration. Required for
+	// RollbackMigrations.
+	Down string
+}
+
+// Provides migrations to apply
+type MigrationSource interface {
+	// Load all migrations in any order
+	Load() ([]Migration, error)
+}
+
+// Migrations defined in code
+type Migrations []Migration
+
+func (m Migrations) Load() ([]Migration, error) {
+	return m, nil
+}
+
+// Load migrations from SQL files in directory dir of fsys, like an embed.FS.
+//
+// Files must be named "<version>_<name>.up.sql" and optionally
+// "<version>_<name>.down.sql" for the reverting script. Files named
+// "<version>_<name>.sql" are treated as up migrations without a down script.
+// Other files are ignored. Example: "0001_create_users.up.sql"
+func MigrationsFS(fsys fs.FS, dir string) MigrationSource {
+	return fsMigrations{fsys, dir}
+}
+
+// Like MigrationsFS, but loads migrations from a directory on disk
+func MigrationsDir(dir string) MigrationSource {
+	return fsMigrations{os.DirFS(dir), "."}
+}
+
+type fsMigrations struct {
+	fsys fs.FS
+	dir  string
+}
+
+func (s fsMigrations) Load() (migs []Migration, err error) {
+	entries, err := fs.ReadDir(s.fsys, s.dir)
+	if err != nil {
+		return
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		down := strings.HasSuffix(name, ".down")
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".down"), ".up")
+
+		i := strings.IndexByte(name, '_')
+		if i == -1 {
+			i = len(name)
+		}
+		version, err := strconv.ParseInt(name[:i], 10, 64)
+		if err != nil {
+			continue
+		}
+		if i < len(name) {
+			name = name[i+1:]
+		} else {
+			name = ""
+		}
+
+		buf, err := fs.ReadFile(s.fsys, path.Join(s.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{
+				Version: version,
+				Name:    name,
+			}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf(
+				"pg_util: migration %d has conflicting names: %s and %s",
+				version,
+				m.Name,
+				name,
+			)
+		}
+		if down {
+			m.Down = string(buf)
+		} else {
+			m.Up = string(buf)
+		}
+	}
+
+	migs = make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migs = append(migs, *m)
+	}
+	return
+}
+
+// Load, validate and sort migrations from src
+func loadMigrations(src MigrationSource) (migs []Migration, err error) {
+	migs, err = src.Load()
+	if err != nil {
+		return
+	}
+	migs = append([]Migration(nil), migs...)
+	sort.Slice(migs, func(i, j int) bool {
+		return migs[i].Version < migs[j].Version
+	})
+	for i, m := range migs {
+		switch {
+		case m.Version <= 0:
+			err = fmt.Errorf("pg_util: invalid migration version: %d",
+				m.Version)
+		case i != 0 && migs[i-1].Version == m.Version:
+			err = fmt.Errorf("pg_util: duplicate migration version: %d",
+				m.Version)
+		case m.Up == "":
+			err = fmt.Errorf("pg_util: migration %d has no up script",
+				m.Version)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Error of applying or reverting a migration
+type MigrationError struct {
+	Version int64
+	Name    string
+	Err     error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("pg_util: migration %d %s: %s", e.Version, e.Name,
+		e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// Create the migrations table, if it does not exist yet
+func createMigrationsTable(ctx context.Context, conn TxStarter) error {
+	return InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		_, err = tx.Exec(
+			ctx,
+			`CREATE TABLE IF NOT EXISTS `+quoteIdentifier(MigrationsTable)+` (
+				version bigint PRIMARY KEY,
+				name text NOT NULL,
+				applied_at timestamptz NOT NULL DEFAULT now(),
+				duration interval NOT NULL
+			)`,
+		)
+		return
+	})
+}
+
+// Return set of applied migration versions
+func appliedVersions(ctx context.Context, conn TxStarter) (
+	map[int64]struct{},
+	error,
+) {
+	return InTransactionValue(
+		ctx,
+		conn,
+		func(tx pgx.Tx) (versions map[int64]struct{}, err error) {
+			vals, err := QueryValues[int64](
+				ctx,
+				tx,
+				`SELECT version FROM `+quoteIdentifier(MigrationsTable),
+			)
+			if err != nil {
+				return
+			}
+			versions = make(map[int64]struct{}, len(vals))
+			for _, v := range vals {
+				versions[v] = struct{}{}
+			}
+			return
+		},
+	)
+}
+
+// Options for MigrateWith
+type MigrateOpts struct {
+	// Do not take the migration advisory lock. Only safe, if no other
+	// process applies migrations concurrently.
+	NoLock bool
+
+	// Return ErrMigrationLocked immediately, if another process holds the
+	// migration lock, instead of waiting for it
+	NoWait bool
+
+	// Maximum duration to wait for the migration lock, before returning
+	// ErrMigrationLocked. Waits until ctx is done, if zero.
+	LockTimeout time.Duration
+}
+
+// Returned, if the migration lock is held by another process and
+// MigrateOpts.NoWait is set or MigrateOpts.LockTimeout is exceeded
+var ErrMigrationLocked = errors.New(
+	"pg_util: migrations locked by another process",
+)
+
+// Advisory lock key protecting migrations. Spells "pg_util" in ASCII.
+var migrationLockKey = LockKey(0x70675f7574696c)
+
+// Apply all migrations from src, that have not been applied yet, in ascending
+// order of their versions. Each migration is applied in its own transaction
+// and recorded in MigrationsTable, which is created, if needed. Returns the
+// number of applied migrations.
+//
+// An advisory lock is held while migrating, so multiple replicas starting
+// simultaneously do not race to apply the same migrations. Waits for the lock
+// until ctx is done. See MigrateWith for configuring this behavior.
+//
+// Stops at the first failed migration and returns *MigrationError.
+func Migrate(ctx context.Context, conn TxStarter, src MigrationSource) (
+	applied int,
+	err error,
+) {
+	return MigrateWith(ctx, conn, src, MigrateOpts{})
+}
+
+// Like Migrate, but with options for locking.
+//
+// The session-level lock requires a single connection. Pools implementing
+// Acquire, like *pgxpool.Pool, are used through a connection acquired for
+// the duration of the migration. For pgx.Tx a transaction-level lock is
+// taken and all migrations are applied in pseudo nested transactions of it.
+// Other types of conn must implement Querier on a single connection or be
+// used with MigrateOpts.NoLock.
+func MigrateWith(
+	ctx context.Context,
+	conn TxStarter,
+	src MigrationSource,
+	opts MigrateOpts,
+) (applied int, err error) {
+	migs, err := loadMigrations(src)
+	if err != nil {
+		return
+	}
+	err = withMigrationLock(ctx, conn, opts, func(conn TxStarter) (err error) {
+		err = createMigrationsTable(ctx, conn)
+		if err != nil {
+			return
+		}
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return
+		}
+
+		for _, m := range migs {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err = applyMigration(ctx, conn, m)
+			if err != nil {
+				return
+			}
+			applied++
+		}
+		return
+	})
+	return
+}
+
+// Interface of connection pools, like *pgxpool.Pool
+type poolAcquirer interface {
+	Acquire(context.Context) (*pgxpool.Conn, error)
+}
+
+// Run fn with the migration lock held on a connection derived from conn
+func withMigrationLock(
+	ctx context.Context,
+	conn TxStarter,
+	opts MigrateOpts,
+	fn func(TxStarter) error,
+) (err error) {
+	if opts.NoLock {
+		return fn(conn)
+	}
+
+	switch c := conn.(type) {
+	case pgx.Tx:
+		return InTransaction(ctx, c, func(tx pgx.Tx) (err error) {
+			err = waitMigrationLock(ctx, opts, func() (bool, error) {
+				return TryAdvisoryXactLock(ctx, tx, migrationLockKey)
+			})
+			if err != nil {
+				return
+			}
+			return fn(tx)
+		})
+	case poolAcquirer:
+		pc, err := c.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer pc.Release()
+		conn = pc
+	}
+
+	q, ok := conn.(Querier)
+	if !ok {
+		return fmt.Errorf(
+			"pg_util: can not lock migrations on %T: use MigrateOpts.NoLock",
+			conn,
+		)
+	}
+	err = waitMigrationLock(ctx, opts, func() (bool, error) {
+		return TryAdvisoryLock(ctx, q, migrationLockKey)
+	})
+	if err != nil {
+		return
+	}
+	defer func() {
+		// Release the lock even, if ctx was cancelled
+		unlockErr := AdvisoryUnlock(context.Background(), q, migrationLockKey)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+	return fn(conn)
+}
+
+// Poll try until it acquires the migration lock, respecting the waiting
+// behavior of opts. Polling does not cancel statements on timeout, which
+// would close the connection.
+func waitMigrationLock(
+	ctx context.Context,
+	opts MigrateOpts,
+	try func() (bool, error),
+) error {
+	var deadline time.Time
+	if opts.LockTimeout > 0 {
+		deadline = time.Now().Add(opts.LockTimeout)
+	}
+	b := backoff{50 * time.Millisecond, time.Second}
+	for {
+		acquired, err := try()
+		switch {
+		case err != nil:
+			return err
+		case acquired:
+			return nil
+		case opts.NoWait:
+			return ErrMigrationLocked
+		case !deadline.IsZero() && !time.Now().Add(b.delay).Before(deadline):
+			return ErrMigrationLocked
+		}
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Apply a single migration and record it
+func applyMigration(ctx context.Context, conn TxStarter, m Migration) error {
+	err := InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		start := time.Now()
+		err = ExecScript(ctx, tx, m.Up)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO `+quoteIdentifier(MigrationsTable)+`
+				(version, name, duration)
+			VALUES ($1, $2, make_interval(secs => $3))`,
+			m.Version,
+			m.Name,
+			time.Since(start).Seconds(),
+		)
+		return
+	})
+	if err != nil {
+		return &MigrationError{m.Version, m.Name, err}
+	}
+	return nil
+}
+
+// Revert the last n applied migrations in descending order of their
+// versions using their down scripts. Each migration is reverted in its own
+// transaction. Returns the number of reverted migrations.
+//
+// Returns an error before reverting anything, if any of the migrations to
+// revert is not in src or has no down script. Takes the same advisory lock as
+// Migrate.
+func RollbackMigrations(
+	ctx context.Context,
+	conn TxStarter,
+	src MigrationSource,
+	n int,
+) (reverted int, err error) {
+	if n <= 0 {
+		return
+	}
+	migs, err := loadMigrations(src)
+	if err != nil {
+		return
+	}
+	byVersion := make(map[int64]Migration, len(migs))
+	for _, m := range migs {
+		byVersion[m.Version] = m
+	}
+
+	err = withMigrationLock(ctx, conn, MigrateOpts{}, func(conn TxStarter) (
+		err error,
+	) {
+		reverted, err = rollbackMigrations(ctx, conn, byVersion, n)
+		return
+	})
+	return
+}
+
+// Revert the last n applied migrations, whose definitions are in byVersion
+func rollbackMigrations(
+	ctx context.Context,
+	conn TxStarter,
+	byVersion map[int64]Migration,
+	n int,
+) (reverted int, err error) {
+	err = createMigrationsTable(ctx, conn)
+	if err != nil {
+		return
+	}
+	versions, err := InTransactionValue(
+		ctx,
+		conn,
+		func(tx pgx.Tx) ([]int64, error) {
+			return QueryValues[int64](
+				ctx,
+				tx,
+				`SELECT version
+				FROM `+quoteIdentifier(MigrationsTable)+`
+				ORDER BY version DESC
+				LIMIT $1`,
+				n,
+			)
+		},
+	)
+	if err != nil {
+		return
+	}
+
+	toRevert := make([]Migration, 0, len(versions))
+	for _, v := range versions {
+		m, ok := byVersion[v]
+		switch {
+		case !ok:
+			err = fmt.Errorf("pg_util: applied migration %d not in source", v)
+		case m.Down == "":
+			err = fmt.Errorf("pg_util: migration %d has no down script", v)
+		}
+		if err != nil {
+			return
+		}
+		toRevert = append(toRevert, m)
+	}
+
+	for _, m := range toRevert {
+		err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+			err = ExecScript(ctx, tx, m.Down)
+			if err != nil {
+				return
+			}
+			_, err = tx.Exec(
+				ctx,
+				`DELETE FROM `+quoteIdentifier(MigrationsTable)+`
+				WHERE version = $1`,
+				m.Version,
+			)
+			return
+		})
+		if err != nil {
+			err = &MigrationError{m.Version, m.Name, err}
+			return
+		}
+		reverted++
+	}
+	return
+}
@@ -0,0 +1,185 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// State of a single migration in MigrationReport
+type MigrationState struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+
+	// Time the migration was applied at. Zero for pending migrations.
+	AppliedAt time.Time `json:"applied_at"`
+
+	// Time it took to apply the migration. Zero for pending migrations.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// Applied and pending migrations returned by MigrationStatus
+type MigrationReport struct {
+	// Migrations recorded as applied, that are present in the source, in
+	// ascending order of versions
+	Applied []MigrationState `json:"applied"`
+
+	// Migrations present in the source, that have not been applied yet, in
+	// ascending order of versions
+	Pending []MigrationState `json:"pending"`
+
+	// Migrations recorded as applied, that are not present in the source, in
+	// ascending order of versions. Usually means the database was migrated by
+	// a newer version of the application.
+	Unknown []MigrationState `json:"unknown"`
+}
+
+// Options for MigrationStatusWith
+type MigrationStatusOpts struct {
+	// Return *UnknownMigrationsError, if the database has applied migrations,
+	// that are not present in the source
+	Strict bool
+}
+
+// Returned in strict mode, if the database has applied migrations, that are
+// not present in the source
+type UnknownMigrationsError struct {
+	Versions []int64
+}
+
+func (e *UnknownMigrationsError) Error() string {
+	return fmt.Sprintf("pg_util: unknown applied migrations: %v", e.Versions)
+}
+
+// Return applied and pending migrations of src with their application
+// timestamps and durations. Suitable for admin endpoints and startup logs.
+//
+// Does not modify the database. All migrations are pending, if
+// MigrationsTable does not exist yet.
+func MigrationStatus(
+	ctx context.Context,
+	conn TxStarter,
+	src MigrationSource,
+) (MigrationReport, error) {
+	return MigrationStatusWith(ctx, conn, src, MigrationStatusOpts{})
+}
+
+// Like MigrationStatus, but with options. The report is returned even, if
+// strict mode fails.
+func MigrationStatusWith(
+	ctx context.Context,
+	conn TxStarter,
+	src MigrationSource,
+	opts MigrationStatusOpts,
+) (r MigrationReport, err error) {
+	migs, err := loadMigrations(src)
+	if err != nil {
+		return
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return
+	}
+
+	r = MigrationReport{
+		Applied: []MigrationState{},
+		Pending: []MigrationState{},
+		Unknown: []MigrationState{},
+	}
+	known := make(map[int64]struct{}, len(migs))
+	for _, m := range migs {
+		known[m.Version] = struct{}{}
+		s, ok := applied[m.Version]
+		if ok {
+			r.Applied = append(r.Applied, s)
+		} else {
+			r.Pending = append(r.Pending, MigrationState{
+				Version: m.Version,
+				Name:    m.Name,
+			})
+		}
+	}
+	for _, s := range applied.sorted() {
+		if _, ok := known[s.Version]; !ok {
+			r.Unknown = append(r.Unknown, s)
+		}
+	}
+
+	if opts.Strict && len(r.Unknown) != 0 {
+		e := &UnknownMigrationsError{
+			Versions: make([]int64, len(r.Unknown)),
+		}
+		for i, s := range r.Unknown {
+			e.Versions[i] = s.Version
+		}
+		err = e
+	}
+	return
+}
+
+// Applied migrations by version
+type migrationStates map[int64]MigrationState
+
+// Return states sorted by version
+func (m migrationStates) sorted() []MigrationState {
+	s := make([]MigrationState, 0, len(m))
+	for _, st := range m {
+		s = append(s, st)
+	}
+	sort.Slice(s, func(i, j int) bool {
+		return s[i].Version < s[j].Version
+	})
+	return s
+}
+
+// Read applied migrations from MigrationsTable, if it exists
+func appliedMigrations(ctx context.Context, conn TxStarter) (
+	migrationStates,
+	error,
+) {
+	return InTransactionValue(
+		ctx,
+		conn,
+		func(tx pgx.Tx) (states migrationStates, err error) {
+			states = make(migrationStates)
+
+			var exists bool
+			err = tx.
+				QueryRow(
+					ctx,
+					`SELECT to_regclass($1) IS NOT NULL`,
+					quoteIdentifier(MigrationsTable),
+				).
+				Scan(&exists)
+			if err != nil || !exists {
+				return
+			}
+
+			err = QueryEach(
+				ctx,
+				tx,
+				`SELECT version, name, applied_at,
+					EXTRACT(EPOCH FROM duration)::float8
+				FROM `+quoteIdentifier(MigrationsTable),
+				nil,
+				func(row pgx.Row) (err error) {
+					var (
+						s    MigrationState
+						secs float64
+					)
+					err = row.Scan(&s.Version, &s.Name, &s.AppliedAt, &secs)
+					if err != nil {
+						return
+					}
+					s.Duration = time.Duration(secs * float64(time.Second))
+					states[s.Version] = s
+					return
+				},
+			)
+			return
+		},
+	)
+}
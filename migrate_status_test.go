@@ -0,0 +1,108 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestMigrationStatus(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	src := Migrations{
+		{
+			Version: 9100011,
+			Name:    "applied",
+			Up:      "select 1;",
+		},
+		{
+			Version: 9100012,
+			Name:    "pending",
+			Up:      "select 1;",
+		},
+	}
+
+	err = createMigrationsTable(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(
+		ctx,
+		"delete from "+MigrationsTable+" where version between $1 and $2",
+		9100011,
+		9100019,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Migrate(ctx, conn, src[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(
+		ctx,
+		`insert into `+MigrationsTable+` (version, name, duration)
+		values (9100019, 'unknown', '1 second')`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := MigrationStatus(ctx, conn, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var applied *MigrationState
+	for i := range r.Applied {
+		if r.Applied[i].Version == 9100011 {
+			applied = &r.Applied[i]
+		}
+	}
+	if applied == nil || applied.AppliedAt.IsZero() {
+		t.Fatalf("applied migration not reported: %+v", r.Applied)
+	}
+	if len(r.Pending) != 1 || r.Pending[0].Version != 9100012 {
+		t.Fatalf("pending mismatch: %+v", r.Pending)
+	}
+	var unknown *MigrationState
+	for i := range r.Unknown {
+		if r.Unknown[i].Version == 9100019 {
+			unknown = &r.Unknown[i]
+		}
+	}
+	if unknown == nil || unknown.Duration != time.Second {
+		t.Fatalf("unknown migration not reported: %+v", r.Unknown)
+	}
+
+	_, err = MigrationStatusWith(
+		ctx,
+		conn,
+		src,
+		MigrationStatusOpts{Strict: true},
+	)
+	var uErr *UnknownMigrationsError
+	if !errors.As(err, &uErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = conn.Exec(
+		ctx,
+		"delete from "+MigrationsTable+" where version between $1 and $2",
+		9100011,
+		9100019,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
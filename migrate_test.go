@@ -0,0 +1,256 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestMigrationsFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"migrations/0002_add_email.up.sql":   {Data: []byte("up 2")},
+		"migrations/0002_add_email.down.sql": {Data: []byte("down 2")},
+		"migrations/0001_create_users.sql":   {Data: []byte("up 1")},
+		"migrations/10_no_down.up.sql":       {Data: []byte("up 10")},
+		"migrations/README.md":               {Data: []byte("ignored")},
+		"migrations/draft.sql":               {Data: []byte("ignored")},
+	}
+
+	migs, err := loadMigrations(MigrationsFS(fsys, "migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []Migration{
+		{
+			Version: 1,
+			Name:    "create_users",
+			Up:      "up 1",
+		},
+		{
+			Version: 2,
+			Name:    "add_email",
+			Up:      "up 2",
+			Down:    "down 2",
+		},
+		{
+			Version: 10,
+			Name:    "no_down",
+			Up:      "up 10",
+		},
+	}
+	if !reflect.DeepEqual(migs, std) {
+		t.Fatalf("migrations mismatch: %+v != %+v", migs, std)
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		src  MigrationSource
+	}{
+		{
+			name: "invalid version",
+			src:  Migrations{{Version: 0, Up: "a"}},
+		},
+		{
+			name: "duplicate version",
+			src:  Migrations{{Version: 1, Up: "a"}, {Version: 1, Up: "b"}},
+		},
+		{
+			name: "no up script",
+			src:  Migrations{{Version: 1, Down: "a"}},
+		},
+		{
+			name: "conflicting names",
+			src: MigrationsFS(fstest.MapFS{
+				"1_a.up.sql":   {Data: []byte("a")},
+				"1_b.down.sql": {Data: []byte("b")},
+			}, "."),
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := loadMigrations(c.src); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	src := Migrations{
+		{
+			Version: 9100001,
+			Name:    "create",
+			Up:      "create table migrate_test (id int);",
+			Down:    "drop table migrate_test;",
+		},
+		{
+			Version: 9100002,
+			Name:    "add_column",
+			Up:      "alter table migrate_test add column name text;",
+			Down:    "alter table migrate_test drop column name;",
+		},
+	}
+
+	// Clean up after previous failed runs
+	_, err = conn.Exec(ctx, "drop table if exists migrate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = createMigrationsTable(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(
+		ctx,
+		"delete from "+MigrationsTable+" where version between $1 and $2",
+		9100001,
+		9100002,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertApplied := func(n, std int) {
+		t.Helper()
+		if n != std {
+			t.Fatalf("migration count mismatch: %d != %d", n, std)
+		}
+	}
+
+	n, err := Migrate(ctx, conn, src[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(n, 1)
+
+	n, err = Migrate(ctx, conn, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(n, 1)
+
+	_, err = conn.Exec(ctx, "insert into migrate_test values (1, 'a')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = RollbackMigrations(ctx, conn, src, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(n, 2)
+
+	_, err = conn.Exec(ctx, "select 1 from migrate_test")
+	if err == nil {
+		t.Fatal("table not dropped")
+	}
+}
+
+func TestWaitMigrationLock(t *testing.T) {
+	t.Parallel()
+
+	errTry := errors.New("try failed")
+
+	cases := [...]struct {
+		name     string
+		opts     MigrateOpts
+		acquired bool
+		tryErr   error
+		err      error
+	}{
+		{
+			name:     "acquired",
+			acquired: true,
+		},
+		{
+			name:   "try error",
+			tryErr: errTry,
+			err:    errTry,
+		},
+		{
+			name: "no wait",
+			opts: MigrateOpts{NoWait: true},
+			err:  ErrMigrationLocked,
+		},
+		{
+			name: "timeout",
+			opts: MigrateOpts{LockTimeout: 120 * time.Millisecond},
+			err:  ErrMigrationLocked,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := waitMigrationLock(
+				context.Background(),
+				c.opts,
+				func() (bool, error) {
+					return c.acquired, c.tryErr
+				},
+			)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("error mismatch: %v != %v", err, c.err)
+			}
+		})
+	}
+}
+
+func TestMigrateLocked(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	holder, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close(ctx)
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	// Waits for any concurrently running migration test to release the lock
+	err = WithAdvisoryLock(ctx, holder, migrationLockKey, func() error {
+		_, err := MigrateWith(
+			ctx,
+			conn,
+			Migrations{},
+			MigrateOpts{NoWait: true},
+		)
+		if !errors.Is(err, ErrMigrationLocked) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
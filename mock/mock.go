@@ -0,0 +1,223 @@
+// Package mock provides in-memory test doubles for pg_util.TxStarter,
+// pg_util.Querier and pgx.Tx, so code using InTransaction, ExecAll and the
+// query helpers can be unit tested without a database.
+//
+//	conn := mock.New()
+//	conn.OnQuery("SELECT id, name FROM users WHERE id = $1", mock.Result{
+//		Columns: []string{"id", "name"},
+//		Rows:    [][]interface{}{{1, "foo"}},
+//	})
+//	err := pg_util.InTransaction(ctx, conn, fn)
+//	// Assert on conn.Execs(), conn.Commits() and conn.Rollbacks()
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Returned by methods of Tx, that are not supported by the mock
+var ErrUnsupported = errors.New("mock: not supported")
+
+// Statement executed on the mock
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Scripted result of a statement
+type Result struct {
+	// Names of the result columns
+	Columns []string
+
+	// Values of the result rows. Each row must have one value per column.
+	Rows [][]interface{}
+
+	// Command tag returned by Exec. Example: "UPDATE 2"
+	Tag string
+
+	// Error to return instead of a result
+	Err error
+}
+
+// Mock database connection. Implements pg_util.TxOptionsStarter and
+// pg_util.Querier. Safe for concurrent use.
+//
+// Exec succeeds with an empty command tag, unless scripted with OnExec.
+// Query and QueryRow fail, unless scripted with OnQuery.
+type Conn struct {
+	mu                         sync.Mutex
+	execs, queries             []Statement
+	execResults, queryResults  map[string][]Result
+	begins, commits, rollbacks int
+	openTxs                    int
+	lastTxOptions              pgx.TxOptions
+}
+
+// Create a new mock connection
+func New() *Conn {
+	return &Conn{
+		execResults:  make(map[string][]Result),
+		queryResults: make(map[string][]Result),
+	}
+}
+
+// Script the result of the next Exec of sql. Multiple results for the same
+// statement are returned in the order they were scripted.
+func (c *Conn) OnExec(sql string, res Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.execResults[sql] = append(c.execResults[sql], res)
+}
+
+// Script the result of the next Query or QueryRow of sql. Multiple results
+// for the same statement are returned in the order they were scripted.
+func (c *Conn) OnQuery(sql string, res Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queryResults[sql] = append(c.queryResults[sql], res)
+}
+
+// Return all statements executed with Exec so far
+func (c *Conn) Execs() []Statement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Statement(nil), c.execs...)
+}
+
+// Return all statements executed with Query or QueryRow so far
+func (c *Conn) Queries() []Statement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Statement(nil), c.queries...)
+}
+
+// Return the number of started transactions, including pseudo nested ones
+func (c *Conn) Begins() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.begins
+}
+
+// Return the number of committed transactions, including pseudo nested ones
+func (c *Conn) Commits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.commits
+}
+
+// Return the number of rolled back transactions, including pseudo nested
+// ones
+func (c *Conn) Rollbacks() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rollbacks
+}
+
+// Return the number of transactions, that are neither committed nor rolled
+// back. Useful for asserting no transactions were leaked.
+func (c *Conn) Open() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.openTxs
+}
+
+// Return the options of the last transaction started with BeginTx
+func (c *Conn) LastTxOptions() pgx.TxOptions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastTxOptions
+}
+
+func (c *Conn) Begin(ctx context.Context) (pgx.Tx, error) {
+	return c.BeginTx(ctx, pgx.TxOptions{})
+}
+
+func (c *Conn) BeginTx(ctx context.Context, opts pgx.TxOptions) (
+	pgx.Tx,
+	error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.begins++
+	c.openTxs++
+	c.lastTxOptions = opts
+	return &Tx{conn: c}, nil
+}
+
+func (c *Conn) Exec(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgconn.CommandTag, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.execs = append(c.execs, Statement{sql, args})
+	res, ok := pop(c.execResults, sql)
+	if !ok {
+		return nil, nil
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return pgconn.CommandTag(res.Tag), nil
+}
+
+func (c *Conn) Query(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgx.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, Statement{sql, args})
+	res, ok := pop(c.queryResults, sql)
+	if !ok {
+		return nil, fmt.Errorf("mock: unexpected query: %s", sql)
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return newRows(res), nil
+}
+
+func (c *Conn) QueryRow(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) pgx.Row {
+	rows, err := c.Query(ctx, sql, args...)
+	return row{rows, err}
+}
+
+// Pop the first result scripted for sql, if any
+func pop(m map[string][]Result, sql string) (res Result, ok bool) {
+	results := m[sql]
+	if len(results) == 0 {
+		return
+	}
+	res, ok = results[0], true
+	if len(results) == 1 {
+		delete(m, sql)
+	} else {
+		m[sql] = results[1:]
+	}
+	return
+}
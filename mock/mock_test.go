@@ -0,0 +1,203 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bakape/pg_util"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestInTransaction(t *testing.T) {
+	t.Parallel()
+
+	errFail := errors.New("fail")
+	cases := [...]struct {
+		name               string
+		stmts              []string
+		commits, rollbacks int
+		err                error
+	}{
+		{
+			name:    "commit",
+			stmts:   []string{"a", "b"},
+			commits: 1,
+		},
+		{
+			name:      "rollback",
+			stmts:     []string{"a", "fail", "b"},
+			rollbacks: 1,
+			err:       errFail,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := New()
+			conn.OnExec("fail", Result{Err: errFail})
+
+			err := pg_util.InTransaction(
+				context.Background(),
+				conn,
+				func(tx pgx.Tx) error {
+					return pg_util.ExecAll(context.Background(), tx,
+						c.stmts...)
+				},
+			)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("error mismatch: %v != %v", err, c.err)
+			}
+			if n := conn.Commits(); n != c.commits {
+				t.Fatalf("commit count mismatch: %d != %d", n, c.commits)
+			}
+			if n := conn.Rollbacks(); n != c.rollbacks {
+				t.Fatalf("rollback count mismatch: %d != %d", n,
+					c.rollbacks)
+			}
+			if n := conn.Open(); n != 0 {
+				t.Fatalf("open transactions: %d", n)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	type user struct {
+		ID   int64
+		Name string
+		Bio  *string
+	}
+
+	const sql = "select id, name, bio from users where id = $1"
+	conn := New()
+	conn.OnQuery(sql, Result{
+		Columns: []string{"id", "name", "bio"},
+		Rows:    [][]interface{}{{1, "foo", "bar"}},
+	})
+	conn.OnQuery(sql, Result{
+		Columns: []string{"id", "name", "bio"},
+	})
+
+	var u user
+	err := pg_util.GetStruct(context.Background(), conn, &u, sql, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 || u.Name != "foo" || u.Bio == nil || *u.Bio != "bar" {
+		t.Fatalf("unexpected row: %+v", u)
+	}
+
+	err = pg_util.GetStruct(context.Background(), conn, &u, sql, 2)
+	if err != pg_util.ErrNoRows {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = pg_util.QueryValue[int](context.Background(), conn, sql, 3)
+	if err == nil {
+		t.Fatal("expected error for unscripted query")
+	}
+
+	if n := len(conn.Queries()); n != 3 {
+		t.Fatalf("query count mismatch: %d != 3", n)
+	}
+	if args := conn.Queries()[1].Args; len(args) != 1 || args[0] != 2 {
+		t.Fatalf("unexpected arguments: %v", args)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	t.Parallel()
+
+	var s string
+	if err := assign(&s, 1); err == nil {
+		t.Fatal("expected error for integer to string conversion")
+	}
+	if err := assign(&s, []byte("a")); err != nil || s != "a" {
+		t.Fatalf("unexpected result: %q %v", s, err)
+	}
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	t.Parallel()
+
+	const (
+		set = "SELECT current_setting('statement_timeout'), " +
+			"set_config('statement_timeout', $1, true)"
+		restore = `SELECT set_config('statement_timeout', $1, true)`
+	)
+	conn := New()
+	conn.OnQuery(set, Result{
+		Columns: []string{"current_setting", "set_config"},
+		Rows:    [][]interface{}{{"0", "1000"}},
+	})
+
+	err := pg_util.InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) error {
+			return pg_util.WithStatementTimeout(
+				context.Background(),
+				tx,
+				time.Second,
+				func(tx pgx.Tx) error {
+					_, err := tx.Exec(context.Background(), "a")
+					return err
+				},
+			)
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execs := conn.Execs()
+	if n := len(execs); n != 2 {
+		t.Fatalf("exec count mismatch: %d != 2", n)
+	}
+	if s := execs[1]; s.SQL != restore || len(s.Args) != 1 ||
+		s.Args[0] != "0" {
+		t.Fatalf("unexpected restore statement: %+v", s)
+	}
+}
+
+func TestCopyOutUnsupported(t *testing.T) {
+	t.Parallel()
+
+	err := pg_util.InTransaction(
+		context.Background(),
+		New(),
+		func(tx pgx.Tx) error {
+			_, err := pg_util.CopyOut(context.Background(), tx, "TABLE t",
+				io.Discard, pg_util.CopyCSV)
+			return err
+		},
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSchedulerRunWithoutTasks(t *testing.T) {
+	t.Parallel()
+
+	const d = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	start := time.Now()
+	err := pg_util.NewScheduler(pg_util.SchedulerOpts{Conn: New()}).Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < d {
+		t.Fatal("returned before context was done")
+	}
+}
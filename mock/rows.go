@@ -0,0 +1,169 @@
+package mock
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// Scripted rows
+type rows struct {
+	res    Result
+	i      int
+	err    error
+	closed bool
+}
+
+func newRows(res Result) *rows {
+	return &rows{
+		res: res,
+		i:   -1,
+	}
+}
+
+func (r *rows) Close() {
+	r.closed = true
+}
+
+func (r *rows) Err() error {
+	return r.err
+}
+
+func (r *rows) CommandTag() pgconn.CommandTag {
+	return pgconn.CommandTag(r.res.Tag)
+}
+
+func (r *rows) FieldDescriptions() []pgproto3.FieldDescription {
+	fields := make([]pgproto3.FieldDescription, len(r.res.Columns))
+	for i, c := range r.res.Columns {
+		fields[i].Name = []byte(c)
+	}
+	return fields
+}
+
+func (r *rows) Next() bool {
+	if r.closed || r.err != nil {
+		return false
+	}
+	r.i++
+	if r.i >= len(r.res.Rows) {
+		r.Close()
+		return false
+	}
+	return true
+}
+
+func (r *rows) Scan(dest ...interface{}) (err error) {
+	defer func() {
+		if err != nil {
+			r.err = err
+			r.Close()
+		}
+	}()
+
+	if r.i < 0 || r.i >= len(r.res.Rows) {
+		return fmt.Errorf("mock: no current row")
+	}
+	vals := r.res.Rows[r.i]
+	if len(dest) != len(vals) {
+		return fmt.Errorf(
+			"mock: destination count mismatch: %d != %d",
+			len(dest),
+			len(vals),
+		)
+	}
+	for i, d := range dest {
+		if err = assign(d, vals[i]); err != nil {
+			return fmt.Errorf("mock: column %d: %w", i, err)
+		}
+	}
+	return
+}
+
+func (r *rows) Values() ([]interface{}, error) {
+	if r.i < 0 || r.i >= len(r.res.Rows) {
+		return nil, fmt.Errorf("mock: no current row")
+	}
+	return r.res.Rows[r.i], nil
+}
+
+// Not supported
+func (r *rows) RawValues() [][]byte {
+	return nil
+}
+
+// Assign scripted value val to scan destination dest
+func assign(dest, val interface{}) error {
+	if s, ok := dest.(sql.Scanner); ok {
+		return s.Scan(val)
+	}
+
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T",
+			dest)
+	}
+	d = d.Elem()
+	if val == nil {
+		d.Set(reflect.Zero(d.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(val)
+	switch {
+	case v.Type().AssignableTo(d.Type()):
+		d.Set(v)
+	case d.Kind() == reflect.Ptr && convertible(v.Type(), d.Type().Elem()):
+		p := reflect.New(d.Type().Elem())
+		p.Elem().Set(v.Convert(d.Type().Elem()))
+		d.Set(p)
+	case convertible(v.Type(), d.Type()):
+		d.Set(v.Convert(d.Type()))
+	default:
+		return fmt.Errorf("can not assign %T to %s", val, d.Type())
+	}
+	return nil
+}
+
+// Returns, if values of type from can be converted to type to without
+// changing their meaning
+func convertible(from, to reflect.Type) bool {
+	if !from.ConvertibleTo(to) {
+		return false
+	}
+	// Integer to string conversion produces a rune
+	if to.Kind() == reflect.String {
+		switch from.Kind() {
+		case reflect.String, reflect.Slice:
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Row of a scripted result
+type row struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r row) Scan(dest ...interface{}) (err error) {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err = r.rows.Err(); err == nil {
+			err = pgx.ErrNoRows
+		}
+		return
+	}
+	return r.rows.Scan(dest...)
+}
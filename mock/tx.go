@@ -0,0 +1,124 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Mock transaction or pseudo nested transaction started on a Conn.
+// Statements are recorded on and scripted through the Conn.
+type Tx struct {
+	conn   *Conn
+	closed bool
+}
+
+func (t *Tx) Begin(ctx context.Context) (pgx.Tx, error) {
+	if t.closed {
+		return nil, pgx.ErrTxClosed
+	}
+	return t.conn.Begin(ctx)
+}
+
+func (t *Tx) Commit(context.Context) error {
+	return t.finish(&t.conn.commits)
+}
+
+func (t *Tx) Rollback(context.Context) error {
+	return t.finish(&t.conn.rollbacks)
+}
+
+// Close the transaction and increment counter
+func (t *Tx) finish(counter *int) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+	t.closed = true
+
+	t.conn.mu.Lock()
+	defer t.conn.mu.Unlock()
+	*counter++
+	t.conn.openTxs--
+	return nil
+}
+
+func (t *Tx) CopyFrom(
+	context.Context,
+	pgx.Identifier,
+	[]string,
+	pgx.CopyFromSource,
+) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+func (t *Tx) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return batchResults{}
+}
+
+// Not supported. The returned value must not be used.
+func (t *Tx) LargeObjects() pgx.LargeObjects {
+	return pgx.LargeObjects{}
+}
+
+func (t *Tx) Prepare(context.Context, string, string) (
+	*pgconn.StatementDescription,
+	error,
+) {
+	return nil, ErrUnsupported
+}
+
+func (t *Tx) Exec(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgconn.CommandTag, error) {
+	if t.closed {
+		return nil, pgx.ErrTxClosed
+	}
+	return t.conn.Exec(ctx, sql, args...)
+}
+
+func (t *Tx) Query(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgx.Rows, error) {
+	if t.closed {
+		return nil, pgx.ErrTxClosed
+	}
+	return t.conn.Query(ctx, sql, args...)
+}
+
+func (t *Tx) QueryRow(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) pgx.Row {
+	rows, err := t.Query(ctx, sql, args...)
+	return row{rows, err}
+}
+
+// Always nil, as there is no underlying connection
+func (t *Tx) Conn() *pgx.Conn {
+	return nil
+}
+
+// Batches are not supported
+type batchResults struct{}
+
+func (batchResults) Exec() (pgconn.CommandTag, error) {
+	return nil, ErrUnsupported
+}
+
+func (batchResults) Query() (pgx.Rows, error) {
+	return nil, ErrUnsupported
+}
+
+func (batchResults) QueryRow() pgx.Row {
+	return row{nil, ErrUnsupported}
+}
+
+func (batchResults) Close() error {
+	return nil
+}
@@ -0,0 +1,237 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Default table used by Outbox
+const OutboxTable = "pg_util_outbox"
+
+// Message stored in an outbox
+type OutboxMessage struct {
+	ID        int64
+	Topic     string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// Transactional outbox. Messages are written in the same transaction as the
+// changes they describe and delivered by a relay after commit, so messages
+// are never lost or sent for rolled back changes, which solves the dual-write
+// problem of updating the database and a message broker.
+//
+// Delivery is at least once. Messages are marked as sent after delivery, so
+// a crash between the two causes redelivery.
+type Outbox struct {
+	// Table to store messages in. Also used as the channel for waking up the
+	// relay. Defaults to OutboxTable.
+	Table string
+}
+
+// Return the table of the outbox
+func (o Outbox) table() string {
+	if o.Table == "" {
+		return OutboxTable
+	}
+	return o.Table
+}
+
+// Create the table of the outbox, if it does not exist yet
+func (o Outbox) CreateTable(ctx context.Context, q Querier) (err error) {
+	_, err = q.Exec(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS `+quoteIdentifier(o.table())+` (
+			id bigserial PRIMARY KEY,
+			topic text NOT NULL,
+			payload jsonb NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			sent_at timestamptz
+		);
+		CREATE INDEX IF NOT EXISTS `+quoteName(o.table()+"_unsent_idx")+`
+			ON `+quoteIdentifier(o.table())+` (id)
+			WHERE sent_at IS NULL`,
+	)
+	return
+}
+
+// Add a message with the JSON-encoded payload on topic to the outbox as part
+// of transaction tx. The relay is woken up on commit.
+func (o Outbox) Add(
+	ctx context.Context,
+	tx pgx.Tx,
+	topic string,
+	payload interface{},
+) (id int64, err error) {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	err = tx.
+		QueryRow(
+			ctx,
+			`INSERT INTO `+quoteIdentifier(o.table())+` (topic, payload)
+			VALUES ($1, $2)
+			RETURNING id`,
+			topic,
+			string(buf),
+		).
+		Scan(&id)
+	if err != nil {
+		return
+	}
+	err = NotifyOnCommit(ctx, tx, o.table(), "")
+	return
+}
+
+// Options for Outbox.Relay
+type OutboxRelayOpts struct {
+	// Connection or pool to read and mark messages on. Required.
+	Conn TxStarter
+
+	// URL to listen for notifications of added messages on. Messages are
+	// only discovered by polling, if empty.
+	ConnectionURL string
+
+	// Delivers a message to its destination, like a message broker.
+	// Required.
+	Deliver func(ctx context.Context, msg OutboxMessage) error
+
+	// Maximum number of messages read per transaction. Defaults to 100.
+	BatchSize int
+
+	// Interval of polling for messages, when no notifications arrive, and of
+	// retrying failed deliveries. Defaults to 5 seconds.
+	PollInterval time.Duration
+
+	// Optional handler for delivery and database errors
+	OnError func(err error)
+}
+
+// Deliver unsent messages of the outbox in order of addition until ctx is
+// done. Delivery stops at the first failed message of a batch and is retried
+// after the poll interval to preserve ordering.
+//
+// Multiple relays may run concurrently for availability, as messages are
+// claimed with FOR UPDATE SKIP LOCKED, but then ordering is only guaranteed
+// within a batch.
+func (o Outbox) Relay(ctx context.Context, opts OutboxRelayOpts) (err error) {
+	if opts.Conn == nil || opts.Deliver == nil {
+		return errors.New("pg_util: outbox relay Conn and Deliver required")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+
+	wake, err := listenWake(
+		ctx,
+		opts.ConnectionURL,
+		o.table(),
+		1,
+		opts.OnError,
+	)
+	if err != nil {
+		return
+	}
+
+	for {
+		full, err := o.relayBatch(ctx, opts)
+		if err != nil {
+			full = false
+			if ctx.Err() == nil && opts.OnError != nil {
+				opts.OnError(err)
+			}
+		}
+		if full {
+			// More messages are likely pending
+			continue
+		}
+		if !sleepOrWake(ctx, opts.PollInterval, wake) {
+			return nil
+		}
+	}
+}
+
+// Deliver a single batch of messages. Returns, if the batch was full and
+// delivered successfully.
+func (o Outbox) relayBatch(ctx context.Context, opts OutboxRelayOpts) (
+	full bool,
+	err error,
+) {
+	err = InTransaction(ctx, opts.Conn, func(tx pgx.Tx) (err error) {
+		var msgs []OutboxMessage
+		err = QueryEach(
+			ctx,
+			tx,
+			`SELECT id, topic, payload, created_at
+			FROM `+quoteIdentifier(o.table())+`
+			WHERE sent_at IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED`,
+			[]interface{}{opts.BatchSize},
+			func(row pgx.Row) (err error) {
+				var (
+					m       OutboxMessage
+					payload []byte
+				)
+				err = row.Scan(&m.ID, &m.Topic, &payload, &m.CreatedAt)
+				if err != nil {
+					return
+				}
+				m.Payload = json.RawMessage(payload)
+				msgs = append(msgs, m)
+				return
+			},
+		)
+		if err != nil {
+			return
+		}
+
+		sent := make([]int64, 0, len(msgs))
+		var deliverErr error
+		for _, m := range msgs {
+			deliverErr = opts.Deliver(ctx, m)
+			if deliverErr != nil {
+				deliverErr = fmt.Errorf(
+					"pg_util: delivering outbox message id=%d topic=%s: %w",
+					m.ID, m.Topic, deliverErr,
+				)
+				break
+			}
+			sent = append(sent, m.ID)
+		}
+
+		// Mark delivered messages even, if a later one failed, to prevent
+		// their redelivery
+		if len(sent) != 0 {
+			_, err = tx.Exec(
+				ctx,
+				`UPDATE `+quoteIdentifier(o.table())+`
+				SET sent_at = now()
+				WHERE id = ANY($1)`,
+				sent,
+			)
+			if err != nil {
+				return
+			}
+		}
+		if deliverErr != nil {
+			if opts.OnError != nil {
+				opts.OnError(deliverErr)
+			}
+			return
+		}
+		full = len(msgs) == opts.BatchSize
+		return
+	})
+	return
+}
@@ -0,0 +1,109 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestOutbox(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	o := Outbox{Table: "outbox_test"}
+	_, err = pool.Exec(ctx, "DROP TABLE IF EXISTS outbox_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.CreateTable(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rolled back messages must never be delivered
+	errRollback := errors.New("rollback")
+	err = InTransaction(ctx, pool, func(tx pgx.Tx) (err error) {
+		_, err = o.Add(ctx, tx, "rolled_back", 0)
+		if err != nil {
+			return
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = InTransaction(ctx, pool, func(tx pgx.Tx) (err error) {
+		for i := 1; i <= 3; i++ {
+			_, err = o.Add(ctx, tx, "test", i)
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		delivered []string
+		failed    bool
+		done      = make(chan struct{})
+	)
+	errFail := errors.New("fail")
+	relayCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go o.Relay(relayCtx, OutboxRelayOpts{
+		Conn:          pool,
+		ConnectionURL: getURL(t),
+		PollInterval:  100 * time.Millisecond,
+		Deliver: func(_ context.Context, msg OutboxMessage) error {
+			// Fail the second message once
+			if string(msg.Payload) == "2" && !failed {
+				failed = true
+				return errFail
+			}
+			delivered = append(delivered, msg.Topic+string(msg.Payload))
+			if len(delivered) == 3 {
+				close(done)
+			}
+			return nil
+		},
+	})
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("messages not delivered")
+	}
+	stop()
+
+	std := []string{"test1", "test2", "test3"}
+	if !reflect.DeepEqual(delivered, std) {
+		t.Fatalf("delivery mismatch: %v != %v", delivered, std)
+	}
+	unsent, err := QueryValue[int](
+		ctx,
+		pool,
+		"SELECT count(*) FROM outbox_test WHERE sent_at IS NULL",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsent != 0 {
+		t.Fatalf("unsent messages: %d", unsent)
+	}
+}
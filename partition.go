@@ -0,0 +1,338 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Interval of range partitions managed by EnsurePartitions
+type PartitionInterval int
+
+const (
+	// Partitions named <table>_YYYYMM
+	PartitionMonthly PartitionInterval = iota
+
+	// Partitions named <table>_YYYYMMDD
+	PartitionDaily
+
+	// Partitions starting on Monday named <table>_YYYYMMDD
+	PartitionWeekly
+
+	// Partitions named <table>_YYYY
+	PartitionYearly
+)
+
+// Return the start of the partition period containing t in UTC
+func (i PartitionInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	y, m, d := t.Date()
+	switch i {
+	case PartitionDaily:
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	case PartitionWeekly:
+		// ISO weeks start on Monday
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0,
+			time.UTC)
+	case PartitionYearly:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Return the start of the partition period n periods after the one starting
+// at start
+func (i PartitionInterval) add(start time.Time, n int) time.Time {
+	switch i {
+	case PartitionDaily:
+		return start.AddDate(0, 0, n)
+	case PartitionWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case PartitionYearly:
+		return start.AddDate(n, 0, 0)
+	default:
+		return start.AddDate(0, n, 0)
+	}
+}
+
+// Layout of the partition name suffix
+func (i PartitionInterval) layout() string {
+	switch i {
+	case PartitionDaily, PartitionWeekly:
+		return "20060102"
+	case PartitionYearly:
+		return "2006"
+	default:
+		return "200601"
+	}
+}
+
+// Range partitioning scheme of a table for EnsurePartitions
+type PartitionSpec struct {
+	// Schema of the table. Uses the search path, if empty.
+	Schema string
+
+	// Parent table partitioned by range on a date or timestamp column.
+	// Required.
+	Table string
+
+	// Period covered by each partition. Periods are aligned in UTC.
+	Interval PartitionInterval
+
+	// Number of partitions to create ahead of the current one
+	Premake int
+
+	// Number of partitions before the current one to keep. Older partitions
+	// are removed. Partitions are kept indefinitely, if zero.
+	Retention int
+
+	// Detach old partitions instead of dropping them, so they can be
+	// archived
+	DetachOnly bool
+
+	// Reference time for the current partition. Defaults to the current
+	// time.
+	Now time.Time
+}
+
+// Return the quoted, optionally schema-qualified, identifier of table
+func (s PartitionSpec) identifier(table string) string {
+	if s.Schema == "" {
+		return quoteIdentifier(table)
+	}
+	return pgx.Identifier{s.Schema, table}.Sanitize()
+}
+
+// Return the partition name prefix, truncated to fit the suffix into the
+// maximum identifier length
+func (s PartitionSpec) prefix() string {
+	p := s.Table
+	max := maxIdentifierLength - len(s.Interval.layout()) - 1
+	if len(p) > max {
+		p = p[:max]
+	}
+	return p + "_"
+}
+
+// Return the name of the partition of the period containing t
+func (s PartitionSpec) PartitionName(t time.Time) string {
+	return s.prefix() + s.Interval.start(t).Format(s.Interval.layout())
+}
+
+// Maximum length of a Postgres identifier in bytes
+const maxIdentifierLength = 63
+
+// Format t as a range bound literal
+func partitionBound(t time.Time) string {
+	return "'" + t.Format("2006-01-02 15:04:05Z07:00") + "'"
+}
+
+// Create the partition of the period containing t, if it does not exist yet.
+// Returns the name of the partition.
+func CreatePartition(
+	ctx context.Context,
+	q Querier,
+	spec PartitionSpec,
+	t time.Time,
+) (name string, err error) {
+	start := spec.Interval.start(t)
+	name = spec.PartitionName(start)
+	_, err = q.Exec(
+		ctx,
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s
+			FOR VALUES FROM (%s) TO (%s)`,
+			spec.identifier(name),
+			spec.identifier(spec.Table),
+			partitionBound(start),
+			partitionBound(spec.Interval.add(start, 1)),
+		),
+	)
+	return
+}
+
+// Attach existing table as the partition of the period containing t. The
+// table must have the same columns as the parent table.
+func AttachPartition(
+	ctx context.Context,
+	q Querier,
+	spec PartitionSpec,
+	table string,
+	t time.Time,
+) (err error) {
+	start := spec.Interval.start(t)
+	_, err = q.Exec(
+		ctx,
+		fmt.Sprintf(
+			`ALTER TABLE %s ATTACH PARTITION %s
+			FOR VALUES FROM (%s) TO (%s)`,
+			spec.identifier(spec.Table),
+			spec.identifier(table),
+			partitionBound(start),
+			partitionBound(spec.Interval.add(start, 1)),
+		),
+	)
+	return
+}
+
+// Detach partition from the parent table of spec. The partition is kept as a
+// standalone table.
+func DetachPartition(
+	ctx context.Context,
+	q Querier,
+	spec PartitionSpec,
+	partition string,
+) (err error) {
+	_, err = q.Exec(
+		ctx,
+		fmt.Sprintf(
+			`ALTER TABLE %s DETACH PARTITION %s`,
+			spec.identifier(spec.Table),
+			spec.identifier(partition),
+		),
+	)
+	return
+}
+
+// Partition of a table managed by EnsurePartitions
+type Partition struct {
+	Name string
+
+	// Start of the partition period
+	Start time.Time
+}
+
+// List partitions of the table of spec named according to spec in ascending
+// order of their periods. Other partitions, like a default partition, are
+// ignored.
+func ListPartitions(ctx context.Context, q Querier, spec PartitionSpec) (
+	parts []Partition,
+	err error,
+) {
+	names, err := QueryValues[string](
+		ctx,
+		q,
+		`SELECT c.relname::text
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass`,
+		spec.identifier(spec.Table),
+	)
+	if err != nil {
+		return
+	}
+
+	prefix := spec.prefix()
+	parts = make([]Partition, 0, len(names))
+	for _, n := range names {
+		if !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		start, err := time.Parse(
+			spec.Interval.layout(),
+			strings.TrimPrefix(n, prefix),
+		)
+		if err != nil || !spec.Interval.start(start).Equal(start) {
+			continue
+		}
+		parts = append(parts, Partition{
+			Name:  n,
+			Start: start,
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Start.Before(parts[j].Start)
+	})
+	return
+}
+
+// Changes made by EnsurePartitions
+type PartitionChanges struct {
+	// Names of created partitions
+	Created []string
+
+	// Names of dropped or detached partitions
+	Removed []string
+}
+
+// Create the current partition, spec.Premake partitions ahead and the
+// retained past partitions, that do not exist yet, and remove partitions
+// older than spec.Retention. Run periodically, for example with Scheduler,
+// to keep partitions available ahead of time.
+//
+// All changes are made in a single transaction holding an advisory lock
+// keyed by the table, so concurrent calls from multiple replicas are safe.
+func EnsurePartitions(
+	ctx context.Context,
+	conn TxStarter,
+	spec PartitionSpec,
+) (changes PartitionChanges, err error) {
+	now := spec.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	current := spec.Interval.start(now)
+
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		changes = PartitionChanges{}
+		err = AdvisoryXactLock(
+			ctx,
+			tx,
+			LockKeyString("pg_util_partitions:"+spec.identifier(spec.Table)),
+		)
+		if err != nil {
+			return
+		}
+
+		existing, err := ListPartitions(ctx, tx, spec)
+		if err != nil {
+			return
+		}
+		exists := make(map[string]struct{}, len(existing))
+		for _, p := range existing {
+			exists[p.Name] = struct{}{}
+		}
+
+		for i := -spec.Retention; i <= spec.Premake; i++ {
+			start := spec.Interval.add(current, i)
+			name := spec.PartitionName(start)
+			if _, ok := exists[name]; ok {
+				continue
+			}
+			_, err = CreatePartition(ctx, tx, spec, start)
+			if err != nil {
+				return
+			}
+			changes.Created = append(changes.Created, name)
+		}
+
+		if spec.Retention <= 0 {
+			return
+		}
+		oldest := spec.Interval.add(current, -spec.Retention)
+		for _, p := range existing {
+			if !p.Start.Before(oldest) {
+				break
+			}
+			if spec.DetachOnly {
+				err = DetachPartition(ctx, tx, spec, p.Name)
+			} else {
+				_, err = tx.Exec(
+					ctx,
+					"DROP TABLE "+spec.identifier(p.Name),
+				)
+			}
+			if err != nil {
+				return
+			}
+			changes.Removed = append(changes.Removed, p.Name)
+		}
+		return
+	})
+	return
+}
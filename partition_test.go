@@ -0,0 +1,155 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestPartitionName(t *testing.T) {
+	t.Parallel()
+
+	// Wednesday
+	now := time.Date(2021, 3, 17, 13, 0, 0, 0, time.UTC)
+
+	cases := [...]struct {
+		name     string
+		table    string
+		interval PartitionInterval
+		out      string
+	}{
+		{
+			name:     "monthly",
+			table:    "events",
+			interval: PartitionMonthly,
+			out:      "events_202103",
+		},
+		{
+			name:     "daily",
+			table:    "events",
+			interval: PartitionDaily,
+			out:      "events_20210317",
+		},
+		{
+			name:     "weekly",
+			table:    "events",
+			interval: PartitionWeekly,
+			out:      "events_20210315",
+		},
+		{
+			name:     "yearly",
+			table:    "events",
+			interval: PartitionYearly,
+			out:      "events_2021",
+		},
+		{
+			name:     "truncated",
+			table:    strings.Repeat("a", 70),
+			interval: PartitionYearly,
+			out:      strings.Repeat("a", 58) + "_2021",
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			spec := PartitionSpec{
+				Table:    c.table,
+				Interval: c.interval,
+			}
+			name := spec.PartitionName(now)
+			if name != c.out {
+				t.Fatalf("name mismatch: %s != %s", name, c.out)
+			}
+		})
+	}
+}
+
+func TestEnsurePartitions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(
+		ctx,
+		`DROP TABLE IF EXISTS partition_test, partition_test_detached;
+		CREATE TABLE partition_test (
+			created_at timestamptz NOT NULL
+		) PARTITION BY RANGE (created_at);
+		CREATE TABLE partition_test_detached (
+			created_at timestamptz NOT NULL
+		)`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec(
+		ctx,
+		"DROP TABLE IF EXISTS partition_test, partition_test_detached",
+	)
+
+	spec := PartitionSpec{
+		Table:     "partition_test",
+		Premake:   2,
+		Retention: 1,
+		Now:       time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC),
+	}
+	old := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	err = AttachPartition(ctx, conn, spec, "partition_test_detached", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DetachPartition(ctx, conn, spec, "partition_test_detached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CreatePartition(ctx, conn, spec, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := EnsurePartitions(ctx, conn, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := PartitionChanges{
+		Created: []string{
+			"partition_test_202102",
+			"partition_test_202103",
+			"partition_test_202104",
+			"partition_test_202105",
+		},
+		Removed: []string{"partition_test_202012"},
+	}
+	if !reflect.DeepEqual(changes, std) {
+		t.Fatalf("changes mismatch: %+v != %+v", changes, std)
+	}
+
+	// Idempotent
+	changes, err = EnsurePartitions(ctx, conn, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Created) != 0 || len(changes.Removed) != 0 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+
+	_, err = conn.Exec(
+		ctx,
+		"INSERT INTO partition_test VALUES ('2021-05-31 23:59:59+00')",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,306 @@
+// Package pgtest provisions isolated schemas and databases for integration
+// tests, so tests do not depend on the state of a shared database.
+//
+//	func TestUsers(t *testing.T) {
+//		db := pgtest.Schema(t, pgtest.Opts{
+//			DDL: []string{"CREATE TABLE users (id int PRIMARY KEY)"},
+//		})
+//		_, err := db.Pool.Exec(ctx, "INSERT INTO users VALUES (1)")
+//		...
+//	}
+//
+// The schema or database is dropped, when the test finishes.
+//
+// Tests of package pg_util itself can not use pgtest, as pgtest imports it.
+// They read the same URLEnv variable, if test_config.json is absent, but run
+// against the shared database.
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bakape/pg_util"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Environment variable holding the default database URL
+const URLEnv = "PG_UTIL_TEST_URL"
+
+// Options for provisioning a schema or database
+type Opts struct {
+	// URL of the database to provision in. Defaults to the URLEnv
+	// environment variable. The test is skipped, if neither is set.
+	URL string
+
+	// SQL scripts executed with pg_util.ExecScript after provisioning
+	DDL []string
+
+	// Migrations applied with pg_util.Migrate after provisioning and before
+	// DDL
+	Migrations pg_util.MigrationSource
+
+	// Existing database to clone for Database. Cloning a template with a
+	// prepared schema is faster than applying DDL for every test. See
+	// CreateTemplate. The template must not have any open connections.
+	Template string
+}
+
+// Isolated schema or database provisioned for a test
+type DB struct {
+	// Name of the schema or database
+	Name string
+
+	// URL connecting to the schema or database
+	URL string
+
+	// Pool connected to URL. Closed, when the test finishes.
+	Pool *pgxpool.Pool
+}
+
+// Create a schema with a random name and a URL with the search_path set to
+// it, so unqualified names used by the test resolve to the schema. The
+// schema is dropped with all its objects, when the test finishes.
+//
+// Schemas are cheaper than databases, but extensions and other database-wide
+// objects are shared between tests.
+func Schema(t testing.TB, opts Opts) *DB {
+	t.Helper()
+
+	base := baseURL(t, opts)
+	ctx := context.Background()
+	name := randomName(t)
+	exec(t, base, "CREATE SCHEMA "+quote(name))
+	t.Cleanup(func() {
+		exec(t, base, "DROP SCHEMA IF EXISTS "+quote(name)+" CASCADE")
+	})
+
+	u, err := setParam(base, "search_path", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provision(ctx, t, name, u, opts)
+}
+
+// Create a database with a random name, cloned from opts.Template, if set.
+// The database is dropped, when the test finishes.
+func Database(t testing.TB, opts Opts) *DB {
+	t.Helper()
+
+	base := baseURL(t, opts)
+	ctx := context.Background()
+	name := randomName(t)
+	sql := "CREATE DATABASE " + quote(name)
+	if opts.Template != "" {
+		sql += " TEMPLATE " + quote(opts.Template)
+	}
+	exec(t, base, sql)
+	t.Cleanup(func() {
+		dropDatabase(t, base, name)
+	})
+
+	u, err := setParam(base, "dbname", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provision(ctx, t, name, u, opts)
+}
+
+// Create database name from scratch with migrations and DDL of opts applied
+// for use as Opts.Template. Any existing database with the same name is
+// dropped. Call once per process, for example in TestMain.
+func CreateTemplate(ctx context.Context, name string, opts Opts) (err error) {
+	base := opts.URL
+	if base == "" {
+		base = os.Getenv(URLEnv)
+	}
+	if base == "" {
+		return fmt.Errorf("pgtest: %s not set", URLEnv)
+	}
+
+	conn, err := pgx.Connect(ctx, base)
+	if err != nil {
+		return
+	}
+	defer conn.Close(ctx)
+	err = terminate(ctx, conn, name)
+	if err != nil {
+		return
+	}
+	_, err = conn.Exec(ctx, "DROP DATABASE IF EXISTS "+quote(name))
+	if err != nil {
+		return
+	}
+	_, err = conn.Exec(ctx, "CREATE DATABASE "+quote(name))
+	if err != nil {
+		return
+	}
+
+	u, err := setParam(base, "dbname", name)
+	if err != nil {
+		return
+	}
+	tmpl, err := pgx.Connect(ctx, u)
+	if err != nil {
+		return
+	}
+	defer tmpl.Close(ctx)
+	return setup(ctx, tmpl, opts)
+}
+
+// Return the URL to provision in or skip the test
+func baseURL(t testing.TB, opts Opts) string {
+	t.Helper()
+
+	if opts.URL != "" {
+		return opts.URL
+	}
+	u := os.Getenv(URLEnv)
+	if u == "" {
+		t.Skipf("pgtest: %s not set", URLEnv)
+	}
+	return u
+}
+
+// Connect a pool to u and apply migrations and DDL of opts
+func provision(
+	ctx context.Context,
+	t testing.TB,
+	name, u string,
+	opts Opts,
+) *DB {
+	t.Helper()
+
+	pool, err := pgxpool.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Registered after dropping, so it runs first
+	t.Cleanup(pool.Close)
+
+	err = setup(ctx, pool, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DB{
+		Name: name,
+		URL:  u,
+		Pool: pool,
+	}
+}
+
+// Apply migrations and DDL of opts
+func setup(
+	ctx context.Context,
+	conn pg_util.TxStarter,
+	opts Opts,
+) (err error) {
+	if opts.Migrations != nil {
+		_, err = pg_util.Migrate(ctx, conn, opts.Migrations)
+		if err != nil {
+			return
+		}
+	}
+	for _, ddl := range opts.DDL {
+		err = pg_util.InTransaction(ctx, conn, func(tx pgx.Tx) error {
+			return pg_util.ExecScript(ctx, tx, ddl)
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Execute sql on a new connection to u
+func exec(t testing.TB, u, sql string) {
+	t.Helper()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Terminate remaining connections to database name and drop it
+func dropDatabase(t testing.TB, u, name string) {
+	t.Helper()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	err = terminate(ctx, conn, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(ctx, "DROP DATABASE IF EXISTS "+quote(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Terminate all connections to database name
+func terminate(ctx context.Context, conn *pgx.Conn, name string) (err error) {
+	_, err = conn.Exec(
+		ctx,
+		`SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE datname = $1 AND pid <> pg_backend_pid()`,
+		name,
+	)
+	return
+}
+
+// Return a random lowercase identifier
+func randomName(t testing.TB) string {
+	t.Helper()
+
+	var buf [8]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "pgtest_" + hex.EncodeToString(buf[:])
+}
+
+func quote(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// Set connection parameter key of URL or keyword/value connection string s
+func setParam(s, key, value string) (string, error) {
+	if strings.HasPrefix(s, "postgres://") ||
+		strings.HasPrefix(s, "postgresql://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		if key == "dbname" {
+			q.Del(key)
+			u.Path = "/" + value
+		} else {
+			q.Set(key, value)
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	// Names generated by this package need no escaping
+	return s + " " + key + "=" + value, nil
+}
@@ -0,0 +1,98 @@
+package pgtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bakape/pg_util"
+)
+
+func TestSetParam(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in, key, value, out string
+	}{
+		{
+			name:  "url search_path",
+			in:    "postgres://u:p@localhost/db?sslmode=disable",
+			key:   "search_path",
+			value: "s",
+			out:   "postgres://u:p@localhost/db?search_path=s&sslmode=disable",
+		},
+		{
+			name:  "url dbname",
+			in:    "postgresql://localhost/db?dbname=x",
+			key:   "dbname",
+			value: "other",
+			out:   "postgresql://localhost/other",
+		},
+		{
+			name:  "keyword/value",
+			in:    "host=localhost dbname=db",
+			key:   "dbname",
+			value: "other",
+			out:   "host=localhost dbname=db dbname=other",
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := setParam(c.in, c.key, c.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != c.out {
+				t.Fatalf("expected %s, got %s", c.out, out)
+			}
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	db := Schema(t, Opts{
+		DDL: []string{`create table things (id int primary key)`},
+	})
+	ctx := context.Background()
+	_, err := db.Pool.Exec(ctx, `insert into things values (1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := pg_util.QueryValue[string](
+		ctx,
+		db.Pool,
+		`select table_schema::text
+		from information_schema.tables
+		where table_name = 'things' and table_schema = current_schema()`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema != db.Name {
+		t.Fatalf("expected table in schema %s, got %s", db.Name, schema)
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	t.Parallel()
+
+	db := Database(t, Opts{
+		DDL: []string{`create table things (id int primary key)`},
+	})
+	name, err := pg_util.QueryValue[string](
+		context.Background(),
+		db.Pool,
+		`select current_database()::text`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != db.Name {
+		t.Fatalf("expected database %s, got %s", db.Name, name)
+	}
+}
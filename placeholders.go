@@ -0,0 +1,169 @@
+package pg_util
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Shift all $N placeholders in sql by offset, so the fragment can be combined
+// with other fragments, whose arguments occupy the first offset positions.
+//
+// Placeholders inside string literals, quoted identifiers, dollar-quoted
+// strings and comments are left intact.
+func shiftPlaceholders(sql string, offset int) string {
+	if offset == 0 {
+		return sql
+	}
+
+	var tmp []byte
+	return replacePlaceholders(sql, func(w *strings.Builder, n uint64) {
+		w.WriteByte('$')
+		tmp = strconv.AppendUint(tmp[:0], n+uint64(offset), 10)
+		w.Write(tmp)
+	})
+}
+
+// Replace all $N placeholders in sql with the output of fn.
+//
+// Placeholders inside string literals, quoted identifiers, dollar-quoted
+// strings and comments are left intact.
+func replacePlaceholders(
+	sql string,
+	fn func(w *strings.Builder, n uint64),
+) string {
+	if !strings.ContainsRune(sql, '$') {
+		return sql
+	}
+
+	var w strings.Builder
+	w.Grow(len(sql) + 8)
+	for i := 0; i < len(sql); {
+		b := sql[i]
+		switch {
+		case b == '\'':
+			// Backslash escapes are only valid in E'' strings
+			escapes := i != 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') &&
+				(i == 1 || !isIdentByte(sql[i-2]))
+			j := skipQuoted(sql, i, '\'', escapes)
+			w.WriteString(sql[i:j])
+			i = j
+		case b == '"':
+			j := skipQuoted(sql, i, '"', false)
+			w.WriteString(sql[i:j])
+			i = j
+		case b == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			j := strings.IndexByte(sql[i:], '\n')
+			if j == -1 {
+				j = len(sql)
+			} else {
+				j += i + 1
+			}
+			w.WriteString(sql[i:j])
+			i = j
+		case b == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			j := skipBlockComment(sql, i)
+			w.WriteString(sql[i:j])
+			i = j
+		case b == '$' && (i == 0 || !isIdentByte(sql[i-1])):
+			j := i + 1
+			for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+				j++
+			}
+			if j != i+1 {
+				n, err := strconv.ParseUint(sql[i+1:j], 10, 64)
+				if err != nil {
+					w.WriteString(sql[i:j])
+				} else {
+					fn(&w, n)
+				}
+				i = j
+				continue
+			}
+
+			// Dollar-quoted string
+			if tag, ok := readDollarTag(sql, i); ok {
+				end := strings.Index(sql[i+len(tag):], tag)
+				if end == -1 {
+					j = len(sql)
+				} else {
+					j = i + len(tag) + end + len(tag)
+				}
+				w.WriteString(sql[i:j])
+				i = j
+				continue
+			}
+			w.WriteByte(b)
+			i++
+		default:
+			w.WriteByte(b)
+			i++
+		}
+	}
+	return w.String()
+}
+
+// Return index after the closing quote of quoted string starting at i
+func skipQuoted(sql string, i int, quote byte, escapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch sql[j] {
+		case '\\':
+			if escapes {
+				j++
+			}
+		case quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++ // Escaped quote
+			} else {
+				return j + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// Return index after the end of a possibly nested block comment starting
+// at i
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for j := i; j+1 < len(sql); j++ {
+		switch {
+		case sql[j] == '/' && sql[j+1] == '*':
+			depth++
+			j++
+		case sql[j] == '*' && sql[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// Read dollar quote tag like $$ or $body$ starting at i
+func readDollarTag(sql string, i int) (tag string, ok bool) {
+	for j := i + 1; j < len(sql); j++ {
+		b := sql[j]
+		switch {
+		case b == '$':
+			return sql[i : j+1], true
+		case b >= '0' && b <= '9':
+			if j == i+1 {
+				return
+			}
+		case !isIdentByte(b):
+			return
+		}
+	}
+	return
+}
+
+// Byte can be part of an unquoted identifier
+func isIdentByte(b byte) bool {
+	return b == '_' ||
+		(b >= 'a' && b <= 'z') ||
+		(b >= 'A' && b <= 'Z') ||
+		(b >= '0' && b <= '9') ||
+		b >= 0x80
+}
@@ -0,0 +1,69 @@
+package pg_util
+
+import (
+	"testing"
+)
+
+func TestShiftPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in, out string
+		offset        int
+	}{
+		{
+			name:   "no offset",
+			in:     `select $1`,
+			out:    `select $1`,
+			offset: 0,
+		},
+		{
+			name:   "simple",
+			in:     `select $1, $2 from t where a = $10`,
+			out:    `select $4, $5 from t where a = $13`,
+			offset: 3,
+		},
+		{
+			name:   "string literals",
+			in:     `select '$1', 'it''s $2', E'\'$3', $1`,
+			out:    `select '$1', 'it''s $2', E'\'$3', $2`,
+			offset: 1,
+		},
+		{
+			name:   "quoted identifier",
+			in:     `select "$1" from t where a=$1`,
+			out:    `select "$1" from t where a=$2`,
+			offset: 1,
+		},
+		{
+			name:   "comments",
+			in:     "select $1 -- $1\n/* $1 /* $1 */ $1 */ + $2",
+			out:    "select $2 -- $1\n/* $1 /* $1 */ $1 */ + $3",
+			offset: 1,
+		},
+		{
+			name:   "dollar quoted",
+			in:     `select $$ $1 $$, $body$ $1 $body$, $1`,
+			out:    `select $$ $1 $$, $body$ $1 $body$, $2`,
+			offset: 1,
+		},
+		{
+			name:   "identifier with dollar",
+			in:     `select a$1 from t where b = $1`,
+			out:    `select a$1 from t where b = $3`,
+			offset: 2,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res := shiftPlaceholders(c.in, c.offset)
+			if res != c.out {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", res, c.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package pg_util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// Prefix of channels used by topics
+	topicChannelPrefix = "pg_util_topic."
+
+	// Maximum length of a Postgres channel name
+	maxChannelLength = 63
+)
+
+// Named topic of JSON-encoded events of type T delivered over NOTIFY/LISTEN.
+//
+// Delivery is at most once. Events published while a subscriber is
+// reconnecting are lost. Use Outbox or the job queue for reliable delivery.
+type Topic[T any] struct {
+	name string
+}
+
+// Create a topic with name. Any name can be used and is mapped to a valid
+// channel name.
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{name: name}
+}
+
+// Return the name of the topic
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+// Return the channel name of the topic
+func (t Topic[T]) channel() string {
+	return topicChannel(t.name)
+}
+
+// Map topic name to a channel name, that is safe to quote and not truncated
+// by Postgres. Names with other characters than ASCII letters, digits, '_',
+// '-' and '.' or too long names are replaced by their hash.
+func topicChannel(name string) string {
+	ch := topicChannelPrefix + name
+	if len(ch) <= maxChannelLength && isSafeChannelName(name) {
+		return ch
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%s%x", topicChannelPrefix, h.Sum64())
+}
+
+func isSafeChannelName(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z',
+			r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9',
+			r == '_', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Publish event on the topic. If q is a transaction, the event is only
+// delivered, if it commits. The encoded event must be shorter than 8000
+// bytes.
+func (t Topic[T]) Publish(ctx context.Context, q Querier, event T) (
+	err error,
+) {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, err = q.Exec(ctx, `SELECT pg_notify($1, $2)`, t.channel(), string(buf))
+	return
+}
+
+// Subscribe fn to the topic on s in group. Each event of the topic is
+// dispatched once to every group subscribed in s in publication order. Groups
+// are processed independently, so a slow group does not delay others, until
+// its buffer is full.
+//
+// Subscribing the same group to the same topic twice is an error.
+func (t Topic[T]) Subscribe(
+	s *Subscriber,
+	group string,
+	fn func(ctx context.Context, event T) error,
+) error {
+	return s.subscribe(t.channel(), t.name, group, func(payload string) (
+		err error,
+	) {
+		var event T
+		err = json.Unmarshal([]byte(payload), &event)
+		if err != nil {
+			return
+		}
+		return fn(s.opts.Context, event)
+	})
+}
+
+// Options for NewSubscriber
+type SubscriberOpts struct {
+	// URL to connect to the database on. Each subscribed topic uses a
+	// dedicated connection. Required.
+	ConnectionURL string
+
+	// Number of events buffered per group. Defaults to 100.
+	GroupBuffer int
+
+	// Optional handler for handler and connection errors
+	OnError func(err error)
+
+	// Optional context for cancelling all subscriptions
+	Context context.Context
+}
+
+// Receives events of topics and dispatches them to subscribed groups. Create
+// with NewSubscriber and subscribe with Topic.Subscribe.
+type Subscriber struct {
+	opts SubscriberOpts
+
+	mu sync.Mutex
+
+	// Groups by channel
+	channels map[string]map[string]chan string
+}
+
+// Create a subscriber for topics. Subscriptions are active until
+// opts.Context is done.
+func NewSubscriber(opts SubscriberOpts) *Subscriber {
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.GroupBuffer <= 0 {
+		opts.GroupBuffer = 100
+	}
+	return &Subscriber{
+		opts:     opts,
+		channels: make(map[string]map[string]chan string),
+	}
+}
+
+func (s *Subscriber) handleError(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
+
+// Subscribe handle to channel of topic in group. Starts listening on the
+// channel on its first subscription.
+func (s *Subscriber) subscribe(
+	channel, topic, group string,
+	handle func(payload string) error,
+) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, listening := s.channels[channel]
+	if _, ok := groups[group]; ok {
+		return fmt.Errorf(
+			"pg_util: group %s already subscribed to topic %s",
+			group, topic,
+		)
+	}
+	if s.opts.Context.Err() != nil {
+		return errors.New("pg_util: subscriber context done")
+	}
+
+	if !listening {
+		err = Listen(ListenOpts{
+			ConnectionURL: s.opts.ConnectionURL,
+			Channel:       channel,
+			Context:       s.opts.Context,
+			OnError:       s.opts.OnError,
+			OnMsg: func(msg string) error {
+				s.dispatch(channel, msg)
+				return nil
+			},
+		})
+		if err != nil {
+			return
+		}
+		groups = make(map[string]chan string)
+		s.channels[channel] = groups
+	}
+
+	queue := make(chan string, s.opts.GroupBuffer)
+	groups[group] = queue
+	go func() {
+		for {
+			select {
+			case <-s.opts.Context.Done():
+				return
+			case payload := <-queue:
+				err := handle(payload)
+				if err != nil {
+					s.handleError(fmt.Errorf(
+						"pg_util: handling event topic=%s group=%s error=%w",
+						topic, group, err,
+					))
+				}
+			}
+		}
+	}()
+	return
+}
+
+// Queue payload for all groups subscribed to channel
+func (s *Subscriber) dispatch(channel, payload string) {
+	s.mu.Lock()
+	groups := make([]chan string, 0, len(s.channels[channel]))
+	for _, q := range s.channels[channel] {
+		groups = append(groups, q)
+	}
+	s.mu.Unlock()
+
+	for _, q := range groups {
+		select {
+		case <-s.opts.Context.Done():
+			return
+		case q <- payload:
+		}
+	}
+}
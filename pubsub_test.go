@@ -0,0 +1,116 @@
+package pg_util
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestTopicChannel(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, topic string
+		hashed      bool
+	}{
+		{
+			name:  "safe",
+			topic: "users.created",
+		},
+		{
+			name:   "unsafe characters",
+			topic:  `users "created"`,
+			hashed: true,
+		},
+		{
+			name:   "too long",
+			topic:  strings.Repeat("a", maxChannelLength),
+			hashed: true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			ch := topicChannel(c.topic)
+			if len(ch) > maxChannelLength {
+				t.Fatalf("channel name too long: %s", ch)
+			}
+			if (ch != topicChannelPrefix+c.topic) != c.hashed {
+				t.Fatalf("unexpected channel name: %s", ch)
+			}
+			if ch != topicChannel(c.topic) {
+				t.Fatal("channel name not deterministic")
+			}
+		})
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	type event struct {
+		ID   int
+		Name string
+	}
+	topic := NewTopic[event]("pub sub test")
+
+	received := make(chan string, 2)
+	s := NewSubscriber(SubscriberOpts{
+		ConnectionURL: getURL(t),
+		Context:       ctx,
+		OnError: func(err error) {
+			t.Error(err)
+		},
+	})
+	for _, g := range [...]string{"a", "b"} {
+		g := g
+		err := topic.Subscribe(s, g, func(_ context.Context, e event) error {
+			if e.ID != 1 || e.Name != "foo" {
+				t.Errorf("event mismatch: %+v", e)
+			}
+			received <- g
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := topic.Subscribe(s, "a", func(context.Context, event) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected duplicate group error")
+	}
+
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	err = topic.Publish(ctx, conn, event{ID: 1, Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := make(map[string]bool)
+	for len(groups) != 2 {
+		select {
+		case g := <-received:
+			if groups[g] {
+				t.Fatalf("event dispatched to group %s twice", g)
+			}
+			groups[g] = true
+		case <-ctx.Done():
+			t.Fatalf("event not dispatched to all groups: %v", groups)
+		}
+	}
+}
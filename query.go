@@ -0,0 +1,72 @@
+package pg_util
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Run query, that selects a single column, and scan the first row into a
+// value of type T. Returns ErrNoRows, if the query produced no rows.
+// Example: QueryValue[int64](ctx, q, "SELECT count(*) FROM users")
+func QueryValue[T any](
+	ctx context.Context,
+	q Querier,
+	sql string,
+	args ...interface{},
+) (val T, err error) {
+	err = q.QueryRow(ctx, sql, args...).Scan(&val)
+	return
+}
+
+// Run query, that selects a single column, and scan all resulting rows into
+// a slice of type T. Returns an empty slice, if the query produced no rows.
+func QueryValues[T any](
+	ctx context.Context,
+	q Querier,
+	sql string,
+	args ...interface{},
+) (vals []T, err error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	vals = make([]T, 0)
+	for rows.Next() {
+		var v T
+		if err = rows.Scan(&v); err != nil {
+			return
+		}
+		vals = append(vals, v)
+	}
+	err = rows.Err()
+	return
+}
+
+// Run query and call fn for each resulting row. Handles closing rows and
+// propagating query errors. Iteration stops at the first error returned by
+// fn, which is then returned.
+//
+// fn must only scan the current row.
+func QueryEach(
+	ctx context.Context,
+	q Querier,
+	sql string,
+	args []interface{},
+	fn func(pgx.Row) error,
+) (err error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return
+		}
+	}
+	return rows.Err()
+}
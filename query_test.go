@@ -0,0 +1,132 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestQueryValue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	n, err := QueryValue[int64](ctx, conn,
+		"select count(*) from generate_series(1, $1)", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("value mismatch: %d != 5", n)
+	}
+
+	_, err = QueryValue[int64](ctx, conn, "select 1 where false")
+	if err != ErrNoRows {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	cases := [...]struct {
+		name string
+		n    int
+	}{
+		{"empty", 0},
+		{"multiple", 3},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			vals, err := QueryValues[string](ctx, conn,
+				"select i::text from generate_series(1, $1) i", c.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vals == nil || len(vals) != c.n {
+				t.Fatalf("unexpected values: %#v", vals)
+			}
+			for j, v := range vals {
+				if v != string(rune('1'+j)) {
+					t.Fatalf("value mismatch: %s", v)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryEach(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	errStop := errors.New("stop")
+	cases := [...]struct {
+		name   string
+		stopAt int
+		sum    int
+		err    error
+	}{
+		{
+			name: "all rows",
+			sum:  15,
+		},
+		{
+			name:   "stopped",
+			stopAt: 3,
+			sum:    6,
+			err:    errStop,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			var sum int
+			err := QueryEach(
+				ctx,
+				conn,
+				"select generate_series(1, $1)",
+				[]interface{}{5},
+				func(r pgx.Row) (err error) {
+					var i int
+					if err = r.Scan(&i); err != nil {
+						return
+					}
+					sum += i
+					if i == c.stopAt {
+						return errStop
+					}
+					return
+				},
+			)
+			if err != c.err {
+				t.Fatalf("error mismatch: %v != %v", err, c.err)
+			}
+			if sum != c.sum {
+				t.Fatalf("sum mismatch: %d != %d", sum, c.sum)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Options for retrying transactions
+type RetryOpts struct {
+	// Maximum number of attempts, including the first one. Defaults to 3.
+	MaxAttempts int
+
+	// Delay before the first retry. Doubled after each retry. Defaults to
+	// 10ms.
+	Backoff time.Duration
+
+	// Maximum delay between retries. Defaults to 1s.
+	MaxBackoff time.Duration
+
+	// Options to start each transaction with
+	TxOptions pgx.TxOptions
+
+	// Optional function called after each attempt, that failed with a
+	// retryable error. Useful for logging serialization conflict hot spots.
+	OnRetryableError func(RetryInfo)
+}
+
+// Information about a transaction attempt, that failed with a retryable error
+type RetryInfo struct {
+	// Number of the attempt, starting from 1
+	Attempt int
+
+	// Error of the attempt
+	Err error
+
+	// SQLSTATE code of the error. Either "40001" for serialization failures
+	// or "40P01" for deadlocks.
+	Code string
+
+	// Delay before the next attempt or zero, if no further attempts will be
+	// made
+	Delay time.Duration
+}
+
+// Returns, if err is caused by a serialization failure (SQLSTATE 40001) or a
+// deadlock (SQLSTATE 40P01), in which case the transaction can be safely
+// retried
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
+
+// Like InTransactionOpts, but rolls back and reruns fn with exponential
+// backoff, if the transaction fails because of a serialization failure or
+// deadlock. Required for transactions with SERIALIZABLE isolation.
+//
+// fn must be safe to run multiple times. Returns the last error, if all
+// attempts fail, or the context error, if ctx is done while waiting.
+func InTransactionRetry(
+	ctx context.Context,
+	conn TxStarter,
+	opts RetryOpts,
+	fn func(pgx.Tx) error,
+) (err error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 10 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Second
+	}
+
+	b := backoff{opts.Backoff, opts.MaxBackoff}
+	for attempt := 1; ; attempt++ {
+		err = InTransactionOpts(ctx, conn, opts.TxOptions, fn)
+		if err == nil || !IsRetryable(err) {
+			return
+		}
+		last := attempt >= opts.MaxAttempts
+		if opts.OnRetryableError != nil {
+			info := RetryInfo{
+				Attempt: attempt,
+				Err:     err,
+			}
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				info.Code = pgErr.Code
+			}
+			if !last {
+				info.Delay = b.delay
+			}
+			opts.OnRetryableError(info)
+		}
+		if last {
+			return
+		}
+
+		atomic.AddInt64(&txRetries, 1)
+		if err = b.wait(ctx); err != nil {
+			return
+		}
+	}
+}
+
+// Exponential backoff between retries
+type backoff struct {
+	delay, max time.Duration
+}
+
+// Wait for the current delay and double it up to the maximum. Returns the
+// context error, if ctx is done first.
+func (b *backoff) wait(ctx context.Context) error {
+	t := time.NewTimer(b.delay)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	case <-t.C:
+	}
+	b.delay *= 2
+	if b.delay > b.max {
+		b.delay = b.max
+	}
+	return nil
+}
+
+// Run fn in a SERIALIZABLE transaction and retry it with up to 5 attempts on
+// serialization failures and deadlocks.
+//
+// fn must be safe to run multiple times. Use InTransactionRetry for custom
+// attempt limits or backoff.
+func RunSerializable(
+	ctx context.Context,
+	conn TxStarter,
+	fn func(pgx.Tx) error,
+) error {
+	return InTransactionRetry(
+		ctx,
+		conn,
+		RetryOpts{
+			MaxAttempts: 5,
+			TxOptions:   pgx.TxOptions{IsoLevel: pgx.Serializable},
+		},
+		fn,
+	)
+}
@@ -0,0 +1,173 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		err  error
+		std  bool
+	}{
+		{"nil", nil, false},
+		{"other", errors.New("foo"), false},
+		{"serialization", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"unique", &pgconn.PgError{Code: "23505"}, false},
+		{
+			"wrapped",
+			fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40001"}),
+			true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if res := IsRetryable(c.err); res != c.std {
+				t.Fatalf("result mismatch: %t != %t", res, c.std)
+			}
+		})
+	}
+}
+
+func TestInTransactionRetry(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	var (
+		attempts int
+		infos    []RetryInfo
+	)
+	err = InTransactionRetry(
+		context.Background(),
+		conn,
+		RetryOpts{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			TxOptions:   pgx.TxOptions{IsoLevel: pgx.Serializable},
+			OnRetryableError: func(info RetryInfo) {
+				infos = append(infos, info)
+			},
+		},
+		func(tx pgx.Tx) (err error) {
+			attempts++
+			if attempts < 3 {
+				return &pgconn.PgError{Code: "40001"}
+			}
+			_, err = tx.Exec(context.Background(), "select 1")
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("attempt count mismatch: %d != 3", attempts)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("retry info count mismatch: %d != 2", len(infos))
+	}
+	for i, info := range infos {
+		if info.Attempt != i+1 || info.Code != "40001" || info.Delay == 0 {
+			t.Fatalf("unexpected retry info: %+v", info)
+		}
+	}
+}
+
+func TestRunSerializable(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	attempts := 0
+	err = RunSerializable(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			attempts++
+			var level string
+			err = tx.
+				QueryRow(context.Background(), "show transaction_isolation").
+				Scan(&level)
+			if err != nil {
+				return
+			}
+			if level != "serializable" {
+				t.Fatalf("isolation level mismatch: %s", level)
+			}
+			return &pgconn.PgError{Code: "40001"}
+		},
+	)
+	if !IsRetryable(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 5 {
+		t.Fatalf("attempt count mismatch: %d != 5", attempts)
+	}
+}
+
+func TestRetryInfo(t *testing.T) {
+	t.Parallel()
+
+	var infos []RetryInfo
+	err := InTransactionRetry(
+		context.Background(),
+		fakeTxStarter{},
+		RetryOpts{
+			MaxAttempts: 2,
+			Backoff:     time.Millisecond,
+			OnRetryableError: func(info RetryInfo) {
+				infos = append(infos, info)
+			},
+		},
+		func(pgx.Tx) error {
+			return &pgconn.PgError{Code: "40P01"}
+		},
+	)
+	if !IsRetryable(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	std := []RetryInfo{
+		{
+			Attempt: 1,
+			Code:    "40P01",
+			Delay:   time.Millisecond,
+		},
+		{
+			Attempt: 2,
+			Code:    "40P01",
+		},
+	}
+	if len(infos) != len(std) {
+		t.Fatalf("retry info count mismatch: %d != %d", len(infos), len(std))
+	}
+	for i := range std {
+		infos[i].Err = nil
+		if infos[i] != std[i] {
+			t.Fatalf("retry info mismatch: %+v != %+v", infos[i], std[i])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Run fn with configuration parameters read by row-level security policies,
+// like app.tenant_id or app.current_user_id, set to settings. Policies read
+// them with current_setting('app.tenant_id', true).
+//
+// The parameters are set with SetLocal inside a savepoint of tx and restored
+// to their previous values before fn's savepoint is released, so they never
+// leak to the rest of the transaction, the connection or other pool users. If
+// fn returns an error, the savepoint is rolled back together with the
+// parameters.
+//
+// Previously unset parameters are restored as empty strings, so policies
+// should treat empty values like missing ones, for example by wrapping
+// current_setting() in nullif().
+func WithRLSContext(
+	ctx context.Context,
+	tx pgx.Tx,
+	settings map[string]string,
+	fn func(tx pgx.Tx) error,
+) error {
+	return InTransaction(ctx, tx, func(tx pgx.Tx) (err error) {
+		prev, err := currentSettings(ctx, tx, settings)
+		if err != nil {
+			return
+		}
+		err = SetLocal(ctx, tx, settings)
+		if err != nil {
+			return
+		}
+		err = fn(tx)
+		if err != nil {
+			return
+		}
+		return SetLocal(ctx, tx, prev)
+	})
+}
+
+// Return current values of the parameters named by the keys of settings.
+// Unset parameters are returned as empty strings.
+func currentSettings(
+	ctx context.Context,
+	tx pgx.Tx,
+	settings map[string]string,
+) (current map[string]string, err error) {
+	if len(settings) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(settings))
+	for k := range settings {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var w strings.Builder
+	args := make([]interface{}, len(names))
+	values := make([]interface{}, len(names))
+	strs := make([]string, len(names))
+	w.WriteString("SELECT ")
+	for i, k := range names {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		fmt.Fprintf(&w, "coalesce(current_setting($%d,true),'')", i+1)
+		args[i] = k
+		values[i] = &strs[i]
+	}
+	err = tx.QueryRow(ctx, w.String(), args...).Scan(values...)
+	if err != nil {
+		return
+	}
+
+	current = make(map[string]string, len(names))
+	for i, k := range names {
+		current[k] = strs[i]
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestWithRLSContext(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	ctx := context.Background()
+	tenant := func(tx pgx.Tx) (string, error) {
+		return QueryValue[string](
+			ctx,
+			tx,
+			`select coalesce(current_setting('app.tenant_id', true), '')`,
+		)
+	}
+
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		err = SetLocal(ctx, tx, map[string]string{"app.tenant_id": "outer"})
+		if err != nil {
+			return
+		}
+
+		err = WithRLSContext(
+			ctx,
+			tx,
+			map[string]string{
+				"app.tenant_id":       "1",
+				"app.current_user_id": "2",
+			},
+			func(tx pgx.Tx) (err error) {
+				id, err := tenant(tx)
+				if err != nil {
+					return
+				}
+				if id != "1" {
+					t.Fatalf("unexpected tenant: %s", id)
+				}
+				return
+			},
+		)
+		if err != nil {
+			return
+		}
+		id, err := tenant(tx)
+		if err != nil {
+			return
+		}
+		if id != "outer" {
+			t.Fatalf("setting not restored: %s", id)
+		}
+
+		errFail := errors.New("fail")
+		err = WithRLSContext(
+			ctx,
+			tx,
+			map[string]string{"app.tenant_id": "3"},
+			func(tx pgx.Tx) error {
+				return errFail
+			},
+		)
+		if !errors.Is(err, errFail) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		id, err = tenant(tx)
+		if err != nil {
+			return
+		}
+		if id != "outer" {
+			t.Fatalf("setting not rolled back: %s", id)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,219 @@
+package pg_util
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Options for NewRouter
+type RouterOpts struct {
+	// Pool of the primary server. Required.
+	Primary *pgxpool.Pool
+
+	// Pools of read replicas. Reads go to the primary, if empty.
+	Replicas []*pgxpool.Pool
+
+	// Interval of replica health checks. Defaults to 5 seconds.
+	HealthCheckInterval time.Duration
+
+	// Stop routing to replicas lagging behind the primary by more than
+	// MaxReplicationLag. Lag is not checked, if zero.
+	MaxReplicationLag time.Duration
+
+	// Optional handler for failed health checks
+	OnError func(err error)
+
+	// Optional context for stopping health checks
+	Context context.Context
+}
+
+// Routes queries between a primary pool and replica pools. Writes and
+// read-write transactions go to Primary. Read-only helpers go to a healthy
+// replica in round-robin order and fall back to the primary, if no replica is
+// healthy or acquiring a replica connection fails. Create with NewRouter.
+type Router struct {
+	opts RouterOpts
+
+	// Health state of each replica
+	healthy []int32
+
+	// Round-robin counter
+	next uint32
+}
+
+// Create a router and start health checking its replicas in the background
+// until opts.Context is done. Replicas are assumed healthy until the first
+// check completes.
+func NewRouter(opts RouterOpts) *Router {
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = 5 * time.Second
+	}
+	r := &Router{
+		opts:    opts,
+		healthy: make([]int32, len(opts.Replicas)),
+	}
+	for i := range r.healthy {
+		r.healthy[i] = 1
+	}
+	if len(opts.Replicas) != 0 {
+		go r.checkHealth()
+	}
+	return r
+}
+
+// Return the primary pool
+func (r *Router) Primary() *pgxpool.Pool {
+	return r.opts.Primary
+}
+
+// Return the next healthy replica pool or the primary, if there are none
+func (r *Router) Replica() *pgxpool.Pool {
+	p, _ := r.replica()
+	return p
+}
+
+// Return the next healthy replica pool and its index or the primary and -1
+func (r *Router) replica() (*pgxpool.Pool, int) {
+	n := len(r.opts.Replicas)
+	if n == 0 {
+		return r.opts.Primary, -1
+	}
+	start := int(atomic.AddUint32(&r.next, 1))
+	for i := 0; i < n; i++ {
+		j := (start + i) % n
+		if atomic.LoadInt32(&r.healthy[j]) == 1 {
+			return r.opts.Replicas[j], j
+		}
+	}
+	return r.opts.Primary, -1
+}
+
+// Report, if replica i of RouterOpts.Replicas is considered healthy
+func (r *Router) ReplicaHealthy(i int) bool {
+	return atomic.LoadInt32(&r.healthy[i]) == 1
+}
+
+func (r *Router) setHealthy(i int, healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&r.healthy[i], v)
+}
+
+// Periodically check the health of all replicas
+func (r *Router) checkHealth() {
+	t := time.NewTicker(r.opts.HealthCheckInterval)
+	defer t.Stop()
+
+	for {
+		for i := range r.opts.Replicas {
+			r.setHealthy(i, r.checkReplica(i))
+		}
+		select {
+		case <-r.opts.Context.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Check the health of replica i
+func (r *Router) checkReplica(i int) bool {
+	ctx, cancel := context.WithTimeout(
+		r.opts.Context,
+		r.opts.HealthCheckInterval,
+	)
+	defer cancel()
+
+	s, err := HealthCheck(ctx, r.opts.Replicas[i], HealthCheckOpts{
+		ReplicationLag: r.opts.MaxReplicationLag > 0,
+	})
+	if err != nil {
+		if r.opts.OnError != nil && r.opts.Context.Err() == nil {
+			r.opts.OnError(err)
+		}
+		return false
+	}
+	return r.opts.MaxReplicationLag <= 0 ||
+		s.ReplicationLag <= r.opts.MaxReplicationLag
+}
+
+// Acquire a connection from a healthy replica or the primary. Replicas
+// failing to provide a connection are marked unhealthy until the next health
+// check.
+func (r *Router) acquireReader(ctx context.Context) (*pgxpool.Conn, error) {
+	for {
+		p, i := r.replica()
+		c, err := p.Acquire(ctx)
+		if err == nil || i == -1 || ctx.Err() != nil {
+			return c, err
+		}
+		r.setHealthy(i, false)
+	}
+}
+
+// Run fn with a connection acquired from a replica with fallback to the
+// primary
+func (r *Router) withReader(
+	ctx context.Context,
+	fn func(c *pgxpool.Conn) error,
+) (err error) {
+	c, err := r.acquireReader(ctx)
+	if err != nil {
+		return
+	}
+	defer c.Release()
+	return fn(c)
+}
+
+// Like InTransaction, but on the primary
+func (r *Router) InTransaction(
+	ctx context.Context,
+	fn func(pgx.Tx) error,
+) error {
+	return InTransaction(ctx, r.opts.Primary, fn)
+}
+
+// Like InReadOnlyTransaction, but on a replica with fallback to the primary
+func (r *Router) InReadOnlyTransaction(
+	ctx context.Context,
+	fn func(pgx.Tx) error,
+) error {
+	return r.withReader(ctx, func(c *pgxpool.Conn) error {
+		return InReadOnlyTransaction(ctx, c, fn)
+	})
+}
+
+// Like GetStruct, but on a replica of r with fallback to the primary
+func GetStructReplica[T any](
+	ctx context.Context,
+	r *Router,
+	dest *T,
+	sql string,
+	args ...interface{},
+) error {
+	return r.withReader(ctx, func(c *pgxpool.Conn) error {
+		return GetStruct(ctx, c, dest, sql, args...)
+	})
+}
+
+// Like SelectStructs, but on a replica of r with fallback to the primary
+func SelectStructsReplica[T any](
+	ctx context.Context,
+	r *Router,
+	dest *[]T,
+	sql string,
+	args ...interface{},
+) error {
+	return r.withReader(ctx, func(c *pgxpool.Conn) error {
+		return SelectStructs(ctx, c, dest, sql, args...)
+	})
+}
@@ -0,0 +1,100 @@
+package pg_util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	u := getURL(t)
+	primary, err := pgxpool.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	// Use the test database as a replica
+	replica, err := pgxpool.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	// Closed pools fail to acquire connections
+	broken, err := pgxpool.Connect(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken.Close()
+
+	r := NewRouter(RouterOpts{
+		Primary:             primary,
+		Replicas:            []*pgxpool.Pool{broken, replica},
+		HealthCheckInterval: time.Hour,
+		Context:             ctx,
+	})
+
+	type row struct {
+		A int
+	}
+	for i := 0; i < 4; i++ {
+		var rows []row
+		err = SelectStructsReplica(ctx, r, &rows, `select 1 as a`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].A != 1 {
+			t.Fatalf("unexpected rows: %+v", rows)
+		}
+	}
+	if r.ReplicaHealthy(0) {
+		t.Fatal("broken replica considered healthy")
+	}
+	if r.Replica() != replica {
+		t.Fatal("expected healthy replica")
+	}
+
+	var dest row
+	err = GetStructReplica(ctx, r, &dest, `select 2 as a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest.A != 2 {
+		t.Fatalf("unexpected row: %+v", dest)
+	}
+
+	err = r.InReadOnlyTransaction(ctx, func(tx pgx.Tx) (err error) {
+		_, err = tx.Exec(ctx, `create temp table router_test (id int)`)
+		return
+	})
+	if err == nil {
+		t.Fatal("write in read-only transaction succeeded")
+	}
+
+	// Falls back to the primary without healthy replicas
+	r = NewRouter(RouterOpts{
+		Primary:             primary,
+		Replicas:            []*pgxpool.Pool{broken},
+		HealthCheckInterval: time.Hour,
+		Context:             ctx,
+	})
+	err = GetStructReplica(ctx, r, &dest, `select 3 as a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest.A != 3 {
+		t.Fatalf("unexpected row: %+v", dest)
+	}
+	if r.Replica() != primary {
+		t.Fatal("expected primary")
+	}
+}
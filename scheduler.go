@@ -0,0 +1,246 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Table storing the last runs of scheduled tasks
+const ScheduleTable = "pg_util_schedule"
+
+// Create the table used by Scheduler, if it does not exist yet
+func CreateScheduleTable(ctx context.Context, q Querier) (err error) {
+	_, err = q.Exec(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS `+quoteIdentifier(ScheduleTable)+` (
+			name text PRIMARY KEY,
+			last_tick timestamptz NOT NULL,
+			last_run_at timestamptz NOT NULL,
+			last_duration interval NOT NULL,
+			last_error text
+		)`,
+	)
+	return
+}
+
+// Error of a scheduled task reported to SchedulerOpts.OnError
+type TaskError struct {
+	// Name of the task
+	Name string
+
+	// Activation time of the failed run
+	Tick time.Time
+
+	Err error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf(
+		"pg_util: scheduled task name=%s tick=%s: %s",
+		e.Name, e.Tick.Format(time.RFC3339), e.Err,
+	)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// Options for NewScheduler
+type SchedulerOpts struct {
+	// Connection or pool to coordinate tasks on. A transaction is held for
+	// the duration of each task run. Required.
+	Conn TxStarter
+
+	// Optional handler for task and database errors
+	OnError func(err error)
+}
+
+// Named periodic task
+type scheduledTask struct {
+	name     string
+	schedule Schedule
+	fn       func(context.Context) error
+}
+
+// Runs named periodic tasks, coordinated between all replicas sharing a
+// database, so that each activation of a task is run by only one replica.
+//
+// Each activation takes a transaction-level advisory lock keyed by the task
+// name and records the activation in ScheduleTable. Replicas failing to take
+// the lock or finding the activation already recorded skip it. Coordination
+// relies on replica clocks being synchronized closer than the task interval.
+type Scheduler struct {
+	opts SchedulerOpts
+
+	mu    sync.Mutex
+	tasks map[string]scheduledTask
+}
+
+// Create a scheduler. Add tasks with Add and start it with Run.
+//
+// Requires the table created by CreateScheduleTable.
+func NewScheduler(opts SchedulerOpts) *Scheduler {
+	return &Scheduler{
+		opts:  opts,
+		tasks: make(map[string]scheduledTask),
+	}
+}
+
+// Add a task to run fn on schedule. Use ParseCron or Every to create a
+// Schedule. Names must be unique across the whole database. Tasks added after
+// Run is called are not run.
+func (s *Scheduler) Add(
+	name string,
+	schedule Schedule,
+	fn func(context.Context) error,
+) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("pg_util: duplicate scheduled task %s", name)
+	}
+	s.tasks[name] = scheduledTask{
+		name:     name,
+		schedule: schedule,
+		fn:       fn,
+	}
+	return
+}
+
+// Run tasks until ctx is done, even if there are no tasks or all schedules
+// have ended. Waits for tasks in progress to finish before returning.
+func (s *Scheduler) Run(ctx context.Context) (err error) {
+	if s.opts.Conn == nil {
+		return errors.New("pg_util: scheduler connection required")
+	}
+
+	s.mu.Lock()
+	tasks := make([]scheduledTask, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(tasks))
+	for _, t := range tasks {
+		go func(t scheduledTask) {
+			defer wg.Done()
+			s.runTask(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+	<-ctx.Done()
+	return
+}
+
+// Run activations of t until ctx is done or the schedule ends
+func (s *Scheduler) runTask(ctx context.Context, t scheduledTask) {
+	for {
+		tick := t.schedule.Next(time.Now())
+		if tick.IsZero() {
+			return
+		}
+		if !sleepOrWake(ctx, time.Until(tick), nil) {
+			return
+		}
+
+		err := s.tick(ctx, t, tick)
+		if err != nil && ctx.Err() == nil && s.opts.OnError != nil {
+			s.opts.OnError(err)
+		}
+	}
+}
+
+// Run activation tick of t, unless another replica holds the lock or
+// already ran it
+func (s *Scheduler) tick(
+	ctx context.Context,
+	t scheduledTask,
+	tick time.Time,
+) (err error) {
+	var runErr error
+	err = InTransaction(ctx, s.opts.Conn, func(tx pgx.Tx) (err error) {
+		acquired, err := TryAdvisoryXactLock(
+			ctx,
+			tx,
+			LockKeyString(ScheduleTable+":"+t.name),
+		)
+		if err != nil || !acquired {
+			return
+		}
+
+		var lastTick time.Time
+		err = tx.
+			QueryRow(
+				ctx,
+				`SELECT last_tick
+				FROM `+quoteIdentifier(ScheduleTable)+`
+				WHERE name = $1`,
+				t.name,
+			).
+			Scan(&lastTick)
+		switch err {
+		case nil:
+			if !lastTick.Before(tick) {
+				return
+			}
+		case pgx.ErrNoRows:
+			err = nil
+		default:
+			return
+		}
+
+		start := time.Now()
+		runErr = runScheduledTask(ctx, t.fn)
+		var lastError *string
+		if runErr != nil {
+			msg := runErr.Error()
+			lastError = &msg
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO `+quoteIdentifier(ScheduleTable)+`
+				(name, last_tick, last_run_at, last_duration, last_error)
+			VALUES ($1, $2, $3, make_interval(secs => $4), $5)
+			ON CONFLICT (name) DO UPDATE
+			SET last_tick = excluded.last_tick,
+				last_run_at = excluded.last_run_at,
+				last_duration = excluded.last_duration,
+				last_error = excluded.last_error`,
+			t.name,
+			tick,
+			start,
+			time.Since(start).Seconds(),
+			lastError,
+		)
+		return
+	})
+	if err == nil && runErr != nil {
+		// Reported after commit to keep the bookkeeping of the failed run
+		err = &TaskError{
+			Name: t.name,
+			Tick: tick,
+			Err:  runErr,
+		}
+	}
+	return
+}
+
+// Run fn, converting panics to errors
+func runScheduledTask(ctx context.Context, fn func(context.Context) error) (
+	err error,
+) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,84 @@
+package pg_util
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	pool, err := pgxpool.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	err = CreateScheduleTable(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pool.Exec(
+		ctx,
+		`DELETE FROM `+ScheduleTable+` WHERE name = 'scheduler_test'`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate multiple replicas running the same task
+	var runs int64
+	runCtx, cancel := context.WithTimeout(ctx, 2500*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	const replicas = 3
+	for i := 0; i < replicas; i++ {
+		s := NewScheduler(SchedulerOpts{
+			Conn: pool,
+			OnError: func(err error) {
+				t.Error(err)
+			},
+		})
+		err = s.Add(
+			"scheduler_test",
+			Every(time.Second),
+			func(context.Context) error {
+				atomic.AddInt64(&runs, 1)
+				return nil
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			s.Run(runCtx)
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < replicas; i++ {
+		<-done
+	}
+
+	// 2 or 3 activations depending on alignment
+	if n := atomic.LoadInt64(&runs); n < 2 || n > 3 {
+		t.Fatalf("unexpected number of runs: %d", n)
+	}
+	ran, err := QueryValue[bool](
+		ctx,
+		pool,
+		`SELECT last_error IS NULL
+		FROM `+ScheduleTable+`
+		WHERE name = 'scheduler_test'`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Fatal("run not recorded")
+	}
+}
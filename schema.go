@@ -0,0 +1,322 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Implemented by models, that define the table they map to, for
+// ValidateSchema
+type TableNamer interface {
+	TableName() string
+}
+
+// Pairs a model with its table for ValidateSchema
+type TableModel struct {
+	// Table the model maps to. May be schema-qualified with a dot.
+	Table string
+
+	// Struct, pointer to struct or reflect.Type of either
+	Data interface{}
+}
+
+// Kind of a SchemaIssue
+type SchemaIssueKind int
+
+const (
+	// Table does not exist
+	MissingTable SchemaIssueKind = iota
+
+	// Column of the model does not exist in the table
+	MissingColumn
+
+	// Column type of the table is incompatible with the model
+	TypeMismatch
+
+	// Column of the table is not mapped by the model
+	ExtraColumn
+)
+
+func (k SchemaIssueKind) String() string {
+	switch k {
+	case MissingTable:
+		return "missing table"
+	case MissingColumn:
+		return "missing column"
+	case TypeMismatch:
+		return "type mismatch"
+	default:
+		return "extra column"
+	}
+}
+
+// Difference between a model and its table found by ValidateSchema
+type SchemaIssue struct {
+	Kind   SchemaIssueKind
+	Table  string
+	Column string
+
+	// Expected type of the model and actual type of the table for
+	// TypeMismatch
+	Expected, Actual string
+}
+
+func (i SchemaIssue) String() string {
+	switch i.Kind {
+	case MissingTable:
+		return fmt.Sprintf("%s: %s", i.Kind, i.Table)
+	case TypeMismatch:
+		return fmt.Sprintf(
+			"%s: %s.%s: expected %s, got %s",
+			i.Kind, i.Table, i.Column, i.Expected, i.Actual,
+		)
+	default:
+		return fmt.Sprintf("%s: %s.%s", i.Kind, i.Table, i.Column)
+	}
+}
+
+// Returned by ValidateSchema, if models and tables differ
+type SchemaError struct {
+	Issues []SchemaIssue
+}
+
+func (e *SchemaError) Error() string {
+	var w strings.Builder
+	w.WriteString("pg_util: schema validation failed:")
+	for _, i := range e.Issues {
+		w.WriteString("\n\t")
+		w.WriteString(i.String())
+	}
+	return w.String()
+}
+
+// Compare columns derived from models with the actual table definitions and
+// return *SchemaError describing missing tables and columns, type mismatches
+// and extra columns. Useful for catching schema drift on startup instead of
+// at the first failing query.
+//
+// Models must be TableModel values or structs implementing TableNamer.
+// Columns are derived the same way as by BuildCreateTable. Types explicitly
+// set with ",type=" must match exactly. Inferred types only need to be
+// compatible, for example any integer column is accepted for an int field
+// and string fields are accepted for any non-array column. Nullability is not
+// compared.
+func ValidateSchema(
+	ctx context.Context,
+	q Querier,
+	models ...interface{},
+) (err error) {
+	var issues []SchemaIssue
+	for _, m := range models {
+		var (
+			table string
+			data  interface{}
+		)
+		switch m := m.(type) {
+		case TableModel:
+			table, data = m.Table, m.Data
+		case TableNamer:
+			table, data = m.TableName(), m
+		default:
+			return fmt.Errorf(
+				"pg_util: model %T is neither TableModel nor TableNamer",
+				m,
+			)
+		}
+
+		var iss []SchemaIssue
+		iss, err = validateTable(ctx, q, table, data)
+		if err != nil {
+			return
+		}
+		issues = append(issues, iss...)
+	}
+	if len(issues) != 0 {
+		err = &SchemaError{issues}
+	}
+	return
+}
+
+// Actual column of a table
+type tableColumn struct {
+	name, typ string
+}
+
+// Compare columns of data with table
+func validateTable(
+	ctx context.Context,
+	q Querier,
+	table string,
+	data interface{},
+) (issues []SchemaIssue, err error) {
+	cols, err := Columns(data)
+	if err != nil {
+		return
+	}
+
+	var (
+		exists bool
+		actual []tableColumn
+		// Quote, so names resolve the same way as in the built statements
+		name = quoteIdentifier(table)
+	)
+	err = q.
+		QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).
+		Scan(&exists)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return []SchemaIssue{{Kind: MissingTable, Table: table}}, nil
+	}
+	err = QueryEach(
+		ctx,
+		q,
+		`SELECT attname::text, format_type(atttypid, atttypmod)
+		FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped
+		ORDER BY attnum`,
+		[]interface{}{name},
+		func(row pgx.Row) (err error) {
+			var c tableColumn
+			err = row.Scan(&c.name, &c.typ)
+			if err != nil {
+				return
+			}
+			actual = append(actual, c)
+			return
+		},
+	)
+	if err != nil {
+		return
+	}
+
+	byName := make(map[string]tableColumn, len(actual))
+	for _, c := range actual {
+		byName[c.name] = c
+	}
+	mapped := make(map[string]struct{}, len(cols))
+	for i := range cols {
+		c := &cols[i]
+		name := c.Name
+		if !c.Quoted {
+			name = strings.ToLower(name)
+		}
+		mapped[name] = struct{}{}
+
+		a, ok := byName[name]
+		if !ok {
+			issues = append(issues, SchemaIssue{
+				Kind:   MissingColumn,
+				Table:  table,
+				Column: name,
+			})
+			continue
+		}
+		if expected, ok := columnTypeMismatch(c, a.typ); ok {
+			issues = append(issues, SchemaIssue{
+				Kind:     TypeMismatch,
+				Table:    table,
+				Column:   name,
+				Expected: expected,
+				Actual:   a.typ,
+			})
+		}
+	}
+	for _, a := range actual {
+		if _, ok := mapped[a.name]; !ok {
+			issues = append(issues, SchemaIssue{
+				Kind:   ExtraColumn,
+				Table:  table,
+				Column: a.name,
+			})
+		}
+	}
+	return
+}
+
+// Return the expected type of column c, if actual is not compatible with it
+func columnTypeMismatch(c *Column, actual string) (expected string, ok bool) {
+	expected, _ = columnType(c)
+	actual = normalizeSQLType(actual)
+	if _, explicit := c.Option("type"); explicit {
+		return expected, normalizeSQLType(expected) != actual
+	}
+
+	t := c.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if c.HasOption("string") || t.Kind() == reflect.String {
+		// Strings can encode most types
+		return expected, strings.HasSuffix(actual, "[]")
+	}
+	return expected, sqlTypeFamily(normalizeSQLType(expected)) !=
+		sqlTypeFamily(actual)
+}
+
+// Canonical names of SQL type aliases as returned by format_type()
+var sqlTypeAliases = map[string]string{
+	"int":         "integer",
+	"int2":        "smallint",
+	"int4":        "integer",
+	"int8":        "bigint",
+	"float4":      "real",
+	"float8":      "double precision",
+	"bool":        "boolean",
+	"varchar":     "character varying",
+	"char":        "character",
+	"decimal":     "numeric",
+	"timestamptz": "timestamp with time zone",
+	"timestamp":   "timestamp without time zone",
+	"timetz":      "time with time zone",
+	"time":        "time without time zone",
+	"serial":      "integer",
+	"bigserial":   "bigint",
+}
+
+// Normalize SQL type name to the form returned by format_type()
+func normalizeSQLType(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	var suffix string
+	for strings.HasSuffix(typ, "[]") {
+		typ = strings.TrimSuffix(typ, "[]")
+		suffix += "[]"
+	}
+	base, mod := typ, ""
+	if i := strings.IndexByte(typ, '('); i != -1 {
+		base = strings.TrimSpace(typ[:i])
+		mod = strings.ReplaceAll(typ[i:], " ", "")
+	}
+	if alias, ok := sqlTypeAliases[base]; ok {
+		base = alias
+	}
+	return base + mod + suffix
+}
+
+// Return the family of compatible types a normalized SQL type belongs to
+func sqlTypeFamily(typ string) string {
+	if strings.HasSuffix(typ, "[]") {
+		return sqlTypeFamily(strings.TrimSuffix(typ, "[]")) + "[]"
+	}
+	if i := strings.IndexByte(typ, '('); i != -1 {
+		typ = typ[:i]
+	}
+	switch typ {
+	case "smallint", "integer", "bigint", "numeric", "real",
+		"double precision":
+		return "number"
+	case "text", "character varying", "character", "citext":
+		return "text"
+	case "timestamp with time zone", "timestamp without time zone", "date":
+		return "time"
+	case "json", "jsonb":
+		return "json"
+	default:
+		return typ
+	}
+}
@@ -0,0 +1,128 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestNormalizeSQLType(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		in, out string
+	}{
+		{"int8", "bigint"},
+		{"TIMESTAMPTZ", "timestamp with time zone"},
+		{"varchar(255)", "character varying(255)"},
+		{"numeric(10, 2)", "numeric(10,2)"},
+		{"int4[]", "integer[]"},
+		{"uuid", "uuid"},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.in, func(t *testing.T) {
+			t.Parallel()
+
+			if out := normalizeSQLType(c.in); out != c.out {
+				t.Fatalf("type mismatch: %s != %s", out, c.out)
+			}
+		})
+	}
+}
+
+type validateSchemaTest struct {
+	ID        int64 `db:"id"`
+	Name      string
+	Price     float64   `db:"price,type=numeric(10,2)"`
+	Tags      []string  `db:"tags"`
+	CreatedAt time.Time `db:"created_at"`
+	Missing   int       `db:"missing"`
+}
+
+func (validateSchemaTest) TableName() string {
+	return "validate_schema_test"
+}
+
+func TestValidateSchema(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(
+		ctx,
+		`CREATE TEMPORARY TABLE validate_schema_test (
+			id integer,
+			name uuid,
+			price numeric(12,2),
+			tags text,
+			created_at timestamp,
+			extra text
+		)`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ValidateSchema(
+		ctx,
+		conn,
+		validateSchemaTest{},
+		TableModel{
+			Table: "validate_schema_test_missing",
+			Data:  validateSchemaTest{},
+		},
+	)
+	var sErr *SchemaError
+	if !errors.As(err, &sErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	std := []SchemaIssue{
+		{
+			Kind:     TypeMismatch,
+			Table:    "validate_schema_test",
+			Column:   "price",
+			Expected: "numeric(10,2)",
+			Actual:   "numeric(12,2)",
+		},
+		{
+			Kind:     TypeMismatch,
+			Table:    "validate_schema_test",
+			Column:   "tags",
+			Expected: "text[]",
+			Actual:   "text",
+		},
+		{
+			Kind:   MissingColumn,
+			Table:  "validate_schema_test",
+			Column: "missing",
+		},
+		{
+			Kind:   ExtraColumn,
+			Table:  "validate_schema_test",
+			Column: "extra",
+		},
+		{
+			Kind:  MissingTable,
+			Table: "validate_schema_test_missing",
+		},
+	}
+	if !reflect.DeepEqual(sErr.Issues, std) {
+		t.Fatalf("issue mismatch:\n%+v\n!=\n%+v", sErr.Issues, std)
+	}
+
+	err = ValidateSchema(ctx, conn, struct{}{})
+	if err == nil {
+		t.Fatal("expected error for model without table")
+	}
+}
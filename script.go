@@ -0,0 +1,117 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Split a multi-statement SQL script into individual statements on
+// semicolons. Semicolons inside string literals, quoted identifiers,
+// dollar-quoted strings, like PL/pgSQL function bodies, and comments do not
+// split statements.
+//
+// Statements are trimmed of surrounding whitespace and statements consisting
+// only of whitespace and comments are omitted. SQL-standard BEGIN ATOMIC
+// function bodies are not supported.
+func SplitSQL(script string) (stmts []string) {
+	var (
+		start   int
+		content bool // Statement contains more than whitespace and comments
+	)
+	flush := func(end int) {
+		if content {
+			stmts = append(stmts, strings.TrimSpace(script[start:end]))
+		}
+		start = end + 1
+		content = false
+	}
+
+	for i := 0; i < len(script); {
+		b := script[i]
+		switch {
+		case b == ';':
+			flush(i)
+			i++
+		case b == '\'':
+			escapes := i != 0 && (script[i-1] == 'E' || script[i-1] == 'e') &&
+				(i == 1 || !isIdentByte(script[i-2]))
+			i = skipQuoted(script, i, '\'', escapes)
+			content = true
+		case b == '"':
+			i = skipQuoted(script, i, '"', false)
+			content = true
+		case b == '-' && i+1 < len(script) && script[i+1] == '-':
+			j := strings.IndexByte(script[i:], '\n')
+			if j == -1 {
+				i = len(script)
+			} else {
+				i += j + 1
+			}
+		case b == '/' && i+1 < len(script) && script[i+1] == '*':
+			i = skipBlockComment(script, i)
+		case b == '$' && (i == 0 || !isIdentByte(script[i-1])):
+			content = true
+			tag, ok := readDollarTag(script, i)
+			if !ok {
+				i++
+				continue
+			}
+			end := strings.Index(script[i+len(tag):], tag)
+			if end == -1 {
+				i = len(script)
+			} else {
+				i += len(tag) + end + len(tag)
+			}
+		default:
+			switch b {
+			case ' ', '\t', '\n', '\r', '\f', '\v':
+			default:
+				content = true
+			}
+			i++
+		}
+	}
+	flush(len(script))
+	return
+}
+
+// Split script with SplitSQL and execute its statements on tx with ExecAll.
+// Wrap in InTransaction to apply the script atomically.
+func ExecScript(ctx context.Context, tx pgx.Tx, script string) error {
+	return ExecAll(ctx, tx, SplitSQL(script)...)
+}
+
+// Execute all files in fsys matching glob, like SQL files of an embed.FS, in
+// lexical order of their paths. Each file is executed with ExecScript.
+// Useful for applying schema and seed scripts shipped inside the binary.
+//
+// See fs.Glob for the pattern syntax.
+func ExecFS(
+	ctx context.Context,
+	tx pgx.Tx,
+	fsys fs.FS,
+	glob string,
+) (err error) {
+	paths, err := fs.Glob(fsys, glob)
+	if err != nil {
+		return
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		var buf []byte
+		buf, err = fs.ReadFile(fsys, p)
+		if err != nil {
+			return
+		}
+		err = ExecScript(ctx, tx, string(buf))
+		if err != nil {
+			return fmt.Errorf("pg_util: executing %s: %w", p, err)
+		}
+	}
+	return
+}
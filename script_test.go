@@ -0,0 +1,196 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestSplitSQL(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, in string
+		out      []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "single without semicolon",
+			in:   " select 1 ",
+			out:  []string{"select 1"},
+		},
+		{
+			name: "multiple",
+			in:   "select 1;\nselect 2;\n\n;",
+			out:  []string{"select 1", "select 2"},
+		},
+		{
+			name: "quoted",
+			in:   `select ';', "a;b", E'\';'; select 2`,
+			out:  []string{`select ';', "a;b", E'\';'`, "select 2"},
+		},
+		{
+			name: "comments",
+			in: `-- leading; comment
+select 1 /* inline; /* nested; */ */;
+-- only a comment;
+/* block */;`,
+			out: []string{
+				"-- leading; comment\nselect 1 /* inline; /* nested; */ */",
+			},
+		},
+		{
+			name: "dollar quoted function",
+			in: `create function f() returns int as $body$
+begin
+	perform 1;
+	return $$;$$::int;
+end;
+$body$ language plpgsql;
+select $1;`,
+			out: []string{
+				`create function f() returns int as $body$
+begin
+	perform 1;
+	return $$;$$::int;
+end;
+$body$ language plpgsql`,
+				"select $1",
+			},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res := SplitSQL(c.in)
+			if !reflect.DeepEqual(res, c.out) {
+				t.Fatalf("statements mismatch: %q != %q", res, c.out)
+			}
+		})
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		err = ExecScript(ctx, tx, `
+			create temp table exec_script_test (v text) on commit drop;
+
+			create function pg_temp.exec_script_test_fn() returns text as $$
+			begin
+				return 'a;b';
+			end;
+			$$ language plpgsql;
+
+			insert into exec_script_test
+				values (pg_temp.exec_script_test_fn());
+		`)
+		if err != nil {
+			return
+		}
+
+		v, err := QueryValue[string](ctx, tx,
+			"select v from exec_script_test")
+		if err != nil {
+			return
+		}
+		if v != "a;b" {
+			t.Fatalf("value mismatch: %s != a;b", v)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Transaction, that records executed statements
+type recordingTx struct {
+	fakeTx
+	stmts *[]string
+}
+
+func (tx recordingTx) Exec(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgconn.CommandTag, error) {
+	*tx.stmts = append(*tx.stmts, sql)
+	return tx.fakeTx.Exec(ctx, sql, args...)
+}
+
+func TestExecFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"sql/02_seed.sql":   {Data: []byte("insert 1; insert 2;")},
+		"sql/01_schema.sql": {Data: []byte("create 1;")},
+		"sql/03_fail.sql":   {Data: []byte("fail;")},
+		"sql/readme.txt":    {Data: []byte("not sql")},
+	}
+
+	cases := [...]struct {
+		name, glob string
+		stmts      []string
+		err        bool
+	}{
+		{
+			name:  "ordered",
+			glob:  "sql/0[12]_*.sql",
+			stmts: []string{"create 1", "insert 1", "insert 2"},
+		},
+		{
+			name:  "failed file",
+			glob:  "sql/*.sql",
+			stmts: []string{"create 1", "insert 1", "insert 2", "fail"},
+			err:   true,
+		},
+		{
+			name: "no matches",
+			glob: "*.sql",
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stmts []string
+			err := ExecFS(
+				context.Background(),
+				recordingTx{stmts: &stmts},
+				fsys,
+				c.glob,
+			)
+			if c.err {
+				if err == nil || !strings.Contains(err.Error(), "03_fail.sql") {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stmts, c.stmts) {
+				t.Fatalf("statements mismatch: %q != %q", stmts, c.stmts)
+			}
+		})
+	}
+}
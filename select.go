@@ -0,0 +1,368 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// Anything, that can execute queries, like *pgx.Conn, *pgxpool.Pool or
+// pgx.Tx
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (
+		pgconn.CommandTag, error,
+	)
+	Query(ctx context.Context, sql string, args ...interface{}) (
+		pgx.Rows, error,
+	)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Returned by GetStruct, when the query produced no rows. Same value as
+// pgx.ErrNoRows.
+var ErrNoRows = pgx.ErrNoRows
+
+// Error returned, when a query result column has no matching struct field
+type UnknownColumnError struct {
+	Column string
+	Type   reflect.Type
+}
+
+func (e *UnknownColumnError) Error() string {
+	return fmt.Sprintf(
+		"pg_util: no field for column %s in %s",
+		e.Column, e.Type,
+	)
+}
+
+// Run query and scan all resulting rows into structs appended to dest.
+//
+// Result columns are mapped to struct fields using the same `db` tag rules as
+// BuildInsert, including embedded structs. Unquoted column names are matched
+// case-insensitively. Returns *UnknownColumnError, if a result column has no
+// matching field.
+//
+// See InsertOpts.Data for column mapping rules.
+func SelectStructs[T any](
+	ctx context.Context,
+	q Querier,
+	dest *[]T,
+	sql string,
+	args ...interface{},
+) (err error) {
+	meta, err := getStructMeta(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return
+	}
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	indices, err := resultIndices(meta, rows.FieldDescriptions())
+	if err != nil {
+		return
+	}
+	targets := make([]interface{}, len(indices))
+	for rows.Next() {
+		var row T
+		err = scanStruct(rows, reflect.ValueOf(&row).Elem(), indices, targets)
+		if err != nil {
+			return
+		}
+		*dest = append(*dest, row)
+	}
+	return rows.Err()
+}
+
+// Run query and scan the first resulting row into dest. Returns ErrNoRows,
+// if the query produced no rows. Any further rows are discarded.
+//
+// See SelectStructs for column mapping rules.
+func GetStruct[T any](
+	ctx context.Context,
+	q Querier,
+	dest *T,
+	sql string,
+	args ...interface{},
+) (err error) {
+	meta, err := getStructMeta(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return
+	}
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return
+	}
+	return scanFirstRow(rows, meta, reflect.ValueOf(dest).Elem())
+}
+
+// Scan the first row of rows into struct value v and close rows. Returns
+// ErrNoRows, if there are no rows.
+func scanFirstRow(rows pgx.Rows, meta *structMeta, v reflect.Value) (
+	err error,
+) {
+	defer rows.Close()
+
+	indices, err := resultIndices(meta, rows.FieldDescriptions())
+	if err != nil {
+		return
+	}
+	if !rows.Next() {
+		err = rows.Err()
+		if err == nil {
+			err = ErrNoRows
+		}
+		return
+	}
+	err = scanStruct(rows, v, indices, make([]interface{}, len(indices)))
+	if err != nil {
+		return
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// Resolve field index paths for each result column
+func resultIndices(meta *structMeta, fields []pgproto3.FieldDescription) (
+	indices [][]int,
+	err error,
+) {
+	indices = make([][]int, len(fields))
+	for i, f := range fields {
+		c, ok := meta.lookup(string(f.Name))
+		if !ok {
+			err = &UnknownColumnError{
+				Column: string(f.Name),
+				Type:   meta.typ,
+			}
+			return
+		}
+		indices[i] = c.index
+	}
+	return
+}
+
+// Scan current row into struct value v using field index paths of each result
+// column. targets is a reusable buffer of the same length as indices.
+func scanStruct(
+	row pgx.Row,
+	v reflect.Value,
+	indices [][]int,
+	targets []interface{},
+) error {
+	for i, index := range indices {
+		targets[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+	return row.Scan(targets...)
+}
+
+// Options for building a SELECT statement
+type SelectOpts struct {
+	// Table to select from. Required.
+	Table string
+
+	// Value of the struct type, whose columns will be selected. Only the type
+	// is used. Can also be a nil pointer to such a struct.
+	//
+	// See InsertOpts.Data for column mapping rules.
+	Columns interface{}
+
+	// Double-quote all column names, including ones not set through a tag,
+	// preserving the exact case of Go field names. By default such names are
+	// left unquoted and thus folded to lowercase by Postgres.
+	QuoteAll bool
+
+	// Optional WHERE condition. Placeholders start from $1.
+	// Example: `"age" > $1`
+	Where string
+
+	// Arguments to Where
+	Args []interface{}
+
+	// Optional struct, whose non-zero fields are added as ANDed equality
+	// conditions. See BuildWhere.
+	Cond interface{}
+
+	// Exclude soft-deleted rows by requiring this column to be NULL.
+	// Example: "deleted_at"
+	SoftDeleteColumn string
+
+	// Optional prefix to statement
+	Prefix string
+
+	// Optional common table expressions to prepend to the statement as a WITH
+	// clause. Written after Prefix. Placeholders of all CTEs and Where are
+	// renumbered automatically and the CTE arguments prepended to the returned
+	// arguments.
+	CTEs []CTE
+
+	// Optional suffix to statement, like an ORDER BY or LIMIT clause
+	Suffix string
+
+	// Shift generated placeholders by ArgOffset, so the statement can be
+	// appended to other SQL, whose arguments occupy the first ArgOffset
+	// positions. The returned arguments do not include these.
+	ArgOffset int
+
+	// Optional row locking clause written after Suffix
+	Lock LockStrength
+
+	// Optional tables to restrict locking to with an OF clause. Requires Lock.
+	LockOf []string
+
+	// Skip rows, that can not be locked immediately. Useful for queue
+	// consumers claiming rows. Requires Lock.
+	SkipLocked bool
+
+	// Return an error instead of waiting, if rows can not be locked
+	// immediately. Requires Lock.
+	NoWait bool
+}
+
+// Strength of row locks acquired by a SELECT statement
+type LockStrength int
+
+const (
+	// No locking
+	LockNone LockStrength = iota
+
+	// FOR UPDATE
+	LockForUpdate
+
+	// FOR NO KEY UPDATE
+	LockForNoKeyUpdate
+
+	// FOR SHARE
+	LockForShare
+
+	// FOR KEY SHARE
+	LockForKeyShare
+)
+
+// Locking options set without Lock or mutually exclusive options set
+var ErrInvalidLock = errors.New("pg_util: invalid locking options")
+
+// Write row locking clause, if any
+func writeLock(w *strings.Builder, o *SelectOpts) error {
+	if o.Lock == LockNone {
+		if len(o.LockOf) != 0 || o.SkipLocked || o.NoWait {
+			return ErrInvalidLock
+		}
+		return nil
+	}
+	if o.SkipLocked && o.NoWait {
+		return ErrInvalidLock
+	}
+
+	switch o.Lock {
+	case LockForUpdate:
+		w.WriteString(" FOR UPDATE")
+	case LockForNoKeyUpdate:
+		w.WriteString(" FOR NO KEY UPDATE")
+	case LockForShare:
+		w.WriteString(" FOR SHARE")
+	case LockForKeyShare:
+		w.WriteString(" FOR KEY SHARE")
+	default:
+		return ErrInvalidLock
+	}
+	if len(o.LockOf) != 0 {
+		w.WriteString(" OF ")
+		writeIdentifierList(w, o.LockOf)
+	}
+	switch {
+	case o.SkipLocked:
+		w.WriteString(" SKIP LOCKED")
+	case o.NoWait:
+		w.WriteString(" NOWAIT")
+	}
+	return nil
+}
+
+// Build SELECT statement for all columns of a struct type.
+// The result can be scanned with SelectStructs or GetStruct.
+//
+// See SelectOpts for further documentation.
+func BuildSelect(o SelectOpts) (sql string, args []interface{}, err error) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildSelect", start, sql, len(args), false)
+	}()
+
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	t := reflect.TypeOf(o.Columns)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	meta, err := getStructMeta(t)
+	if err != nil {
+		return
+	}
+	if len(meta.columns) == 0 {
+		err = ErrNoColumns
+		return
+	}
+
+	var w strings.Builder
+	writePrefix(&w, o.Prefix)
+	args = writeCTEs(&w, o.CTEs, o.ArgOffset)
+	w.WriteString("SELECT ")
+	for i := range meta.columns {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		meta.columns[i].writeName(&w, o.QuoteAll)
+	}
+	w.WriteString(" FROM ")
+	w.WriteString(quoteIdentifier(o.Table))
+
+	var conds []string
+	if o.Where != "" {
+		where := shiftPlaceholders(o.Where, o.ArgOffset+len(args))
+		conds = append(conds, "("+where+")")
+	}
+	var condArgs []interface{}
+	if o.Cond != nil {
+		var cond string
+		cond, condArgs, err = buildWhere(
+			o.Cond,
+			o.ArgOffset+len(args)+len(o.Args),
+			o.QuoteAll,
+		)
+		if err != nil {
+			return
+		}
+		if cond != "" {
+			conds = append(conds, cond)
+		}
+	}
+	if o.SoftDeleteColumn != "" {
+		conds = append(conds, quoteName(o.SoftDeleteColumn)+" IS NULL")
+	}
+	if len(conds) != 0 {
+		w.WriteString(" WHERE ")
+		w.WriteString(strings.Join(conds, " AND "))
+	}
+	writeSuffix(&w, o.Suffix)
+	err = writeLock(&w, &o)
+	if err != nil {
+		return
+	}
+
+	sql = w.String()
+	args = append(append(args, o.Args...), condArgs...)
+	return
+}
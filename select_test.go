@@ -0,0 +1,234 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+type selectRow struct {
+	ID   int `db:"id"`
+	Name string
+	selectInner
+}
+
+type selectInner struct {
+	Tag string `db:"Tag"`
+}
+
+func TestResultIndices(t *testing.T) {
+	t.Parallel()
+
+	meta, err := getStructMeta(reflect.TypeOf(selectRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := func(names ...string) []pgproto3.FieldDescription {
+		f := make([]pgproto3.FieldDescription, len(names))
+		for i, n := range names {
+			f[i].Name = []byte(n)
+		}
+		return f
+	}
+
+	indices, err := resultIndices(meta, fields("name", "Tag", "id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := [][]int{{1}, {2, 0}, {0}}
+	if !reflect.DeepEqual(indices, std) {
+		t.Fatalf("index mismatch: `%+v` != `%+v`", indices, std)
+	}
+
+	for _, name := range [...]string{"tag", "ID", "foo"} {
+		_, err = resultIndices(meta, fields(name))
+		if _, ok := err.(*UnknownColumnError); !ok {
+			t.Fatalf("unexpected error for %s: %v", name, err)
+		}
+	}
+}
+
+func TestSelectStructs(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	var res []selectRow
+	err = SelectStructs(
+		context.Background(),
+		conn,
+		&res,
+		`select id, 'name_' || id as name, 'tag' as "Tag"
+		from generate_series(1, $1) as id`,
+		3,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	std := []selectRow{
+		{1, "name_1", selectInner{"tag"}},
+		{2, "name_2", selectInner{"tag"}},
+		{3, "name_3", selectInner{"tag"}},
+	}
+	if !reflect.DeepEqual(res, std) {
+		t.Fatalf("result mismatch: `%+v` != `%+v`", res, std)
+	}
+}
+
+func TestGetStruct(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	t.Run("found", func(t *testing.T) {
+		var res selectRow
+		err := GetStruct(
+			context.Background(),
+			conn,
+			&res,
+			`select 1 as id, 'name' as name, 'tag' as "Tag"`,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		std := selectRow{1, "name", selectInner{"tag"}}
+		if res != std {
+			t.Fatalf("result mismatch: `%+v` != `%+v`", res, std)
+		}
+	})
+	t.Run("no rows", func(t *testing.T) {
+		var res selectRow
+		err := GetStruct(
+			context.Background(),
+			conn,
+			&res,
+			`select 1 as id where false`,
+		)
+		if err != ErrNoRows {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestBuildSelect(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, sql string
+		opts      SelectOpts
+		args      []interface{}
+	}{
+		{
+			name: "simple",
+			opts: SelectOpts{
+				Table:   "t1",
+				Columns: selectRow{},
+			},
+			sql: `SELECT "id",Name,"Tag" FROM "t1"`,
+		},
+		{
+			name: "with condition and soft delete",
+			opts: SelectOpts{
+				Table:            "t1",
+				Columns:          (*selectRow)(nil),
+				Where:            `"id" > $1 OR Name = $2`,
+				Args:             []interface{}{1, "a"},
+				SoftDeleteColumn: "deleted_at",
+				Suffix:           "ORDER BY 1",
+				CTEs: []CTE{
+					{Name: "v", SQL: "SELECT $1::int", Args: []interface{}{0}},
+				},
+			},
+			sql: `WITH "v" AS (SELECT $1::int) SELECT "id",Name,"Tag" ` +
+				`FROM "t1" WHERE ("id" > $2 OR Name = $3) ` +
+				`AND "deleted_at" IS NULL ORDER BY 1`,
+			args: []interface{}{0, 1, "a"},
+		},
+		{
+			name: "skip locked",
+			opts: SelectOpts{
+				Table:      "t1",
+				Columns:    selectRow{},
+				Suffix:     "LIMIT 1",
+				Lock:       LockForUpdate,
+				SkipLocked: true,
+			},
+			sql: `SELECT "id",Name,"Tag" FROM "t1" LIMIT 1 ` +
+				`FOR UPDATE SKIP LOCKED`,
+		},
+		{
+			name: "lock of tables",
+			opts: SelectOpts{
+				Table:   "t1",
+				Columns: selectRow{},
+				Lock:    LockForNoKeyUpdate,
+				LockOf:  []string{"t1"},
+				NoWait:  true,
+			},
+			sql: `SELECT "id",Name,"Tag" FROM "t1" ` +
+				`FOR NO KEY UPDATE OF "t1" NOWAIT`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, args, err := BuildSelect(c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, c.args)
+			}
+		})
+	}
+}
+
+func TestBuildSelectInvalidLock(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		opts SelectOpts
+	}{
+		{"no lock strength", SelectOpts{SkipLocked: true}},
+		{"skip locked and nowait", SelectOpts{
+			Lock:       LockForShare,
+			SkipLocked: true,
+			NoWait:     true,
+		}},
+		{"invalid strength", SelectOpts{Lock: -1}},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			c.opts.Table = "t1"
+			c.opts.Columns = selectRow{}
+			_, _, err := BuildSelect(c.opts)
+			if err != ErrInvalidLock {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package pg_util
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Version, extensions and capabilities of a server returned by ServerInfo
+type ServerDetails struct {
+	// Full version string. Example: "15.2 (Debian 15.2-1.pgdg110+1)"
+	Version string
+
+	// Numeric version. Example: 150002
+	VersionNum int
+
+	// Major version. Example: 15
+	Major int
+
+	// Minor version. Example: 2
+	//
+	// Versions before 10 have a two-component major version. For these Major
+	// and Minor hold its first and second component, like 9 and 6 for 9.6.24,
+	// and the minor version is only available through VersionNum.
+	Minor int
+
+	// Installed extensions mapped to their versions
+	Extensions map[string]string
+
+	// Server is a standby in recovery mode
+	InRecovery bool
+
+	// Value of the wal_level setting
+	WALLevel string
+
+	// MERGE statements are supported. Required by BuildMerge.
+	SupportsMerge bool
+
+	// wal_level is set to logical, allowing logical replication and
+	// decoding
+	LogicalReplication bool
+}
+
+// Returns, if the server's major version is at least major. Versions before
+// 10 only compare by their first component.
+func (s *ServerDetails) AtLeast(major int) bool {
+	return s.Major >= major
+}
+
+// Returns, if extension name is installed in the current database
+func (s *ServerDetails) HasExtension(name string) bool {
+	_, ok := s.Extensions[name]
+	return ok
+}
+
+// Detect the version, installed extensions and capabilities of the server,
+// so behavior can be gated by capability instead of failing at runtime
+func ServerInfo(ctx context.Context, q Querier) (s ServerDetails, err error) {
+	err = q.
+		QueryRow(
+			ctx,
+			`SELECT current_setting('server_version'),
+				current_setting('server_version_num')::int,
+				current_setting('wal_level'),
+				pg_is_in_recovery()`,
+		).
+		Scan(&s.Version, &s.VersionNum, &s.WALLevel, &s.InRecovery)
+	if err != nil {
+		return
+	}
+	s.Major, s.Minor = splitVersionNum(s.VersionNum)
+	s.SupportsMerge = s.Major >= 15
+	s.LogicalReplication = s.WALLevel == "logical"
+
+	s.Extensions = make(map[string]string)
+	err = QueryEach(
+		ctx,
+		q,
+		`SELECT extname, extversion FROM pg_extension`,
+		nil,
+		func(r pgx.Row) (err error) {
+			var name, version string
+			err = r.Scan(&name, &version)
+			if err != nil {
+				return
+			}
+			s.Extensions[name] = version
+			return
+		},
+	)
+	return
+}
+
+// Split server_version_num into the major and minor version or, before
+// version 10, the two components of the major version
+func splitVersionNum(n int) (major, minor int) {
+	major = n / 10000
+	if n >= 100000 {
+		minor = n % 10000
+	} else {
+		minor = n / 100 % 100
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package pg_util
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestServerInfo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	s, err := ServerInfo(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version == "" || s.Major < 9 {
+		t.Fatalf("invalid version: %+v", s)
+	}
+	if !s.AtLeast(s.Major) || s.AtLeast(s.Major+1) {
+		t.Fatalf("invalid version comparison: %d", s.Major)
+	}
+	if !s.HasExtension("plpgsql") {
+		t.Fatal("plpgsql not detected")
+	}
+	if s.SupportsMerge != (s.Major >= 15) {
+		t.Fatal("invalid MERGE support flag")
+	}
+}
+
+func TestSplitVersionNum(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		num, major, minor int
+	}{
+		{150002, 15, 2},
+		{100023, 10, 23},
+		{90624, 9, 6},
+		{80423, 8, 4},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(strconv.Itoa(c.num), func(t *testing.T) {
+			t.Parallel()
+
+			major, minor := splitVersionNum(c.num)
+			if major != c.major || minor != c.minor {
+				t.Fatalf(
+					"version mismatch: %d.%d != %d.%d",
+					major, minor, c.major, c.minor,
+				)
+			}
+		})
+	}
+}
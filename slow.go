@@ -0,0 +1,187 @@
+package pg_util
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Maximum number of statement summaries recorded per transaction for
+// SlowInfo
+const maxSlowStatements = 32
+
+var slowHook atomic.Value // *SlowHook
+
+// Kind of operation reported to SlowHook
+type SlowKind int
+
+const (
+	// Transaction started by InTransaction or any of its variants
+	SlowTransaction SlowKind = iota
+
+	// Single statement executed by ExecAll
+	SlowStatement
+)
+
+func (k SlowKind) String() string {
+	if k == SlowStatement {
+		return "statement"
+	}
+	return "transaction"
+}
+
+// Information about an operation, that exceeded its SlowHook threshold
+type SlowInfo struct {
+	Kind SlowKind
+
+	// Duration of the operation
+	Duration time.Duration
+
+	// Summaries of statements executed with Exec, Query or QueryRow on the
+	// transaction passed to fn, in execution order and limited to the first
+	// 32, or the executed statement for SlowStatement
+	Statements []string
+
+	// Error of the operation, if any
+	Err error
+}
+
+// Threshold-based hook for slow transactions and statements. Useful for
+// catching lock contention problems early.
+type SlowHook struct {
+	// Report transactions taking longer than TxThreshold. Disabled, if zero.
+	TxThreshold time.Duration
+
+	// Report ExecAll statements taking longer than StatementThreshold.
+	// Disabled, if zero.
+	StatementThreshold time.Duration
+
+	// Called synchronously with information about every slow operation. Must
+	// be safe for concurrent use.
+	Fn func(SlowInfo)
+}
+
+// Set a hook to be called for transactions and statements exceeding the
+// configured durations. Pass a SlowHook with nil Fn to remove the hook.
+//
+// Recording statement summaries for transactions wraps the pgx.Tx passed to
+// fn, while TxThreshold is set.
+func SetSlowHook(h SlowHook) {
+	if h.Fn == nil {
+		h = SlowHook{}
+	}
+	slowHook.Store(&h)
+}
+
+// Return the slow hook, if set
+func loadSlowHook() *SlowHook {
+	h, _ := slowHook.Load().(*SlowHook)
+	if h == nil || h.Fn == nil {
+		return nil
+	}
+	return h
+}
+
+// Wrap tx to record statement summaries, if slow transactions are reported
+func recordStatements(tx pgx.Tx) pgx.Tx {
+	if h := loadSlowHook(); h == nil || h.TxThreshold <= 0 {
+		return tx
+	}
+	if _, ok := tx.(*statementRecorder); ok {
+		return tx
+	}
+	return &statementRecorder{Tx: tx}
+}
+
+// Report transaction on tx, if it took longer than the threshold
+func reportSlowTx(tx pgx.Tx, d time.Duration, err error) {
+	h := loadSlowHook()
+	if h == nil || h.TxThreshold <= 0 || d <= h.TxThreshold {
+		return
+	}
+	info := SlowInfo{
+		Kind:     SlowTransaction,
+		Duration: d,
+		Err:      err,
+	}
+	if r, ok := tx.(*statementRecorder); ok {
+		info.Statements = r.statements
+	}
+	h.Fn(info)
+}
+
+// Time execution of statement sql by fn and report it, if it took longer than
+// the threshold
+func timeStatement(sql string, fn func() error) error {
+	h := loadSlowHook()
+	if h == nil || h.StatementThreshold <= 0 {
+		return fn()
+	}
+	start := time.Now()
+	err := fn()
+	if d := time.Since(start); d > h.StatementThreshold {
+		h.Fn(SlowInfo{
+			Kind:       SlowStatement,
+			Duration:   d,
+			Statements: []string{summarizeSQL(sql)},
+			Err:        err,
+		})
+	}
+	return err
+}
+
+// Records summaries of statements executed on a transaction and its
+// pseudo nested transactions
+type statementRecorder struct {
+	pgx.Tx
+	parent     *statementRecorder
+	statements []string
+}
+
+// Record sql on r and all its parents
+func (r *statementRecorder) record(sql string) {
+	sql = summarizeSQL(sql)
+	for ; r != nil; r = r.parent {
+		if len(r.statements) < maxSlowStatements {
+			r.statements = append(r.statements, sql)
+		}
+	}
+}
+
+func (r *statementRecorder) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := r.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &statementRecorder{Tx: tx, parent: r}, nil
+}
+
+func (r *statementRecorder) Exec(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgconn.CommandTag, error) {
+	r.record(sql)
+	return r.Tx.Exec(ctx, sql, args...)
+}
+
+func (r *statementRecorder) Query(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgx.Rows, error) {
+	r.record(sql)
+	return r.Tx.Query(ctx, sql, args...)
+}
+
+func (r *statementRecorder) QueryRow(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) pgx.Row {
+	r.record(sql)
+	return r.Tx.QueryRow(ctx, sql, args...)
+}
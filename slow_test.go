@@ -0,0 +1,70 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Transaction, that sleeps on the statement "sleep"
+type sleepTx struct {
+	fakeTx
+}
+
+func (tx sleepTx) Exec(ctx context.Context, sql string, args ...interface{}) (
+	pgconn.CommandTag,
+	error,
+) {
+	if sql == "sleep" {
+		time.Sleep(2 * time.Millisecond)
+	}
+	return tx.fakeTx.Exec(ctx, sql, args...)
+}
+
+// Not parallel, as the hook is global
+func TestSlowHook(t *testing.T) {
+	var infos []SlowInfo
+	SetSlowHook(SlowHook{
+		TxThreshold:        time.Millisecond,
+		StatementThreshold: time.Millisecond,
+		Fn: func(info SlowInfo) {
+			info.Duration = 0
+			infos = append(infos, info)
+		},
+	})
+	defer SetSlowHook(SlowHook{})
+
+	err := runTx(
+		context.Background(),
+		sleepTx{},
+		&TxOpts{},
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(context.Background(), "select   1")
+			if err != nil {
+				return
+			}
+			return ExecAll(context.Background(), tx, "a", "sleep")
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	std := []SlowInfo{
+		{
+			Kind:       SlowStatement,
+			Statements: []string{"sleep"},
+		},
+		{
+			Kind:       SlowTransaction,
+			Statements: []string{"select 1", "a", "sleep"},
+		},
+	}
+	if !reflect.DeepEqual(infos, std) {
+		t.Fatalf("info mismatch: %+v != %+v", infos, std)
+	}
+}
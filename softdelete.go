@@ -0,0 +1,79 @@
+package pg_util
+
+import (
+	"strings"
+)
+
+// Default column used for marking rows as soft-deleted
+const DefaultSoftDeleteColumn = "deleted_at"
+
+// Build statement soft-deleting rows matching all columns of key by setting
+// column to now(). Rows, that are already soft-deleted, are not modified.
+// If column is empty, DefaultSoftDeleteColumn is used.
+//
+// key is a struct, whose columns form the key of the rows to delete.
+// Columns with an ",expr=" tag option are matched against the expression
+// instead of the field value and zero ",nullzero" columns with IS NULL.
+// Generated and read-only columns are not part of the key. See
+// InsertOpts.Data for column mapping rules.
+//
+// Use SelectOpts.SoftDeleteColumn to exclude soft-deleted rows when selecting.
+func BuildSoftDelete(table string, key interface{}, column string) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	start := buildStart()
+	defer func() {
+		reportBuild("BuildSoftDelete", start, sql, len(args), false)
+	}()
+
+	if table == "" {
+		err = ErrNoTable
+		return
+	}
+	if column == "" {
+		column = DefaultSoftDeleteColumn
+	}
+	v, meta, err := getDataMeta(key)
+	if err != nil {
+		return
+	}
+	if len(meta.writable) == 0 {
+		err = ErrNoColumns
+		return
+	}
+
+	column = quoteName(column)
+	var w strings.Builder
+	w.WriteString("UPDATE ")
+	w.WriteString(quoteIdentifier(table))
+	w.WriteString(" SET ")
+	w.WriteString(column)
+	w.WriteString("=now() WHERE ")
+	for _, c := range meta.writable {
+		c.writeName(&w, false)
+		f := v.FieldByIndex(c.index)
+		switch {
+		case c.expr != "":
+			w.WriteByte('=')
+			w.WriteString(c.expr)
+		case c.nullZero && isZero(f, f.Interface()):
+			// =NULL never matches
+			w.WriteString(" IS NULL")
+		default:
+			w.WriteByte('=')
+			c.writePlaceholder(&w, len(args))
+			args, err = c.appendValue(args, v)
+			if err != nil {
+				return
+			}
+		}
+		w.WriteString(" AND ")
+	}
+	w.WriteString(column)
+	w.WriteString(" IS NULL")
+
+	sql = w.String()
+	return
+}
@@ -0,0 +1,95 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	type key struct {
+		ID     int `db:"id"`
+		Tenant int `db:"tenant"`
+	}
+
+	cases := [...]struct {
+		name, column, sql string
+	}{
+		{
+			name: "default column",
+			sql: `UPDATE "t1" SET "deleted_at"=now() ` +
+				`WHERE "id"=$1 AND "tenant"=$2 AND "deleted_at" IS NULL`,
+		},
+		{
+			name:   "custom column",
+			column: "removed_at",
+			sql: `UPDATE "t1" SET "removed_at"=now() ` +
+				`WHERE "id"=$1 AND "tenant"=$2 AND "removed_at" IS NULL`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, args, err := BuildSoftDelete("t1", key{1, 2}, c.column)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, []interface{}{1, 2}) {
+				t.Fatalf("argument list mismatch: `%+v`", args)
+			}
+		})
+	}
+}
+
+func TestBuildSoftDeleteExpr(t *testing.T) {
+	t.Parallel()
+
+	type key struct {
+		ID     int `db:"id"`
+		Tenant int `db:"tenant,expr=current_setting('app.tenant')::int"`
+	}
+
+	sql, args, err := BuildSoftDelete("t1", key{ID: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `UPDATE "t1" SET "deleted_at"=now() WHERE "id"=$1 AND ` +
+		`"tenant"=current_setting('app.tenant')::int AND "deleted_at" IS NULL`
+	if sql != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+}
+
+func TestBuildSoftDeleteSkippedColumns(t *testing.T) {
+	t.Parallel()
+
+	type key struct {
+		ID      int    `db:"id"`
+		Parent  int    `db:"parent,nullzero"`
+		Version int    `db:"version,generated"`
+		Name    string `db:"name,readonly"`
+	}
+
+	sql, args, err := BuildSoftDelete("t1", key{ID: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `UPDATE "t1" SET "deleted_at"=now() WHERE "id"=$1 AND ` +
+		`"parent" IS NULL AND "deleted_at" IS NULL`
+	if sql != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+}
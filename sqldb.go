@@ -0,0 +1,333 @@
+package pg_util
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+// Returned by methods of transactions adapted from database/sql, that have no
+// database/sql equivalent
+var ErrSQLUnsupported = errors.New("pg_util: not supported by database/sql")
+
+// Anything, that can start a database/sql transaction, like *sql.DB or
+// *sql.Conn
+type SQLBeginner interface {
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Adapt a database/sql handle, like *sql.DB opened with the pgx stdlib
+// driver, for use with InTransaction and the other transaction helpers.
+// This lets code bases migrating between database/sql and pgx share one
+// transaction utility.
+//
+// See FromSQLTx for the limitations of the started transactions.
+func FromSQL(db SQLBeginner) TxOptionsStarter {
+	return sqlStarter{db}
+}
+
+type sqlStarter struct {
+	db SQLBeginner
+}
+
+func (s sqlStarter) Begin(ctx context.Context) (pgx.Tx, error) {
+	return s.BeginTx(ctx, pgx.TxOptions{})
+}
+
+func (s sqlStarter) BeginTx(ctx context.Context, opts pgx.TxOptions) (
+	tx pgx.Tx,
+	err error,
+) {
+	sqlOpts, err := sqlTxOptions(opts)
+	if err != nil {
+		return
+	}
+	sqlTx, err := s.db.BeginTx(ctx, sqlOpts)
+	if err != nil {
+		return
+	}
+	tx = FromSQLTx(sqlTx)
+	return
+}
+
+// Convert pgx transaction options to database/sql ones
+func sqlTxOptions(o pgx.TxOptions) (opts *sql.TxOptions, err error) {
+	opts = new(sql.TxOptions)
+	switch o.IsoLevel {
+	case "":
+	case pgx.Serializable:
+		opts.Isolation = sql.LevelSerializable
+	case pgx.RepeatableRead:
+		opts.Isolation = sql.LevelRepeatableRead
+	case pgx.ReadCommitted:
+		opts.Isolation = sql.LevelReadCommitted
+	case pgx.ReadUncommitted:
+		opts.Isolation = sql.LevelReadUncommitted
+	default:
+		err = fmt.Errorf("pg_util: unknown isolation level: %s", o.IsoLevel)
+		return
+	}
+	switch o.AccessMode {
+	case "", pgx.ReadWrite:
+	case pgx.ReadOnly:
+		opts.ReadOnly = true
+	default:
+		err = fmt.Errorf("pg_util: unknown access mode: %s", o.AccessMode)
+		return
+	}
+	switch o.DeferrableMode {
+	case "", pgx.NotDeferrable:
+	default:
+		err = fmt.Errorf("%w: deferrable mode %s", ErrSQLUnsupported,
+			o.DeferrableMode)
+	}
+	return
+}
+
+// Adapt a database/sql transaction to pgx.Tx, so it can be passed to
+// InTransaction for nested pseudotransactions via savepoints, ExecAll and
+// other helpers taking a pgx.Tx or Querier.
+//
+// Exec, Query, QueryRow, Begin, Commit and Rollback are supported. Command
+// tags only carry the number of affected rows. Rows do not provide field
+// descriptions or raw values. CopyFrom, SendBatch and Prepare return
+// ErrSQLUnsupported. LargeObjects and Conn must not be used.
+//
+// The transaction is committed or rolled back with the context it was started
+// with, as database/sql does not accept one on commit or rollback.
+func FromSQLTx(tx *sql.Tx) pgx.Tx {
+	return &sqlTx{
+		tx:         tx,
+		savepoints: new(int),
+	}
+}
+
+// database/sql transaction or savepoint adapted to pgx.Tx
+type sqlTx struct {
+	tx *sql.Tx
+
+	// Name of savepoint, if a pseudo nested transaction
+	savepoint string
+
+	// Number of savepoints created on tx
+	savepoints *int
+
+	closed bool
+}
+
+func (t *sqlTx) Begin(ctx context.Context) (tx pgx.Tx, err error) {
+	if t.closed {
+		err = pgx.ErrTxClosed
+		return
+	}
+	*t.savepoints++
+	name := "pg_util_sp_" + strconv.Itoa(*t.savepoints)
+	_, err = t.tx.ExecContext(ctx, "SAVEPOINT "+name)
+	if err != nil {
+		return
+	}
+	tx = &sqlTx{
+		tx:         t.tx,
+		savepoint:  name,
+		savepoints: t.savepoints,
+	}
+	return
+}
+
+func (t *sqlTx) Commit(ctx context.Context) error {
+	return t.finish(ctx, "RELEASE SAVEPOINT ", t.tx.Commit)
+}
+
+func (t *sqlTx) Rollback(ctx context.Context) error {
+	return t.finish(ctx, "ROLLBACK TO SAVEPOINT ", t.tx.Rollback)
+}
+
+// Close the transaction by either executing savepointCmd on the savepoint or
+// calling txFn for real transactions
+func (t *sqlTx) finish(
+	ctx context.Context,
+	savepointCmd string,
+	txFn func() error,
+) (err error) {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+	t.closed = true
+	if t.savepoint != "" {
+		_, err = t.tx.ExecContext(ctx, savepointCmd+t.savepoint)
+		return
+	}
+	err = txFn()
+	if errors.Is(err, sql.ErrTxDone) {
+		err = pgx.ErrTxClosed
+	}
+	return
+}
+
+func (t *sqlTx) CopyFrom(
+	context.Context,
+	pgx.Identifier,
+	[]string,
+	pgx.CopyFromSource,
+) (int64, error) {
+	return 0, ErrSQLUnsupported
+}
+
+func (t *sqlTx) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return sqlBatchResults{}
+}
+
+func (t *sqlTx) LargeObjects() pgx.LargeObjects {
+	return pgx.LargeObjects{}
+}
+
+func (t *sqlTx) Prepare(context.Context, string, string) (
+	*pgconn.StatementDescription,
+	error,
+) {
+	return nil, ErrSQLUnsupported
+}
+
+func (t *sqlTx) Exec(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (tag pgconn.CommandTag, err error) {
+	res, err := t.tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	tag = pgconn.CommandTag(strconv.FormatInt(n, 10))
+	return
+}
+
+func (t *sqlTx) Query(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgx.Rows, error) {
+	r, err := t.tx.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlRows{rows: r}, nil
+}
+
+func (t *sqlTx) QueryRow(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) pgx.Row {
+	return sqlRow{t.tx.QueryRowContext(ctx, sql, args...)}
+}
+
+func (t *sqlTx) Conn() *pgx.Conn {
+	return nil
+}
+
+// database/sql row adapted to pgx.Row
+type sqlRow struct {
+	row *sql.Row
+}
+
+func (r sqlRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = pgx.ErrNoRows
+	}
+	return err
+}
+
+// database/sql rows adapted to pgx.Rows
+type sqlRows struct {
+	rows *sql.Rows
+	err  error
+}
+
+func (r *sqlRows) Close() {
+	r.rows.Close()
+}
+
+func (r *sqlRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+func (r *sqlRows) CommandTag() pgconn.CommandTag {
+	return nil
+}
+
+func (r *sqlRows) FieldDescriptions() []pgproto3.FieldDescription {
+	return nil
+}
+
+func (r *sqlRows) Next() bool {
+	return r.err == nil && r.rows.Next()
+}
+
+func (r *sqlRows) Scan(dest ...interface{}) (err error) {
+	err = r.rows.Scan(dest...)
+	if err != nil {
+		r.err = err
+		r.rows.Close()
+	}
+	return
+}
+
+func (r *sqlRows) Values() (vals []interface{}, err error) {
+	cols, err := r.rows.Columns()
+	if err != nil {
+		return
+	}
+	vals = make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	err = r.Scan(dest...)
+	return
+}
+
+func (r *sqlRows) RawValues() [][]byte {
+	return nil
+}
+
+// Batch results of a database/sql transaction. Batches are not supported.
+type sqlBatchResults struct{}
+
+func (sqlBatchResults) Exec() (pgconn.CommandTag, error) {
+	return nil, ErrSQLUnsupported
+}
+
+func (sqlBatchResults) Query() (pgx.Rows, error) {
+	return nil, ErrSQLUnsupported
+}
+
+func (sqlBatchResults) QueryRow() pgx.Row {
+	return errRow{ErrSQLUnsupported}
+}
+
+func (sqlBatchResults) Close() error {
+	return nil
+}
+
+// Row, that always returns an error on Scan
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...interface{}) error {
+	return r.err
+}
@@ -0,0 +1,171 @@
+package pg_util
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+func TestSQLTxOptions(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		in   pgx.TxOptions
+		out  sql.TxOptions
+		err  bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "serializable read only",
+			in: pgx.TxOptions{
+				IsoLevel:   pgx.Serializable,
+				AccessMode: pgx.ReadOnly,
+			},
+			out: sql.TxOptions{
+				Isolation: sql.LevelSerializable,
+				ReadOnly:  true,
+			},
+		},
+		{
+			name: "read committed",
+			in: pgx.TxOptions{
+				IsoLevel:       pgx.ReadCommitted,
+				AccessMode:     pgx.ReadWrite,
+				DeferrableMode: pgx.NotDeferrable,
+			},
+			out: sql.TxOptions{
+				Isolation: sql.LevelReadCommitted,
+			},
+		},
+		{
+			name: "deferrable",
+			in: pgx.TxOptions{
+				DeferrableMode: pgx.Deferrable,
+			},
+			err: true,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts, err := sqlTxOptions(c.in)
+			if c.err {
+				if !errors.Is(err, ErrSQLUnsupported) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *opts != c.out {
+				t.Fatalf("options mismatch: %+v != %+v", *opts, c.out)
+			}
+		})
+	}
+}
+
+func TestFromSQL(t *testing.T) {
+	t.Parallel()
+
+	conf, err := pgx.ParseConfig(getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := stdlib.OpenDB(*conf)
+	defer db.Close()
+
+	errFail := errors.New("fail")
+	err = InTransaction(
+		context.Background(),
+		FromSQL(db),
+		func(tx pgx.Tx) (err error) {
+			err = ExecAll(
+				context.Background(),
+				tx,
+				"create temp table sql_adapter_test (id int) on commit drop",
+				"insert into sql_adapter_test values (1), (2)",
+			)
+			if err != nil {
+				return
+			}
+
+			err = InTransaction(
+				context.Background(),
+				tx,
+				func(tx pgx.Tx) (err error) {
+					_, err = tx.Exec(
+						context.Background(),
+						"insert into sql_adapter_test values (3)",
+					)
+					if err != nil {
+						return
+					}
+					return errFail
+				},
+			)
+			if err != errFail {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			tag, err := tx.Exec(
+				context.Background(),
+				"update sql_adapter_test set id = id + 1",
+			)
+			if err != nil {
+				return
+			}
+			if n := tag.RowsAffected(); n != 2 {
+				t.Fatalf("rows affected mismatch: %d != 2", n)
+			}
+
+			var ids []int
+			r, err := tx.Query(
+				context.Background(),
+				"select id from sql_adapter_test order by id",
+			)
+			if err != nil {
+				return
+			}
+			defer r.Close()
+			for r.Next() {
+				var id int
+				if err = r.Scan(&id); err != nil {
+					return
+				}
+				ids = append(ids, id)
+			}
+			if err = r.Err(); err != nil {
+				return
+			}
+			if len(ids) != 2 || ids[0] != 2 || ids[1] != 3 {
+				t.Fatalf("unexpected rows: %v", ids)
+			}
+
+			var id int
+			err = tx.
+				QueryRow(
+					context.Background(),
+					"select id from sql_adapter_test where id = 10",
+				).
+				Scan(&id)
+			if err != pgx.ErrNoRows {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
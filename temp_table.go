@@ -0,0 +1,48 @@
+package pg_util
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Create a temporary table, run fn with its name and drop the table
+// afterwards. Supports staging-table workflows for bulk operations.
+//
+// The table name is generated from the prefix name and a unique suffix, so
+// concurrent and nested calls never collide. ddl is the rest of the table
+// definition following the name.
+// Example: WithTempTable(ctx, tx, "(LIKE users)", "users_staging", fn)
+//
+// The table is created with ON COMMIT DROP, so it is also dropped, if fn
+// fails and the transaction is committed regardless.
+func WithTempTable(
+	ctx context.Context,
+	tx pgx.Tx,
+	ddl, name string,
+	fn func(table string) error,
+) (err error) {
+	suffix := "_" + strconv.FormatUint(
+		atomic.AddUint64(&tempTableCounter, 1),
+		10,
+	)
+	// Postgres truncates identifiers longer than 63 bytes
+	if max := 63 - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	name += suffix
+
+	quoted := quoteName(name)
+	_, err = tx.Exec(ctx,
+		"CREATE TEMP TABLE "+quoted+" "+ddl+" ON COMMIT DROP")
+	if err != nil {
+		return
+	}
+	if err = fn(name); err != nil {
+		return
+	}
+	_, err = tx.Exec(ctx, "DROP TABLE "+quoted)
+	return
+}
@@ -0,0 +1,60 @@
+package pg_util
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestWithTempTable(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) error {
+		return WithTempTable(
+			ctx,
+			tx,
+			"(id int)",
+			strings.Repeat("a", 70),
+			func(outer string) (err error) {
+				if len(outer) > 63 {
+					t.Fatalf("name too long: %s", outer)
+				}
+				_, err = tx.Exec(ctx,
+					"insert into "+quoteIdentifier(outer)+" values (1)")
+				if err != nil {
+					return
+				}
+
+				return WithTempTable(
+					ctx,
+					tx,
+					"(LIKE "+quoteIdentifier(outer)+")",
+					"staging",
+					func(inner string) (err error) {
+						if inner == outer {
+							t.Fatal("name collision")
+						}
+						_, err = tx.Exec(
+							ctx,
+							"insert into "+quoteIdentifier(inner)+
+								" select * from "+quoteIdentifier(outer),
+						)
+						return
+					},
+				)
+			},
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
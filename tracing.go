@@ -0,0 +1,148 @@
+package pg_util
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var tracer atomic.Value // tracerHolder
+
+// Names of spans started by the transaction and exec helpers
+const (
+	// Whole transaction started by InTransaction or any of its variants,
+	// including the execution of fn
+	SpanTransaction = "pg_util.Transaction"
+
+	// Start of a transaction or savepoint
+	SpanBegin = "pg_util.Begin"
+
+	// Commit of a transaction or release of a savepoint
+	SpanCommit = "pg_util.Commit"
+
+	// Rollback of a transaction or savepoint
+	SpanRollback = "pg_util.Rollback"
+
+	// Single statement executed by ExecAll
+	SpanExec = "pg_util.Exec"
+)
+
+// Operation traced by a Tracer
+type SpanInfo struct {
+	// Name of the span. One of the Span* constants.
+	Name string
+
+	// Summary of the executed statement with whitespace collapsed and
+	// truncated to a reasonable length. Only set for SpanExec.
+	SQL string
+
+	// Index of the statement in the ExecAll call. Only set for SpanExec.
+	Index int
+}
+
+// Creates spans for transaction and statement execution. Allows integrating
+// with any tracing library without pg_util depending on it.
+//
+// Example adapter for OpenTelemetry:
+//
+//	type otelTracer struct {
+//		t trace.Tracer
+//	}
+//
+//	func (o otelTracer) StartSpan(ctx context.Context, i pg_util.SpanInfo) (
+//		context.Context,
+//		pg_util.Span,
+//	) {
+//		ctx, s := o.t.Start(ctx, i.Name,
+//			trace.WithSpanKind(trace.SpanKindClient))
+//		if i.SQL != "" {
+//			s.SetAttributes(
+//				attribute.String("db.statement", i.SQL),
+//				attribute.Int("db.statement.index", i.Index),
+//			)
+//		}
+//		return ctx, otelSpan{s}
+//	}
+//
+//	type otelSpan struct {
+//		trace.Span
+//	}
+//
+//	func (s otelSpan) End(err error) {
+//		if err != nil {
+//			s.RecordError(err)
+//			s.SetStatus(codes.Error, err.Error())
+//		}
+//		s.Span.End()
+//	}
+//
+//	pg_util.SetTracer(otelTracer{otel.Tracer("pg_util")})
+type Tracer interface {
+	// Start a span described by info as a child of any span in ctx. The
+	// returned context is used for the traced operation and any operations
+	// nested in it.
+	StartSpan(ctx context.Context, info SpanInfo) (context.Context, Span)
+}
+
+// Span started by a Tracer
+type Span interface {
+	// End the span with the error of the traced operation, if any
+	End(err error)
+}
+
+// Wrapper to allow storing any Tracer implementation in an atomic.Value
+type tracerHolder struct {
+	t Tracer
+}
+
+// Set a Tracer to create spans for transactions and ExecAll statements.
+// Pass nil to disable tracing.
+//
+// t is called synchronously and must be safe for concurrent use.
+func SetTracer(t Tracer) {
+	tracer.Store(tracerHolder{t})
+}
+
+// Span used, when no Tracer is set
+type noopSpan struct{}
+
+func (noopSpan) End(error) {}
+
+// Start a span with the Tracer, if any
+func startSpan(ctx context.Context, info SpanInfo) (context.Context, Span) {
+	h, _ := tracer.Load().(tracerHolder)
+	if h.t == nil {
+		return ctx, noopSpan{}
+	}
+	return h.t.StartSpan(ctx, info)
+}
+
+// Commit tx inside a SpanCommit span
+func commitTx(ctx context.Context, tx pgx.Tx) (err error) {
+	ctx, span := startSpan(ctx, SpanInfo{Name: SpanCommit})
+	defer func() {
+		span.End(err)
+	}()
+	return tx.Commit(ctx)
+}
+
+// Roll back tx inside a SpanRollback span
+func rollbackTx(ctx context.Context, tx pgx.Tx) (err error) {
+	// Roll back even, if ctx is already done, to release locks as soon as
+	// possible
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(
+			detachedContext{ctx},
+			rollbackTimeout,
+		)
+		defer cancel()
+	}
+
+	ctx, span := startSpan(ctx, SpanInfo{Name: SpanRollback})
+	defer func() {
+		span.End(err)
+	}()
+	return tx.Rollback(ctx)
+}
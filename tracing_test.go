@@ -0,0 +1,125 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Records ended spans
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *recordingTracer) StartSpan(ctx context.Context, info SpanInfo) (
+	context.Context,
+	Span,
+) {
+	return ctx, recordingSpan{r, info}
+}
+
+type recordingSpan struct {
+	r    *recordingTracer
+	info SpanInfo
+}
+
+func (s recordingSpan) End(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+
+	name := s.info.Name
+	if s.info.SQL != "" {
+		name += " " + s.info.SQL
+	}
+	if err != nil {
+		name += " !"
+	}
+	s.r.spans = append(s.r.spans, name)
+}
+
+// Transaction, that fails the statement "fail"
+type fakeTx struct {
+	pgx.Tx
+}
+
+func (fakeTx) Exec(_ context.Context, sql string, _ ...interface{}) (
+	pgconn.CommandTag,
+	error,
+) {
+	if sql == "fail" {
+		return nil, errors.New("fail")
+	}
+	return nil, nil
+}
+
+func (fakeTx) Commit(context.Context) error {
+	return nil
+}
+
+func (fakeTx) Rollback(context.Context) error {
+	return nil
+}
+
+type fakeTxStarter struct{}
+
+func (fakeTxStarter) Begin(context.Context) (pgx.Tx, error) {
+	return fakeTx{}, nil
+}
+
+// Not parallel, as the tracer is global
+func TestTracing(t *testing.T) {
+	cases := [...]struct {
+		name  string
+		stmts []string
+		spans []string
+	}{
+		{
+			name:  "commit",
+			stmts: []string{"a", "b"},
+			spans: []string{
+				SpanBegin,
+				SpanExec + " a",
+				SpanExec + " b",
+				SpanCommit,
+				SpanTransaction,
+			},
+		},
+		{
+			name:  "rollback",
+			stmts: []string{"a", "fail", "b"},
+			spans: []string{
+				SpanBegin,
+				SpanExec + " a",
+				SpanExec + " fail !",
+				SpanRollback,
+				SpanTransaction + " !",
+			},
+		},
+	}
+
+	defer SetTracer(nil)
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			var r recordingTracer
+			SetTracer(&r)
+
+			InTransaction(
+				context.Background(),
+				fakeTxStarter{},
+				func(tx pgx.Tx) error {
+					return ExecAll(context.Background(), tx, c.stmts...)
+				},
+			)
+			if !reflect.DeepEqual(r.spans, c.spans) {
+				t.Fatalf("span mismatch: %v != %v", r.spans, c.spans)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Passed to TxOpts.AfterRollback, if the transaction was rolled back because
+// of a panic in fn
+var ErrTxPanic = errors.New("pg_util: panic in transaction")
+
+// Options for InTransactionWith
+type TxOpts struct {
+	// Options to start the transaction with, like the isolation level.
+	// See InTransactionOpts.
+	TxOptions pgx.TxOptions
+
+	// Optional hook called after fn succeeds and before the transaction is
+	// committed. Returning an error rolls back the transaction.
+	BeforeCommit func(context.Context, pgx.Tx) error
+
+	// Optional hook called after the transaction is committed. Useful for
+	// publishing events or invalidating caches only after the data is
+	// visible to other transactions.
+	AfterCommit func(context.Context)
+
+	// Optional hook called after the transaction is rolled back with the
+	// error, that caused the rollback. Called with ErrTxPanic before a panic
+	// in fn is propagated.
+	AfterRollback func(context.Context, error)
+
+	// Set statement_timeout for the duration of the transaction, if non-zero
+	StatementTimeout time.Duration
+
+	// Configuration parameters to set for the duration of the transaction.
+	// See SetLocal.
+	Settings map[string]string
+
+	// Recover panics in fn and the hooks called before committing, roll back
+	// the transaction and return them as *PanicError instead of propagating
+	// them. Useful to avoid crashing HTTP handlers without their own recover.
+	RecoverPanics bool
+}
+
+// Panic recovered in a transaction with TxOpts.RecoverPanics set.
+// Matches ErrTxPanic with errors.Is.
+type PanicError struct {
+	// Recovered value
+	Value interface{}
+
+	// Stack trace of the panicking goroutine
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("pg_util: panic in transaction: %v\n%s", e.Value,
+		e.Stack)
+}
+
+// Return the recovered value, if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+func (e *PanicError) Is(target error) bool {
+	return target == ErrTxPanic
+}
+
+// Like InTransaction, but with additional options.
+//
+// See TxOpts for further documentation.
+func InTransactionWith(
+	ctx context.Context,
+	conn TxStarter,
+	opts TxOpts,
+	fn func(pgx.Tx) error,
+) (err error) {
+	ctx, span := startSpan(ctx, SpanInfo{Name: SpanTransaction})
+	defer func() {
+		span.End(err)
+	}()
+
+	tx, err := beginTx(ctx, conn, opts.TxOptions)
+	if err != nil {
+		return
+	}
+	settings := opts.Settings
+	if opts.StatementTimeout != 0 {
+		settings = make(map[string]string, len(opts.Settings)+1)
+		for k, v := range opts.Settings {
+			settings[k] = v
+		}
+		settings["statement_timeout"] = strconv.FormatInt(
+			opts.StatementTimeout.Milliseconds(),
+			10,
+		)
+	}
+	if len(settings) != 0 {
+		inner := fn
+		fn = func(tx pgx.Tx) (err error) {
+			err = SetLocal(ctx, tx, settings)
+			if err != nil {
+				return
+			}
+			return inner(tx)
+		}
+	}
+	return runTx(ctx, tx, &opts, fn)
+}
+
+// Like InTransaction, but bounds the transaction by timeout d. fn receives a
+// context with the derived deadline, that must be used for all queries in fn,
+// so they are cancelled, once the deadline is exceeded. The transaction is
+// then rolled back, even though the context is done, so that fn can not hold
+// locks indefinitely.
+func InTransactionTimeout(
+	ctx context.Context,
+	conn TxStarter,
+	d time.Duration,
+	fn func(context.Context, pgx.Tx) error,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	return InTransaction(ctx, conn, func(tx pgx.Tx) error {
+		return fn(ctx, tx)
+	})
+}
+
+// Maximum duration of rolling back a transaction, whose context is already
+// done
+const rollbackTimeout = 5 * time.Second
+
+// Context, that carries the values of its parent, but is never cancelled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// Like InTransaction, but starts a READ ONLY transaction. Signals intent to
+// reviewers and makes the database reject accidental writes.
+//
+// Use InTransactionWith with TxOpts.StatementTimeout to also bound the
+// duration of statements.
+func InReadOnlyTransaction(
+	ctx context.Context,
+	conn TxStarter,
+	fn func(pgx.Tx) error,
+) error {
+	return InTransactionWith(
+		ctx,
+		conn,
+		TxOpts{
+			TxOptions: pgx.TxOptions{AccessMode: pgx.ReadOnly},
+		},
+		fn,
+	)
+}
+
+// Begin transaction with options, if conn supports them
+func beginTx(ctx context.Context, conn TxStarter, opts pgx.TxOptions) (
+	tx pgx.Tx,
+	err error,
+) {
+	ctx, span := startSpan(ctx, SpanInfo{Name: SpanBegin})
+	defer func() {
+		span.End(err)
+	}()
+
+	if s, ok := conn.(TxOptionsStarter); ok {
+		return s.BeginTx(ctx, opts)
+	}
+	if opts != (pgx.TxOptions{}) {
+		err = fmt.Errorf(
+			"pg_util: %T does not support transaction options",
+			conn,
+		)
+		return
+	}
+	return conn.Begin(ctx)
+}
+
+// Run fn on tx and commit or roll back tx
+func runTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	opts *TxOpts,
+	fn func(pgx.Tx) error,
+) (err error) {
+	start := txStart()
+	tx = recordStatements(tx)
+	panicked := true
+	defer func() {
+		if !panicked {
+			return
+		}
+		rollbackErr := ErrTxPanic
+		if opts.RecoverPanics {
+			if p := recover(); p != nil {
+				err = &PanicError{p, debug.Stack()}
+				rollbackErr = err
+			}
+		}
+		rollbackTx(ctx, tx)
+		txEnd(start, tx, false, rollbackErr)
+		if opts.AfterRollback != nil {
+			opts.AfterRollback(ctx, rollbackErr)
+		}
+	}()
+
+	err = fn(tx)
+	if err == nil && opts.BeforeCommit != nil {
+		err = opts.BeforeCommit(ctx, tx)
+	}
+	if err != nil {
+		rollbackTx(ctx, tx)
+		goto rolledBack
+	}
+
+	// A failed commit rolls back the transaction
+	err = commitTx(ctx, tx)
+	if err != nil {
+		goto rolledBack
+	}
+	panicked = false
+	txEnd(start, tx, true, nil)
+	if opts.AfterCommit != nil {
+		opts.AfterCommit(ctx)
+	}
+	return
+
+rolledBack:
+	panicked = false
+	txEnd(start, tx, false, err)
+	if opts.AfterRollback != nil {
+		opts.AfterRollback(ctx, err)
+	}
+	return
+}
+
+// Run fn inside a named savepoint of tx. The savepoint is released, if fn
+// succeeds, and rolled back to on error or panic, keeping the rest of the
+// transaction intact. Makes partial failure handling inside a large
+// transaction explicit.
+//
+// Returns the error of fn, if any.
+func WithSavepoint(
+	ctx context.Context,
+	tx pgx.Tx,
+	name string,
+	fn func(pgx.Tx) error,
+) (err error) {
+	name = quoteName(name)
+	_, err = tx.Exec(ctx, "SAVEPOINT "+name)
+	if err != nil {
+		return
+	}
+
+	panicked := true
+	defer func() {
+		if panicked {
+			tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		}
+	}()
+
+	err = fn(tx)
+	panicked = false
+	if err != nil {
+		_, rbErr := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		if rbErr == nil {
+			_, rbErr = tx.Exec(ctx, "RELEASE SAVEPOINT "+name)
+		}
+		if rbErr != nil {
+			err = fmt.Errorf(
+				"pg_util: rolling back to savepoint: %s; original error: %w",
+				rbErr,
+				err,
+			)
+		}
+		return
+	}
+	_, err = tx.Exec(ctx, "RELEASE SAVEPOINT "+name)
+	return
+}
+
+// Run fn with the statement_timeout of tx set to d and restore the previous
+// value afterwards. Bounds individual risky queries without changing
+// connection-wide settings.
+//
+// The previous value is restored, even if fn returns an error, unless the
+// transaction is aborted or already ended by then. In both cases the setting
+// is reverted with the transaction anyway.
+func WithStatementTimeout(
+	ctx context.Context,
+	tx pgx.Tx,
+	d time.Duration,
+	fn func(pgx.Tx) error,
+) (err error) {
+	var prev, set string
+	err = tx.
+		QueryRow(
+			ctx,
+			"SELECT current_setting('statement_timeout'), "+
+				"set_config('statement_timeout', $1, true)",
+			strconv.FormatInt(d.Milliseconds(), 10),
+		).
+		Scan(&prev, &set)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		// Restoring in an aborted transaction would fail. Adapters not backed
+		// by a pgx connection do not expose it, so always restore on them.
+		if conn := tx.Conn(); conn != nil &&
+			conn.PgConn().TxStatus() != 'T' {
+			return
+		}
+		_, rErr := tx.Exec(
+			ctx,
+			`SELECT set_config('statement_timeout', $1, true)`,
+			prev,
+		)
+		if err == nil {
+			err = rErr
+		}
+	}()
+	return fn(tx)
+}
+
+// Context key of the transaction started by InTransactionCtx
+type txContextKey struct{}
+
+// Return the transaction stored in ctx by InTransactionCtx, if any
+func TxFromContext(ctx context.Context) (tx pgx.Tx, ok bool) {
+	tx, ok = ctx.Value(txContextKey{}).(pgx.Tx)
+	return
+}
+
+// Like InTransaction, but stores the transaction in the context passed to fn.
+// If ctx already carries a transaction, a nested pseudotransaction via
+// savepoints is started on it instead of using conn. This lets functions
+// compose without knowing, if they are already running inside a transaction.
+func InTransactionCtx(
+	ctx context.Context,
+	conn TxStarter,
+	fn func(context.Context, pgx.Tx) error,
+) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		conn = tx
+	}
+	return InTransaction(ctx, conn, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txContextKey{}, tx), tx)
+	})
+}
+
+// Set configuration parameters for the rest of the transaction, like
+// SET LOCAL, in a single statement. Names and values are passed as arguments,
+// so no quoting is required.
+// Example: SetLocal(ctx, tx, map[string]string{"search_path": "app"})
+func SetLocal(
+	ctx context.Context,
+	tx pgx.Tx,
+	settings map[string]string,
+) (err error) {
+	if len(settings) == 0 {
+		return
+	}
+
+	// Sort for deterministic statements
+	names := make([]string, 0, len(settings))
+	for k := range settings {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var w strings.Builder
+	args := make([]interface{}, 0, len(settings)*2)
+	w.WriteString("SELECT ")
+	for i, k := range names {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		fmt.Fprintf(&w, "set_config($%d,$%d,true)", i*2+1, i*2+2)
+		args = append(args, k, settings[k])
+	}
+	_, err = tx.Exec(ctx, w.String(), args...)
+	return
+}
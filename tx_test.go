@@ -0,0 +1,445 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestInTransactionWithHooks(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	errFail := errors.New("fail")
+
+	cases := [...]struct {
+		name                string
+		fnErr, beforeCommit error
+		calls               string
+		err                 error
+	}{
+		{
+			name:  "commit",
+			calls: "fn,before,commit",
+		},
+		{
+			name:  "fn error",
+			fnErr: errFail,
+			calls: "fn,rollback",
+			err:   errFail,
+		},
+		{
+			name:         "before commit error",
+			beforeCommit: errFail,
+			calls:        "fn,before,rollback",
+			err:          errFail,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			var calls string
+			add := func(s string) {
+				if calls != "" {
+					calls += ","
+				}
+				calls += s
+			}
+
+			err := InTransactionWith(
+				context.Background(),
+				conn,
+				TxOpts{
+					BeforeCommit: func(context.Context, pgx.Tx) error {
+						add("before")
+						return c.beforeCommit
+					},
+					AfterCommit: func(context.Context) {
+						add("commit")
+					},
+					AfterRollback: func(_ context.Context, err error) {
+						if err != c.err {
+							t.Fatalf("rollback error mismatch: %v", err)
+						}
+						add("rollback")
+					},
+				},
+				func(tx pgx.Tx) error {
+					add("fn")
+					return c.fnErr
+				},
+			)
+			if err != c.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if calls != c.calls {
+				t.Fatalf("call order mismatch: %s != %s", calls, c.calls)
+			}
+		})
+	}
+}
+
+func TestInTransactionRecoverPanics(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	errFail := errors.New("fail")
+	var rollbackErr error
+	err = InTransactionWith(
+		context.Background(),
+		conn,
+		TxOpts{
+			RecoverPanics: true,
+			AfterRollback: func(_ context.Context, err error) {
+				rollbackErr = err
+			},
+		},
+		func(tx pgx.Tx) error {
+			panic(errFail)
+		},
+	)
+	var pErr *PanicError
+	if !errors.As(err, &pErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(err, ErrTxPanic) || !errors.Is(err, errFail) {
+		t.Fatalf("error does not match: %v", err)
+	}
+	if len(pErr.Stack) == 0 {
+		t.Fatal("no stack trace")
+	}
+	if rollbackErr != err {
+		t.Fatalf("rollback error mismatch: %v", rollbackErr)
+	}
+}
+
+func TestWithSavepoint(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	errFail := errors.New("fail")
+	err = InTransaction(context.Background(), conn, func(tx pgx.Tx) (err error) {
+		_, err = tx.Exec(
+			context.Background(),
+			`create temp table savepoint_test (id int) on commit drop`,
+		)
+		if err != nil {
+			return
+		}
+		insert := func(id int) func(pgx.Tx) error {
+			return func(tx pgx.Tx) (err error) {
+				_, err = tx.Exec(
+					context.Background(),
+					`insert into savepoint_test values ($1)`,
+					id,
+				)
+				return
+			}
+		}
+
+		err = WithSavepoint(context.Background(), tx, "a", insert(1))
+		if err != nil {
+			return
+		}
+		err = WithSavepoint(
+			context.Background(),
+			tx,
+			"b",
+			func(tx pgx.Tx) error {
+				if err := insert(2)(tx); err != nil {
+					return err
+				}
+				return errFail
+			},
+		)
+		if err != errFail {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var n int
+		err = tx.
+			QueryRow(context.Background(), `select count(*) from savepoint_test`).
+			Scan(&n)
+		if err != nil {
+			return
+		}
+		if n != 1 {
+			t.Fatalf("row count mismatch: %d != 1", n)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(context.Background(), conn, func(tx pgx.Tx) (err error) {
+		show := func() (s string) {
+			err := tx.
+				QueryRow(context.Background(), "show statement_timeout").
+				Scan(&s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+
+		prev := show()
+		err = WithStatementTimeout(
+			context.Background(),
+			tx,
+			1500*time.Millisecond,
+			func(tx pgx.Tx) error {
+				if s := show(); s != "1500ms" {
+					t.Fatalf("timeout not set: %s", s)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return
+		}
+		if s := show(); s != prev {
+			t.Fatalf("timeout not restored: %s != %s", s, prev)
+		}
+
+		// Restored on errors, that do not abort the transaction
+		errFn := errors.New("fn")
+		err = WithStatementTimeout(
+			context.Background(),
+			tx,
+			time.Second,
+			func(pgx.Tx) error {
+				return errFn
+			},
+		)
+		if err != errFn {
+			t.Fatalf("error mismatch: %v", err)
+		}
+		if s := show(); s != prev {
+			t.Fatalf("timeout not restored after error: %s != %s", s, prev)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInReadOnlyTransaction(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InReadOnlyTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(
+				context.Background(),
+				"create temp table read_only_test (id int)",
+			)
+			return
+		},
+	)
+	if ExtractException(err) == "" {
+		t.Fatalf("write not rejected: %v", err)
+	}
+
+	err = InTransactionWith(
+		context.Background(),
+		conn,
+		TxOpts{StatementTimeout: 10 * time.Millisecond},
+		func(tx pgx.Tx) (err error) {
+			_, err = tx.Exec(context.Background(), "select pg_sleep(1)")
+			return
+		},
+	)
+	if ExtractException(err) == "" {
+		t.Fatalf("statement not timed out: %v", err)
+	}
+}
+
+func TestInTransactionCtx(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, ok := TxFromContext(context.Background()); ok {
+		t.Fatal("transaction in empty context")
+	}
+
+	errFail := errors.New("fail")
+	err = InTransactionCtx(
+		context.Background(),
+		conn,
+		func(ctx context.Context, outer pgx.Tx) (err error) {
+			if tx, ok := TxFromContext(ctx); !ok || tx != outer {
+				t.Fatal("transaction not stored in context")
+			}
+			_, err = outer.Exec(
+				ctx,
+				"create temp table tx_ctx_test (id int) on commit drop",
+			)
+			if err != nil {
+				return
+			}
+
+			// Nested call must use a savepoint and only roll back its own
+			// changes
+			err = InTransactionCtx(
+				ctx,
+				conn,
+				func(ctx context.Context, tx pgx.Tx) (err error) {
+					_, err = tx.Exec(ctx, "insert into tx_ctx_test values (1)")
+					if err != nil {
+						return
+					}
+					return errFail
+				},
+			)
+			if err != errFail {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var n int
+			err = outer.
+				QueryRow(ctx, "select count(*) from tx_ctx_test").
+				Scan(&n)
+			if err != nil {
+				return
+			}
+			if n != 0 {
+				t.Fatalf("nested transaction not rolled back: %d", n)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetachedContext(t *testing.T) {
+	t.Parallel()
+
+	type key struct{}
+	parent, cancel := context.WithCancel(
+		context.WithValue(context.Background(), key{}, 1),
+	)
+	cancel()
+
+	ctx := detachedContext{parent}
+	if ctx.Err() != nil || ctx.Done() != nil {
+		t.Fatal("detached context cancelled")
+	}
+	if v := ctx.Value(key{}); v != 1 {
+		t.Fatalf("value mismatch: %v != 1", v)
+	}
+}
+
+func TestInTransactionTimeout(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	start := time.Now()
+	err = InTransactionTimeout(
+		context.Background(),
+		conn,
+		100*time.Millisecond,
+		func(ctx context.Context, tx pgx.Tx) (err error) {
+			_, err = tx.Exec(ctx, "select pg_sleep(10)")
+			return
+		},
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("transaction not cancelled: %s", d)
+	}
+}
+
+func TestSetLocal(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransactionWith(
+		context.Background(),
+		conn,
+		TxOpts{
+			StatementTimeout: time.Minute,
+			Settings: map[string]string{
+				"application_name": "it's quoted",
+				"search_path":      "public",
+			},
+		},
+		func(tx pgx.Tx) (err error) {
+			var name, path, timeout string
+			err = tx.
+				QueryRow(
+					context.Background(),
+					`select current_setting('application_name'),
+						current_setting('search_path'),
+						current_setting('statement_timeout')`,
+				).
+				Scan(&name, &path, &timeout)
+			if err != nil {
+				return
+			}
+			if name != "it's quoted" || path != "public" || timeout != "1min" {
+				t.Fatalf("unexpected settings: %s %s %s", name, path, timeout)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
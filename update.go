@@ -0,0 +1,332 @@
+package pg_util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	updateByPKCache, deleteByPKCache sync.Map
+
+	// Data struct has no fields tagged with `db:",pk"`
+	ErrNoPrimaryKey = errors.New("pg_util: no primary key fields")
+
+	// Data struct has no columns to write
+	ErrNoColumns = errors.New("pg_util: no columns to write")
+)
+
+// Options for building UPDATE or DELETE statements for a single row matched
+// by its primary key
+type ByPKOpts struct {
+	// Table to modify
+	Table string
+
+	// Struct with the row's fields. Uses the same semantics as InsertOpts.Data.
+	//
+	// Fields tagged with ",pk" after the name form the primary key and are
+	// used to build the WHERE clause. Examples: `db:"id,pk"` `db:",pk"`
+	//
+	// Columns with an ",expr=" tag option are set to the raw SQL expression.
+	Data interface{}
+
+	// Double-quote all column names, including ones not set through a tag,
+	// preserving the exact case of Go field names. By default such names are
+	// left unquoted and thus folded to lowercase by Postgres.
+	QuoteAll bool
+
+	// Add a RETURNING clause for all columns, so UpdateByPK refreshes Data
+	// with values set by defaults, triggers and generated columns after the
+	// write. Data must be a pointer to a struct for the refresh to happen.
+	// Ignored by BuildDeleteByPK.
+	Refresh bool
+
+	// Optional prefix to statement
+	Prefix string
+
+	// Optional common table expressions to prepend to the statement as a WITH
+	// clause. Written after Prefix. Placeholders and arguments of all CTEs are
+	// renumbered automatically and their arguments prepended to the returned
+	// arguments.
+	CTEs []CTE
+
+	// Optional struct, whose non-zero fields are added as ANDed equality
+	// conditions. See BuildWhere.
+	Cond interface{}
+
+	// Shift generated placeholders by ArgOffset, so the statement can be
+	// appended to other SQL, whose arguments occupy the first ArgOffset
+	// positions. The returned arguments do not include these.
+	ArgOffset int
+
+	// Optional suffix to statement. Must not contain a RETURNING clause, if
+	// Refresh is set.
+	Suffix string
+}
+
+// Key for caching statements built from ByPKOpts
+type byPKCacheKey struct {
+	table, prefix, suffix, ctes, cond string
+	argOffset                         int
+	quoteAll, refresh                 bool
+	typ                               reflect.Type
+}
+
+// Build and cache an UPDATE statement, that sets all non-primary key columns
+// of the row matched by the primary key columns of Data.
+//
+// See ByPKOpts for further documentation.
+func BuildUpdateByPK(o ByPKOpts) (sql string, args []interface{}, err error) {
+	var (
+		start  = buildStart()
+		cached bool
+	)
+	defer func() {
+		reportBuild("BuildUpdateByPK", start, sql, len(args), cached)
+	}()
+
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return
+	}
+
+	var set, pk []*columnMeta
+	for i := range meta.columns {
+		c := &meta.columns[i]
+		switch {
+		case c.pk:
+			pk = append(pk, c)
+		case !c.generated && !c.readOnly:
+			set = append(set, c)
+		}
+	}
+	switch {
+	case len(pk) == 0:
+		err = ErrNoPrimaryKey
+		return
+	case len(set) == 0:
+		err = ErrNoColumns
+		return
+	}
+
+	args = cteArgs(o.CTEs)
+	argOffset := o.ArgOffset + len(args)
+	for _, c := range set {
+		if c.expr == "" {
+			args, err = c.appendValue(args, v)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, c := range pk {
+		args, err = c.appendValue(args, v)
+		if err != nil {
+			return
+		}
+	}
+	cond, err := appendCond(&args, &o)
+	if err != nil {
+		return
+	}
+
+	k := byPKCacheKey{
+		o.Table,
+		o.Prefix,
+		o.Suffix,
+		ctesCacheKey(o.CTEs),
+		cond,
+		o.ArgOffset,
+		o.QuoteAll,
+		o.Refresh,
+		v.Type(),
+	}
+	if _sql, ok := updateByPKCache.Load(k); ok {
+		sql = _sql.(string)
+		cached = true
+		return
+	}
+
+	var w strings.Builder
+	writePrefix(&w, o.Prefix)
+	writeCTEs(&w, o.CTEs, o.ArgOffset)
+	w.WriteString("UPDATE ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(" SET ")
+	arg := argOffset
+	for i, c := range set {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		c.writeName(&w, o.QuoteAll)
+		w.WriteByte('=')
+		if c.expr != "" {
+			w.WriteString(c.expr)
+		} else {
+			c.writePlaceholder(&w, arg)
+			arg++
+		}
+	}
+	writePKCondition(&w, pk, arg, o.QuoteAll)
+	writeCond(&w, cond)
+	var returning []*columnMeta
+	if o.Refresh {
+		returning = meta.all
+	}
+	err = writeSuffixReturning(&w, o.Suffix, returning, o.QuoteAll)
+	if err != nil {
+		return
+	}
+
+	sql = w.String()
+	updateByPKCache.Store(k, sql)
+	return
+}
+
+// Build and execute an UPDATE statement for the row matched by the primary
+// key columns of Data.
+//
+// If Refresh is set and Data is a pointer to a struct, all columns are scanned
+// back into Data from the RETURNING clause. In this case ErrNoRows is
+// returned, if no row matched.
+//
+// See ByPKOpts for further documentation.
+func UpdateByPK(ctx context.Context, q Querier, o ByPKOpts) (err error) {
+	sql, args, err := BuildUpdateByPK(o)
+	if err != nil {
+		return
+	}
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return
+	}
+	var returning []*columnMeta
+	if o.Refresh {
+		returning = meta.all
+	}
+	return execReturning(ctx, q, sql, args, v, returning)
+}
+
+// Build and cache a DELETE statement for the row matched by the primary key
+// columns of Data.
+//
+// See ByPKOpts for further documentation.
+func BuildDeleteByPK(o ByPKOpts) (sql string, args []interface{}, err error) {
+	var (
+		start  = buildStart()
+		cached bool
+	)
+	defer func() {
+		reportBuild("BuildDeleteByPK", start, sql, len(args), cached)
+	}()
+
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return
+	}
+
+	var pk []*columnMeta
+	args = cteArgs(o.CTEs)
+	argOffset := o.ArgOffset + len(args)
+	for i := range meta.columns {
+		if c := &meta.columns[i]; c.pk {
+			pk = append(pk, c)
+			args, err = c.appendValue(args, v)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if len(pk) == 0 {
+		err = ErrNoPrimaryKey
+		return
+	}
+	cond, err := appendCond(&args, &o)
+	if err != nil {
+		return
+	}
+
+	k := byPKCacheKey{
+		o.Table,
+		o.Prefix,
+		o.Suffix,
+		ctesCacheKey(o.CTEs),
+		cond,
+		o.ArgOffset,
+		o.QuoteAll,
+		false,
+		v.Type(),
+	}
+	if _sql, ok := deleteByPKCache.Load(k); ok {
+		sql = _sql.(string)
+		cached = true
+		return
+	}
+
+	var w strings.Builder
+	writePrefix(&w, o.Prefix)
+	writeCTEs(&w, o.CTEs, o.ArgOffset)
+	w.WriteString("DELETE FROM ")
+	w.WriteString(quoteIdentifier(o.Table))
+	writePKCondition(&w, pk, argOffset, o.QuoteAll)
+	writeCond(&w, cond)
+	writeSuffix(&w, o.Suffix)
+
+	sql = w.String()
+	deleteByPKCache.Store(k, sql)
+	return
+}
+
+// Build conditions from o.Cond, if any, and append their arguments to args
+func appendCond(args *[]interface{}, o *ByPKOpts) (cond string, err error) {
+	if o.Cond == nil {
+		return
+	}
+	cond, condArgs, err := buildWhere(
+		o.Cond,
+		o.ArgOffset+len(*args),
+		o.QuoteAll,
+	)
+	if err != nil {
+		return
+	}
+	*args = append(*args, condArgs...)
+	return
+}
+
+// Write additional ANDed conditions, if any
+func writeCond(w *strings.Builder, cond string) {
+	if cond != "" {
+		w.WriteString(" AND ")
+		w.WriteString(cond)
+	}
+}
+
+// Write WHERE clause matching all primary key columns. Placeholders start at
+// $offset+1.
+func writePKCondition(
+	w *strings.Builder,
+	pk []*columnMeta,
+	offset int,
+	quoteAll bool,
+) {
+	w.WriteString(" WHERE ")
+	for i, c := range pk {
+		if i != 0 {
+			w.WriteString(" AND ")
+		}
+		c.writeName(w, quoteAll)
+		w.WriteByte('=')
+		c.writePlaceholder(w, offset+i)
+	}
+}
@@ -0,0 +1,292 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestBuildByPK(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID   int `db:"id,pk"`
+		Name string
+		Tag  string `db:"tag,pk"`
+	}
+
+	type builder func(ByPKOpts) (string, []interface{}, error)
+
+	cases := [...]struct {
+		name, sql string
+		build     builder
+		args      []interface{}
+	}{
+		{
+			name:  "update",
+			build: BuildUpdateByPK,
+			sql:   `UPDATE "t1" SET Name=$1 WHERE "id"=$2 AND "tag"=$3`,
+			args:  []interface{}{"aaa", 1, "x"},
+		},
+		{
+			name:  "delete",
+			build: BuildDeleteByPK,
+			sql:   `DELETE FROM "t1" WHERE "id"=$1 AND "tag"=$2`,
+			args:  []interface{}{1, "x"},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			q, args, err := c.build(ByPKOpts{
+				Table: "t1",
+				Data:  row{1, "aaa", "x"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", q, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, c.args)
+			}
+		})
+	}
+}
+
+func TestBuildUpdateByPKExpression(t *testing.T) {
+	t.Parallel()
+
+	q, args, err := BuildUpdateByPK(ByPKOpts{
+		Table: "t1",
+		Data: struct {
+			ID        int `db:"id,pk"`
+			UpdatedAt int `db:"updated_at,expr=now()"`
+			Name      string
+		}{1, 0, "aaa"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `UPDATE "t1" SET "updated_at"=now(),Name=$1 WHERE "id"=$2`
+	if q != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", q, std)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"aaa", 1}) {
+		t.Fatalf("argument list mismatch: `%+v`", args)
+	}
+}
+
+func TestBuildByPKErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name string
+		data interface{}
+		err  error
+	}{
+		{
+			name: "no primary key",
+			data: struct{ F1 int }{1},
+			err:  ErrNoPrimaryKey,
+		},
+		{
+			name: "only primary key",
+			data: struct {
+				ID int `db:"id,pk"`
+			}{1},
+			err: ErrNoColumns,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := BuildUpdateByPK(ByPKOpts{Table: "t1", Data: c.data})
+			if err != c.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	data := struct {
+		ID int `db:"id,pk"`
+		F1 int
+	}{1, 2}
+	_, _, err := BuildUpdateByPK(ByPKOpts{Data: data})
+	if err != ErrNoTable {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	_, _, err = BuildDeleteByPK(ByPKOpts{Data: data})
+	if err != ErrNoTable {
+		t.Fatalf("unexpected delete error: %v", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID      int `db:"id,pk"`
+		Name    string
+		Counter int `db:"counter,readonly"`
+	}
+
+	cases := [...]struct {
+		name, sql string
+		build     func() (string, []interface{}, error)
+	}{
+		{
+			name: "insert",
+			build: func() (string, []interface{}, error) {
+				return BuildInsertT(InsertOptsT[row]{Table: "t9"})
+			},
+			sql: `INSERT INTO "t9" ("id",Name) VALUES ($1,$2)`,
+		},
+		{
+			name: "update",
+			build: func() (string, []interface{}, error) {
+				return BuildUpdateByPK(ByPKOpts{Table: "t9", Data: row{}})
+			},
+			sql: `UPDATE "t9" SET Name=$1 WHERE "id"=$2`,
+		},
+		{
+			name: "select",
+			build: func() (string, []interface{}, error) {
+				return BuildSelect(SelectOpts{Table: "t9", Columns: row{}})
+			},
+			sql: `SELECT "id",Name,"counter" FROM "t9"`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			q, _, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", q, c.sql)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID      int `db:"id,pk"`
+		Name    string
+		Updated int `db:"updated,readonly"`
+	}
+
+	cases := [...]struct {
+		name, sql string
+		build     func() (string, []interface{}, error)
+	}{
+		{
+			name: "insert",
+			build: func() (string, []interface{}, error) {
+				return BuildInsertT(InsertOptsT[row]{
+					Table:   "t12",
+					Refresh: true,
+				})
+			},
+			sql: `INSERT INTO "t12" ("id",Name) VALUES ($1,$2) ` +
+				`RETURNING "id",Name,"updated"`,
+		},
+		{
+			name: "update",
+			build: func() (string, []interface{}, error) {
+				return BuildUpdateByPK(ByPKOpts{
+					Table:   "t12",
+					Data:    &row{},
+					Refresh: true,
+				})
+			},
+			sql: `UPDATE "t12" SET Name=$1 WHERE "id"=$2 ` +
+				`RETURNING "id",Name,"updated"`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			q, _, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", q, c.sql)
+			}
+		})
+	}
+}
+
+func TestUpdateByPKRefresh(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	type row struct {
+		ID   int `db:"id,pk"`
+		Name string
+		Hits int `db:"hits,readonly"`
+	}
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			err = ExecAll(
+				context.Background(),
+				tx,
+				`create temp table update_refresh_test (
+					id int primary key,
+					name text not null,
+					hits int not null default 7
+				) on commit drop`,
+				`insert into update_refresh_test (id, name) values (1, 'a')`,
+			)
+			if err != nil {
+				return
+			}
+
+			r := row{ID: 1, Name: "b"}
+			err = UpdateByPK(context.Background(), tx, ByPKOpts{
+				Table:   "update_refresh_test",
+				Data:    &r,
+				Refresh: true,
+			})
+			if err != nil {
+				return
+			}
+			std := row{1, "b", 7}
+			if r != std {
+				t.Fatalf("row not refreshed: %+v != %+v", r, std)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,393 @@
+package pg_util
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var tempTableCounter uint64
+
+// Options for upserting a large batch of rows through a temporary table
+type BulkUpsertOpts struct {
+	// Table to upsert into. Required.
+	Table string
+
+	// Slice of structs or pointers to structs to upsert. Required.
+	//
+	// See InsertOpts.Data for column mapping rules. Columns with an ",expr="
+	// tag option are not copied and set to the expression instead. Generated
+	// columns are skipped.
+	Rows interface{}
+
+	// Use the exact case of Go field names for columns not set through a tag.
+	// By default such names are converted to lowercase, matching Postgres case
+	// folding of unquoted identifiers.
+	QuoteAll bool
+
+	// Columns of the conflict target. Defaults to the columns tagged with
+	// ",pk".
+	ConflictColumns []string
+
+	// Columns to update on conflict. Defaults to all columns not in
+	// ConflictColumns. If there are no columns to update, conflicting rows are
+	// skipped with DO NOTHING.
+	UpdateColumns []string
+
+	// Only update rows, if any of the updated columns differ from the
+	// existing row
+	OnlyChanged bool
+}
+
+// Upsert a large number of rows efficiently by copying them into a temporary
+// table with COPY and then executing
+// INSERT ... SELECT ... ON CONFLICT DO UPDATE against the target table.
+//
+// Must be run inside a transaction, as the temporary table is dropped on
+// commit. Returns the number of inserted or updated rows.
+//
+// See BulkUpsertOpts for further documentation.
+func BulkUpsert(ctx context.Context, tx pgx.Tx, o BulkUpsertOpts) (
+	n int64,
+	err error,
+) {
+	if o.Table == "" {
+		err = ErrNoTable
+		return
+	}
+	src, err := newStructCopySource(o.Rows)
+	if err != nil {
+		return
+	}
+	if src.Len() == 0 {
+		return
+	}
+
+	tmp := "pg_util_upsert_" +
+		strconv.FormatUint(atomic.AddUint64(&tempTableCounter, 1), 10)
+	cols := src.columnNames(o.QuoteAll)
+
+	// Only create the copied columns, so NOT NULL constraints of skipped
+	// columns do not reject the copied rows
+	var w strings.Builder
+	w.WriteString("CREATE TEMP TABLE ")
+	w.WriteString(quoteName(tmp))
+	w.WriteString(" ON COMMIT DROP AS SELECT ")
+	writeIdentifierList(&w, cols)
+	w.WriteString(" FROM ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(" WITH NO DATA")
+	_, err = tx.Exec(ctx, w.String())
+	if err != nil {
+		return
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{tmp}, cols, src)
+	if err != nil {
+		return
+	}
+
+	sql, err := buildBulkUpsert(&o, tmp, src.meta)
+	if err != nil {
+		return
+	}
+	tag, err := tx.Exec(ctx, sql)
+	if err != nil {
+		return
+	}
+	n = tag.RowsAffected()
+	return
+}
+
+// Build INSERT ... SELECT ... ON CONFLICT statement copying rows from table
+// tmp into the target table
+func buildBulkUpsert(o *BulkUpsertOpts, tmp string, meta *structMeta) (
+	sql string,
+	err error,
+) {
+	conflict, update, err := resolveUpsertColumns(
+		meta,
+		o.ConflictColumns,
+		o.UpdateColumns,
+		o.QuoteAll,
+	)
+	if err != nil {
+		return
+	}
+
+	var w strings.Builder
+	w.WriteString("INSERT INTO ")
+	w.WriteString(quoteIdentifier(o.Table))
+	w.WriteString(" (")
+	for i, c := range meta.writable {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(quoteName(c.identifier(o.QuoteAll)))
+	}
+	w.WriteString(") SELECT ")
+	for i, c := range meta.writable {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		if c.expr != "" {
+			w.WriteString(c.expr)
+		} else {
+			w.WriteString(quoteName(c.identifier(o.QuoteAll)))
+		}
+	}
+	w.WriteString(" FROM ")
+	w.WriteString(quoteName(tmp))
+	w.WriteByte(' ')
+	writeOnConflict(&w, o.Table, conflict, update, o.OnlyChanged)
+
+	sql = w.String()
+	return
+}
+
+// Resolve conflict target and updated columns, applying defaults, if not set
+func resolveUpsertColumns(
+	meta *structMeta,
+	conflict, update []string,
+	quoteAll bool,
+) (
+	[]string,
+	[]string,
+	error,
+) {
+	if len(conflict) == 0 {
+		for i := range meta.columns {
+			if c := &meta.columns[i]; c.pk {
+				conflict = append(conflict, c.identifier(quoteAll))
+			}
+		}
+		if len(conflict) == 0 {
+			return nil, nil, ErrNoPrimaryKey
+		}
+	}
+
+	if update == nil {
+		isConflict := make(map[string]bool, len(conflict))
+		for _, c := range conflict {
+			isConflict[c] = true
+		}
+		for _, c := range meta.writable {
+			if id := c.identifier(quoteAll); !isConflict[id] {
+				update = append(update, id)
+			}
+		}
+	}
+	return conflict, update, nil
+}
+
+// Write ON CONFLICT clause updating columns of table from the excluded row or
+// doing nothing, if there are no columns to update.
+// If onlyChanged is set, rows are only updated, if any of the columns differ.
+func writeOnConflict(
+	w *strings.Builder,
+	table string,
+	conflict, update []string,
+	onlyChanged bool,
+) {
+	w.WriteString("ON CONFLICT (")
+	writeIdentifierList(w, conflict)
+	w.WriteString(") DO ")
+	if len(update) == 0 {
+		w.WriteString("NOTHING")
+		return
+	}
+
+	w.WriteString("UPDATE SET ")
+	for i, c := range update {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		c = quoteName(c)
+		w.WriteString(c)
+		w.WriteString("=EXCLUDED.")
+		w.WriteString(c)
+	}
+	if onlyChanged {
+		table = quoteIdentifier(table)
+		w.WriteString(" WHERE (")
+		for i, c := range update {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(table)
+			w.WriteByte('.')
+			w.WriteString(quoteName(c))
+		}
+		w.WriteString(") IS DISTINCT FROM (")
+		for i, c := range update {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString("EXCLUDED.")
+			w.WriteString(quoteName(c))
+		}
+		w.WriteByte(')')
+	}
+}
+
+// Options for building a single row upsert statement
+type UpsertOpts struct {
+	// Insert statement options. Suffix is written after the ON CONFLICT
+	// clause.
+	InsertOpts
+
+	// Columns of the conflict target. Defaults to the columns tagged with
+	// ",pk".
+	ConflictColumns []string
+
+	// Columns to update on conflict. Defaults to all columns not in
+	// ConflictColumns. If there are no columns to update, conflicting rows are
+	// skipped with DO NOTHING.
+	UpdateColumns []string
+
+	// Only update the row, if any of the updated columns differ from the
+	// existing row. Avoids write amplification, trigger execution and
+	// bumping of columns like updated_at for no-op updates.
+	OnlyChanged bool
+}
+
+// Build and cache INSERT ... ON CONFLICT statement for all fields of Data.
+//
+// See UpsertOpts and InsertOpts for further documentation.
+func BuildUpsert(o UpsertOpts) (sql string, args []interface{}, err error) {
+	v, meta, err := getDataMeta(o.Data)
+	if err != nil {
+		return
+	}
+	conflict, update, err := resolveUpsertColumns(
+		meta,
+		o.ConflictColumns,
+		o.UpdateColumns,
+		o.QuoteAll,
+	)
+	if err != nil {
+		return
+	}
+
+	var w strings.Builder
+	writeOnConflict(&w, o.Table, conflict, update, o.OnlyChanged)
+	writeSuffix(&w, o.Suffix)
+	o.Suffix = w.String()
+	return buildInsert("BuildUpsert", &o.InsertOpts, v, meta)
+}
+
+// Write comma-separated list of quoted single-part identifiers, like columns
+func writeIdentifierList(w *strings.Builder, ids []string) {
+	for i, id := range ids {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(quoteName(id))
+	}
+}
+
+// Write comma-separated list of quoted, optionally schema-qualified, tables
+func writeTableList(w *strings.Builder, tables []string) {
+	for i, t := range tables {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(quoteIdentifier(t))
+	}
+}
+
+// pgx.CopyFromSource over a slice of structs
+type structCopySource struct {
+	meta   *structMeta
+	rows   reflect.Value
+	deref  bool
+	i      int
+	values []interface{}
+	err    error
+}
+
+// Create a pgx.CopyFromSource over a slice of structs or pointers to structs.
+// Columns with raw SQL expressions are skipped.
+func newStructCopySource(rows interface{}) (s *structCopySource, err error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		err = fmt.Errorf("pg_util: rows must be a slice, got %T", rows)
+		return
+	}
+	t := v.Type().Elem()
+	deref := t.Kind() == reflect.Ptr
+	if deref {
+		t = t.Elem()
+	}
+	meta, err := getStructMeta(t)
+	if err != nil {
+		return
+	}
+	s = &structCopySource{
+		meta:  meta,
+		rows:  v,
+		deref: deref,
+		i:     -1,
+	}
+	return
+}
+
+// Number of rows in the source
+func (s *structCopySource) Len() int {
+	return s.rows.Len()
+}
+
+// Names of the copied columns as unquoted identifiers
+func (s *structCopySource) columnNames(quoteAll bool) (names []string) {
+	for _, c := range s.meta.writable {
+		if c.expr == "" {
+			names = append(names, c.identifier(quoteAll))
+		}
+	}
+	return
+}
+
+func (s *structCopySource) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	s.i++
+	return s.i < s.rows.Len()
+}
+
+func (s *structCopySource) Values() (values []interface{}, err error) {
+	row := s.rows.Index(s.i)
+	if s.deref {
+		if row.IsNil() {
+			s.err = fmt.Errorf("pg_util: nil row at index %d", s.i)
+			return nil, s.err
+		}
+		row = row.Elem()
+	}
+	row, err = runBeforeInsert(&InsertOpts{}, row, s.meta)
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	s.values = s.values[:0]
+	for _, c := range s.meta.writable {
+		if c.expr == "" {
+			s.values, err = c.appendValue(s.values, row)
+			if err != nil {
+				s.err = err
+				return
+			}
+		}
+	}
+	return s.values, nil
+}
+
+func (s *structCopySource) Err() error {
+	return s.err
+}
@@ -0,0 +1,216 @@
+package pg_util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type upsertRow struct {
+	ID        int `db:"id,pk"`
+	Name      string
+	UpdatedAt int `db:"updated_at,expr=now()"`
+}
+
+func TestBuildBulkUpsert(t *testing.T) {
+	t.Parallel()
+
+	meta, err := getStructMeta(reflect.TypeOf(upsertRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const prefix = `INSERT INTO "t1" ("id","name","updated_at") ` +
+		`SELECT "id","name",now() FROM "tmp" `
+	cases := [...]struct {
+		name, sql string
+		opts      BulkUpsertOpts
+	}{
+		{
+			name: "defaults",
+			sql: prefix + `ON CONFLICT ("id") DO UPDATE SET ` +
+				`"name"=EXCLUDED."name","updated_at"=EXCLUDED."updated_at"`,
+		},
+		{
+			name: "explicit columns",
+			opts: BulkUpsertOpts{
+				ConflictColumns: []string{"name"},
+				UpdateColumns:   []string{"updated_at"},
+			},
+			sql: prefix + `ON CONFLICT ("name") DO UPDATE SET ` +
+				`"updated_at"=EXCLUDED."updated_at"`,
+		},
+		{
+			name: "only changed",
+			opts: BulkUpsertOpts{
+				UpdateColumns: []string{"name", "updated_at"},
+				OnlyChanged:   true,
+			},
+			sql: prefix + `ON CONFLICT ("id") DO UPDATE SET ` +
+				`"name"=EXCLUDED."name","updated_at"=EXCLUDED."updated_at" ` +
+				`WHERE ("t1"."name","t1"."updated_at") IS DISTINCT FROM ` +
+				`(EXCLUDED."name",EXCLUDED."updated_at")`,
+		},
+		{
+			name: "do nothing",
+			opts: BulkUpsertOpts{
+				UpdateColumns: []string{},
+			},
+			sql: prefix + `ON CONFLICT ("id") DO NOTHING`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			c.opts.Table = "t1"
+			sql, err := buildBulkUpsert(&c.opts, "tmp", meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+		})
+	}
+}
+
+func TestBulkUpsert(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (err error) {
+			err = ExecAll(
+				context.Background(),
+				tx,
+				`create temp table bulk_upsert_test (
+					id int primary key,
+					name text not null,
+					updated_at timestamptz not null
+				) on commit drop`,
+				`insert into bulk_upsert_test (id, name, updated_at)
+				values (1, 'old', now())`,
+			)
+			if err != nil {
+				return
+			}
+
+			n, err := BulkUpsert(context.Background(), tx, BulkUpsertOpts{
+				Table: "bulk_upsert_test",
+				Rows: []upsertRow{
+					{ID: 1, Name: "new"},
+					{ID: 2, Name: "inserted"},
+				},
+			})
+			if err != nil {
+				return
+			}
+			if n != 2 {
+				t.Fatalf("unexpected affected row count: %d", n)
+			}
+
+			var name string
+			err = tx.
+				QueryRow(
+					context.Background(),
+					`select name from bulk_upsert_test where id = 1`,
+				).
+				Scan(&name)
+			if err != nil {
+				return
+			}
+			if name != "new" {
+				t.Fatalf("row not updated: %s", name)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildUpsert(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name, sql string
+		opts      UpsertOpts
+	}{
+		{
+			name: "defaults",
+			opts: UpsertOpts{
+				InsertOpts: InsertOpts{
+					Table: "t11",
+					Data:  upsertRow{ID: 1, Name: "a"},
+				},
+			},
+			sql: `INSERT INTO "t11" ("id",Name,"updated_at") ` +
+				`VALUES ($1,$2,now()) ON CONFLICT ("id") DO UPDATE SET ` +
+				`"name"=EXCLUDED."name","updated_at"=EXCLUDED."updated_at"`,
+		},
+		{
+			name: "only changed",
+			opts: UpsertOpts{
+				InsertOpts: InsertOpts{
+					Table:  "t11",
+					Data:   upsertRow{ID: 1, Name: "a"},
+					Suffix: "RETURNING id",
+				},
+				UpdateColumns: []string{"name"},
+				OnlyChanged:   true,
+			},
+			sql: `INSERT INTO "t11" ("id",Name,"updated_at") ` +
+				`VALUES ($1,$2,now()) ON CONFLICT ("id") DO UPDATE SET ` +
+				`"name"=EXCLUDED."name" ` +
+				`WHERE ("t11"."name") IS DISTINCT FROM (EXCLUDED."name") ` +
+				`RETURNING id`,
+		},
+		{
+			name: "schema-qualified table",
+			opts: UpsertOpts{
+				InsertOpts: InsertOpts{
+					Table: "app.t11",
+					Data:  upsertRow{ID: 1, Name: "a"},
+				},
+				UpdateColumns: []string{"name"},
+				OnlyChanged:   true,
+			},
+			sql: `INSERT INTO "app"."t11" ("id",Name,"updated_at") ` +
+				`VALUES ($1,$2,now()) ON CONFLICT ("id") DO UPDATE SET ` +
+				`"name"=EXCLUDED."name" ` +
+				`WHERE ("app"."t11"."name") IS DISTINCT FROM ` +
+				`(EXCLUDED."name")`,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, args, err := BuildUpsert(c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, []interface{}{1, "a"}) {
+				t.Fatalf("argument list mismatch: `%+v`", args)
+			}
+		})
+	}
+}
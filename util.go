@@ -2,6 +2,10 @@ package pg_util
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
@@ -25,42 +29,249 @@ func InTransaction(
 	conn TxStarter,
 	fn func(pgx.Tx) error,
 ) (err error) {
-	tx, err := conn.Begin(ctx)
+	return InTransactionWith(ctx, conn, TxOpts{}, fn)
+}
+
+// Like InTransaction, but returns the result of fn. The zero value of T is
+// returned on error.
+func InTransactionValue[T any](
+	ctx context.Context,
+	conn TxStarter,
+	fn func(pgx.Tx) (T, error),
+) (val T, err error) {
+	err = InTransaction(ctx, conn, func(tx pgx.Tx) (err error) {
+		val, err = fn(tx)
+		return
+	})
 	if err != nil {
+		var zero T
+		val = zero
+	}
+	return
+}
+
+// Interface required to start a transaction with options, like *pgx.Conn or
+// *pgxpool.Pool
+type TxOptionsStarter interface {
+	TxStarter
+	BeginTx(context.Context, pgx.TxOptions) (pgx.Tx, error)
+}
+
+// Like InTransaction, but starts the transaction with options, like the
+// isolation level, access mode or deferrable mode.
+//
+// Nested pseudotransactions via savepoints do not support options, so conn
+// must implement TxOptionsStarter, unless opts is the zero value.
+func InTransactionOpts(
+	ctx context.Context,
+	conn TxStarter,
+	opts pgx.TxOptions,
+	fn func(pgx.Tx) error,
+) (err error) {
+	return InTransactionWith(ctx, conn, TxOpts{TxOptions: opts}, fn)
+}
+
+// Execute all SQL statement strings and return on first error, if any.
+// Errors are returned as *ExecError.
+func ExecAll(ctx context.Context, tx pgx.Tx, q ...string) error {
+	return ExecAllWith(ctx, tx, ExecOpts{}, q...)
+}
+
+// Options for ExecAllWith
+type ExecOpts struct {
+	// Maximum duration of each statement. Unlimited, if zero.
+	StatementTimeout time.Duration
+
+	// Maximum duration of all statements combined. Unlimited, if zero.
+	Timeout time.Duration
+}
+
+// Like ExecAll, but bounds the duration of each statement and all statements
+// combined, so a single runaway statement in a script can not hang forever.
+//
+// Statements are cancelled through their context, once a timeout is
+// exceeded. pgx closes the connection on cancellation, so the transaction
+// can not be used afterwards.
+func ExecAllWith(
+	ctx context.Context,
+	tx pgx.Tx,
+	opts ExecOpts,
+	q ...string,
+) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	for i, q := range q {
+		if err := execStatement(ctx, tx, opts, i, q); err != nil {
+			return newExecError(i, q, err)
+		}
+	}
+	return nil
+}
+
+// Execute statement q with index i of an ExecAllWith call
+func execStatement(
+	ctx context.Context,
+	tx pgx.Tx,
+	opts ExecOpts,
+	i int,
+	q string,
+) (err error) {
+	if opts.StatementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.StatementTimeout)
+		defer cancel()
+	}
+	ctx, span := startSpan(ctx, SpanInfo{
+		Name:  SpanExec,
+		SQL:   summarizeSQL(q),
+		Index: i,
+	})
+	err = timeStatement(q, func() (err error) {
+		_, err = tx.Exec(ctx, q)
 		return
+	})
+	span.End(err)
+	return
+}
+
+// Like ExecAll, but sends all statements in a single batch, reducing the
+// number of network round trips to one. Errors are returned as *ExecError for
+// the first failed statement.
+func ExecAllBatch(ctx context.Context, tx pgx.Tx, q ...string) (err error) {
+	if len(q) == 0 {
+		return
+	}
+	var batch pgx.Batch
+	for _, q := range q {
+		batch.Queue(q)
 	}
-	panicked := true
+	res := tx.SendBatch(ctx, &batch)
 	defer func() {
-		if panicked {
-			tx.Rollback(ctx)
+		closeErr := res.Close()
+		if err == nil {
+			err = closeErr
 		}
 	}()
+	for i, q := range q {
+		if _, err = res.Exec(); err != nil {
+			return newExecError(i, q, err)
+		}
+	}
+	return
+}
 
-	err = fn(tx)
-	if err != nil {
-		goto end
+// Maximum length of statements included in ExecError and traces
+const execErrorSQLLength = 64
+
+// Error returned by ExecAll, that specifies the failed statement
+type ExecError struct {
+	// Index of the statement
+	Index int
+
+	// Statement, truncated to a reasonable length
+	SQL string
+
+	// Underlying error
+	Err error
+}
+
+func newExecError(i int, sql string, err error) *ExecError {
+	return &ExecError{i, summarizeSQL(sql), err}
+}
+
+// Collapse whitespace in sql and truncate it to a reasonable length for
+// inclusion in errors and traces
+func summarizeSQL(sql string) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if r := []rune(sql); len(r) > execErrorSQLLength {
+		sql = string(r[:execErrorSQLLength]) + "..."
 	}
+	return sql
+}
 
-	err = tx.Commit(ctx)
-end:
-	panicked = false
-	return
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("pg_util: statement %d `%s`: %s", e.Index, e.SQL, e.Err)
 }
 
-// Execute all SQL statement strings and return on first error, if any.
-func ExecAll(ctx context.Context, tx pgx.Tx, q ...string) error {
-	for _, q := range q {
-		if _, err := tx.Exec(ctx, q); err != nil {
-			return err
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// Result of a single statement executed by ExecAllContinue
+type ExecResult struct {
+	// Command tag of the statement, if successful
+	Tag pgconn.CommandTag
+
+	// Error of the statement, if any
+	Err error
+}
+
+// Errors of all failed statements executed by ExecAllContinue
+type ExecErrors []*ExecError
+
+func (e ExecErrors) Error() string {
+	var w strings.Builder
+	fmt.Fprintf(&w, "pg_util: %d statements failed", len(e))
+	for _, err := range e {
+		w.WriteString("\n")
+		w.WriteString(err.Error())
+	}
+	return w.String()
+}
+
+// Execute all SQL statement strings, continuing on failures. Each statement is
+// run in its own savepoint, so failed statements do not abort the
+// transaction. Useful for best-effort cleanup scripts and idempotent DDL.
+//
+// Returns the result of each statement and ExecErrors, if any statements
+// failed. Context cancellation aborts execution.
+func ExecAllContinue(ctx context.Context, tx pgx.Tx, q ...string) (
+	results []ExecResult,
+	err error,
+) {
+	var errs ExecErrors
+	results = make([]ExecResult, len(q))
+	for i, q := range q {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		err = InTransaction(ctx, tx, func(tx pgx.Tx) (err error) {
+			results[i].Tag, err = tx.Exec(ctx, q)
+			return
+		})
+		if err != nil {
+			results[i].Err = err
+			errs = append(errs, newExecError(i, q, err))
 		}
 	}
-	return nil
+	if len(errs) != 0 {
+		err = errs
+	} else {
+		err = nil
+	}
+	return
 }
 
-// Try to extract an exception message, if err is *pgconn.PgError
+// Try to extract an exception message, if err is or wraps *pgconn.PgError
 func ExtractException(err error) string {
-	if err, ok := err.(*pgconn.PgError); ok {
-		return err.Message
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Message
 	}
 	return ""
 }
+
+// Quote an SQL identifier, escaping any double quotes in it. Identifiers
+// qualified with a schema, like "schema.table", are quoted per part.
+func quoteIdentifier(s string) string {
+	return pgx.Identifier(strings.Split(s, ".")).Sanitize()
+}
+
+// Quote a single-part SQL identifier, like a column, index or savepoint name,
+// escaping any double quotes in it. Dots are kept as part of the name.
+func quoteName(s string) string {
+	return pgx.Identifier{s}.Sanitize()
+}
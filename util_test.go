@@ -3,19 +3,29 @@ package pg_util
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-// Return database URL
+// Return database URL from test_config.json or, if the file does not exist,
+// the PG_UTIL_TEST_URL environment variable also read by package pgtest.
+// pgtest itself can not be used here, as it imports this package.
 func getURL(t *testing.T) string {
-
 	t.Helper()
 
 	f, err := os.Open("test_config.json")
+	if errors.Is(err, os.ErrNotExist) {
+		if u := os.Getenv("PG_UTIL_TEST_URL"); u != "" {
+			return u
+		}
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -114,3 +124,303 @@ func TestInTransactionPanic(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type beginOnly struct{}
+
+func (beginOnly) Begin(context.Context) (pgx.Tx, error) {
+	return nil, nil
+}
+
+func TestInTransactionOptsUnsupported(t *testing.T) {
+	t.Parallel()
+
+	err := InTransactionOpts(
+		context.Background(),
+		beginOnly{},
+		pgx.TxOptions{IsoLevel: pgx.Serializable},
+		func(pgx.Tx) error {
+			t.Fatal("function should not be called")
+			return nil
+		},
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestInTransactionOpts(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransactionOpts(
+		context.Background(),
+		conn,
+		pgx.TxOptions{
+			IsoLevel:   pgx.Serializable,
+			AccessMode: pgx.ReadOnly,
+		},
+		func(tx pgx.Tx) (err error) {
+			var level string
+			err = tx.
+				QueryRow(context.Background(), "show transaction_isolation").
+				Scan(&level)
+			if err != nil {
+				return
+			}
+			if level != "serializable" {
+				t.Fatalf("isolation level mismatch: %s", level)
+			}
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInTransactionValue(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	n, err := InTransactionValue(
+		context.Background(),
+		conn,
+		func(tx pgx.Tx) (n int, err error) {
+			err = tx.QueryRow(context.Background(), "select 7").Scan(&n)
+			return
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Fatalf("value mismatch: %d != 7", n)
+	}
+}
+
+func TestExecError(t *testing.T) {
+	t.Parallel()
+
+	pgErr := &pgconn.PgError{Message: "syntax error"}
+	err := newExecError(
+		2,
+		"select\n\t1 "+strings.Repeat("a", 100),
+		pgErr,
+	)
+	std := "pg_util: statement 2 `select 1 " + strings.Repeat("a", 55) +
+		"...`: : syntax error (SQLSTATE )"
+	if err.Error() != std {
+		t.Fatalf("message mismatch: `%s` != `%s`", err.Error(), std)
+	}
+	if !errors.Is(err, pgErr) {
+		t.Fatal("error not wrapped")
+	}
+	if msg := ExtractException(err); msg != "syntax error" {
+		t.Fatalf("exception mismatch: %s", msg)
+	}
+}
+
+func TestExecAll(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(context.Background(), conn, func(tx pgx.Tx) error {
+		return ExecAll(context.Background(), tx, "select 1", "selec 2")
+	})
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if execErr.Index != 1 || execErr.SQL != "selec 2" {
+		t.Fatalf("statement mismatch: %d `%s`", execErr.Index, execErr.SQL)
+	}
+}
+
+func TestExecAllContinue(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(context.Background(), conn, func(tx pgx.Tx) error {
+		res, err := ExecAllContinue(
+			context.Background(),
+			tx,
+			"selec 1",
+			"select 2",
+			"selec 3",
+		)
+		errs, ok := err.(ExecErrors)
+		if !ok {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(errs) != 2 || errs[0].Index != 0 || errs[1].Index != 2 {
+			t.Fatalf("error mismatch: %v", errs)
+		}
+		if len(res) != 3 || res[1].Err != nil || res[0].Err == nil {
+			t.Fatalf("result mismatch: %+v", res)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecAllBatch(t *testing.T) {
+	t.Parallel()
+
+	conn, err := pgx.Connect(context.Background(), getURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	err = InTransaction(context.Background(), conn, func(tx pgx.Tx) error {
+		return ExecAllBatch(
+			context.Background(),
+			tx,
+			"create temp table exec_all_batch (id int) on commit drop",
+			"insert into exec_all_batch values (1)",
+			"selec 3",
+		)
+	})
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if execErr.Index != 2 {
+		t.Fatalf("statement index mismatch: %d", execErr.Index)
+	}
+}
+
+// Transaction, that blocks on the statement "block" until the context is done
+type blockingTx struct {
+	fakeTx
+}
+
+func (tx blockingTx) Exec(ctx context.Context, sql string, args ...interface{}) (
+	pgconn.CommandTag,
+	error,
+) {
+	if sql == "block" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return tx.fakeTx.Exec(ctx, sql, args...)
+}
+
+func TestExecAllWith(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name  string
+		opts  ExecOpts
+		stmts []string
+		index int
+		err   error
+	}{
+		{
+			name:  "no timeouts",
+			stmts: []string{"a", "b"},
+		},
+		{
+			name: "statement timeout",
+			opts: ExecOpts{
+				StatementTimeout: time.Millisecond,
+			},
+			stmts: []string{"a", "block"},
+			index: 1,
+			err:   context.DeadlineExceeded,
+		},
+		{
+			name: "overall timeout",
+			opts: ExecOpts{
+				StatementTimeout: time.Hour,
+				Timeout:          time.Millisecond,
+			},
+			stmts: []string{"block", "a"},
+			err:   context.DeadlineExceeded,
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ExecAllWith(context.Background(), blockingTx{}, c.opts,
+				c.stmts...)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("error mismatch: %v != %v", err, c.err)
+			}
+			if c.err != nil {
+				var execErr *ExecError
+				if !errors.As(err, &execErr) || execErr.Index != c.index {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		in, out string
+	}{
+		{"users", `"users"`},
+		{"app.users", `"app"."users"`},
+		{`we"ird`, `"we""ird"`},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.in, func(t *testing.T) {
+			t.Parallel()
+
+			if s := quoteIdentifier(c.in); s != c.out {
+				t.Fatalf("quoting mismatch: `%s` != `%s`", s, c.out)
+			}
+		})
+	}
+}
+
+func TestQuotedColumnWithDot(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID int    `db:"a.b,pk"`
+		V  string `db:"v"`
+	}
+	sql, _, err := BuildUpsert(UpsertOpts{
+		InsertOpts: InsertOpts{Table: "t1", Data: row{1, "x"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const std = `INSERT INTO "t1" ("a.b","v") VALUES ($1,$2) ` +
+		`ON CONFLICT ("a.b") DO UPDATE SET "v"=EXCLUDED."v"`
+	if sql != std {
+		t.Fatalf("SQL mismatch: `%s` != `%s`", sql, std)
+	}
+}
@@ -0,0 +1,53 @@
+package pg_util
+
+import (
+	"strings"
+)
+
+// Build comma-separated list of n parenthesized tuples of m placeholders each,
+// numbered sequentially from $offset+1.
+// Example: BuildValues(2, 3, 1) == "($2,$3,$4),($5,$6,$7)"
+func BuildValues(n, m int, offset int) string {
+	if n <= 0 || m <= 0 {
+		return ""
+	}
+
+	var w strings.Builder
+	w.Grow(n * m * 4)
+	for i := 0; i < n; i++ {
+		if i != 0 {
+			w.WriteByte(',')
+		}
+		w.WriteByte('(')
+		writePlaceholders(&w, m, offset+i*m)
+		w.WriteByte(')')
+	}
+	return w.String()
+}
+
+// Extract arguments from all columns of data struct in the same order and with
+// the same conversion rules BuildInsert uses.
+// Columns with raw SQL expressions and generated columns are skipped.
+// BeforeInserter is run on a copy of data first.
+//
+// See InsertOpts.Data for further documentation.
+func ExtractArgs(data interface{}) (args []interface{}, err error) {
+	v, meta, err := getDataMeta(data)
+	if err != nil {
+		return
+	}
+	v, err = runBeforeInsert(&InsertOpts{}, v, meta)
+	if err != nil {
+		return
+	}
+	args = make([]interface{}, 0, len(meta.writable))
+	for _, c := range meta.writable {
+		if c.expr == "" {
+			args, err = c.appendValue(args, v)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,176 @@
+package pg_util
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildValues(t *testing.T) {
+	t.Parallel()
+
+	cases := [...]struct {
+		name         string
+		n, m, offset int
+		std          string
+	}{
+		{"single", 1, 1, 0, "($1)"},
+		{"rows", 2, 3, 0, "($1,$2,$3),($4,$5,$6)"},
+		{"offset", 2, 2, 8, "($9,$10),($11,$12)"},
+		{"empty", 0, 2, 0, ""},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			res := BuildValues(c.n, c.m, c.offset)
+			if res != c.std {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", res, c.std)
+			}
+		})
+	}
+}
+
+func TestExtractArgs(t *testing.T) {
+	t.Parallel()
+
+	args, err := ExtractArgs(struct {
+		F1 string
+		F2 int `db:",string"`
+		F3 int `db:",expr=now()"`
+	}{"aaa", 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []interface{}{"aaa", "1"}
+	if !reflect.DeepEqual(args, std) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, std)
+	}
+}
+
+func TestExtractArgsNullable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		one      = 1
+		nilInt   *int
+		validStr = sql.NullString{String: "a", Valid: true}
+	)
+	args, err := ExtractArgs(struct {
+		F1 sql.NullString  `db:",string"`
+		F2 sql.NullString  `db:",string"`
+		F3 sql.NullInt64   `db:",string"`
+		F4 *sql.NullString `db:",string"`
+		F5 *int            `db:",string"`
+		F6 *int            `db:",string"`
+	}{
+		F1: validStr,
+		F3: sql.NullInt64{Int64: 2, Valid: true},
+		F4: &validStr,
+		F5: nilInt,
+		F6: &one,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []interface{}{
+		"a",
+		(*string)(nil),
+		"2",
+		"a",
+		(*string)(nil),
+		"1",
+	}
+	if !reflect.DeepEqual(args, std) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, std)
+	}
+}
+
+func TestExtractArgsNullZero(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	type row struct {
+		F1 time.Time  `db:",nullzero"`
+		F2 int        `db:",nullzero"`
+		F3 string     `db:",nullzero,string"`
+		F4 *time.Time `db:",nullzero"`
+		F5 time.Time  `db:",nullzero"`
+		F6 int        `db:",nullzero"`
+	}
+
+	args, err := ExtractArgs(row{
+		F1: time.Time{}.In(time.UTC),
+		F5: now,
+		F6: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []interface{}{nil, nil, (*string)(nil), nil, now, 1}
+	if !reflect.DeepEqual(args, std) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, std)
+	}
+}
+
+func TestExtractArgsStringComposite(t *testing.T) {
+	t.Parallel()
+
+	args, err := ExtractArgs(struct {
+		F1 []string         `db:",string"`
+		F2 [][]int          `db:",string"`
+		F3 []*int           `db:",string"`
+		F4 [2]string        `db:",string"`
+		F5 map[string]int   `db:",string"`
+		F6 []string         `db:",string"`
+		F7 map[string]int   `db:",string"`
+		F8 []byte           `db:",string"`
+		F9 []sql.NullString `db:",string"`
+	}{
+		F1: []string{"a", `b"c`, `d\e`, "f,g"},
+		F2: [][]int{{1, 2}, {3, 4}},
+		F3: []*int{nil},
+		F4: [2]string{"x", "y"},
+		F5: map[string]int{"b": 2, "a": 1},
+		F8: []byte("bytes"),
+		F9: []sql.NullString{{String: "s", Valid: true}, {}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []interface{}{
+		`{"a","b\"c","d\\e","f,g"}`,
+		`{{"1","2"},{"3","4"}}`,
+		`{NULL}`,
+		`{"x","y"}`,
+		`{"a":1,"b":2}`,
+		(*string)(nil),
+		(*string)(nil),
+		"bytes",
+		`{"s",NULL}`,
+	}
+	if !reflect.DeepEqual(args, std) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, std)
+	}
+}
+
+func TestExtractArgsBeforeInsert(t *testing.T) {
+	t.Parallel()
+
+	args, err := ExtractArgs(beforeInsertRow{F1: "a", F2: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := []interface{}{"A", 1}
+	if !reflect.DeepEqual(args, std) {
+		t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, std)
+	}
+
+	_, err = ExtractArgs(beforeInsertRow{F2: -1})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
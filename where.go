@@ -0,0 +1,55 @@
+package pg_util
+
+import (
+	"strings"
+)
+
+// Build ANDed equality conditions for all non-zero fields of the cond struct.
+// Placeholders start from $offset+1. Returns an empty string, if all fields
+// are zero.
+//
+// Types with an IsZero() method, like time.Time, are checked using it.
+// See InsertOpts.Data for column mapping rules.
+//
+// Example: BuildWhere(struct{ ID int `db:"id"`; Name string }{ID: 1}, 0)
+// produces `"id"=$1`.
+func BuildWhere(cond interface{}, offset int) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	return buildWhere(cond, offset, false)
+}
+
+func buildWhere(cond interface{}, offset int, quoteAll bool) (
+	sql string,
+	args []interface{},
+	err error,
+) {
+	v, meta, err := getDataMeta(cond)
+	if err != nil {
+		return
+	}
+
+	var w strings.Builder
+	for i := range meta.columns {
+		c := &meta.columns[i]
+		f := v.FieldByIndex(c.index)
+		if isZero(f, f.Interface()) {
+			continue
+		}
+
+		if len(args) != 0 {
+			w.WriteString(" AND ")
+		}
+		c.writeName(&w, quoteAll)
+		w.WriteByte('=')
+		c.writePlaceholder(&w, offset+len(args))
+		args, err = c.appendValue(args, v)
+		if err != nil {
+			return
+		}
+	}
+	sql = w.String()
+	return
+}
@@ -0,0 +1,139 @@
+package pg_util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildWhere(t *testing.T) {
+	t.Parallel()
+
+	type cond struct {
+		ID      int `db:"id"`
+		Name    string
+		Created time.Time `db:"created"`
+		Tag     *string   `db:"tag"`
+	}
+	tag := "x"
+
+	cases := [...]struct {
+		name, sql string
+		cond      cond
+		offset    int
+		args      []interface{}
+	}{
+		{
+			name: "all zero",
+		},
+		{
+			name: "some fields",
+			cond: cond{ID: 1, Tag: &tag},
+			sql:  `"id"=$1 AND "tag"=$2`,
+			args: []interface{}{1, &tag},
+		},
+		{
+			name:   "with offset",
+			cond:   cond{Name: "aaa"},
+			offset: 3,
+			sql:    `Name=$4`,
+			args:   []interface{}{"aaa"},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, args, err := BuildWhere(c.cond, c.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", sql, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, c.args)
+			}
+		})
+	}
+}
+
+func TestCond(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		ID      int `db:"id,pk"`
+		Name    string
+		Version int `db:"version"`
+	}
+	type cond struct {
+		Version int `db:"version"`
+	}
+
+	cases := [...]struct {
+		name, sql string
+		build     func() (string, []interface{}, error)
+		args      []interface{}
+	}{
+		{
+			name: "update",
+			build: func() (string, []interface{}, error) {
+				return BuildUpdateByPK(ByPKOpts{
+					Table: "t10",
+					Data:  row{1, "aaa", 3},
+					Cond:  cond{2},
+				})
+			},
+			sql: `UPDATE "t10" SET Name=$1,"version"=$2 ` +
+				`WHERE "id"=$3 AND "version"=$4`,
+			args: []interface{}{"aaa", 3, 1, 2},
+		},
+		{
+			name: "delete",
+			build: func() (string, []interface{}, error) {
+				return BuildDeleteByPK(ByPKOpts{
+					Table: "t10",
+					Data:  row{ID: 1},
+					Cond:  cond{2},
+				})
+			},
+			sql:  `DELETE FROM "t10" WHERE "id"=$1 AND "version"=$2`,
+			args: []interface{}{1, 2},
+		},
+		{
+			name: "select",
+			build: func() (string, []interface{}, error) {
+				return BuildSelect(SelectOpts{
+					Table:   "t10",
+					Columns: row{},
+					Where:   "Name <> $1",
+					Args:    []interface{}{"bbb"},
+					Cond:    cond{2},
+				})
+			},
+			sql: `SELECT "id",Name,"version" FROM "t10" ` +
+				`WHERE (Name <> $1) AND "version"=$2`,
+			args: []interface{}{"bbb", 2},
+		},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			q, args, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q != c.sql {
+				t.Fatalf("SQL mismatch: `%s` != `%s`", q, c.sql)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Fatalf("argument list mismatch: `%+v` != `%+v`", args, c.args)
+			}
+		})
+	}
+}